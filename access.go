@@ -0,0 +1,90 @@
+package main
+
+import (
+	"container/heap"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Default and maximum number of hashes listed by `/admin/top-accessed` endpoint.
+const (
+	DefaultTopAccessed = 10
+	MaxTopAccessed     = 1000
+)
+
+// TopAccessedEntry defines the structure of the entries listed by '/admin/top-accessed' endpoint.
+type TopAccessedEntry struct {
+	ID           int       `json:"id"`
+	AccessCount  int       `json:"accessCount"`
+	Algorithm    string    `json:"algorithm"`
+	LastAccessed time.Time `json:"lastAccessed"`
+}
+
+// accessHeap is a min-heap of entries, the least accessed first, ties being broken by the greatest id.
+type accessHeap []TopAccessedEntry
+
+func (h accessHeap) Len() int { return len(h) }
+func (h accessHeap) Less(i, j int) bool {
+	if h[i].AccessCount != h[j].AccessCount {
+		return h[i].AccessCount < h[j].AccessCount
+	}
+	return h[i].ID > h[j].ID
+}
+func (h accessHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *accessHeap) Push(x any)   { *h = append(*h, x.(TopAccessedEntry)) }
+func (h *accessHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// topAccessed returns the n most accessed hashes of the store, the most accessed first, the smallest id first
+// among those accessed as many times. The tombstones are left out.
+func topAccessed(store map[int]*HashRecord, n int) []TopAccessedEntry {
+	h := make(accessHeap, 0, n)
+	for id, rec := range store {
+		if rec.Deleted {
+			continue
+		}
+		e := TopAccessedEntry{ID: id, AccessCount: rec.AccessCount, Algorithm: rec.Algorithm, LastAccessed: rec.LastAccessed}
+		if h.Len() < n {
+			heap.Push(&h, e)
+		} else if (accessHeap{h[0], e}).Less(0, 1) {
+			// The least accessed of the heap is replaced, as e is accessed more.
+			h[0] = e
+			heap.Fix(&h, 0)
+		}
+	}
+	sort.Sort(sort.Reverse(h))
+	return h
+}
+
+// topAccessedHandler handles the admin only GET requests to `/admin/top-accessed?n=10` endpoint.
+func (s *Server) topAccessedHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	n := DefaultTopAccessed
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil || n < 1 || n > MaxTopAccessed {
+			http.Error(w, fmt.Sprintf("The `n` must be between 1 and %d!", MaxTopAccessed), http.StatusBadRequest)
+			return
+		}
+	}
+	res := s.send(r.Context(), Command{requestType: TopAccessedCommand, filter: &SearchFilter{Limit: n}})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"slices"
+	"sync"
+)
+
+// MaxReloadAllowlistBodySize limits the size of `/admin/reload-allowlist` request bodies.
+const MaxReloadAllowlistBodySize = 1 << 16
+
+// ACL holds the CIDRs the clients are allowed or denied access from. A client is denied if its address is in a
+// denied CIDR, or if there are allowed CIDRs and its address is in none of them. A nil ACL allows all the clients.
+// Safe for concurrent use.
+type ACL struct {
+	mu          sync.RWMutex
+	allow, deny []netip.Prefix
+}
+
+// NewACL creates the ACL of the allowed and denied CIDRs.
+func NewACL(allow, deny []netip.Prefix) *ACL {
+	return &ACL{allow: allow, deny: deny}
+}
+
+// Allows reports whether the client of the address is allowed access.
+func (a *ACL) Allows(addr netip.Addr) bool {
+	if a == nil {
+		return true
+	}
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	contains := func(p netip.Prefix) bool { return p.Contains(addr) }
+	if slices.ContainsFunc(a.deny, contains) {
+		return false
+	}
+	return len(a.allow) == 0 || slices.ContainsFunc(a.allow, contains)
+}
+
+// Replace replaces the allowed and denied CIDRs at once, and returns the previous ones.
+func (a *ACL) Replace(allow, deny []netip.Prefix) (oldAllow, oldDeny []netip.Prefix) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	oldAllow, oldDeny = a.allow, a.deny
+	a.allow, a.deny = allow, deny
+	return oldAllow, oldDeny
+}
+
+// parseCIDR parses a CIDR, e.g. `10.0.0.0/8`, masking its host bits.
+func parseCIDR(cidr string) (netip.Prefix, error) {
+	p, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return p.Masked(), nil
+}
+
+// checkACL writes a 403 response and returns false if the client of the request is denied access by the ACL.
+func (s *Server) checkACL(w http.ResponseWriter, r *http.Request) bool {
+	// A remote address which cannot be parsed is the invalid address, only allowed when no CIDR is.
+	addrPort, _ := netip.ParseAddrPort(r.RemoteAddr)
+	if s.acl.Allows(addrPort.Addr().Unmap()) {
+		return true
+	}
+	http.Error(w, "Access denied!", http.StatusForbidden)
+	log.Println("Rejecting the request as its client is denied access: ", r.RemoteAddr)
+	return false
+}
+
+// ReloadAllowlistRequest defines request structure for '/admin/reload-allowlist' endpoint.
+type ReloadAllowlistRequest struct {
+	Allow []string `json:"allow"`
+	Deny  []string `json:"deny"`
+}
+
+// CIDRDiff lists the CIDRs added to and removed from a list.
+type CIDRDiff struct {
+	Added   []string `json:"added"`
+	Removed []string `json:"removed"`
+}
+
+// ReloadAllowlistResponse defines response structure for '/admin/reload-allowlist' endpoint.
+type ReloadAllowlistResponse struct {
+	Allow CIDRDiff `json:"allow"`
+	Deny  CIDRDiff `json:"deny"`
+}
+
+// diffCIDRs returns the CIDRs of next not in prev as added, and those of prev not in next as removed.
+func diffCIDRs(prev, next []netip.Prefix) CIDRDiff {
+	diff := CIDRDiff{Added: []string{}, Removed: []string{}}
+	for _, p := range next {
+		if !slices.Contains(prev, p) {
+			diff.Added = append(diff.Added, p.String())
+		}
+	}
+	for _, p := range prev {
+		if !slices.Contains(next, p) {
+			diff.Removed = append(diff.Removed, p.String())
+		}
+	}
+	return diff
+}
+
+// reloadAllowlistHandler handles the admin only POST requests to `/admin/reload-allowlist` endpoint.
+// The allowed and denied CIDRs are replaced at once by those given, an omitted list being emptied.
+func (s *Server) reloadAllowlistHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	req := &ReloadAllowlistRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxReloadAllowlistBodySize)).Decode(req); err != nil {
+		http.Error(w, "Invalid JSON request!", http.StatusBadRequest)
+		log.Println("Rejecting the request as the JSON body is invalid: ", err)
+		return
+	}
+	var lists [2][]netip.Prefix
+	for i, cidrs := range [][]string{req.Allow, req.Deny} {
+		for _, cidr := range cidrs {
+			p, err := parseCIDR(cidr)
+			if err != nil {
+				http.Error(w, fmt.Sprintf("Invalid CIDR '%s'!", cidr), http.StatusBadRequest)
+				return
+			}
+			if !slices.Contains(lists[i], p) {
+				lists[i] = append(lists[i], p)
+			}
+		}
+	}
+	oldAllow, oldDeny := s.acl.Replace(lists[0], lists[1])
+	log.Printf("Replacing the allowed CIDRs %v and the denied CIDRs %v", oldAllow, oldDeny)
+	s.audit.Record("reload-allowlist", r, req)
+	writeJSON(w, &ReloadAllowlistResponse{Allow: diffCIDRs(oldAllow, lists[0]), Deny: diffCIDRs(oldDeny, lists[1])})
+}
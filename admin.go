@@ -0,0 +1,24 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// requireAdmin reports whether the request carries the admin bearer token.
+// If not, it writes an error response and the caller must not handle the request any further.
+func (s *Server) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	if s.cfg.AdminToken == "" {
+		http.Error(w, "Admin endpoints are disabled!", http.StatusForbidden)
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.cfg.AdminToken)) != 1 {
+		http.Error(w, "Admin authentication required!", http.StatusUnauthorized)
+		log.Println("Rejecting the admin request as it is not authenticated.")
+		return false
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultAdminPort is the port the admin server listens on, on the loopback interface only.
+const DefaultAdminPort = 9000
+
+// AdminHost is the address the admin server binds to, so that the admin endpoints are never exposed on the network.
+const AdminHost = "127.0.0.1"
+
+// adminPathPrefixes are the prefixes of the unversioned paths only served by the admin server.
+var adminPathPrefixes = []string{"/admin/", "/debug/", "/metrics"}
+
+// isAdminPath reports whether the path, versioned or not, is only served by the admin server.
+func isAdminPath(path string) bool {
+	path = strings.TrimPrefix(path, APIPrefix)
+	for _, prefix := range adminPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// servesPath reports whether the admin server if admin, or the public server otherwise, serves the path.
+// The admin server serves the admin paths, and the public server all the others. Every path is served by the public
+// server when the admin server is disabled.
+func (s *Server) servesPath(path string, admin bool) bool {
+	if s.cfg.AdminPort == 0 {
+		return true
+	}
+	if admin {
+		return isAdminPath(path)
+	}
+	return !isAdminPath(path)
+}
+
+// matchAdminHandlers matches the endpoints served by the admin server to their handlers, like matchHandlers.
+func (s *Server) matchAdminHandlers(w http.ResponseWriter, r *http.Request) {
+	s.serveRoutes(w, r, true)
+}
+
+// newAdminServer creates the admin server of `--admin-port`, listening on AdminHost only.
+func newAdminServer(s *Server) *http.Server {
+	addr := net.JoinHostPort(AdminHost, strconv.Itoa(s.cfg.AdminPort))
+	return &http.Server{Addr: addr, Handler: http.HandlerFunc(s.matchAdminHandlers), WriteTimeout: s.cfg.WriteTimeout}
+}
+
+// startAdminServer starts serving the admin endpoints on `--admin-port`, exiting if the port cannot be listened on.
+func startAdminServer(s *Server) {
+	s.adminServer = newAdminServer(s)
+	listener, err := net.Listen("tcp", s.adminServer.Addr)
+	if err != nil {
+		log.Fatal("Cannot listen on the admin port: ", err)
+	}
+	go func() {
+		if err := s.adminServer.Serve(listener); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+	log.Println("Serving the admin endpoints on ", s.adminServer.Addr)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	b64 "encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+)
+
+// HashFunc computes the hashed-encoded value stored for a password.
+type HashFunc func(password string) (string, error)
+
+// hashAlgorithms holds the supported hashing algorithms by name.
+var hashAlgorithms = map[string]HashFunc{
+	"sha512":   hashSHA512,
+	"sha256":   hashSHA256,
+	"argon2id": hashArgon2id,
+	"bcrypt":   hashBcrypt,
+}
+
+// IdentityAlgorithm stores the passwords as given, without hashing them nor waiting for the preprocessing delay.
+// It is INSECURE, only meant to measure the overhead of the server, and only available with
+// `--allow-insecure-algorithms`.
+const IdentityAlgorithm = "identity"
+
+// hashEncodings holds the encoding of the values computed by each of the hashAlgorithms.
+var hashEncodings = map[string]string{
+	"sha512":   "base64",
+	"sha256":   "base64",
+	"argon2id": "phc",
+	"bcrypt":   "mcf",
+}
+
+// streamHashes holds the hash functions of the hashAlgorithms able to hash a password read from a stream.
+var streamHashes = map[string]func() hash.Hash{
+	"sha512": sha512.New,
+	"sha256": sha256.New,
+}
+
+// hashVerifiers holds the functions checking a password against a hash, for the algorithms using a random salt.
+// The hashes of the other algorithms are verified by computing them again.
+var hashVerifiers = map[string]func(password, hash string) bool{
+	"argon2id": verifyArgon2id,
+	"bcrypt":   verifyBcrypt,
+}
+
+// DigestEncoding converts the digests computed by the base64 hashAlgorithms to and from text.
+type DigestEncoding struct {
+	Encode func([]byte) string
+	Decode func(string) ([]byte, error)
+}
+
+// digestEncodings holds the encodings that can be requested for the base64 hashAlgorithms, by name.
+var digestEncodings = map[string]DigestEncoding{
+	"base64":      {b64.StdEncoding.EncodeToString, b64.StdEncoding.DecodeString},
+	"base64nopad": {b64.RawStdEncoding.EncodeToString, b64.RawStdEncoding.DecodeString},
+	"base64url":   {b64.URLEncoding.EncodeToString, b64.URLEncoding.DecodeString},
+	"hex":         {hex.EncodeToString, hex.DecodeString},
+}
+
+// resolveEncoding returns the encoding of the hashes computed by the algorithm, being the requested one
+// or, when empty, the default one of the algorithm.
+func resolveEncoding(algorithm, encoding string) (string, error) {
+	if encoding == "" || encoding == hashEncodings[algorithm] {
+		return hashEncodings[algorithm], nil
+	}
+	if _, ok := digestEncodings[encoding]; !ok || hashEncodings[algorithm] != "base64" {
+		return "", fmt.Errorf("unsupported encoding %q for algorithm %q", encoding, algorithm)
+	}
+	return encoding, nil
+}
+
+// computeHash hashes the password with the algorithm, the hash being encoded with an encoding given by resolveEncoding.
+func computeHash(password, algorithm, encoding string) (string, error) {
+	hash, err := hashAlgorithms[algorithm](password)
+	if err != nil || encoding == hashEncodings[algorithm] {
+		return hash, err
+	}
+	digest, err := b64.StdEncoding.DecodeString(hash)
+	if err != nil {
+		return "", err
+	}
+	return digestEncodings[encoding].Encode(digest), nil
+}
+
+// computeStreamHash is computeHash for a password read from r, the algorithm being one of the streamHashes.
+// The password is hashed as it is read, being keyed with the pepper, if any, as by Pepper.Apply, whose version is
+// returned with the hash.
+func computeStreamHash(r io.Reader, algorithm, encoding string, pepper *Pepper) (string, int, error) {
+	mac, version := pepper.NewMAC()
+	if mac != nil {
+		if _, err := io.Copy(mac, r); err != nil {
+			return "", 0, err
+		}
+		hash, err := computeHash(b64.StdEncoding.EncodeToString(mac.Sum(nil)), algorithm, encoding)
+		return hash, version, err
+	}
+	h := streamHashes[algorithm]()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", 0, err
+	}
+	return digestEncodings[encoding].Encode(h.Sum(nil)), version, nil
+}
+
+// verifyHash reports whether hash, computed with the algorithm and encoding, is the one of the password.
+func verifyHash(password, algorithm, encoding, hash string) bool {
+	if verify, ok := hashVerifiers[algorithm]; ok {
+		return verify(password, hash)
+	}
+	computed, err := computeHash(password, algorithm, encoding)
+	return err == nil && subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) == 1
+}
+
+// enableInsecureAlgorithms registers the IdentityAlgorithm. It must be called before serving requests.
+func enableInsecureAlgorithms() {
+	hashAlgorithms[IdentityAlgorithm] = hashIdentity
+	hashEncodings[IdentityAlgorithm] = "plain"
+}
+
+// hashIdentity returns the password itself.
+func hashIdentity(password string) (string, error) {
+	return password, nil
+}
+
+// hashSHA512 performs Sha512 and base64 encode.
+func hashSHA512(password string) (string, error) {
+	s512 := sha512.Sum512([]byte(password))
+	return b64.StdEncoding.EncodeToString(s512[:]), nil
+}
+
+// hashSHA256 performs Sha256 and base64 encode.
+func hashSHA256(password string) (string, error) {
+	s256 := sha256.Sum256([]byte(password))
+	return b64.StdEncoding.EncodeToString(s256[:]), nil
+}
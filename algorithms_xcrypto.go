@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	b64 "encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Argon2id parameters, following the recommendations of RFC 9106.
+const (
+	Argon2Time    = 3
+	Argon2Memory  = 64 * 1024
+	Argon2Threads = 4
+	Argon2KeyLen  = 32
+	Argon2SaltLen = 16
+)
+
+// BcryptCost is the cost factor of bcrypt hashes.
+const BcryptCost = 12
+
+// argon2idHash holds the fields of an argon2id PHC string.
+type argon2idHash struct {
+	version      int
+	memory, time uint32
+	threads      uint8
+	salt, key    []byte
+}
+
+// parseArgon2id parses the argon2id PHC string computed by hashArgon2id.
+func parseArgon2id(hash string) (*argon2idHash, error) {
+	fields := strings.Split(hash, "$")
+	if len(fields) != 6 || fields[1] != "argon2id" {
+		return nil, errors.New("not an argon2id PHC string")
+	}
+	h := &argon2idHash{}
+	if _, err := fmt.Sscanf(fields[2]+" "+fields[3], "v=%d m=%d,t=%d,p=%d", &h.version, &h.memory, &h.time, &h.threads); err != nil {
+		return nil, err
+	}
+	var err error
+	if h.salt, err = b64.RawStdEncoding.DecodeString(fields[4]); err != nil {
+		return nil, err
+	}
+	if h.key, err = b64.RawStdEncoding.DecodeString(fields[5]); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// hashArgon2id hashes the password with a random salt, encoded in the PHC string format.
+func hashArgon2id(password string) (string, error) {
+	salt := make([]byte, Argon2SaltLen)
+	rand.Read(salt)
+	key := argon2.IDKey([]byte(password), salt, Argon2Time, Argon2Memory, Argon2Threads, Argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, Argon2Memory, Argon2Time, Argon2Threads,
+		b64.RawStdEncoding.EncodeToString(salt), b64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// hashBcrypt hashes the password, the salt and cost being embedded in the result.
+func hashBcrypt(password string) (string, error) {
+	h, err := bcrypt.GenerateFromPassword([]byte(password), BcryptCost)
+	return string(h), err
+}
+
+// verifyArgon2id hashes the password again with the salt and parameters of the PHC string, and compares the keys.
+func verifyArgon2id(password, hash string) bool {
+	h, err := parseArgon2id(hash)
+	if err != nil || h.version != argon2.Version {
+		return false
+	}
+	computed := argon2.IDKey([]byte(password), h.salt, h.time, h.memory, h.threads, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(computed, h.key) == 1
+}
+
+// argon2idParameters reads the version, costs and salt of the argon2id PHC string.
+func argon2idParameters(hash string, params *AlgorithmParameters) error {
+	h, err := parseArgon2id(hash)
+	if err != nil {
+		return err
+	}
+	params.Version = h.version
+	params.MemoryCost = h.memory
+	params.TimeCost = h.time
+	params.Parallelism = h.threads
+	params.Salt = hex.EncodeToString(h.salt)
+	params.KeyLen = len(h.key)
+	return nil
+}
+
+// bcryptParameters reads the cost of the bcrypt hash, whose salt is only meaningful within the hash itself.
+func bcryptParameters(hash string, params *AlgorithmParameters) error {
+	cost, err := bcrypt.Cost([]byte(hash))
+	params.Cost = cost
+	return err
+}
+
+// verifyBcrypt checks the password against the bcrypt hash.
+func verifyBcrypt(password, hash string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Maximum sizes in bytes of the annotation keys and values, and of `/hash/{id}/annotate` request bodies.
+const (
+	MaxAnnotationKeySize   = 64
+	MaxAnnotationValueSize = 256
+	MaxAnnotateBodySize    = 1 << 12
+)
+
+// AnnotateRequest defines request structure for '/hash/{id}/annotate' endpoint.
+type AnnotateRequest struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// AnnotationsResponse defines response structure for '/hash/{id}/annotate' and '/hash/{id}/annotations' endpoints.
+type AnnotationsResponse struct {
+	ID          int               `json:"id"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// annotateHandler handles the POST requests to `/hash/{id}/annotate` endpoint, setting the value of an annotation
+// of the hash, e.g. `{"key":"userId","value":"12345"}`.
+func (s *Server) annotateHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	req := &AnnotateRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxAnnotateBodySize)).Decode(req); err != nil {
+		http.Error(w, "Invalid JSON request!", http.StatusBadRequest)
+		log.Println("Rejecting the request as the JSON body is invalid: ", err)
+		return
+	}
+	if req.Key == "" || len(req.Key) > MaxAnnotationKeySize || len(req.Value) > MaxAnnotationValueSize {
+		http.Error(w, fmt.Sprintf("The annotation `key` must be given, of at most %d bytes, and its `value` of at most %d bytes!", MaxAnnotationKeySize, MaxAnnotationValueSize), http.StatusBadRequest)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: AnnotateHashCommand, id: hashId, annotation: [2]string{req.Key, req.Value}})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	s.audit.Record("annotate", r, map[string]any{"id": hashId, "key": req.Key, "value": req.Value})
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// annotationsHandler handles the GET requests to `/hash/{id}/annotations` endpoint.
+func (s *Server) annotationsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetAnnotationsCommand, id: hashId})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// annotationsOf returns the annotations response of the record, with an empty map if it has none.
+func annotationsOf(id int, rec *HashRecord) Result {
+	annotations := rec.Annotations
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	value, err := safeMarshal(&AnnotationsResponse{ID: id, Annotations: annotations})
+	return Result{value: value, err: err}
+}
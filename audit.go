@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditEntry is a line of the audit log.
+type AuditEntry struct {
+	Time       time.Time `json:"time"`
+	Action     string    `json:"action"`
+	RemoteAddr string    `json:"remoteAddr"`
+	Details    any       `json:"details,omitempty"`
+}
+
+// AuditLog appends an AuditEntry per admin operation to a file, as newline-delimited JSON.
+// A nil *AuditLog discards all entries.
+type AuditLog struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog opens the audit log file for appending, or returns nil if path is empty.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	if path == "" {
+		return nil, nil
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{file: f}, nil
+}
+
+// Record appends an entry for the action performed by the request.
+func (a *AuditLog) Record(action string, r *http.Request, details any) {
+	if a == nil {
+		return
+	}
+	line, err := json.Marshal(&AuditEntry{Time: time.Now(), Action: action, RemoteAddr: r.RemoteAddr, Details: details})
+	if err != nil {
+		log.Println("Cannot encode audit entry: ", err)
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		log.Println("Cannot write audit entry: ", err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// PrintBanner writes the summary of the configuration the server starts with to w, so that operators can check at
+// a glance that the expected settings were loaded. No secret is written.
+func PrintBanner(cfg *Config, w io.Writer) {
+	tls := "disabled"
+	if cfg.TLSCertFile != "" {
+		tls = "enabled (" + cfg.TLSCertFile + ")"
+		if cfg.TLSClientCAFile != "" {
+			tls = "mutual (" + cfg.TLSCertFile + ", clients of " + cfg.TLSClientCAFile + ")"
+		}
+	}
+	admin := "same as the public port"
+	if cfg.AdminPort > 0 {
+		admin = AdminHost + ":" + strconv.Itoa(cfg.AdminPort)
+	}
+	var limits []string
+	for _, algorithm := range slices.Sorted(maps.Keys(cfg.AlgorithmRateLimits)) {
+		if rps := cfg.AlgorithmRateLimits[algorithm]; rps > 0 {
+			limits = append(limits, algorithm+"="+strconv.FormatFloat(rps, 'g', -1, 64)+"/s")
+		}
+	}
+	if len(limits) == 0 {
+		limits = []string{"none"}
+	}
+	storage := "in-memory, snapshots in " + cfg.SnapshotDir
+	if cfg.WALFile != "" {
+		storage += ", write-ahead log " + cfg.WALFile
+	}
+	audit := cfg.AuditLogFile
+	if audit == "" {
+		audit = "disabled"
+	}
+
+	fmt.Fprintln(w, "Password hashing server")
+	fmt.Fprintf(w, "  Port:            %s\n", strings.TrimPrefix(DefaultPort, ":"))
+	fmt.Fprintf(w, "  Admin port:      %s\n", admin)
+	fmt.Fprintf(w, "  TLS:             %s\n", tls)
+	fmt.Fprintf(w, "  API version:     %s\n", cfg.APIVersion)
+	fmt.Fprintf(w, "  Algorithms:      %s (default %s)\n", strings.Join(slices.Sorted(maps.Keys(hashAlgorithms)), ", "), DefaultAlgorithm)
+	fmt.Fprintf(w, "  Rate limits:     %s\n", strings.Join(limits, ", "))
+	fmt.Fprintf(w, "  Storage:         %s\n", storage)
+	fmt.Fprintf(w, "  Audit log:       %s\n", audit)
+	fmt.Fprintf(w, "  Hash delay:      %s\n", cfg.HashPreprocessingDelay)
+}
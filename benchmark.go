@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BenchmarkResult holds the measures of a benchmark phase.
+type BenchmarkResult struct {
+	Name      string
+	Requests  int
+	Errors    int
+	Elapsed   time.Duration
+	Latencies []time.Duration
+}
+
+// Throughput returns the number of requests per second.
+func (b *BenchmarkResult) Throughput() float64 {
+	return float64(b.Requests) / b.Elapsed.Seconds()
+}
+
+// Percentile returns the latency below which p percent of the requests completed.
+func (b *BenchmarkResult) Percentile(p int) time.Duration {
+	if len(b.Latencies) == 0 {
+		return 0
+	}
+	return b.Latencies[(len(b.Latencies)-1)*p/100]
+}
+
+// String formats the result as a line of the benchmark report.
+func (b *BenchmarkResult) String() string {
+	return fmt.Sprintf("%-8s %6d requests  %10.1f req/s  p50 %-10v p95 %-10v p99 %-10v errors %.2f%%",
+		b.Name, b.Requests, b.Throughput(), b.Percentile(50), b.Percentile(95), b.Percentile(99), 100*float64(b.Errors)/float64(b.Requests))
+}
+
+// runBenchmark starts a server with an empty store in-process, and measures the `/hash` and `/hash/{id}` endpoints.
+// Each of the workers makes the given number of requests per phase. An error is returned if the throughput of a
+// phase is below cfg.BenchmarkMinRPS.
+func runBenchmark(cfg *Config) error {
+	// The benchmark clients do not send request timestamps.
+	serverCfg := *cfg
+	serverCfg.RequireTimestamp = false
+	server := NewServer(&serverCfg, StoreOptions{}, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	go http.Serve(listener, http.HandlerFunc(server.matchHandlers))
+	base := "http://" + listener.Addr().String() + APIPrefix
+	client := &http.Client{Transport: &http.Transport{MaxIdleConnsPerHost: cfg.BenchmarkWorkers}}
+
+	// Each request of the setHash phase writes the returned id at its own index.
+	ids := make([]string, cfg.BenchmarkWorkers*cfg.BenchmarkRequests)
+	set := benchmarkPhase("setHash", cfg, func(worker, i int) error {
+		resp, err := client.PostForm(base+"/hash", url.Values{"password": {fmt.Sprintf("benchmark-%d-%d", worker, i)}, "algorithm": {cfg.BenchmarkAlgorithm}})
+		if err != nil {
+			return err
+		}
+		body, err := readBenchmarkResponse(resp)
+		if err != nil {
+			return err
+		}
+		ids[worker*cfg.BenchmarkRequests+i] = strings.TrimSpace(body)
+		return nil
+	})
+	// Wait for the hashes to be stored before reading them.
+	if cfg.BenchmarkAlgorithm == IdentityAlgorithm {
+		time.Sleep(time.Second)
+	} else {
+		time.Sleep(cfg.HashPreprocessingDelay + time.Second)
+	}
+	get := benchmarkPhase("getHash", cfg, func(worker, i int) error {
+		id := ids[worker*cfg.BenchmarkRequests+i]
+		if id == "" {
+			return fmt.Errorf("no hash id for request %d of worker %d", i, worker)
+		}
+		resp, err := client.Get(base + "/hash/" + id)
+		if err != nil {
+			return err
+		}
+		_, err = readBenchmarkResponse(resp)
+		return err
+	})
+
+	fmt.Printf("%d workers, %d requests each\n", cfg.BenchmarkWorkers, cfg.BenchmarkRequests)
+	for _, res := range []*BenchmarkResult{set, get} {
+		fmt.Println(res)
+	}
+	for _, res := range []*BenchmarkResult{set, get} {
+		if res.Throughput() < cfg.BenchmarkMinRPS {
+			return fmt.Errorf("%s throughput %.1f req/s is below %.1f req/s", res.Name, res.Throughput(), cfg.BenchmarkMinRPS)
+		}
+	}
+	return nil
+}
+
+// benchmarkPhase runs the request function concurrently in cfg.BenchmarkWorkers goroutines, cfg.BenchmarkRequests
+// times each, and measures its latency.
+func benchmarkPhase(name string, cfg *Config, request func(worker, i int) error) *BenchmarkResult {
+	res := &BenchmarkResult{Name: name, Requests: cfg.BenchmarkWorkers * cfg.BenchmarkRequests}
+	latencies := make([][]time.Duration, cfg.BenchmarkWorkers)
+	failures := make([]int, cfg.BenchmarkWorkers)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for worker := 0; worker < cfg.BenchmarkWorkers; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < cfg.BenchmarkRequests; i++ {
+				t := time.Now()
+				if err := request(worker, i); err != nil {
+					failures[worker]++
+				}
+				latencies[worker] = append(latencies[worker], time.Since(t))
+			}
+		}()
+	}
+	wg.Wait()
+	res.Elapsed = time.Since(start)
+	for worker := range latencies {
+		res.Latencies = append(res.Latencies, latencies[worker]...)
+		res.Errors += failures[worker]
+	}
+	sort.Slice(res.Latencies, func(i, j int) bool { return res.Latencies[i] < res.Latencies[j] })
+	return res
+}
+
+// readBenchmarkResponse reads the response body, and returns an error if the request failed.
+// Some errors are reported with a 200 status, so the body of the successful responses is checked as well.
+func readBenchmarkResponse(resp *http.Response) (string, error) {
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("status %d: %s", resp.StatusCode, body)
+	}
+	if strings.HasPrefix(string(body), "Invalid") || strings.HasPrefix(string(body), "Cannot") {
+		return "", fmt.Errorf("%s", strings.TrimSpace(string(body)))
+	}
+	return string(body), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxBulkBodySize limits the size of bulk request bodies.
+const MaxBulkBodySize = 1 << 20
+
+// BulkGetResponse defines response structure for GET '/hashes/bulk' endpoint.
+type BulkGetResponse struct {
+	// Hashes holds the stored hashes by id.
+	Hashes map[int]string `json:"hashes"`
+	// Missing lists the ids for which no hash exists.
+	Missing []int `json:"missing"`
+	// Deleted lists the ids whose hash has been deleted.
+	Deleted []int `json:"deleted"`
+}
+
+// BulkDeleteRequest defines request structure for DELETE '/hashes/bulk' endpoint.
+// Either IDs, or Namespace and OlderThan must be set.
+type BulkDeleteRequest struct {
+	IDs       []int      `json:"ids"`
+	Namespace string     `json:"namespace"`
+	OlderThan *time.Time `json:"olderThan"`
+}
+
+// BulkDeleteResponse defines response structure for DELETE '/hashes/bulk' endpoint.
+type BulkDeleteResponse struct {
+	Deleted  int `json:"deleted"`
+	NotFound int `json:"notFound"`
+}
+
+// bulkGetHandler handles the GET requests to `/hashes/bulk` endpoint, retrieving the hashes of the `ids` list.
+func (s *Server) bulkGetHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	ids, err := parseIDList(r.URL.Query().Get("ids"))
+	if err != nil || len(ids) == 0 {
+		http.Error(w, "Invalid hash ids!", http.StatusBadRequest)
+		return
+	}
+	if len(ids) > s.cfg.MaxBulkSize {
+		http.Error(w, fmt.Sprintf("At most %d ids can be requested at once!", s.cfg.MaxBulkSize), http.StatusBadRequest)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: BulkGetHashCommand, ids: ids})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// bulkDeleteHandler handles the admin only DELETE requests to `/hashes/bulk` endpoint.
+// All the hashes are soft-deleted at once by the store goroutine.
+func (s *Server) bulkDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	req := &BulkDeleteRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxBulkBodySize)).Decode(req); err != nil {
+		http.Error(w, "Invalid bulk delete request!", http.StatusBadRequest)
+		return
+	}
+	c := Command{requestType: BulkDeleteCommand}
+	switch {
+	case len(req.IDs) > 0 && req.Namespace == "" && req.OlderThan == nil:
+		if len(req.IDs) > s.cfg.MaxBulkSize {
+			http.Error(w, fmt.Sprintf("At most %d ids can be deleted at once!", s.cfg.MaxBulkSize), http.StatusBadRequest)
+			return
+		}
+		c.ids = req.IDs
+	case len(req.IDs) == 0 && req.Namespace != "" && req.OlderThan != nil:
+		c.namespace = req.Namespace
+		c.before = *req.OlderThan
+	default:
+		http.Error(w, "Either `ids` or `namespace` and `olderThan` must be given!", http.StatusBadRequest)
+		return
+	}
+	res := s.send(r.Context(), c)
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Println("Bulk delete done: ", res.value)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// parseIDList parses a comma separated list of hash ids, ignoring duplicates.
+func parseIDList(list string) ([]int, error) {
+	var ids []int
+	seen := make(map[int]bool)
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"maps"
+	"sync/atomic"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// Default number of ids whose hashes are cached for `/hash/{id}` endpoint, and how long they are.
+const (
+	DefaultGetCacheSize = 1000
+	DefaultGetCacheTTL  = time.Minute
+)
+
+// HashCache caches the hashes returned by `/hash/{id}` endpoint, by id and version, for a TTL since the last hash of
+// the id was cached. The least recently used ids are evicted beyond its size. A nil HashCache caches nothing.
+// Safe for concurrent use.
+type HashCache struct {
+	// lru holds the hashes of each id, by version. The maps are replaced, never modified, once cached.
+	lru          *expirable.LRU[int, map[int]CachedHash]
+	hits, misses atomic.Int64
+}
+
+// CachedHash is a cached hash, along with its algorithm, so that the retrievals of the hashes computed with a
+// deprecated algorithm are still warned about.
+type CachedHash struct {
+	Hash      string
+	Algorithm string
+}
+
+// NewHashCache creates a HashCache of the hashes of up to size ids, or returns nil if size or ttl is not positive.
+func NewHashCache(size int, ttl time.Duration) *HashCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &HashCache{lru: expirable.NewLRU[int, map[int]CachedHash](size, nil, ttl)}
+}
+
+// Get returns the cached hash of the version of the id, the latest one being version 0, and counts the hit or miss.
+func (c *HashCache) Get(id, version int) (CachedHash, bool) {
+	if c == nil {
+		return CachedHash{}, false
+	}
+	if hashes, ok := c.lru.Get(id); ok {
+		if hash, ok := hashes[version]; ok {
+			c.hits.Add(1)
+			return hash, true
+		}
+	}
+	c.misses.Add(1)
+	return CachedHash{}, false
+}
+
+// Add caches the hash of the version of the id, evicting the least recently used id if the cache is full.
+// The hashes are only added by the store goroutine, so that those of an id are not added concurrently.
+func (c *HashCache) Add(id, version int, hash CachedHash) {
+	if c == nil {
+		return
+	}
+	hashes, _ := c.lru.Peek(id)
+	hashes = maps.Clone(hashes)
+	if hashes == nil {
+		hashes = make(map[int]CachedHash)
+	}
+	hashes[version] = hash
+	c.lru.Add(id, hashes)
+}
+
+// Remove drops the cached hashes of the id.
+func (c *HashCache) Remove(id int) {
+	if c == nil {
+		return
+	}
+	c.lru.Remove(id)
+}
+
+// Purge drops all the cached hashes.
+func (c *HashCache) Purge() {
+	if c == nil {
+		return
+	}
+	c.lru.Purge()
+}
+
+// Counts returns the number of cache hits and misses.
+func (c *HashCache) Counts() (hits, misses int64) {
+	if c == nil {
+		return 0, 0
+	}
+	return c.hits.Load(), c.misses.Load()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// MaxCASBodySize limits the size of compare-and-swap request bodies.
+const MaxCASBodySize = 1 << 16
+
+// CASRequest defines request structure for PUT requests to '/hash/{id}' endpoint.
+type CASRequest struct {
+	// ExpectedHash is the hash the client read, which must still be the current one.
+	ExpectedHash string `json:"expectedHash"`
+	NewPassword  string `json:"newPassword"`
+}
+
+// compareAndSwapHandler handles the PUT requests to `/hash/{id}` endpoint.
+// The new password is hashed with the algorithm of the current hash, only if the current hash is the expected one.
+func (s *Server) compareAndSwapHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if s.rejectDraining(w) {
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	req := &CASRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxCASBodySize)).Decode(req); err != nil || req.ExpectedHash == "" || req.NewPassword == "" {
+		http.Error(w, "Both `expectedHash` and `newPassword` must be given!", http.StatusBadRequest)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: CompareHashCommand, id: hashId, expectedHash: req.ExpectedHash})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	alg := &AlgorithmResponse{}
+	if !decodeResult(w, res, alg) || !s.allowAlgorithm(w, alg.Algorithm) {
+		return
+	}
+	fmt.Fprintf(w, "%d\n", hashId)
+	// The store compares the hashes again when storing the new one, in case of a concurrent update during the delay.
+	s.queueSetHash(&Command{requestType: SetHashCommand, password: req.NewPassword, algorithm: alg.Algorithm, encoding: alg.Encoding, id: hashId, expectedHash: req.ExpectedHash, requestID: requestIDFrom(r.Context())})
+}
+
+// UpgradeRequest defines request structure for PATCH requests to '/hash/{id}' endpoint.
+type UpgradeRequest struct {
+	// ExpectedAlgorithm is the algorithm the client knows the hash was computed with.
+	ExpectedAlgorithm string `json:"expectedAlgorithm"`
+	NewAlgorithm      string `json:"newAlgorithm"`
+	// Password must be the one of the current hash.
+	Password string `json:"password"`
+}
+
+// upgradeAlgorithmHandler handles the PATCH requests to `/hash/{id}` endpoint.
+// The password is hashed with the new algorithm, only if the current hash is its hash with the expected algorithm.
+func (s *Server) upgradeAlgorithmHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if s.rejectDraining(w) {
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	req := &UpgradeRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxCASBodySize)).Decode(req); err != nil || req.ExpectedAlgorithm == "" || req.NewAlgorithm == "" || req.Password == "" {
+		http.Error(w, "The `expectedAlgorithm`, `newAlgorithm` and `password` must be given!", http.StatusBadRequest)
+		return
+	}
+	if _, ok := hashAlgorithms[req.NewAlgorithm]; !ok {
+		http.Error(w, "Unsupported hash algorithm!", http.StatusBadRequest)
+		log.Println("Rejecting the request as the hash algorithm is not supported: ", req.NewAlgorithm)
+		return
+	}
+	if !s.allowAlgorithm(w, req.NewAlgorithm) {
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: CompareAlgorithmCommand, id: hashId, algorithm: req.ExpectedAlgorithm})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	current := &HashVersion{}
+	if !decodeResult(w, res, current) {
+		return
+	}
+	password, ok := s.pepper.ApplyVersion(s.normalizer.String(req.Password), current.PepperVersion)
+	if !ok {
+		log.Printf("Cannot verify the hash for id %d: pepper version %d is not in the keyring", hashId, current.PepperVersion)
+		writeInternalError(w)
+		return
+	}
+	if !verifyHash(password, current.Algorithm, current.Encoding, current.Hash) {
+		writeStoreError(w, ErrPasswordMismatch)
+		return
+	}
+	// The encoding is kept if the new algorithm supports it.
+	encoding, err := resolveEncoding(req.NewAlgorithm, current.Encoding)
+	if err != nil {
+		encoding = hashEncodings[req.NewAlgorithm]
+	}
+	fmt.Fprintf(w, "%d\n", hashId)
+	// The new hash replaces the current one only if it has not been modified meanwhile.
+	s.queueSetHash(&Command{requestType: SetHashCommand, password: req.Password, algorithm: req.NewAlgorithm, encoding: encoding, id: hashId, expectedHash: current.Hash, requestID: requestIDFrom(r.Context())})
+}
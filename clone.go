@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// cloneHandler handles the POST requests to `/hash/{id}/clone?namespace={namespace}` endpoint.
+// The hash and its metadata are copied to a new id, in the given namespace or in the one of the source hash.
+func (s *Server) cloneHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if s.rejectDraining(w) {
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	// The new id is released by the store goroutine whether or not the hash could be cloned,
+	// so the command must reach it even if the request has timed out.
+	newId := s.ids.Next()
+	res := s.send(context.WithoutCancel(r.Context()), Command{requestType: CloneHashCommand, id: hashId, targetID: newId, namespace: r.URL.Query().Get("namespace")})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	fmt.Fprintf(w, "%s\n", res.value)
+}
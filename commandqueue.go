@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// MaxChannelCapacity is the largest capacity `/admin/reconfigure-channel` accepts for the inboundRequests channel.
+const MaxChannelCapacity = 100000
+
+// ErrStoreStopped is returned for the commands sent once the store goroutine is stopped.
+var ErrStoreStopped = errors.New("The store has been stopped!")
+
+// CommandQueue is the inboundRequests channel of the commands sent to the store goroutine, which can be replaced by a
+// channel of another capacity while the server runs. Safe for concurrent use.
+type CommandQueue struct {
+	// mu is held for reading while a command is being sent, and for writing while the channel is replaced or closed.
+	mu sync.RWMutex
+	ch chan Command
+	// retired are the channels replaced by Resize, whose commands may not have been processed yet.
+	retired []chan Command
+	// closed is set once the channel is closed, the commands sent afterwards being dropped.
+	closed bool
+}
+
+// NewCommandQueue creates the CommandQueue of a channel of the capacity.
+func NewCommandQueue(capacity int) *CommandQueue {
+	return &CommandQueue{ch: make(chan Command, capacity)}
+}
+
+// Send sends the command to the store goroutine, waiting until it is queued. The command is dropped once the
+// channel is closed, e.g. a hash computed after the shutdown.
+func (q *CommandQueue) Send(c Command) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		log.Printf("Dropping the %s sent after the store was stopped", c.requestType)
+		return
+	}
+	q.ch <- c
+}
+
+// SendContext sends the command to the store goroutine, waiting until it is queued, or returns the error of ctx once
+// it is done.
+func (q *CommandQueue) SendContext(ctx context.Context, c Command) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrStoreStopped
+	}
+	select {
+	case q.ch <- c:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySend sends the command to the store goroutine if it can be queued at once, and reports whether it was sent.
+func (q *CommandQueue) TrySend(c Command) bool {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return false
+	}
+	select {
+	case q.ch <- c:
+		return true
+	default:
+		return false
+	}
+}
+
+// Len returns the number of queued commands, including those left in the channels replaced by Resize until the store
+// goroutine has processed them and switched to the next channel.
+func (q *CommandQueue) Len() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	n := len(q.ch)
+	for _, ch := range q.retired {
+		n += len(ch)
+	}
+	return n
+}
+
+// Cap returns the capacity of the channel.
+func (q *CommandQueue) Cap() int {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return cap(q.ch)
+}
+
+// Close closes the channel, stopping the store goroutine once the queued commands are processed.
+func (q *CommandQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	close(q.ch)
+}
+
+// Resize replaces the channel by a new one of the capacity, and returns the capacity of the replaced one. The store
+// goroutine is told to switch to the new channel by a SwitchChannelCommand queued after the commands of the replaced
+// one; those are processed first, so that none is lost and their order is kept.
+func (q *CommandQueue) Resize(capacity int) int {
+	q.mu.Lock()
+	old := q.ch
+	if q.closed {
+		q.mu.Unlock()
+		return cap(old)
+	}
+	q.ch = make(chan Command, capacity)
+	// The replaced channels left empty have no command to count: only their SwitchChannelCommand is sent to them once
+	// replaced.
+	q.retired = append(slices.DeleteFunc(q.retired, func(ch chan Command) bool { return len(ch) == 0 }), old)
+	switchCommand := Command{requestType: SwitchChannelCommand, channel: q.ch}
+	q.mu.Unlock()
+	// The replaced channel may be full, so the SwitchChannelCommand is queued once the senders are using the new one:
+	// they are not blocked while the store goroutine is busy, and no command is sent to the replaced channel after it.
+	old <- switchCommand
+	return cap(old)
+}
+
+// ReconfigureChannelResponse defines response structure for '/admin/reconfigure-channel' endpoint.
+type ReconfigureChannelResponse struct {
+	Capacity         int `json:"capacity"`
+	PreviousCapacity int `json:"previousCapacity"`
+}
+
+// reconfigureChannelHandler handles the admin only POST requests to `/admin/reconfigure-channel?capacity=N` endpoint,
+// replacing the inboundRequests channel by one of the capacity without restarting the server.
+func (s *Server) reconfigureChannelHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	capacity, err := strconv.Atoi(r.URL.Query().Get("capacity"))
+	if err != nil || capacity < 1 || capacity > MaxChannelCapacity {
+		http.Error(w, fmt.Sprintf("Invalid capacity, it must be between 1 and %d!", MaxChannelCapacity), http.StatusBadRequest)
+		return
+	}
+	resp := &ReconfigureChannelResponse{Capacity: capacity, PreviousCapacity: s.inboundRequests.Resize(capacity)}
+	s.audit.Record("reconfigure-channel", r, resp)
+	log.Printf("Inbound requests channel capacity changed from %d to %d", resp.PreviousCapacity, resp.Capacity)
+	writeJSON(w, resp)
+}
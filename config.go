@@ -0,0 +1,317 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/netip"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Values of the `--api-version` flag.
+const (
+	// APIVersionAll serves the current API version and redirects the legacy, unversioned routes to it.
+	APIVersionAll = "all"
+	// APIVersionV1 only serves the routes under APIPrefix.
+	APIVersionV1 = "v1"
+)
+
+// DefaultTombstoneRetention is how long deleted hashes can be restored by default.
+const DefaultTombstoneRetention = 7 * 24 * time.Hour
+
+// DefaultMaxBulkSize is the default maximum number of ids accepted by a bulk request.
+const DefaultMaxBulkSize = 100
+
+// DefaultMaxEvents is the default number of events kept by the event log.
+const DefaultMaxEvents = 100000
+
+// DefaultMaxRequestAge is the default age after which a request timestamp is stale.
+const DefaultMaxRequestAge = 30 * time.Second
+
+// DefaultAlgorithmRateLimits are the default maximum numbers of passwords hashed per second, for the slow algorithms.
+var DefaultAlgorithmRateLimits = map[string]float64{
+	"bcrypt":   10,
+	"argon2id": 5,
+}
+
+// Default number of benchmark clients and of requests made by each of them.
+const (
+	DefaultBenchmarkWorkers  = 10
+	DefaultBenchmarkRequests = 100
+)
+
+// Config holds the server settings supplied on the command line.
+type Config struct {
+	// NATSURL of the NATS server hash events are published to. Publishing is disabled when empty.
+	NATSURL string
+	// APIVersion selects the routes being served, either APIVersionAll or APIVersionV1.
+	APIVersion string
+	// AdminToken is the bearer token required by admin endpoints. Admin endpoints are disabled when empty.
+	AdminToken string
+	// AdminPort is the port of the loopback only server of the admin endpoints, which are then not served on the
+	// public port. The admin endpoints are served on the public port when zero.
+	AdminPort int
+	// TombstoneRetention is how long deleted hashes are kept before being permanently removed.
+	// Tombstones are kept forever when zero.
+	TombstoneRetention time.Duration
+	// MaxBulkSize is the maximum number of ids accepted by a bulk request.
+	MaxBulkSize int
+	// MaxEvents is the number of events kept by the event log, the oldest ones being dropped. The log is unbounded
+	// when zero.
+	MaxEvents int
+	// AuditLogFile is the path of the file admin operations are logged to. Auditing is disabled when empty.
+	AuditLogFile string
+	// AutoPurgeAfter is the age after which hashes are purged. Hashes are kept forever when zero.
+	AutoPurgeAfter time.Duration
+	// Quiet suppresses the startup banner summarizing the configuration.
+	Quiet bool
+	// LogLevel is the minimum level of the logged messages.
+	LogLevel slog.Level
+	// SnapshotDir is the directory store snapshots are saved to.
+	SnapshotDir string
+	// WALFile is the path of the write-ahead log of the store. The log is disabled when empty.
+	WALFile string
+	// AllowLoadTest enables the `/admin/load-test` endpoint.
+	AllowLoadTest bool
+	// AllowAdminStress enables the `/admin/stress-store` endpoint.
+	AllowAdminStress bool
+	// AllowBenchmark enables the `/hash/{id}/benchmark` endpoint.
+	AllowBenchmark bool
+	// WriteTimeout is the server-wide time limit to write a response. There is no limit when zero.
+	WriteTimeout time.Duration
+	// EndpointTimeouts are the time limits of the endpoints matching the path patterns, e.g. `/hashes/bulk` or `/hash/*`.
+	EndpointTimeouts map[string]time.Duration
+	// PepperFile is the path of the file holding the pepper mixed into the passwords. No pepper is applied when empty.
+	PepperFile string
+	// HashPreprocessingDelay is the wait time before a password is hashed and stored.
+	HashPreprocessingDelay time.Duration
+	// ShutdownGraceDelay is the wait time for pending requests before the server terminates.
+	ShutdownGraceDelay time.Duration
+	// Benchmark runs the benchmark of an in-process server instead of serving requests.
+	Benchmark bool
+	// BenchmarkWorkers is the number of concurrent clients, each making BenchmarkRequests requests per endpoint.
+	BenchmarkWorkers  int
+	BenchmarkRequests int
+	// BenchmarkMinRPS is the throughput below which the benchmark fails.
+	BenchmarkMinRPS float64
+	// DebugStoreLog logs each command processed by the store goroutine.
+	DebugStoreLog bool
+	// MaxRequestAge is the age after which the requests are rejected, according to their RequestTimestampHeader.
+	MaxRequestAge time.Duration
+	// RequireTimestamp rejects the requests without a RequestTimestampHeader.
+	RequireTimestamp bool
+	// AlgorithmRateLimits are the maximum numbers of passwords hashed per second, by algorithm.
+	// The algorithms without a positive limit are not limited.
+	AlgorithmRateLimits map[string]float64
+	// AllowInsecureAlgorithms enables the IdentityAlgorithm, for benchmarks and tests only.
+	AllowInsecureAlgorithms bool
+	// BenchmarkAlgorithm is the algorithm of the hashes posted by the benchmark.
+	BenchmarkAlgorithm string
+	// KeystoreDir is the directory of the PEM files holding the keys signing the hashes. No key is loaded when empty.
+	KeystoreDir string
+	// SignHashesKey is the PEM file of the ED25519 private key signing the stored hashes. Nothing is signed when empty.
+	SignHashesKey string
+	// GetCacheSize is the number of ids whose hashes are cached for GetCacheTTL. Nothing is cached when zero.
+	GetCacheSize int
+	GetCacheTTL  time.Duration
+	// WarmupFile is the JSON file of the WarmupEntry hashed and stored on startup.
+	WarmupFile string
+	// PasswordNormalizer is the Unicode normalization form applied to the passwords before they are hashed,
+	// NormalizerNone, NormalizerNFC or NormalizerNFKC, and PasswordCase whether they are lowercased.
+	PasswordNormalizer string
+	PasswordCase       string
+	// PreHashTransforms are applied in order to the normalized passwords: TransformTrim, TransformLowercase,
+	// TransformStripControl, NormalizerNFC or NormalizerNFKC.
+	PreHashTransforms []string
+	// DeprecatedAlgorithms are the algorithms whose hashes are returned by `/hash/{id}` with a
+	// DeprecatedAlgorithmWarning, for the clients to re-hash them.
+	DeprecatedAlgorithms []string
+	// AllowCIDRs and DenyCIDRs are the CIDRs the clients are allowed and denied access from, replaced by
+	// `/admin/reload-allowlist`. All the clients are allowed when both are empty.
+	AllowCIDRs []netip.Prefix
+	DenyCIDRs  []netip.Prefix
+	// LinkSigningKey is the key signing the links created by `/hash/{id}/link`. Share links are disabled when empty.
+	LinkSigningKey string
+	// DedupWindow is how long the ids issued to the passwords posted to `/hash` are returned again for the same
+	// passwords, instead of hashing them again. Disabled when zero.
+	DedupWindow time.Duration
+	// TLSCertFile and TLSKeyFile are the PEM files of the certificate the server is served over HTTPS with.
+	// The server is served over HTTP when empty.
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSClientCAFile is the PEM file of the CAs of the client certificates, enabling mutual TLS when given.
+	TLSClientCAFile string
+	// PreShutdownWebhook is the URL notified when the shutdown begins, PreShutdownDelay before the server stops
+	// serving requests. The shutdown begins at once when empty.
+	PreShutdownWebhook string
+	PreShutdownDelay   time.Duration
+}
+
+// ParseConfig parses the command line arguments into a Config.
+func ParseConfig(args []string) (*Config, error) {
+	cfg := &Config{}
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	fs.StringVar(&cfg.NATSURL, "nats-url", "", "URL of the NATS server to publish hash events to")
+	fs.StringVar(&cfg.APIVersion, "api-version", APIVersionAll, "API routes to serve: 'all' (versioned and legacy) or 'v1'")
+	fs.StringVar(&cfg.AdminToken, "admin-token", "", "bearer token authenticating requests to admin endpoints")
+	fs.IntVar(&cfg.AdminPort, "admin-port", DefaultAdminPort, "port of the admin endpoints, served on 127.0.0.1 only; 0 serves them on the public port")
+	fs.DurationVar(&cfg.TombstoneRetention, "tombstone-retention", DefaultTombstoneRetention, "how long deleted hashes are kept before being purged, 0 to keep them forever")
+	fs.IntVar(&cfg.MaxBulkSize, "max-bulk-size", DefaultMaxBulkSize, "maximum number of ids accepted by a bulk request")
+	fs.IntVar(&cfg.MaxEvents, "max-events", DefaultMaxEvents, "number of events kept by the event log, the oldest ones being dropped; 0 keeps them all")
+	fs.StringVar(&cfg.AuditLogFile, "audit-log", "", "file to append the audit log of admin operations to")
+	fs.DurationVar(&cfg.AutoPurgeAfter, "auto-purge-after", 0, "age after which hashes are purged, e.g. 720h; 0 keeps them forever")
+	fs.BoolVar(&cfg.Quiet, "quiet", false, "do not print the startup banner summarizing the configuration to stderr")
+	fs.TextVar(&cfg.LogLevel, "log-level", slog.LevelInfo, "minimum level of the logged messages: debug, info, warn or error")
+	fs.StringVar(&cfg.SnapshotDir, "snapshot-dir", "snapshots", "directory store snapshots are saved to")
+	fs.StringVar(&cfg.WALFile, "wal-file", "", "write-ahead log file used to recover the hashes stored since the last snapshot")
+	fs.BoolVar(&cfg.AllowLoadTest, "allow-load-test", false, "enable the /admin/load-test endpoint generating synthetic hash traffic")
+	fs.BoolVar(&cfg.AllowAdminStress, "allow-admin-stress", false, "enable the /admin/stress-store endpoint populating the store with synthetic hashes")
+	fs.BoolVar(&cfg.AllowBenchmark, "allow-benchmark", false, "enable the /hash/{id}/benchmark endpoint timing the verification of a hash")
+	fs.DurationVar(&cfg.WriteTimeout, "write-timeout", 0, "time limit to write a response, 0 for no limit")
+	cfg.EndpointTimeouts = make(map[string]time.Duration)
+	fs.Func("endpoint-timeout", "`pattern=duration` time limit of the endpoints matching the path pattern, e.g. /hashes/bulk=30s; can be repeated", func(v string) error {
+		pattern, d, ok := strings.Cut(v, "=")
+		if !ok {
+			return errors.New("expected pattern=duration")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return err
+		}
+		timeout, err := time.ParseDuration(d)
+		if err != nil {
+			return err
+		}
+		cfg.EndpointTimeouts[pattern] = timeout
+		return nil
+	})
+	fs.StringVar(&cfg.PepperFile, "pepper-file", "", "file holding the secret pepper mixed into the passwords, read again on SIGHUP")
+	fs.DurationVar(&cfg.HashPreprocessingDelay, "hash-delay", DefaultHashPreprocessingDelay, "wait time before a password is hashed and stored")
+	fs.DurationVar(&cfg.ShutdownGraceDelay, "shutdown-grace", DefaultShutdownGraceDelay, "wait time for pending requests when shutting down")
+	fs.BoolVar(&cfg.Benchmark, "benchmark", false, "benchmark the /hash and /hash/{id} endpoints of an in-process server, then exit")
+	fs.IntVar(&cfg.BenchmarkWorkers, "benchmark-workers", DefaultBenchmarkWorkers, "number of concurrent benchmark clients")
+	fs.IntVar(&cfg.BenchmarkRequests, "benchmark-requests", DefaultBenchmarkRequests, "number of requests made by each benchmark client per endpoint")
+	fs.Float64Var(&cfg.BenchmarkMinRPS, "benchmark-min-rps", 0, "requests per second below which the benchmark exits with an error")
+	fs.BoolVar(&cfg.DebugStoreLog, "debug-store-log", false, "log each command processed by the store, whatever the --log-level")
+	fs.DurationVar(&cfg.MaxRequestAge, "max-request-age", DefaultMaxRequestAge, "age after which requests are rejected according to their X-Request-Timestamp header")
+	fs.BoolVar(&cfg.RequireTimestamp, "require-timestamp", false, "reject the requests without an X-Request-Timestamp header")
+	cfg.AlgorithmRateLimits = maps.Clone(DefaultAlgorithmRateLimits)
+	fs.Func("algorithm-rate-limit", "`algorithm=rps` maximum number of passwords hashed per second with the algorithm, 0 for no limit; can be repeated", func(v string) error {
+		algorithm, limit, ok := strings.Cut(v, "=")
+		if !ok {
+			return errors.New("expected algorithm=rps")
+		}
+		rps, err := strconv.ParseFloat(limit, 64)
+		if err != nil {
+			return err
+		}
+		cfg.AlgorithmRateLimits[algorithm] = rps
+		return nil
+	})
+	fs.BoolVar(&cfg.AllowInsecureAlgorithms, "allow-insecure-algorithms", false, "enable the INSECURE identity algorithm storing passwords in clear, for benchmarks and tests only")
+	fs.StringVar(&cfg.BenchmarkAlgorithm, "benchmark-algorithm", DefaultAlgorithm, "algorithm of the hashes posted by the benchmark, e.g. identity to measure the server overhead only")
+	fs.StringVar(&cfg.KeystoreDir, "keystore-dir", "", "directory of the {keyId}.pem files holding the keys signing the hashes")
+	fs.StringVar(&cfg.SignHashesKey, "sign-hashes", "", "{keyId}.pem file of the ED25519 private key signing the stored hashes, returned by GET /hash/{id}/signed")
+	fs.IntVar(&cfg.GetCacheSize, "get-cache-size", DefaultGetCacheSize, "number of ids whose hashes are cached for GET /hash/{id}, 0 to disable the cache")
+	fs.DurationVar(&cfg.GetCacheTTL, "get-cache-ttl", DefaultGetCacheTTL, "how long the hashes are cached for GET /hash/{id}")
+	fs.StringVar(&cfg.WarmupFile, "warmup-file", "", "JSON array of {\"id\",\"password\",\"algorithm\"} entries hashed and stored on startup, without the --hash-delay")
+	fs.StringVar(&cfg.PasswordNormalizer, "password-normalizer", NormalizerNone, "Unicode normalization of the passwords before they are hashed: none, nfc or nfkc")
+	fs.StringVar(&cfg.PasswordCase, "password-case", CasePreserve, "case of the passwords before they are hashed: preserve or lower")
+	fs.Func("pre-hash-transforms", "comma separated `transforms` applied in order to the passwords before they are hashed: trim, lowercase, strip-control, nfc or nfkc; can be repeated", func(v string) error {
+		for _, name := range strings.Split(v, ",") {
+			cfg.PreHashTransforms = append(cfg.PreHashTransforms, strings.TrimSpace(name))
+		}
+		return nil
+	})
+	fs.Func("deprecated-algorithms", "comma separated `algorithms` whose hashes are returned with a warning to re-hash them, e.g. sha512; can be repeated", func(v string) error {
+		for _, name := range strings.Split(v, ",") {
+			cfg.DeprecatedAlgorithms = append(cfg.DeprecatedAlgorithms, strings.TrimSpace(name))
+		}
+		return nil
+	})
+	fs.Func("allow-cidrs", "comma separated `CIDRs` the clients are only allowed access from; can be repeated", func(v string) error {
+		return appendCIDRs(&cfg.AllowCIDRs, v)
+	})
+	fs.Func("deny-cidrs", "comma separated `CIDRs` the clients are denied access from, even if allowed; can be repeated", func(v string) error {
+		return appendCIDRs(&cfg.DenyCIDRs, v)
+	})
+	fs.StringVar(&cfg.LinkSigningKey, "link-signing-key", "", "key signing the share links created by GET /hash/{id}/link")
+	fs.DurationVar(&cfg.DedupWindow, "dedup-window", 0, "how long the same password posted to /hash gets the same id instead of a new hash, 0 to disable")
+	fs.StringVar(&cfg.TLSCertFile, "tls-cert-file", "", "PEM certificate file to serve HTTPS with")
+	fs.StringVar(&cfg.TLSKeyFile, "tls-key-file", "", "PEM private key file of --tls-cert-file")
+	fs.StringVar(&cfg.TLSClientCAFile, "tls-client-ca-file", "", "PEM file of the CAs the clients must present a certificate of, enabling mutual TLS")
+	fs.StringVar(&cfg.PreShutdownWebhook, "pre-shutdown-webhook", "", "URL posted a draining notification when the shutdown begins, e.g. to take the server out of a load balancer")
+	fs.DurationVar(&cfg.PreShutdownDelay, "pre-shutdown-delay", DefaultPreShutdownDelay, "wait time after the --pre-shutdown-webhook notification before shutting down")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if cfg.APIVersion != APIVersionAll && cfg.APIVersion != APIVersionV1 {
+		return nil, fmt.Errorf("invalid --api-version %q", cfg.APIVersion)
+	}
+	if cfg.AdminPort < 0 || cfg.AdminPort > 65535 {
+		return nil, fmt.Errorf("invalid --admin-port %d", cfg.AdminPort)
+	}
+	if cfg.BenchmarkWorkers < 1 || cfg.BenchmarkRequests < 1 {
+		return nil, errors.New("--benchmark-workers and --benchmark-requests must be positive")
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, errors.New("--tls-cert-file and --tls-key-file must be given together")
+	}
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		return nil, errors.New("--tls-client-ca-file requires --tls-cert-file")
+	}
+	if _, err := NewPasswordNormalizer(cfg.PasswordNormalizer, cfg.PasswordCase, cfg.PreHashTransforms); err != nil {
+		return nil, err
+	}
+	if cfg.BenchmarkAlgorithm == IdentityAlgorithm && !cfg.AllowInsecureAlgorithms {
+		return nil, errors.New("--benchmark-algorithm identity requires --allow-insecure-algorithms")
+	}
+	return cfg, nil
+}
+
+// appendCIDRs parses the comma separated CIDRs and appends them to cidrs.
+func appendCIDRs(cidrs *[]netip.Prefix, v string) error {
+	for _, cidr := range strings.Split(v, ",") {
+		p, err := parseCIDR(strings.TrimSpace(cidr))
+		if err != nil {
+			return err
+		}
+		*cidrs = append(*cidrs, p)
+	}
+	return nil
+}
+
+// ConfigResponse defines response structure for '/config' endpoint: the settings of the server, without its secrets.
+type ConfigResponse struct {
+	APIVersion   string `json:"apiVersion"`
+	HashDelay    string `json:"hashDelay"`
+	MaxBulkSize  int    `json:"maxBulkSize"`
+	GetCacheSize int    `json:"getCacheSize"`
+	// ActivePepperVersion is the version of the pepper applied to the new hashes, 0 for none.
+	ActivePepperVersion int `json:"activePepperVersion"`
+}
+
+// configResponse returns the current settings of the server.
+func (s *Server) configResponse() *ConfigResponse {
+	return &ConfigResponse{
+		APIVersion:          s.cfg.APIVersion,
+		HashDelay:           s.cfg.HashPreprocessingDelay.String(),
+		MaxBulkSize:         s.cfg.MaxBulkSize,
+		GetCacheSize:        s.cfg.GetCacheSize,
+		ActivePepperVersion: s.pepper.ActiveVersion(),
+	}
+}
+
+// configHandler handles the GET requests to `/config` endpoint.
+func (s *Server) configHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	writeJSON(w, s.configResponse())
+}
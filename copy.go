@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// MaxCopyBodySize limits the size of `/hash/{id}/copy` request bodies.
+const MaxCopyBodySize = 1 << 12
+
+// StatusPendingResubmit is the status of the copies of hashes, until their password is submitted again.
+const StatusPendingResubmit = "pending_resubmit"
+
+// CopyRequest defines request structure for '/hash/{id}/copy' endpoint.
+// The namespace and algorithm of the source hash are kept if not given.
+type CopyRequest struct {
+	TargetNamespace string `json:"targetNamespace"`
+	TargetAlgorithm string `json:"targetAlgorithm"`
+}
+
+// CopyResponse defines response structure for '/hash/{id}/copy' endpoint, also returned by `/hash/{id}` endpoint
+// for a copy awaiting its password.
+type CopyResponse struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+// copyHandler handles the POST requests to `/hash/{id}/copy` endpoint.
+// A hash cannot be computed again with another algorithm without its password, so unlike `/hash/{id}/clone`, only
+// the metadata of the hash are copied to a new id. The copy awaits its password, to be submitted to
+// `/hash/{new id}` with the target algorithm.
+func (s *Server) copyHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if s.rejectDraining(w) {
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	req := &CopyRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxCopyBodySize)).Decode(req); err != nil {
+		http.Error(w, "Invalid JSON request!", http.StatusBadRequest)
+		log.Println("Rejecting the request as the JSON body is invalid: ", err)
+		return
+	}
+	if _, ok := hashAlgorithms[req.TargetAlgorithm]; req.TargetAlgorithm != "" && !ok {
+		http.Error(w, "Unsupported hash algorithm!", http.StatusBadRequest)
+		log.Println("Rejecting the request as the hash algorithm is not supported: ", req.TargetAlgorithm)
+		return
+	}
+	// The new id is released by the store goroutine whether or not the hash could be copied,
+	// so the command must reach it even if the request has timed out.
+	newId := s.ids.Next()
+	res := s.send(context.WithoutCancel(r.Context()), Command{requestType: CopyHashCommand, id: hashId, targetID: newId, namespace: req.TargetNamespace, algorithm: req.TargetAlgorithm})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Printf("Hash %d copied to id %d, awaiting its password", hashId, newId)
+	writeJSON(w, &CopyResponse{ID: newId, Status: StatusPendingResubmit})
+}
+
+// writeAwaitingResubmit writes the 202 response to requests for a copy awaiting its password.
+func writeAwaitingResubmit(w http.ResponseWriter, hashId int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, &CopyResponse{ID: hashId, Status: StatusPendingResubmit})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/sha256"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DedupCache remembers the ids issued to the passwords posted to `/hash` endpoint for a window, so that a password
+// posted again within the window gets the same id instead of being hashed and stored again. The passwords are only
+// kept as SHA-256 digests, along with the settings of their hash. A nil DedupCache remembers nothing.
+// Safe for concurrent use.
+type DedupCache struct {
+	window time.Duration
+	// entries holds the dedupEntry of each dedupKey, and keys the dedupKey of each id.
+	entries sync.Map
+	keys    sync.Map
+}
+
+// dedupEntry is an id remembered until expiresAt.
+type dedupEntry struct {
+	id        int
+	expiresAt time.Time
+}
+
+// NewDedupCache creates a DedupCache remembering the ids for window, or returns nil if window is not positive.
+// The expired ids are dropped every window.
+func NewDedupCache(window time.Duration) *DedupCache {
+	if window <= 0 {
+		return nil
+	}
+	c := &DedupCache{window: window}
+	go func() {
+		for now := range time.Tick(window) {
+			c.entries.Range(func(key, e any) bool {
+				if now.After(e.(dedupEntry).expiresAt) && c.entries.CompareAndDelete(key, e) {
+					c.keys.CompareAndDelete(e.(dedupEntry).id, key)
+				}
+				return true
+			})
+		}
+	}()
+	return c
+}
+
+// dedupKey returns the digest identifying the hash requested by req: the same password hashed with another
+// algorithm or encoding, or stored in another namespace or with other tags, is another hash.
+func dedupKey(req *HashRequest) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strings.Join([]string{req.Password, req.Algorithm, req.Encoding, req.Namespace, strings.Join(req.Tags, ",")}, "\x00")))
+}
+
+// Lookup returns the id issued to the same request within the window.
+func (c *DedupCache) Lookup(req *HashRequest) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
+	e, ok := c.entries.Load(dedupKey(req))
+	if !ok || time.Now().After(e.(dedupEntry).expiresAt) {
+		return 0, false
+	}
+	return e.(dedupEntry).id, true
+}
+
+// Add remembers the id issued to the request for the window.
+func (c *DedupCache) Add(req *HashRequest, id int) {
+	if c == nil {
+		return
+	}
+	key := dedupKey(req)
+	c.entries.Store(key, dedupEntry{id: id, expiresAt: time.Now().Add(c.window)})
+	c.keys.Store(id, key)
+}
+
+// Remove forgets the id, e.g. once its hash is deleted or has failed, so that its password gets a new id.
+func (c *DedupCache) Remove(id int) {
+	if c == nil {
+		return
+	}
+	key, ok := c.keys.LoadAndDelete(id)
+	if !ok {
+		return
+	}
+	if e, ok := c.entries.Load(key); ok && e.(dedupEntry).id == id {
+		c.entries.CompareAndDelete(key, e)
+	}
+}
+
+// Purge forgets all the ids, e.g. once they are reissued.
+func (c *DedupCache) Purge() {
+	if c == nil {
+		return
+	}
+	c.entries.Clear()
+	c.keys.Clear()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"log/slog"
+	"slices"
+)
+
+// DeprecatedAlgorithmWarning is the Warning header of the `/hash/{id}` responses returning a hash computed with one of
+// the `--deprecated-algorithms`.
+const DeprecatedAlgorithmWarning = "algorithm-deprecated; please-re-hash"
+
+// DeprecatedKey lists the deprecated algorithms of the stored hashes in the responses of
+// `/admin/algorithm-distribution` endpoint.
+const DeprecatedKey = "deprecated"
+
+// warnDeprecated reports whether the algorithm of the hash retrieved for the id is one of the deprecated ones, and
+// logs a warning if so.
+func warnDeprecated(deprecated []string, id int, algorithm string) bool {
+	if !slices.Contains(deprecated, algorithm) {
+		return false
+	}
+	slog.Warn("Retrieved a hash computed with a deprecated algorithm, it should be re-hashed", "id", id, "algorithm", algorithm)
+	return true
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+)
+
+// PendingAlgorithm is the key counting the hashes being processed in the responses of
+// `/admin/algorithm-distribution` endpoint, their algorithm not being known by the store yet.
+const PendingAlgorithm = "pending"
+
+// algorithmDistribution returns the number of hashes computed with each algorithm, by their latest version,
+// and the number of pending ones. The tombstones are left out.
+func algorithmDistribution(store map[int]*HashRecord, pending int) map[string]int {
+	dist := make(map[string]int)
+	for _, rec := range store {
+		if !rec.Deleted {
+			dist[rec.Algorithm]++
+		}
+	}
+	dist[PendingAlgorithm] = pending
+	return dist
+}
+
+// algorithmDistributionHandler handles the admin only GET requests to `/admin/algorithm-distribution` endpoint.
+// The deprecated algorithms of the stored hashes are listed under DeprecatedKey, when there are any.
+func (s *Server) algorithmDistributionHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: AlgorithmDistributionCommand})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	dist := make(map[string]int)
+	if !decodeResult(w, res, &dist) {
+		return
+	}
+	resp := make(map[string]any, len(dist)+1)
+	var deprecated []string
+	for algorithm, count := range dist {
+		resp[algorithm] = count
+		if count > 0 && slices.Contains(s.cfg.DeprecatedAlgorithms, algorithm) {
+			deprecated = append(deprecated, algorithm)
+		}
+	}
+	if len(deprecated) > 0 {
+		sort.Strings(deprecated)
+		resp[DeprecatedKey] = deprecated
+	}
+	writeJSON(w, resp)
+}
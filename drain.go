@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Values of the `status` of `/health` endpoint.
+const (
+	HealthOK       = "ok"
+	HealthDraining = "draining"
+)
+
+// HealthResponse defines response structure for '/health' endpoint.
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+// drainHandler handles the admin only POST requests to `/admin/drain` endpoint.
+// New hashes are rejected until `/admin/undrain` is called, while the other requests are still served.
+func (s *Server) drainHandler(w http.ResponseWriter, r *http.Request) {
+	s.setDraining(w, r, true)
+}
+
+// undrainHandler handles the admin only POST requests to `/admin/undrain` endpoint, accepting new hashes again.
+func (s *Server) undrainHandler(w http.ResponseWriter, r *http.Request) {
+	s.setDraining(w, r, false)
+}
+
+// setDraining sets whether the server is draining, on behalf of an admin.
+func (s *Server) setDraining(w http.ResponseWriter, r *http.Request, draining bool) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if s.isDraining.Swap(draining) == draining {
+		log.Println("The server draining is already: ", draining)
+	} else if draining {
+		s.audit.Record("drain", r, nil)
+		log.Println("Draining the server, new hashes are rejected.")
+	} else {
+		s.audit.Record("undrain", r, nil)
+		log.Println("Undraining the server, new hashes are accepted again.")
+	}
+	writeJSON(w, s.health())
+}
+
+// rejectDraining writes a 503 response and returns true if the server is draining, so that no new hash is stored.
+func (s *Server) rejectDraining(w http.ResponseWriter) bool {
+	if !s.isDraining.Load() {
+		return false
+	}
+	http.Error(w, "The server is draining, new hashes are not accepted!", http.StatusServiceUnavailable)
+	log.Println("Rejecting the request as the server is draining.")
+	return true
+}
+
+// health returns the health of the server; a draining server is healthy, though not accepting new hashes.
+// The server is draining too once its shutdown begins, so that the load balancers take it out of rotation.
+func (s *Server) health() *HealthResponse {
+	if s.isDraining.Load() || s.isShuttingDown.Load() {
+		return &HealthResponse{Status: HealthDraining}
+	}
+	return &HealthResponse{Status: HealthOK}
+}
+
+// healthHandler handles the GET requests to `/health` endpoint.
+func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.health())
+}
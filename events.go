@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	hashserverpb "github.com/KetanA/JC-Golang/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+// Event types recorded in the event log.
+const (
+	HashSetEvent      = "HashSet"
+	HashDeletedEvent  = "HashDeleted"
+	HashAccessedEvent = "HashAccessed"
+)
+
+// Event is a single entry of the append-only event log kept by the password store.
+type Event struct {
+	// EventID is a monotonically increasing identifier, starting at 1.
+	EventID   int64     `json:"eventId"`
+	Timestamp time.Time `json:"timestamp"`
+	// Type is one of HashSetEvent, HashDeletedEvent or HashAccessedEvent.
+	Type      string `json:"type"`
+	HashID    int    `json:"hashId"`
+	Algorithm string `json:"algorithm"`
+}
+
+// EventCount defines response structure for '/events/count' endpoint.
+type EventCount struct {
+	Count int `json:"count"`
+}
+
+// eventsHandler handles the GET requests to `/events` endpoint.
+// Events recorded after the `since` event id are returned as newline-delimited JSON.
+func (s *Server) eventsHandler(w http.ResponseWriter, r *http.Request) {
+	// If the server is being termintaed, reject new requests.
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	var since int64
+	if v := r.URL.Query().Get("since"); v != "" {
+		var err error
+		if since, err = strconv.ParseInt(v, 10, 64); err != nil || since < 0 {
+			fmt.Fprintf(w, "Invalid event id!\n")
+			log.Println("Invalid event id!")
+			return
+		}
+	}
+
+	res := s.send(r.Context(), Command{requestType: GetEventsCommand, eventID: since})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	events := res.value
+	if acceptsProtobuf(r) {
+		// Re-encode the JSON lines as a stream of length-delimited messages.
+		var msgs []proto.Message
+		dec := json.NewDecoder(strings.NewReader(events))
+		for dec.More() {
+			var e Event
+			if err := dec.Decode(&e); err != nil {
+				break
+			}
+			msgs = append(msgs, e.protobuf())
+		}
+		writeProtobufStream(w, msgs)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	fmt.Fprint(w, events)
+}
+
+// eventCountHandler handles the GET requests to `/events/count` endpoint.
+func (s *Server) eventCountHandler(w http.ResponseWriter, r *http.Request) {
+	// If the server is being termintaed, reject new requests.
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+
+	res := s.send(r.Context(), Command{requestType: GetEventCountCommand})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	resp := res.value
+	if acceptsProtobuf(r) {
+		count := &EventCount{}
+		if !decodeResult(w, res, count) {
+			return
+		}
+		writeProtobuf(w, &hashserverpb.EventCount{Count: int64(count.Count)})
+		return
+	}
+	fmt.Fprintf(w, "%s\n", resp)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// MaxExpiryBodySize is the maximum size of the body of a `/hash/{id}/expiry` request.
+const MaxExpiryBodySize = 1 << 10
+
+// ExpiryPurgeInterval is how often the expired hashes are purged.
+const ExpiryPurgeInterval = 1 * time.Minute
+
+// ExpiryRequest defines request structure for '/hash/{id}/expiry' endpoint.
+type ExpiryRequest struct {
+	// TTL is how long from now the hash is kept, e.g. `2h`. A null or zero TTL makes the hash permanent.
+	TTL *string `json:"ttl"`
+}
+
+// ExpiryResponse defines response structure for '/hash/{id}/expiry' endpoint.
+type ExpiryResponse struct {
+	ID int `json:"id"`
+	// ExpiresAt is null for a permanent hash.
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// expiryHandler handles the PUT requests to `/hash/{id}/expiry` endpoint, setting, extending or removing the expiry
+// of an existing hash.
+func (s *Server) expiryHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	req := &ExpiryRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxExpiryBodySize)).Decode(req); err != nil {
+		http.Error(w, "Invalid JSON request!", http.StatusBadRequest)
+		return
+	}
+	var expiresAt *time.Time
+	if req.TTL != nil {
+		ttl, err := time.ParseDuration(*req.TTL)
+		if err != nil || ttl < 0 {
+			http.Error(w, "The `ttl` must be a non-negative duration, e.g. 2h!", http.StatusBadRequest)
+			return
+		}
+		if ttl > 0 {
+			t := time.Now().Add(ttl)
+			expiresAt = &t
+		}
+	}
+	res := s.send(r.Context(), Command{requestType: UpdateExpiryCommand, id: hashId, expiresAt: expiresAt})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Printf("Hash expiry updated for id %d: %v", hashId, expiresAt)
+	writeJSON(w, &ExpiryResponse{ID: hashId, ExpiresAt: expiresAt})
+}
+
+// startExpiryPurger creates a goroutine that periodically removes the expired hashes.
+func startExpiryPurger(inboundRequests *CommandQueue, pending *PendingCommands) {
+	go func() {
+		for range time.Tick(ExpiryPurgeInterval) {
+			resChan := make(chan Result, 1)
+			pending.Send(inboundRequests, Command{requestType: PurgeExpiredCommand, before: time.Now(), responseChannel: resChan})
+			if purged := (<-resChan).value; purged != "0" {
+				log.Printf("Purged %s expired hashes", purged)
+			}
+		}
+	}()
+}
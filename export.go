@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CSVExportBatchSize is the number of records read from the store and flushed to the client at once by the CSV export.
+const CSVExportBatchSize = 500
+
+// HashMetadata is the description of a hash exported by `/admin/export/csv` endpoint, without the hash itself.
+type HashMetadata struct {
+	ID          int       `json:"id"`
+	Algorithm   string    `json:"algorithm"`
+	CreatedAt   time.Time `json:"createdAt"`
+	AccessCount int       `json:"accessCount"`
+	Tags        []string  `json:"tags"`
+	// Annotations are the application-specific metadata of the hash.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Deleted     bool              `json:"deleted"`
+}
+
+// exportCSVHandler handles the admin only GET requests to `/admin/export/csv?include-deleted={true|false}` endpoint.
+// The metadata of the hashes are streamed as RFC 4180 CSV, the tags being separated by spaces. The store is read by
+// batches of CSVExportBatchSize records, so the export is not a consistent snapshot of a store being modified.
+func (s *Server) exportCSVHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	includeDeleted := r.URL.Query().Get("include-deleted") == "true"
+	s.audit.Record("export-csv", r, map[string]bool{"includeDeleted": includeDeleted})
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", `attachment; filename="hashes.csv"`)
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "algorithm", "createdAt", "accessCount", "tags", "deleted", "annotations"})
+	filter := &SearchFilter{Limit: CSVExportBatchSize}
+	for {
+		res := s.send(r.Context(), Command{requestType: ExportMetadataCommand, filter: filter, includeDeleted: includeDeleted})
+		if res.err != nil {
+			// The status has been sent with the header row, so the export can only be cut short.
+			log.Println("Cannot export the hashes: ", res.err)
+			break
+		}
+		var page []HashMetadata
+		if err := json.Unmarshal([]byte(res.value), &page); err != nil {
+			log.Println("Cannot decode the exported hashes: ", err)
+			break
+		}
+		for _, m := range page {
+			cw.Write([]string{strconv.Itoa(m.ID), m.Algorithm, m.CreatedAt.Format(time.RFC3339), strconv.Itoa(m.AccessCount),
+				strings.Join(m.Tags, " "), strconv.FormatBool(m.Deleted), annotationsCSV(m.Annotations)})
+		}
+		cw.Flush()
+		if len(page) < CSVExportBatchSize {
+			break
+		}
+		filter.Cursor = page[len(page)-1].ID
+	}
+	if err := cw.Error(); err != nil {
+		log.Println("Cannot write the CSV export: ", err)
+	}
+}
+
+// annotationsCSV returns the annotations encoded as a JSON object for the CSV export, or an empty string if none.
+func annotationsCSV(annotations map[string]string) string {
+	if len(annotations) == 0 {
+		return ""
+	}
+	data, err := safeMarshal(annotations)
+	if err != nil {
+		return ""
+	}
+	return data
+}
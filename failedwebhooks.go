@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxFailedWebhooks is the maximum number of failed webhook deliveries kept, the least recently attempted ones being
+// dropped beyond.
+const MaxFailedWebhooks = 1000
+
+// FailedWebhook is a webhook notification whose delivery failed all its attempts, kept to be retried manually.
+type FailedWebhook struct {
+	ID            int       `json:"id"`
+	HashID        int       `json:"hashId"`
+	URL           string    `json:"url"`
+	AttemptCount  int       `json:"attemptCount"`
+	LastError     string    `json:"lastError"`
+	LastAttemptAt time.Time `json:"lastAttemptAt"`
+	// subscription and body are the webhook and the notification posted to it, not disclosed as the subscription
+	// holds the secret.
+	subscription WebhookSubscription
+	body         []byte
+}
+
+// RetryWebhookResponse defines response structure for '/admin/failed-webhooks/{webhookId}/retry' endpoint.
+type RetryWebhookResponse struct {
+	ID        int  `json:"id"`
+	Delivered bool `json:"delivered"`
+}
+
+// failedWebhooksHandler handles the admin only GET requests to `/admin/failed-webhooks` endpoint, listing the
+// failed webhook deliveries, the least recently attempted first.
+func (s *Server) failedWebhooksHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: ListFailedWebhooksCommand})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// retryWebhookHandler handles the admin only POST requests to `/admin/failed-webhooks/{webhookId}/retry` endpoint.
+// The notification is posted once more at once; it is kept as failed, with one more attempt, if it fails again.
+func (s *Server) retryWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/retry")
+	webhookId, err := strconv.Atoi(path[strings.LastIndex(path, "/")+1:])
+	if err != nil {
+		http.Error(w, "Invalid webhook id!", http.StatusBadRequest)
+		return
+	}
+	f := &FailedWebhook{ID: webhookId}
+	if res := s.send(r.Context(), Command{requestType: TakeFailedWebhookCommand, failedWebhook: f}); res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	s.audit.Record("retry-webhook", r, map[string]any{"id": webhookId, "url": f.URL})
+	err = postWebhookOnce(f.URL, f.body, signWebhook(f.subscription.Secret, f.body))
+	if err == nil {
+		log.Printf("Failed webhook %d delivered to %s", webhookId, f.URL)
+		writeJSON(w, &RetryWebhookResponse{ID: webhookId, Delivered: true})
+		return
+	}
+	f.AttemptCount++
+	f.LastError = err.Error()
+	f.LastAttemptAt = time.Now()
+	s.pending.Send(s.inboundRequests, Command{requestType: WebhookFailedCommand, failedWebhook: f})
+	log.Printf("Cannot deliver the failed webhook %d to %s: %v", webhookId, f.URL, err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	writeJSON(w, &RetryWebhookResponse{ID: webhookId, Delivered: false})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// FCMSendURL is the Firebase Cloud Messaging HTTP API the push notifications are posted to.
+const FCMSendURL = "https://fcm.googleapis.com/fcm/send"
+
+// fcmSendURL is the URL the push notifications are posted to, FCMSendURL but for the tests.
+var fcmSendURL = FCMSendURL
+
+// FCMSubscription defines request structure for '/hash/{id}/notify-ready' endpoint: a device sent a push notification
+// once the hash is ready. The token and the server key are only held in memory until then, and never logged.
+type FCMSubscription struct {
+	Token     string `json:"fcmToken"`
+	ServerKey string `json:"fcmServerKey"`
+}
+
+// FCMMessage defines request structure of the push notifications posted to FCMSendURL.
+type FCMMessage struct {
+	To   string  `json:"to"`
+	Data FCMData `json:"data"`
+}
+
+// FCMData is the data payload of a push notification.
+type FCMData struct {
+	HashID int `json:"hashId"`
+}
+
+// postFCM posts the push notification that the hash of the id is ready to the device of the subscription.
+func postFCM(id int, sub *FCMSubscription) error {
+	body, err := json.Marshal(&FCMMessage{To: sub.Token, Data: FCMData{HashID: id}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, fcmSendURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "key="+sub.ServerKey)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// notifyReadyHandler handles the POST requests to `/hash/{id}/notify-ready` endpoint.
+// A push notification is sent to the device once the hash is ready; none is sent if its computation fails.
+func (s *Server) notifyReadyHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	fcm := &FCMSubscription{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxSubscribeBodySize)).Decode(fcm); err != nil || fcm.Token == "" || fcm.ServerKey == "" {
+		http.Error(w, "The `fcmToken` and `fcmServerKey` must be given!", http.StatusBadRequest)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: SubscribeHashCommand, id: hashId, subscription: &WebhookSubscription{fcm: fcm}})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Printf("Push notification subscribed to id %d", hashId)
+	writeJSON(w, &SubscribeResponse{ID: hashId, Status: res.value})
+}
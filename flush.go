@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// StorageBackend is the persistence of the password store, whose buffered data are written to disk by FlushCommand.
+type StorageBackend interface {
+	// Flush writes the buffered data to disk, and returns the number of bytes written since the previous flush.
+	Flush() (int64, error)
+}
+
+// MemoryBackend is the StorageBackend of the in-memory store, persisted by its write-ahead log if enabled.
+type MemoryBackend struct {
+	WAL *WAL
+}
+
+// Flush syncs the write-ahead log to disk, if enabled.
+func (b *MemoryBackend) Flush() (int64, error) {
+	if b.WAL == nil {
+		return 0, nil
+	}
+	return b.WAL.Flush()
+}
+
+// FlushResponse defines response structure for '/admin/force-flush' endpoint.
+type FlushResponse struct {
+	FlushedAt time.Time `json:"flushedAt"`
+	// BytesWritten is the number of bytes appended to the write-ahead log since the previous flush.
+	BytesWritten int64 `json:"bytesWritten"`
+}
+
+// forceFlushHandler handles the admin only POST requests to `/admin/force-flush` endpoint, syncing the write-ahead
+// log to disk without shutting the server down.
+func (s *Server) forceFlushHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if s.cfg.WALFile == "" {
+		http.Error(w, "The write-ahead log is disabled, enable it with `--wal-file`!", http.StatusForbidden)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: FlushCommand})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	flushed := &FlushResponse{}
+	if !decodeResult(w, res, flushed) {
+		return
+	}
+	s.audit.Record("force-flush", r, flushed)
+	log.Println("Write-ahead log flushed, bytes written: ", flushed.BytesWritten)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// gcHandler handles the admin only POST requests to `/admin/gc` endpoint.
+// The hashes are reassigned to sequential ids starting from 1, and the map of the old ids to the new ones is returned.
+func (s *Server) gcHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if r.URL.Query().Get("confirm") != "true" {
+		http.Error(w, "Reassigning the hash ids cannot be undone, confirm with `?confirm=true`!", http.StatusBadRequest)
+		return
+	}
+	// The store goroutine reassigns the ids while handling a single command, so no other command sees a partial result.
+	res := s.send(r.Context(), Command{requestType: CompactStoreCommand})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	mapping := map[int]int{}
+	if !decodeResult(w, res, &mapping) {
+		return
+	}
+	s.audit.Record("gc", r, map[string]int{"reassigned": len(mapping)})
+	log.Println("Hash ids compacted, hashes reassigned: ", len(mapping))
+	// The write-ahead log refers to the old ids, so a snapshot of the new ones replaces it.
+	if s.cfg.WALFile != "" {
+		if _, err := s.saveSnapshot(context.WithoutCancel(r.Context()), "gc"); err != nil {
+			log.Println("Cannot save the snapshot: ", err)
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Initial and maximum sizes of the buffer the stack traces of `/admin/goroutine-dump` endpoint are written to.
+const (
+	InitialStackBufferSize = 1 << 20
+	MaxStackBufferSize     = 64 << 20
+)
+
+// goroutineHeaderRegex matches the first line of the stack trace of a goroutine, e.g. `goroutine 1 [running]:`.
+var goroutineHeaderRegex = regexp.MustCompile(`^goroutine (\d+) \[([^\]]*)\]:$`)
+
+// GoroutineDump defines the entries of the '/admin/goroutine-dump' response with the json format.
+type GoroutineDump struct {
+	ID int `json:"id"`
+	// State is the state of the goroutine, such as `running` or `chan receive, 5 minutes`.
+	State  string       `json:"state"`
+	Frames []StackFrame `json:"frames"`
+	// CreatedBy is the frame of the go statement which created the goroutine, nil for the main goroutine.
+	CreatedBy *StackFrame `json:"createdBy,omitempty"`
+}
+
+// StackFrame is a function call of a goroutine stack trace.
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// allStacks returns the stack traces of all the goroutines, truncated to MaxStackBufferSize.
+func allStacks() []byte {
+	buf := make([]byte, InitialStackBufferSize)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= MaxStackBufferSize {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// parseStacks parses the stack traces written by runtime.Stack. The lines not matching the format, such as the
+// elided frames, are skipped.
+func parseStacks(stacks string) []GoroutineDump {
+	var dumps []GoroutineDump
+	for _, block := range strings.Split(strings.TrimSpace(stacks), "\n\n") {
+		lines := strings.Split(block, "\n")
+		m := goroutineHeaderRegex.FindStringSubmatch(lines[0])
+		if m == nil {
+			continue
+		}
+		id, _ := strconv.Atoi(m[1])
+		dump := GoroutineDump{ID: id, State: m[2], Frames: []StackFrame{}}
+		for i := 1; i+1 < len(lines); i++ {
+			location, ok := strings.CutPrefix(lines[i+1], "\t")
+			if !ok {
+				continue
+			}
+			frame := StackFrame{Function: lines[i]}
+			// The location is `file:line`, followed by the offset of the program counter, if any.
+			location, _, _ = strings.Cut(location, " ")
+			if sep := strings.LastIndex(location, ":"); sep >= 0 {
+				frame.File = location[:sep]
+				frame.Line, _ = strconv.Atoi(location[sep+1:])
+			}
+			if creator, ok := strings.CutPrefix(frame.Function, "created by "); ok {
+				// The creating goroutine follows the function, e.g. `created by main.main in goroutine 1`.
+				frame.Function, _, _ = strings.Cut(creator, " in goroutine ")
+				dump.CreatedBy = &frame
+			} else {
+				frame.Function = strings.TrimSuffix(frame.Function, frameArgs(frame.Function))
+				dump.Frames = append(dump.Frames, frame)
+			}
+			i++
+		}
+		dumps = append(dumps, dump)
+	}
+	return dumps
+}
+
+// frameArgs returns the arguments of the function of a frame, e.g. `(0xc000010000, 0x1)` for `main.f(0xc000010000, 0x1)`.
+func frameArgs(function string) string {
+	if !strings.HasSuffix(function, ")") {
+		return ""
+	}
+	if i := strings.LastIndex(function, "("); i > 0 {
+		return function[i:]
+	}
+	return ""
+}
+
+// goroutineDumpHandler handles the admin only GET requests to `/admin/goroutine-dump` endpoint, returning the stack
+// traces of all the goroutines as text, by default, or parsed as JSON with `?format=json`.
+func (s *Server) goroutineDumpHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "text" && format != "json" {
+		http.Error(w, "The `format` must be 'text' or 'json'!", http.StatusBadRequest)
+		return
+	}
+	stacks := allStacks()
+	log.Println("Goroutine dump requested, goroutines: ", runtime.NumGoroutine())
+	if format == "json" {
+		writeJSON(w, parseStacks(string(stacks)))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(stacks)
+}
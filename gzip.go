@@ -0,0 +1,40 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// gzipBody is the decompressed body of a gzip encoded request, closing the original body along with the reader.
+type gzipBody struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+// Close closes the gzip reader and the original body.
+func (b *gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// decompressBody replaces the body of a request with `Content-Encoding: gzip` by its decompressed content, so that
+// the handlers read it transparently, their body size limits applying to the decompressed content.
+// It writes a 400 response and returns false if the body is not gzip compressed.
+func decompressBody(w http.ResponseWriter, r *http.Request) bool {
+	if !strings.EqualFold(strings.TrimSpace(r.Header.Get("Content-Encoding")), "gzip") {
+		return true
+	}
+	zr, err := gzip.NewReader(r.Body)
+	if err != nil {
+		http.Error(w, "Invalid gzip request body!", http.StatusBadRequest)
+		log.Println("Rejecting the request as its gzip body is invalid: ", err)
+		return false
+	}
+	r.Body = &gzipBody{Reader: zr, body: r.Body}
+	r.Header.Del("Content-Encoding")
+	r.ContentLength = -1
+	return true
+}
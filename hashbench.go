@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// MaxHashBenchmarkBodySize is the maximum size of the body of a `/hash/{id}/benchmark` request.
+const MaxHashBenchmarkBodySize = 1 << 12
+
+// Default and maximum numbers of verifications timed by a `/hash/{id}/benchmark` request.
+const (
+	DefaultHashBenchmarkIterations = 1
+	MaxHashBenchmarkIterations     = 100
+)
+
+// HashBenchmarkRequest defines request structure for '/hash/{id}/benchmark' endpoint.
+type HashBenchmarkRequest struct {
+	Password string `json:"password"`
+	// Iterations is DefaultHashBenchmarkIterations when omitted.
+	Iterations int `json:"iterations"`
+}
+
+// HashBenchmarkResponse defines response structure for '/hash/{id}/benchmark' endpoint.
+type HashBenchmarkResponse struct {
+	Iterations int    `json:"iterations"`
+	TotalUs    int64  `json:"totalUs"`
+	AverageUs  int64  `json:"averageUs"`
+	Algorithm  string `json:"algorithm"`
+}
+
+// hashBenchmarkHandler handles the admin only POST requests to `/hash/{id}/benchmark` endpoint.
+// The password is verified against the latest hash `iterations` times, measuring the verification latency of the
+// hash with its own cost parameters. The verifications are not rate limited.
+func (s *Server) hashBenchmarkHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.cfg.AllowBenchmark {
+		http.Error(w, "Hash benchmarks are disabled!", http.StatusForbidden)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	req := &HashBenchmarkRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxHashBenchmarkBodySize)).Decode(req); err != nil || req.Password == "" {
+		http.Error(w, "The `password` must be given!", http.StatusBadRequest)
+		return
+	}
+	if req.Iterations == 0 {
+		req.Iterations = DefaultHashBenchmarkIterations
+	}
+	if req.Iterations < 1 || req.Iterations > MaxHashBenchmarkIterations {
+		http.Error(w, fmt.Sprintf("The `iterations` must be between 1 and %d!", MaxHashBenchmarkIterations), http.StatusBadRequest)
+		return
+	}
+	// Any algorithm is accepted.
+	res := s.send(r.Context(), Command{requestType: CompareAlgorithmCommand, id: hashId})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	current := &HashVersion{}
+	if !decodeResult(w, res, current) {
+		return
+	}
+	password, ok := s.pepper.ApplyVersion(s.normalizer.String(req.Password), current.PepperVersion)
+	if !ok {
+		log.Printf("Cannot verify the hash for id %d: pepper version %d is not in the keyring", hashId, current.PepperVersion)
+		writeInternalError(w)
+		return
+	}
+	s.audit.Record("benchmark-hash", r, map[string]int{"id": hashId, "iterations": req.Iterations})
+
+	matched := true
+	start := time.Now()
+	for range req.Iterations {
+		matched = verifyHash(password, current.Algorithm, current.Encoding, current.Hash) && matched
+	}
+	total := time.Since(start).Microseconds()
+	if !matched {
+		writeStoreError(w, ErrPasswordMismatch)
+		return
+	}
+	writeJSON(w, &HashBenchmarkResponse{Iterations: req.Iterations, TotalUs: total, AverageUs: total / int64(req.Iterations), Algorithm: current.Algorithm})
+}
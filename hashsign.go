@@ -0,0 +1,134 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HashSigner signs the stored hashes with an ED25519 key, so that they can be verified without the server.
+// A nil HashSigner signs nothing.
+type HashSigner struct {
+	// KeyID is the name of the key file, without its `.pem` extension.
+	KeyID string
+	key   ed25519.PrivateKey
+}
+
+// SignedHashResponse defines response structure for '/hash/{id}/signed' endpoint. The signature is the ED25519
+// signature of hashSigningMessage, base64 encoded.
+type SignedHashResponse struct {
+	ID          int       `json:"id"`
+	Algorithm   string    `json:"algorithm"`
+	Hash        string    `json:"hash"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Signature   []byte    `json:"signature"`
+	PublicKeyID string    `json:"publicKeyId"`
+}
+
+// LoadHashSigner reads the PKCS #8 ED25519 private key of the PEM file. No key is loaded when path is empty.
+func LoadHashSigner(path string) (*HashSigner, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("no PKCS #8 private key found")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("only ED25519 keys are supported")
+	}
+	return &HashSigner{KeyID: strings.TrimSuffix(filepath.Base(path), ".pem"), key: key}, nil
+}
+
+// hashSigningMessage returns the message signed for the latest hash of the record stored under the id:
+// `{id}|{algorithm}|{hash}|{createdAt}`, createdAt being formatted as RFC 3339 with nanoseconds, in UTC.
+func hashSigningMessage(id int, rec *HashRecord) []byte {
+	return []byte(strconv.Itoa(id) + "|" + rec.Algorithm + "|" + rec.Hash + "|" + rec.CreatedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// Sign sets the signature of the latest hash of the record stored under the id. It must be called again whenever
+// the hash or the id of the record change.
+func (hs *HashSigner) Sign(id int, rec *HashRecord) {
+	if hs == nil || rec.AwaitingResubmit {
+		return
+	}
+	rec.Signature = ed25519.Sign(hs.key, hashSigningMessage(id, rec))
+	rec.PublicKeyID = hs.KeyID
+}
+
+// PublicKeyPEM returns the PEM encoded public key of the signer.
+func (hs *HashSigner) PublicKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(hs.key.Public())
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// signedHashHandler handles the GET requests to `/hash/{id}/signed` endpoint.
+func (s *Server) signedHashHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetSignedHashCommand, id: hashId})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// publicKeyHandler handles the admin only GET requests to `/admin/public-key/{keyId}` endpoint, returning the PEM
+// encoded public key verifying the signatures of `/hash/{id}/signed`.
+func (s *Server) publicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	keyID := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	if s.hashSigner == nil || keyID != s.hashSigner.KeyID {
+		http.Error(w, "Unknown signing key!", http.StatusNotFound)
+		return
+	}
+	publicKey, err := s.hashSigner.PublicKeyPEM()
+	if err != nil {
+		log.Println("Cannot encode the public key: ", err)
+		writeInternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	w.Write(publicKey)
+}
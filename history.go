@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// StatsHistorySize is the number of minutes returned by `/stats/history` endpoint.
+const StatsHistorySize = 60
+
+// MinuteStats defines the entries of the '/stats/history' response, the stats of the hashes stored during a minute.
+type MinuteStats struct {
+	Minute    time.Time `json:"minute"`
+	Total     int       `json:"total"`
+	AverageUs float64   `json:"average"`
+}
+
+// StatsHistory is the circular buffer of the stats of the last StatsHistorySize minutes.
+// It is only used by the store goroutine.
+type StatsHistory struct {
+	entries [StatsHistorySize]MinuteStats
+	// next is the index the next entry is written at, and n the number of entries.
+	next, n int
+}
+
+// Add appends the stats of a minute, replacing the oldest ones once the buffer is full.
+func (h *StatsHistory) Add(m MinuteStats) {
+	h.entries[h.next] = m
+	h.next = (h.next + 1) % StatsHistorySize
+	h.n = min(h.n+1, StatsHistorySize)
+}
+
+// Entries returns the stats of the minutes, oldest first.
+func (h *StatsHistory) Entries() []MinuteStats {
+	entries := make([]MinuteStats, 0, h.n)
+	for i := h.next - h.n; i < h.next; i++ {
+		entries = append(entries, h.entries[(i+StatsHistorySize)%StatsHistorySize])
+	}
+	return entries
+}
+
+// startStatsHistory creates a goroutine making the store goroutine record its stats at the start of every minute.
+func startStatsHistory(inboundRequests *CommandQueue, pending *PendingCommands) {
+	go func() {
+		time.Sleep(time.Until(time.Now().Truncate(time.Minute).Add(time.Minute)))
+		pending.Send(inboundRequests, Command{requestType: TickCommand, before: time.Now().Truncate(time.Minute)})
+		for t := range time.Tick(time.Minute) {
+			pending.Send(inboundRequests, Command{requestType: TickCommand, before: t.Truncate(time.Minute)})
+		}
+	}()
+}
+
+// statsHistoryHandler handles the GET requests to `/stats/history` endpoint.
+func (s *Server) statsHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetStatsHistoryCommand})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// MaxHMACKeySize is the maximum size in bytes of the keys accepted by `/hash/{id}/hmac` endpoint.
+const MaxHMACKeySize = 64
+
+// hmacHandler handles the GET requests to `/hash/{id}/hmac?key={hex key}` endpoint.
+// The HMAC-SHA256 of the latest hash value is returned in hex, proving the value to a holder of the key without
+// disclosing it.
+func (s *Server) hmacHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	key, err := hex.DecodeString(r.URL.Query().Get("key"))
+	if err != nil || len(key) == 0 || len(key) > MaxHMACKeySize {
+		http.Error(w, fmt.Sprintf("The `key` must be given in hex, of at most %d bytes!", MaxHMACKeySize), http.StatusBadRequest)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetHashCommand, id: hashId})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(res.value))
+	fmt.Fprintf(w, "%s\n", hex.EncodeToString(mac.Sum(nil)))
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// HourBucket defines the entries of the '/stats/hourly' response, the stats of the hashes stored during an hour of
+// the day, in UTC, whatever the day.
+type HourBucket struct {
+	Hour      int     `json:"hour"`
+	Total     int     `json:"total"`
+	AverageUs float64 `json:"averageUs"`
+}
+
+// HourlyStats accumulates the stats of the hashes by hour of the day, since the stats were last reset.
+// It is only used by the store goroutine.
+type HourlyStats struct {
+	totals [24]int
+	// timesUs are the sums of the processing times of each hour, in microseconds.
+	timesUs [24]int64
+}
+
+// Add records a hash stored at t, processed in elapsedUs microseconds.
+func (h *HourlyStats) Add(t time.Time, elapsedUs int64) {
+	hour := t.UTC().Hour()
+	h.totals[hour]++
+	h.timesUs[hour] += elapsedUs
+}
+
+// Buckets returns the stats of the 24 hours, from midnight.
+func (h *HourlyStats) Buckets() []HourBucket {
+	buckets := make([]HourBucket, 24)
+	for hour := range buckets {
+		buckets[hour] = HourBucket{Hour: hour, Total: h.totals[hour]}
+		if h.totals[hour] > 0 {
+			buckets[hour].AverageUs = float64(h.timesUs[hour]) / float64(h.totals[hour])
+		}
+	}
+	return buckets
+}
+
+// hourlyStatsHandler handles the GET requests to `/stats/hourly` endpoint.
+func (s *Server) hourlyStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetHourlyStatsCommand})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
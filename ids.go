@@ -0,0 +1,95 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// IDCounter issues the hash ids, and tracks the ones whose hash has not been stored yet.
+// It is shared by the handlers, which issue ids without a round-trip to the store goroutine, and the store.
+type IDCounter struct {
+	// last is the last id issued, also the total number of '/hash' requests received by the server.
+	last atomic.Int64
+	// pending holds the time each pending id was issued at.
+	pending sync.Map
+}
+
+// Next issues a new id, pending until Done is called.
+func (c *IDCounter) Next() int {
+	id := int(c.last.Add(1))
+	c.pending.Store(id, time.Now())
+	return id
+}
+
+// Last returns the last id issued.
+func (c *IDCounter) Last() int {
+	return int(c.last.Load())
+}
+
+// Raise makes sure the ids up to n are never issued.
+func (c *IDCounter) Raise(n int) {
+	for {
+		last := c.last.Load()
+		if last >= int64(n) || c.last.CompareAndSwap(last, int64(n)) {
+			return
+		}
+	}
+}
+
+// Reserve marks the id as pending, making sure that it and the ids before it are never issued.
+func (c *IDCounter) Reserve(id int) {
+	c.Raise(id)
+	c.pending.Store(id, time.Now())
+}
+
+// Reset sets the last id to n, unless ids have been issued since last was read.
+func (c *IDCounter) Reset(last, n int) bool {
+	return c.last.CompareAndSwap(int64(last), int64(n))
+}
+
+// Done marks the hash of the id as stored.
+func (c *IDCounter) Done(id int) {
+	c.pending.Delete(id)
+}
+
+// IsPending reports whether the hash of the id is being processed.
+func (c *IDCounter) IsPending(id int) bool {
+	_, ok := c.pending.Load(id)
+	return ok
+}
+
+// PurgePending marks the ids pending since before t as done, and returns them in increasing order.
+func (c *IDCounter) PurgePending(t time.Time) []int {
+	purged := []int{}
+	c.pending.Range(func(id, since any) bool {
+		if since.(time.Time).Before(t) {
+			c.pending.Delete(id)
+			purged = append(purged, id.(int))
+		}
+		return true
+	})
+	sort.Ints(purged)
+	return purged
+}
+
+// HasPending reports whether any hash is being processed.
+func (c *IDCounter) HasPending() bool {
+	pending := false
+	c.pending.Range(func(any, any) bool {
+		pending = true
+		return false
+	})
+	return pending
+}
+
+// PendingCount returns the number of hashes being processed.
+func (c *IDCounter) PendingCount() int {
+	n := 0
+	c.pending.Range(func(any, any) bool {
+		n++
+		return true
+	})
+	return n
+}
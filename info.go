@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// HashInfo defines response structure for '/hash/{id}/info' endpoint: the metadata of a hash, without the hash itself.
+type HashInfo struct {
+	ID        int    `json:"id"`
+	Algorithm string `json:"algorithm"`
+	Encoding  string `json:"encoding"`
+	Namespace string `json:"namespace"`
+	// Tags are sorted and deduplicated labels.
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"createdAt"`
+	// CreatedBy is the identity of the mutual TLS client which created the hash, empty when unknown.
+	CreatedBy    string    `json:"createdBy"`
+	VersionCount int       `json:"versionCount"`
+	AccessCount  int       `json:"accessCount"`
+	LastAccessed time.Time `json:"lastAccessed"`
+	// AwaitingResubmit is set for a copy of another hash whose password has not been submitted yet.
+	AwaitingResubmit bool `json:"awaitingResubmit,omitempty"`
+	// ExpiresAt is when the hash is purged, omitted for a permanent hash.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+// infoHandler handles the GET requests to `/hash/{id}/info` endpoint.
+func (s *Server) infoHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetHashInfoCommand, id: hashId})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
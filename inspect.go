@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// InspectResponse defines response structure for '/admin/inspect/{id}' endpoint: the full state of a hash record,
+// including the hash itself, for debugging.
+type InspectResponse struct {
+	ID int `json:"id"`
+	// Pending is set while a hash is being computed for the id, and Failed if its computation failed.
+	Pending bool `json:"pending"`
+	Failed  bool `json:"failed"`
+	// HashRecord is nil until the first hash of the id is stored.
+	*HashRecord
+}
+
+// inspectHandler handles the admin only GET requests to `/admin/inspect/{id}` endpoint.
+// Every inspection is audited, as the hash is disclosed.
+func (s *Server) inspectHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	hashId, err := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	s.audit.Record("inspect", r, map[string]int{"id": hashId})
+	res := s.send(r.Context(), Command{requestType: InspectHashCommand, id: hashId})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	b64 "encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SigningKey is a private key of the Keystore, along with its certificate if any.
+type SigningKey struct {
+	Signer crypto.Signer
+	// Certificate is the PEM encoded certificate of the key, or empty.
+	Certificate string
+}
+
+// Keystore holds the keys signing the hashes, by id. A nil Keystore holds no key.
+type Keystore struct {
+	keys map[string]*SigningKey
+}
+
+// SignatureResponse defines response structure for '/hash/{id}/sign' endpoint.
+type SignatureResponse struct {
+	ID    int    `json:"id"`
+	KeyID string `json:"keyId"`
+	// Algorithm is the signature algorithm: `RSA-PKCS1v15-SHA256` or `ECDSA-SHA256`.
+	Algorithm string `json:"algorithm"`
+	// Signature is the base64 encoded signature of the SHA-256 digest of the hash value.
+	Signature string `json:"signature"`
+	// PublicKey and Certificate are PEM encoded. The certificate is only given if the keystore holds one.
+	PublicKey   string `json:"publicKey"`
+	Certificate string `json:"certificate,omitempty"`
+}
+
+// LoadKeystore reads the keys from the `{keyId}.pem` files of dir, each holding an RSA or ECDSA private key
+// and possibly its certificate. No key is loaded when dir is empty.
+func LoadKeystore(dir string) (*Keystore, error) {
+	ks := &Keystore{keys: make(map[string]*SigningKey)}
+	if dir == "" {
+		return ks, nil
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		key, err := readSigningKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		ks.keys[strings.TrimSuffix(filepath.Base(file), ".pem")] = key
+	}
+	return ks, nil
+}
+
+// readSigningKey reads the private key and the certificate of a PEM file.
+func readSigningKey(file string) (*SigningKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	key := &SigningKey{}
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "CERTIFICATE":
+			key.Certificate = string(pem.EncodeToMemory(block))
+		case "RSA PRIVATE KEY":
+			key.Signer, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			key.Signer, err = x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			var k any
+			if k, err = x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+				switch k := k.(type) {
+				case *rsa.PrivateKey:
+					key.Signer = k
+				case *ecdsa.PrivateKey:
+					key.Signer = k
+				default:
+					err = errors.New("only RSA and ECDSA keys are supported")
+				}
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if key.Signer == nil {
+		return nil, errors.New("no private key found")
+	}
+	return key, nil
+}
+
+// Key returns the key with the id, or nil if there is none.
+func (ks *Keystore) Key(id string) *SigningKey {
+	if ks == nil {
+		return nil
+	}
+	return ks.keys[id]
+}
+
+// Sign signs the SHA-256 digest of the value, and returns the signature along with its algorithm.
+func (k *SigningKey) Sign(value string) ([]byte, string, error) {
+	digest := sha256.Sum256([]byte(value))
+	algorithm := "RSA-PKCS1v15-SHA256"
+	if _, ok := k.Signer.(*ecdsa.PrivateKey); ok {
+		algorithm = "ECDSA-SHA256"
+	}
+	signature, err := k.Signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+	return signature, algorithm, err
+}
+
+// signHandler handles the GET requests to `/hash/{id}/sign?keyId={keyId}` endpoint.
+// The latest hash value is signed with the key of the keystore, and the signature returned with the public key.
+func (s *Server) signHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	keyID := r.URL.Query().Get("keyId")
+	key := s.keystore.Key(keyID)
+	if key == nil {
+		http.Error(w, "Unknown signing key!", http.StatusNotFound)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetHashCommand, id: hashId})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	signature, algorithm, err := key.Sign(res.value)
+	if err != nil {
+		log.Printf("Cannot sign the hash for id %d: %v", hashId, err)
+		writeInternalError(w)
+		return
+	}
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Signer.Public())
+	if err != nil {
+		log.Println("Cannot encode the public key: ", err)
+		writeInternalError(w)
+		return
+	}
+	writeJSON(w, &SignatureResponse{
+		ID:          hashId,
+		KeyID:       keyID,
+		Algorithm:   algorithm,
+		Signature:   b64.StdEncoding.EncodeToString(signature),
+		PublicKey:   string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicKey})),
+		Certificate: key.Certificate,
+	})
+}
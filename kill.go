@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// hashComputation is a hash being computed in the background for an id, until it is stored or cancelled.
+type hashComputation struct {
+	cancel context.CancelFunc
+}
+
+// HashComputations holds the hashes being computed in the background, by id, so that they can be cancelled.
+// Safe for concurrent use.
+type HashComputations struct {
+	mu      sync.Mutex
+	running map[int]*hashComputation
+}
+
+// Start registers the computation of the hash of the id, and returns its context, done once it is cancelled.
+func (h *HashComputations) Start(id int) (context.Context, *hashComputation) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &hashComputation{cancel: cancel}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.running == nil {
+		h.running = make(map[int]*hashComputation)
+	}
+	h.running[id] = c
+	return ctx, c
+}
+
+// Finish unregisters the computation of the hash of the id, and returns false if it has been cancelled meanwhile.
+func (h *HashComputations) Finish(id int, c *hashComputation) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c.cancel()
+	if h.running[id] != c {
+		// The computation of another hash for the same id may have been started since; it is left running.
+		return false
+	}
+	delete(h.running, id)
+	return true
+}
+
+// Kill cancels the computation of the hash of the id, and returns false if no hash is being computed for it.
+func (h *HashComputations) Kill(id int) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	c, ok := h.running[id]
+	if ok {
+		c.cancel()
+		delete(h.running, id)
+	}
+	return ok
+}
+
+// killHandler handles the admin only DELETE requests to `/admin/kill/{id}` endpoint.
+// The hash being computed for the id is discarded, the id being marked as failed unless it was re-hashed. The computation is only
+// interrupted while waiting for the preprocessing delay: a hash function cannot be stopped once started, though its
+// result is discarded.
+func (s *Server) killHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	hashId, err := strconv.Atoi(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	if !s.computations.Kill(hashId) {
+		http.Error(w, "No hash is being computed for the id!", http.StatusNotFound)
+		return
+	}
+	s.audit.Record("kill", r, map[string]int{"id": hashId})
+	// The id is released by the store goroutine, so the command must reach it even if the request has timed out.
+	if res := s.send(context.WithoutCancel(r.Context()), Command{requestType: FailHashCommand, id: hashId}); res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Println("Hash computation killed for id: ", hashId)
+	fmt.Fprintf(w, "Hash computation killed for id: %d\n", hashId)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// Default and maximum lifetimes of the links created by `/hash/{id}/link` endpoint.
+const (
+	DefaultLinkTTL = time.Hour
+	MaxLinkTTL     = 7 * 24 * time.Hour
+)
+
+// LinkResponse defines response structure for '/hash/{id}/link' endpoint.
+type LinkResponse struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// linkSignature returns the hex HMAC-SHA256 of the id and expiry time of a share link, keyed by the
+// `--link-signing-key`. The id and expiry are separated so that no other pair shares their signature.
+func linkSignature(key string, id int, exp int64) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	fmt.Fprintf(mac, "%d:%d", id, exp)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// linkHandler handles the GET requests to `/hash/{id}/link?ttl=3600` endpoint.
+// It returns a tamper-evident link to the hash, `/hash/{id}?sig={signature}&exp={unix time}`, valid for ttl seconds.
+func (s *Server) linkHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if s.cfg.LinkSigningKey == "" {
+		http.Error(w, "Share links are disabled!", http.StatusNotImplemented)
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	ttl := DefaultLinkTTL
+	if v := r.URL.Query().Get("ttl"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if ttl = time.Duration(secs) * time.Second; err != nil || ttl <= 0 || ttl > MaxLinkTTL {
+			http.Error(w, fmt.Sprintf("The `ttl` must be between 1 and %d seconds!", int(MaxLinkTTL.Seconds())), http.StatusBadRequest)
+			return
+		}
+	}
+	// The link is only created for an existing hash, though it may be deleted before the link is used.
+	if res := s.send(r.Context(), Command{requestType: GetHashInfoCommand, id: hashId}); res.err != nil && !errors.Is(res.err, ErrHashPending) {
+		writeStoreError(w, res.err)
+		return
+	}
+	expiresAt := time.Now().Add(ttl).Truncate(time.Second)
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	query := url.Values{"sig": {linkSignature(s.cfg.LinkSigningKey, hashId, expiresAt.Unix())}, "exp": {strconv.FormatInt(expiresAt.Unix(), 10)}}
+	link := url.URL{Scheme: scheme, Host: r.Host, Path: fmt.Sprintf("%s/hash/%d", APIPrefix, hashId), RawQuery: query.Encode()}
+	log.Printf("Share link created for id %d, expiring at %s", hashId, expiresAt)
+	writeJSON(w, &LinkResponse{URL: link.String(), ExpiresAt: expiresAt.UTC()})
+}
+
+// checkLink writes a 403 response and returns false if the request of `/hash/{id}` endpoint has the `sig` or `exp`
+// parameters of a share link, and the link is expired or its signature invalid.
+func (s *Server) checkLink(w http.ResponseWriter, r *http.Request, hashId int) bool {
+	query := r.URL.Query()
+	if !query.Has("sig") && !query.Has("exp") {
+		return true
+	}
+	exp, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	valid := err == nil && s.cfg.LinkSigningKey != "" && time.Now().Unix() <= exp &&
+		hmac.Equal([]byte(query.Get("sig")), []byte(linkSignature(s.cfg.LinkSigningKey, hashId, exp)))
+	if !valid {
+		http.Error(w, "Invalid or expired share link!", http.StatusForbidden)
+		log.Println("Rejecting the request as its share link is invalid or expired for id: ", hashId)
+	}
+	return valid
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Limits of the load test parameters.
+const (
+	MaxLoadTestRate     = 10000
+	MaxLoadTestDuration = 600
+	MaxPasswordLength   = 1024
+	MaxLoadTestBodySize = 1 << 10
+)
+
+// LoadTestProgressInterval is how often the intermediate stats of a load test are streamed.
+const LoadTestProgressInterval = 1 * time.Second
+
+// passwordChars are the characters of the generated passwords.
+const passwordChars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// LoadTestRequest defines request structure for '/admin/load-test' endpoint.
+type LoadTestRequest struct {
+	RequestsPerSecond int    `json:"requestsPerSecond"`
+	DurationSeconds   int    `json:"durationSeconds"`
+	Algorithm         string `json:"algorithm"`
+	PasswordLength    int    `json:"passwordLength"`
+}
+
+// LoadTestStats are the stats streamed by '/admin/load-test' endpoint.
+type LoadTestStats struct {
+	Requests int64 `json:"requests"`
+	Errors   int64 `json:"errors"`
+	// Throughput is the number of requests per second, and ErrorRate the ratio of failed requests.
+	Throughput float64 `json:"throughput"`
+	ErrorRate  float64 `json:"errorRate"`
+	ElapsedMs  int64   `json:"elapsedMs"`
+}
+
+// loadTestWriter is the response writer of the generated requests; only the status is kept.
+type loadTestWriter struct {
+	header http.Header
+	status int
+}
+
+func (w *loadTestWriter) Header() http.Header         { return w.header }
+func (w *loadTestWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *loadTestWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
+
+// loadTestHandler handles the admin only POST requests to `/admin/load-test` endpoint.
+// Random passwords are posted to the `/hash` handler at the requested rate, and the stats are streamed as
+// server-sent events: a `progress` event every second and a final `done` event.
+func (s *Server) loadTestHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.cfg.AllowLoadTest {
+		http.Error(w, "Load tests are disabled!", http.StatusForbidden)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	req := &LoadTestRequest{Algorithm: DefaultAlgorithm, PasswordLength: 12}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxLoadTestBodySize)).Decode(req); err != nil {
+		http.Error(w, "Invalid load test request!", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case req.RequestsPerSecond < 1 || req.RequestsPerSecond > MaxLoadTestRate:
+		http.Error(w, fmt.Sprintf("`requestsPerSecond` must be between 1 and %d!", MaxLoadTestRate), http.StatusBadRequest)
+		return
+	case req.DurationSeconds < 1 || req.DurationSeconds > MaxLoadTestDuration:
+		http.Error(w, fmt.Sprintf("`durationSeconds` must be between 1 and %d!", MaxLoadTestDuration), http.StatusBadRequest)
+		return
+	case req.PasswordLength < 1 || req.PasswordLength > MaxPasswordLength:
+		http.Error(w, fmt.Sprintf("`passwordLength` must be between 1 and %d!", MaxPasswordLength), http.StatusBadRequest)
+		return
+	}
+	if _, ok := hashAlgorithms[req.Algorithm]; !ok {
+		http.Error(w, "Unsupported hash algorithm!", http.StatusBadRequest)
+		return
+	}
+	s.audit.Record("load-test", r, req)
+	log.Println("Starting load test: ", req.RequestsPerSecond, " requests per second for ", req.DurationSeconds, " seconds")
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	flusher, _ := w.(http.Flusher)
+	var requests, failures atomic.Int64
+	start := time.Now()
+	writeStats := func(event string) {
+		elapsed := time.Since(start)
+		stats := &LoadTestStats{Requests: requests.Load(), Errors: failures.Load(), ElapsedMs: elapsed.Milliseconds()}
+		stats.Throughput = float64(stats.Requests) / elapsed.Seconds()
+		if stats.Requests > 0 {
+			stats.ErrorRate = float64(stats.Errors) / float64(stats.Requests)
+		}
+		sJson, _ := safeMarshal(stats)
+		fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, sJson)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	var wg sync.WaitGroup
+	rate := time.NewTicker(time.Second / time.Duration(req.RequestsPerSecond))
+	defer rate.Stop()
+	progress := time.NewTicker(LoadTestProgressInterval)
+	defer progress.Stop()
+	end := time.After(time.Duration(req.DurationSeconds) * time.Second)
+loop:
+	for {
+		select {
+		case <-rate.C:
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if status := s.postRandomHash(req); status >= http.StatusBadRequest {
+					failures.Add(1)
+				}
+				requests.Add(1)
+			}()
+		case <-progress.C:
+			writeStats("progress")
+		case <-end:
+			break loop
+		case <-r.Context().Done():
+			break loop
+		}
+	}
+	wg.Wait()
+	writeStats("done")
+	log.Println("Load test done: ", requests.Load(), " requests, ", failures.Load(), " errors")
+}
+
+// postRandomHash posts a random password to the `/hash` handler, and returns the response status.
+func (s *Server) postRandomHash(req *LoadTestRequest) int {
+	password, err := randomPassword(req.PasswordLength, passwordChars)
+	if err != nil {
+		return http.StatusInternalServerError
+	}
+	form := url.Values{"password": {password}, "algorithm": {req.Algorithm}}
+	r, _ := http.NewRequest(http.MethodPost, APIPrefix+"/hash", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := &loadTestWriter{header: http.Header{}}
+	s.setHashHandler(w, r)
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
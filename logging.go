@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"os"
+)
+
+// RequestIDHeader is the header carrying the id of a request, generated by the server when not given by the client.
+const RequestIDHeader = "X-Request-ID"
+
+// logLevel is the minimum level of the messages written by the default logger.
+var logLevel = new(slog.LevelVar)
+
+// requestIDKey is the context key of the request id.
+type requestIDKey struct{}
+
+// setupLogging makes the default logger, also used by the log package, honor the configured level.
+func setupLogging(cfg *Config) {
+	logLevel.Set(cfg.LogLevel)
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
+}
+
+// newStoreLogger creates the logger of the commands processed by the store goroutine.
+// It is kept apart from the default logger, so that its debug messages are written whatever the `--log-level`.
+func newStoreLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelDebug})).With("logger", "store")
+}
+
+// withRequestID returns the request with its id in its context, and echoes the id in the response header.
+func withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	id := r.Header.Get(RequestIDHeader)
+	if id == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	w.Header().Set(RequestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id))
+}
+
+// requestIDFrom returns the request id held by ctx, or an empty string.
+func requestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
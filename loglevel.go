@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// MaxLogLevelBodySize limits the size of `/admin/set-log-level` request bodies.
+const MaxLogLevelBodySize = 1 << 10
+
+// LogLevelResponse defines request and response structure for '/admin/set-log-level' and '/admin/log-level'
+// endpoints.
+type LogLevelResponse struct {
+	// Level is `debug`, `info`, `warn` or `error`.
+	Level string `json:"level"`
+}
+
+// logLevelResponse returns the current minimum level of the logged messages.
+func logLevelResponse() *LogLevelResponse {
+	return &LogLevelResponse{Level: strings.ToLower(logLevel.Level().String())}
+}
+
+// logLevelHandler handles the admin only GET requests to `/admin/log-level` endpoint.
+func (s *Server) logLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	writeJSON(w, logLevelResponse())
+}
+
+// setLogLevelHandler handles the admin only PUT requests to `/admin/set-log-level` endpoint.
+// The `--log-level` is changed at once for all the messages logged next, without restarting, e.g. to debug an issue.
+func (s *Server) setLogLevelHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	req := &LogLevelResponse{}
+	var level slog.Level
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxLogLevelBodySize)).Decode(req); err != nil || level.UnmarshalText([]byte(req.Level)) != nil {
+		http.Error(w, "The `level` must be debug, info, warn or error!", http.StatusBadRequest)
+		return
+	}
+	previous := logLevel.Level()
+	logLevel.Set(level)
+	s.audit.Record("set-log-level", r, map[string]string{"previous": previous.String(), "level": level.String()})
+	// The change is logged at WARN level at least, so that it is logged whatever the new level.
+	slog.Log(r.Context(), max(slog.LevelWarn, level), "Log level changed", "previous", previous, "level", level)
+	writeJSON(w, logLevelResponse())
+}
@@ -1,16 +1,32 @@
 package main
 
 import (
-	"crypto/sha512"
-	b64 "encoding/base64"
+	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
+	"maps"
+	"math"
+	"mime"
 	"net/http"
 	"os"
 	"regexp"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
+
+	hashserverpb "github.com/KetanA/JC-Golang/proto"
+	"golang.org/x/time/rate"
 )
 
 type CommandType int
@@ -18,81 +34,1594 @@ type CommandType int
 const (
 	GetHashCommand = iota
 	SetHashCommand
-	GetCountCommand
 	GetStatsCommand
+	GetEventsCommand
+	GetEventCountCommand
+	DeleteHashCommand
+	PermanentDeleteHashCommand
+	RestoreHashCommand
+	PurgeTombstonesCommand
+	GetVersionsCommand
+	BulkGetHashCommand
+	BulkDeleteCommand
+	SearchHashesCommand
+	AddTagsCommand
+	RemoveTagCommand
+	ListHashesCommand
+	EraseSubjectCommand
+	ExportSubjectCommand
+	PurgeOldHashesCommand
+	DrainAndPauseCommand
+	RestoreSnapshotCommand
+	RotateWALCommand
+	CompactStoreCommand
+	CompareHashCommand
+	ResetStatsCommand
+	GetAlgorithmCommand
+	TouchHashCommand
+	CloneHashCommand
+	GetRawHashCommand
+	PurgePendingCommand
+	CompareAlgorithmCommand
+	TickCommand
+	GetStatsHistoryCommand
+	ExportMetadataCommand
+	GetHashInfoCommand
+	StoreBatchCommand
+	TopAccessedCommand
+	AlgorithmDistributionCommand
+	GetPreviewCommand
+	CopyHashCommand
+	AnnotateHashCommand
+	GetAnnotationsCommand
+	FailHashCommand
+	GetAlgorithmParametersCommand
+	InspectHashCommand
+	UpdateExpiryCommand
+	PurgeExpiredCommand
+	SubscribeHashCommand
+	WebhookFailedCommand
+	ListFailedWebhooksCommand
+	TakeFailedWebhookCommand
+	GetHourlyStatsCommand
+	MigrateEncodingCommand
+	GetSignedHashCommand
+	FlushCommand
+	PatchMetadataCommand
+	// SwitchChannelCommand is queued by CommandQueue.Resize, and switches the store goroutine to its new channel.
+	SwitchChannelCommand
 )
+
+// commandTypeNames holds the names of the command types, as logged by the store goroutine.
+var commandTypeNames = map[CommandType]string{
+	GetHashCommand:                "GetHashCommand",
+	SetHashCommand:                "SetHashCommand",
+	GetStatsCommand:               "GetStatsCommand",
+	GetEventsCommand:              "GetEventsCommand",
+	GetEventCountCommand:          "GetEventCountCommand",
+	DeleteHashCommand:             "DeleteHashCommand",
+	PermanentDeleteHashCommand:    "PermanentDeleteHashCommand",
+	RestoreHashCommand:            "RestoreHashCommand",
+	PurgeTombstonesCommand:        "PurgeTombstonesCommand",
+	GetVersionsCommand:            "GetVersionsCommand",
+	BulkGetHashCommand:            "BulkGetHashCommand",
+	BulkDeleteCommand:             "BulkDeleteCommand",
+	SearchHashesCommand:           "SearchHashesCommand",
+	AddTagsCommand:                "AddTagsCommand",
+	RemoveTagCommand:              "RemoveTagCommand",
+	ListHashesCommand:             "ListHashesCommand",
+	EraseSubjectCommand:           "EraseSubjectCommand",
+	ExportSubjectCommand:          "ExportSubjectCommand",
+	PurgeOldHashesCommand:         "PurgeOldHashesCommand",
+	DrainAndPauseCommand:          "DrainAndPauseCommand",
+	RestoreSnapshotCommand:        "RestoreSnapshotCommand",
+	RotateWALCommand:              "RotateWALCommand",
+	CompactStoreCommand:           "CompactStoreCommand",
+	CompareHashCommand:            "CompareHashCommand",
+	ResetStatsCommand:             "ResetStatsCommand",
+	GetAlgorithmCommand:           "GetAlgorithmCommand",
+	TouchHashCommand:              "TouchHashCommand",
+	CloneHashCommand:              "CloneHashCommand",
+	GetRawHashCommand:             "GetRawHashCommand",
+	PurgePendingCommand:           "PurgePendingCommand",
+	CompareAlgorithmCommand:       "CompareAlgorithmCommand",
+	TickCommand:                   "TickCommand",
+	GetStatsHistoryCommand:        "GetStatsHistoryCommand",
+	ExportMetadataCommand:         "ExportMetadataCommand",
+	GetHashInfoCommand:            "GetHashInfoCommand",
+	StoreBatchCommand:             "StoreBatchCommand",
+	TopAccessedCommand:            "TopAccessedCommand",
+	AlgorithmDistributionCommand:  "AlgorithmDistributionCommand",
+	GetPreviewCommand:             "GetPreviewCommand",
+	CopyHashCommand:               "CopyHashCommand",
+	AnnotateHashCommand:           "AnnotateHashCommand",
+	GetAnnotationsCommand:         "GetAnnotationsCommand",
+	FailHashCommand:               "FailHashCommand",
+	GetAlgorithmParametersCommand: "GetAlgorithmParametersCommand",
+	InspectHashCommand:            "InspectHashCommand",
+	UpdateExpiryCommand:           "UpdateExpiryCommand",
+	PurgeExpiredCommand:           "PurgeExpiredCommand",
+	SubscribeHashCommand:          "SubscribeHashCommand",
+	WebhookFailedCommand:          "WebhookFailedCommand",
+	ListFailedWebhooksCommand:     "ListFailedWebhooksCommand",
+	TakeFailedWebhookCommand:      "TakeFailedWebhookCommand",
+	GetHourlyStatsCommand:         "GetHourlyStatsCommand",
+	MigrateEncodingCommand:        "MigrateEncodingCommand",
+	GetSignedHashCommand:          "GetSignedHashCommand",
+	FlushCommand:                  "FlushCommand",
+	PatchMetadataCommand:          "PatchMetadataCommand",
+	SwitchChannelCommand:          "SwitchChannelCommand",
+}
+
+// String returns the name of the command type.
+func (t CommandType) String() string {
+	if name, ok := commandTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("CommandType(%d)", int(t))
+}
+
 const (
 	// ChannelCapacity used to define a buffered channel.
 	// This is the number of concurrent, non-blocking requests that server can handle.
 	ChannelCapacity = 200
-	// PreprocessingDelay is the wait time before processing the inbound request.
-	PreprocessingDelay = 5
+	// DefaultHashPreprocessingDelay is the default wait time before processing the inbound request.
+	DefaultHashPreprocessingDelay = 5 * time.Second
+	// DefaultShutdownGraceDelay is the default wait time for pending requests on shutdown.
+	DefaultShutdownGraceDelay = 5 * time.Second
 	// DefaultPort on which the server listens.
 	DefaultPort = ":8080"
+	// APIPrefix is the path prefix of the current API version.
+	APIPrefix = "/v1"
+	// MaxHashBodySize limits the size of JSON encoded `/hash` request bodies.
+	MaxHashBodySize = 1 << 16
+	// MaxMultipartSize limits the size of multipart `/hash` request bodies.
+	MaxMultipartSize = 1 << 20
+	// MemStatsInterval is the minimum time between reads of the memory statistics reported by `/stats`.
+	MemStatsInterval = time.Second
+	// DefaultAlgorithm is the hashing algorithm applied to passwords when none is requested.
+	DefaultAlgorithm = "sha512"
+	// DefaultNamespace is the namespace of hashes created without one.
+	DefaultNamespace = "default"
+	// InvalidHashIDMessage is returned when no hash exists for the requested id.
+	InvalidHashIDMessage = "Invalid hash id!"
+)
+
+var (
+	// ErrHashNotFound is returned by the store when no hash exists for the requested id.
+	ErrHashNotFound = errors.New(InvalidHashIDMessage)
+	// ErrHashDeleted is returned by the store when the hash for the requested id has been deleted.
+	ErrHashDeleted = errors.New("Hash has been deleted!")
+	// ErrHashExpired is returned by the store when the hash for the requested id has expired, until it is purged.
+	ErrHashExpired = errors.New("Hash has expired!")
+	// ErrHashNotDeleted is returned by the store when restoring a hash that has not been deleted.
+	ErrHashNotDeleted = errors.New("Hash has not been deleted!")
+	// ErrVersionNotFound is returned by the store when the requested version of a hash does not exist.
+	ErrVersionNotFound = errors.New("Invalid hash version!")
+	// ErrSubjectNotFound is returned by the store when no hash holds data of the requested subject.
+	ErrSubjectNotFound = errors.New("No data found for the subject!")
+	// ErrWebhookNotFound is returned by the store when no failed webhook delivery has the requested id.
+	ErrWebhookNotFound = errors.New("No failed webhook delivery found for the id!")
+	// ErrHashesPending is returned by the store when compacting it while ids have been issued to hashes not stored yet.
+	ErrHashesPending = errors.New("Hashes are being processed, try again later!")
+	// ErrHashPending is returned by the store when the hash for the requested id has not been stored yet.
+	ErrHashPending = errors.New("Hash is being processed!")
+	// ErrHashMismatch is returned by the store when the current hash is not the one expected by a compare-and-swap.
+	ErrHashMismatch = errors.New("Hash has been modified!")
+	// ErrHashNotSigned is returned by the store when the hash was stored while the hashes were not signed.
+	ErrHashNotSigned = errors.New("Hash is not signed!")
+	// ErrHashNotReversible is returned by the store when the hash is not an encoded digest that can be decoded.
+	ErrHashNotReversible = errors.New("Hash cannot be decoded to binary!")
+	// ErrAlgorithmMismatch is returned by the store when the hash has not been computed with the expected algorithm.
+	ErrAlgorithmMismatch = errors.New("Hash has been computed with another algorithm!")
+	// ErrHashFailed is returned by the store when the hash for the requested id could not be computed, or was killed.
+	ErrHashFailed = errors.New("Hash computation has failed!")
+	// ErrHashAwaitingResubmit is returned by the store when the requested id is a copy awaiting its password.
+	ErrHashAwaitingResubmit = errors.New("Hash is awaiting the submission of its password!")
+	// ErrPasswordMismatch is returned when the password given to update a hash is not the hashed one.
+	ErrPasswordMismatch = errors.New("Password does not match the hash!")
 )
 
 // Command struct holds the request data.
 type Command struct {
-	requestType     CommandType
-	password        string
-	id              int
-	responseChannel chan string
+	requestType CommandType
+	password    string
+	algorithm   string
+	encoding    string
+	namespace   string
+	tags        []string
+	id          int
+	version     int
+	ids         []int
+	filter      *SearchFilter
+	snapshot    *Snapshot
+	walSeq      int64
+	// targetID is the id the hash is copied to by CloneHashCommand.
+	targetID int
+	// expectedHash makes SetHashCommand a compare-and-swap, only applied if it is the current hash.
+	expectedHash string
+	// resume is closed to resume the store goroutine paused by DrainAndPauseCommand.
+	resume <-chan struct{}
+	// includeDeleted makes ExportMetadataCommand export the tombstones too.
+	includeDeleted bool
+	// pepperVersion is the version of the pepper the password of SetHashCommand was hashed with.
+	pepperVersion int
+	// clientIdentity is the identity of the mutual TLS client the command is sent for, if any.
+	clientIdentity string
+	// batch holds the SetHashCommands applied at once by StoreBatchCommand.
+	batch []Command
+	// previewChars are the numbers of characters shown at the start and end of the hash by GetPreviewCommand.
+	previewChars [2]int
+	// annotation is the key and value of the annotation set by AnnotateHashCommand.
+	annotation [2]string
+	// expiresAt is the expiry set by UpdateExpiryCommand, nil to make the hash permanent.
+	expiresAt *time.Time
+	// subscription is the webhook subscribed by SubscribeHashCommand.
+	subscription *WebhookSubscription
+	// failedWebhook is the delivery recorded by WebhookFailedCommand, or filled by TakeFailedWebhookCommand with the
+	// delivery of its id.
+	failedWebhook *FailedWebhook
+	// migration is the progress of the re-encoding updated by each batch of MigrateEncodingCommand.
+	migration *EncodingMigration
+	// metadataPatch is the update of the metadata applied by PatchMetadataCommand.
+	metadataPatch *MetadataPatch
+	// channel is the new channel of SwitchChannelCommand.
+	channel chan Command
+	// requestID identifies the HTTP request the command is sent for, if any.
+	requestID string
+	// responseChannel receives the result of the command. It is buffered, so that the store goroutine can answer the
+	// command which panicked without blocking, in case it was answered before.
+	responseChannel chan Result
 	requestStartTs  int64
+	eventID         int64
+	before          time.Time
+}
+
+// Result struct holds the response of the store goroutine to a Command.
+type Result struct {
+	value string
+	err   error
+	// deprecated is set by GetHashCommand when the hash was computed with one of the deprecated algorithms.
+	deprecated bool
+}
+
+// HashRecord is an entry of the password store.
+type HashRecord struct {
+	// Hash, Algorithm and Encoding are those of the latest version.
+	Hash      string `json:"hash"`
+	Algorithm string `json:"algorithm"`
+	// Encoding is empty for the hashes stored before encodings could be chosen, having the default one of the algorithm.
+	Encoding string `json:"encoding,omitempty"`
+	// PepperVersion is the version of the pepper the latest version was hashed with, 0 for none.
+	PepperVersion int `json:"pepperVersion,omitempty"`
+	// Namespace groups the hashes of a tenant.
+	Namespace string `json:"namespace"`
+	// Tags are sorted and deduplicated labels.
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"createdAt"`
+	// CreatedBy is the identity of the mutual TLS client which created the record, empty when unknown.
+	CreatedBy string `json:"createdBy,omitempty"`
+	// Annotations are the application-specific metadata of the record.
+	Annotations map[string]string `json:"annotations,omitempty"`
+	// Versions holds all the hashes computed for this id, oldest first.
+	Versions []HashVersion `json:"versions"`
+	// AccessCount is the number of times the hash has been retrieved, last at LastAccessed.
+	AccessCount  int       `json:"accessCount"`
+	LastAccessed time.Time `json:"lastAccessed"`
+	// AwaitingResubmit marks a copy of another hash whose password has not been submitted yet, having no hash.
+	AwaitingResubmit bool `json:"awaitingResubmit,omitempty"`
+	// ExpiresAt is when the record is purged, nil for a permanent record.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	// Signature is the ED25519 signature of the latest hash by the key PublicKeyID, nil if the hashes were not signed.
+	Signature   []byte `json:"signature,omitempty"`
+	PublicKeyID string `json:"publicKeyId,omitempty"`
+	// Deleted marks a tombstone, kept until it is permanently removed.
+	Deleted   bool       `json:"deleted"`
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+}
+
+// PendingResponse defines response structure for `/hash/{id}` endpoint while the hash is being processed.
+type PendingResponse struct {
+	Status string `json:"status"`
+	// EstimatedReadySecs is the preprocessing delay, the longest wait before the hash is stored.
+	EstimatedReadySecs int `json:"estimatedReadySecs"`
 }
 
 // Server is the shared data structure for HTTP handlers.
 type Server struct {
-	inboundRequests chan<- Command
-	isTerminated    bool
+	// processor processes the commands the handlers wait for, and inboundRequests receives the commands sent
+	// without waiting, by the background goroutines; both feed the password store goroutine.
+	processor       CommandProcessor
+	inboundRequests *CommandQueue
+	ids             *IDCounter
+	isTerminated    atomic.Bool
+	cfg             *Config
+	audit           *AuditLog
+	// metrics holds the latencies of the requests, by endpoint.
+	metrics LatencyMetrics
+	// pepper is the keyring of the peppers mixed into the passwords before they are hashed.
+	pepper           *Pepper
+	recomputeLimiter *RateLimiter
+	// keystore holds the keys signing the hashes.
+	keystore *Keystore
+	// hashSigner signs the stored hashes, if enabled.
+	hashSigner *HashSigner
+	// algorithmLimiters limit the rate of the passwords hashed, by algorithm.
+	algorithmLimiters map[string]*rate.Limiter
+	// httpServer is shut down by the shutdown method, closing done once the pending requests are processed.
+	httpServer *http.Server
+	// adminServer serves the admin endpoints on `--admin-port`, nil when they are served by httpServer.
+	adminServer *http.Server
+	done        chan struct{}
+	// isPaused is set while the store goroutine is paused by DrainAndPauseCommand.
+	isPaused atomic.Bool
+	// isShuttingDown is set once the shutdown begins, before the requests are rejected by isTerminated.
+	isShuttingDown atomic.Bool
+	// isDraining is set by `/admin/drain` endpoint, rejecting the new hashes until `/admin/undrain` is called.
+	isDraining atomic.Bool
+	// cache holds the hashes recently returned by the store, which it keeps up to date.
+	cache *HashCache
+	// dedup holds the ids recently issued to the passwords posted to `/hash` endpoint.
+	dedup *DedupCache
+	// computations holds the hashes being computed in the background, which can be killed.
+	computations HashComputations
+	// normalizer normalizes the passwords before they are peppered and hashed.
+	normalizer *PasswordNormalizer
+	// acl holds the CIDRs the clients are allowed or denied access from.
+	acl *ACL
+	// pending counts the commands sent to the store goroutine and not processed yet.
+	pending *PendingCommands
+	// routes holds the handlers of the endpoints, by method and endpoint pattern.
+	routes map[string]map[string]http.HandlerFunc
+	// snapshotMu is held while a snapshot is saved, and while the data of a subject is erased from the store and the
+	// snapshots, so that no snapshot taken before an erasure is written after it.
+	snapshotMu sync.Mutex
 }
 
+// LegacyRoutesSunset is the date after which the unversioned endpoints will be removed.
+var LegacyRoutesSunset = time.Date(2027, time.June, 30, 0, 0, 0, 0, time.UTC)
+
 // Stats defines response structure for '/stats' endpoint.
 type Stats struct {
 	// TotalNum of requests processed bu the server.
 	TotalNum int `json:"total"`
 	// AverageTime in microsecond for processing a request.
 	AverageTime float64 `json:"average"`
+	// MinObservedUs and MaxObservedUs are the shortest and longest times in microsecond for processing a request,
+	// since the stats were last reset. Both are 0 until a request is processed.
+	MinObservedUs int64 `json:"minObservedUs"`
+	MaxObservedUs int64 `json:"maxObservedUs"`
+	// LastPurgeAt is when old hashes were last purged, deleting LastPurgeCount of them.
+	LastPurgeAt    *time.Time `json:"lastPurgeAt,omitempty"`
+	LastPurgeCount int        `json:"lastPurgeCount"`
+	// GoRoutineCount is the number of running goroutines, and the other fields the memory statistics of the
+	// runtime, read at most every MemStatsInterval. GCPauseNs is the duration of the last garbage collection pause.
+	GoRoutineCount int   `json:"goRoutineCount"`
+	HeapAllocBytes int64 `json:"heapAllocBytes"`
+	HeapSysBytes   int64 `json:"heapSysBytes"`
+	GCPauseNs      int64 `json:"gcPauseNs"`
+	// CacheHits and CacheMisses count the lookups of the `/hash/{id}` cache, and CacheHitRatio is the share of hits.
+	CacheHits     int64   `json:"cacheHits"`
+	CacheMisses   int64   `json:"cacheMisses"`
+	CacheHitRatio float64 `json:"cacheHitRatio"`
+}
+
+// NewServer creates a Server backed by a new password store, ready to serve requests with its matchHandlers method.
+// The audit log may be nil.
+func NewServer(cfg *Config, opts StoreOptions, audit *AuditLog) *Server {
+	if opts.IDs == nil {
+		opts.IDs = &IDCounter{}
+	}
+	if opts.Cache == nil {
+		opts.Cache = NewHashCache(cfg.GetCacheSize, cfg.GetCacheTTL)
+	}
+	if opts.Dedup == nil {
+		opts.Dedup = NewDedupCache(cfg.DedupWindow)
+	}
+	if opts.Pending == nil {
+		opts.Pending = NewPendingCommands()
+	}
+	if opts.MaxEvents == 0 {
+		opts.MaxEvents = cfg.MaxEvents
+	}
+	// The normalizer settings are validated by ParseConfig.
+	normalizer, _ := NewPasswordNormalizer(cfg.PasswordNormalizer, cfg.PasswordCase, cfg.PreHashTransforms)
+	algorithmLimiters := make(map[string]*rate.Limiter)
+	for algorithm, rps := range cfg.AlgorithmRateLimits {
+		if rps > 0 {
+			algorithmLimiters[algorithm] = newAlgorithmLimiter(rps)
+		}
+	}
+	s := &Server{
+		ids:               opts.IDs,
+		cache:             opts.Cache,
+		pending:           opts.Pending,
+		hashSigner:        opts.Signer,
+		acl:               NewACL(cfg.AllowCIDRs, cfg.DenyCIDRs),
+		normalizer:        normalizer,
+		dedup:             opts.Dedup,
+		pepper:            &Pepper{},
+		cfg:               cfg,
+		audit:             audit,
+		recomputeLimiter:  NewRateLimiter(RecomputeInterval),
+		done:              make(chan struct{}),
+		algorithmLimiters: algorithmLimiters,
+	}
+	if opts.OnRepeatedPanics == nil {
+		opts.OnRepeatedPanics = func() {
+			if s.isShuttingDown.CompareAndSwap(false, true) {
+				go s.shutdown()
+			}
+		}
+	}
+	s.inboundRequests = CreatePasswordStore(opts)
+	s.processor = &storeProcessor{inboundRequests: s.inboundRequests, pending: s.pending}
+	s.routes = s.newRoutes()
+	return s
+}
+
+// StoreOptions holds the optional collaborators of the password store.
+type StoreOptions struct {
+	// Publisher receives the recorded events.
+	Publisher EventPublisher
+	// IDs issues the hash ids. The handlers issuing ids share it with the store.
+	IDs *IDCounter
+	// WAL logs the changes of the store, the hashes before they are stored.
+	WAL *WAL
+	// Backend is flushed by FlushCommand, the MemoryBackend of WAL when nil.
+	Backend StorageBackend
+	// MaxEvents is the number of events kept by the event log, the oldest ones being dropped. All are kept when zero.
+	MaxEvents int
+	// Snapshot is the initial content of the store, and WALEntries are replayed on top of it.
+	Snapshot   *Snapshot
+	WALEntries []WALEntry
+	// Logger receives a debug message for each command processed by the store. Nothing is logged when nil.
+	Logger *slog.Logger
+	// Cache receives the hashes returned by GetHashCommand, and loses them once modified. Nothing is cached when nil.
+	Cache *HashCache
+	// Dedup forgets the ids whose hashes are deleted, erased or failed, and the ids reissued.
+	Dedup *DedupCache
+	// Pending counts the commands sent and not processed yet. The senders count the commands they send.
+	Pending *PendingCommands
+	// Signer signs the stored hashes. Nothing is signed when nil.
+	Signer *HashSigner
+	// DeprecatedAlgorithms are the algorithms whose hashes are returned by GetHashCommand with a warning. The cache
+	// keeps the algorithm of the hashes so that the cached retrievals are warned about too.
+	DeprecatedAlgorithms []string
+	// OnRepeatedPanics is called when the store goroutine panics more than MaxStorePanics times in StorePanicWindow.
+	OnRepeatedPanics func()
 }
 
 // CreatePasswordStore creates a goroutine that provides an in-memory datastore to store passwords received.
 // It returns a channel which is used to send commands to operate on password store.
-func CreatePasswordStore() chan<- Command {
+func CreatePasswordStore(opts StoreOptions) *CommandQueue {
+	publisher := opts.Publisher
 	// secretStore is in-memory datastore for storing hashed-encoded passwords.
-	secretStore := make(map[int]string)
-	// counter maintains total number of '/hash' requests received by the server.
-	counter := 0
+	secretStore := make(map[int]*HashRecord)
+	// ids issues the hash ids; its last id is the total number of '/hash' requests received by the server.
+	ids := opts.IDs
+	if ids == nil {
+		ids = &IDCounter{}
+	}
+	backend := opts.Backend
+	if backend == nil {
+		backend = &MemoryBackend{WAL: opts.WAL}
+	}
 	// inboundRequests creates a buffered-channel to handle inbound requests to the server.
-	inboundRequests := make(chan Command, ChannelCapacity)
+	inboundRequests := NewCommandQueue(ChannelCapacity)
+	// inbound is the channel the store goroutine reads, until a SwitchChannelCommand replaces it.
+	inbound := inboundRequests.ch
 	var totalTime int64
+	// minTime and maxTime are the extremes of the durations summed in totalTime.
+	var minTime, maxTime int64
+	// statsResetAt is the last id when the stats were last reset; ids keep being issued from there.
+	statsResetAt := 0
+	// lastPurgeAt and lastPurgeCount describe the last run of PurgeOldHashesCommand.
+	var lastPurgeAt *time.Time
+	var lastPurgeCount int
+	// memStats are the memory statistics returned by GetStatsCommand, read at memStatsAt.
+	var memStats runtime.MemStats
+	var memStatsAt time.Time
+	// history holds the stats of the last StatsHistorySize minutes, the current one being counted in minute.
+	history := &StatsHistory{}
+	minute := MinuteStats{Minute: time.Now().Truncate(time.Minute)}
+	var minuteTime int64
+	// hourly holds the stats by hour of the day since the stats were last reset.
+	hourly := &HourlyStats{}
+	// purgedIDs are the pending ids purged by PurgePendingCommand, whose hashes are discarded if ever computed.
+	purgedIDs := make(map[int]bool)
+	// failedIDs are the pending ids whose hash could not be computed, or was killed, marked by FailHashCommand.
+	failedIDs := make(map[int]bool)
+	// subscriptions are the webhooks notified once the hash of each id is ready, subscribed by SubscribeHashCommand.
+	subscriptions := make(map[int][]WebhookSubscription)
+	// failedWebhooks are the webhook deliveries which failed all their attempts, the least recently attempted first,
+	// and lastWebhookID the id of the latest one.
+	var failedWebhooks []*FailedWebhook
+	lastWebhookID := 0
+	// webhookFailed reports a failed webhook delivery to the store goroutine, from the goroutine delivering it.
+	webhookFailed := func(f *FailedWebhook) {
+		opts.Pending.Send(inboundRequests, Command{requestType: WebhookFailedCommand, failedWebhook: f})
+	}
+	// eventLog is the append-only log of operations performed on secretStore, keeping the latest opts.MaxEvents.
+	// Entries are only removed otherwise when erasing the data of a subject.
+	var eventLog []Event
+	var lastEventID int64
+	recordEvent := func(eventType string, id int, algorithm string) {
+		e := Event{
+			EventID:   lastEventID + 1,
+			Timestamp: time.Now(),
+			Type:      eventType,
+			HashID:    id,
+			Algorithm: algorithm,
+		}
+		lastEventID = e.EventID
+		eventLog = append(eventLog, e)
+		// The oldest events are dropped by reslicing, append copying the kept ones only once the capacity is reached.
+		if opts.MaxEvents > 0 && len(eventLog) > opts.MaxEvents {
+			eventLog = eventLog[len(eventLog)-opts.MaxEvents:]
+		}
+		// The cached hashes of the id are stale once it is set again or deleted, and its password gets a new id once
+		// deleted.
+		if eventType != HashAccessedEvent {
+			opts.Cache.Remove(id)
+		}
+		if eventType == HashDeletedEvent {
+			opts.Dedup.Remove(id)
+		}
+		if publisher != nil {
+			publisher.Publish(e)
+		}
+	}
+	recordAccess := func(id int, rec *HashRecord, algorithm string) {
+		rec.AccessCount++
+		rec.LastAccessed = time.Now()
+		recordEvent(HashAccessedEvent, id, algorithm)
+	}
+	// storeHash applies a SetHashCommand to secretStore.
+	// Hashing an existing id adds a new version, keeping the previous ones.
+	storeHash := func(r Command) {
+		now := time.Now()
+		rec, ok := secretStore[r.id]
+		if !ok {
+			rec = &HashRecord{Namespace: r.namespace, Tags: addTags(nil, r.tags), CreatedAt: now, CreatedBy: r.clientIdentity}
+			secretStore[r.id] = rec
+		}
+		rec.Hash = r.password
+		rec.AwaitingResubmit = false
+		rec.Algorithm = r.algorithm
+		rec.Encoding = r.encoding
+		rec.PepperVersion = r.pepperVersion
+		rec.Versions = append(rec.Versions, HashVersion{Algorithm: r.algorithm, Encoding: r.encoding, PepperVersion: r.pepperVersion, Hash: r.password, CreatedAt: now})
+		opts.Signer.Sign(r.id, rec)
+	}
 
-	// Following goroutine will run concurrently to handle requests sent to the channel.
-	go func() {
-		for r := range inboundRequests {
-			switch r.requestType {
-			case GetHashCommand:
-				if val, ok := secretStore[r.id]; ok {
-					r.responseChannel <- val
+	// logWAL appends the entry to the write-ahead log, if enabled.
+	logWAL := func(e WALEntry) {
+		if opts.WAL == nil {
+			return
+		}
+		if err := opts.WAL.Append(e); err != nil {
+			log.Println("Cannot write to the write-ahead log: ", err)
+		}
+	}
+	// logRecord logs the record of the id to the write-ahead log once changed, and logDelete its removal.
+	logRecord := func(id int) {
+		logWAL(WALEntry{Op: WALRecord, ID: id, Record: secretStore[id]})
+	}
+	logDelete := func(id int) {
+		logWAL(WALEntry{Op: WALDelete, ID: id})
+	}
+	// logReset logs the replacement of the content of secretStore, followed by its records.
+	logReset := func() {
+		if opts.WAL == nil {
+			return
+		}
+		logWAL(WALEntry{Op: WALReset})
+		for id := range secretStore {
+			logRecord(id)
+		}
+	}
+
+	// setHash applies a SetHashCommand to secretStore, logging it to the write-ahead log first.
+	// setHash stores the hash of the command, and responds once stored if the command has a response channel.
+	setHash := func(r Command) {
+		respond := func(res Result) {
+			if r.responseChannel != nil {
+				r.responseChannel <- res
+			}
+		}
+		if _, ok := secretStore[r.id]; !ok && purgedIDs[r.id] {
+			log.Println("Discarding the hash for purged pending id: ", r.id)
+			respond(Result{err: ErrHashNotFound})
+			return
+		}
+		if r.expectedHash != "" {
+			if err := compareHash(secretStore[r.id], r.expectedHash); err != nil {
+				log.Println("Discarding the compare-and-swap of the hash for id: ", r.id, err)
+				respond(Result{err: err})
+				return
+			}
+		}
+		logWAL(WALEntry{Op: WALSet, ID: r.id, Hash: r.password, Algorithm: r.algorithm, Encoding: r.encoding, PepperVersion: r.pepperVersion, Namespace: r.namespace, Tags: r.tags, CreatedBy: r.clientIdentity})
+		storeHash(r)
+		ids.Done(r.id)
+		logWAL(WALEntry{Op: WALCommit, ID: r.id})
+		elapsed := time.Now().UnixMicro() - r.requestStartTs
+		totalTime += elapsed
+		if minTime == 0 || elapsed < minTime {
+			minTime = elapsed
+		}
+		maxTime = max(maxTime, elapsed)
+		minute.Total++
+		minuteTime += elapsed
+		hourly.Add(time.Now(), elapsed)
+		recordEvent(HashSetEvent, r.id, r.algorithm)
+		if subs, ok := subscriptions[r.id]; ok {
+			delete(subscriptions, r.id)
+			notifyWebhooks(r.id, WebhookStatusReady, subs, webhookFailed)
+		}
+		respond(Result{})
+	}
+
+	// storeSize estimates the memory used by the records of secretStore, in bytes.
+	storeSize := func() int64 {
+		var size int64
+		for _, rec := range secretStore {
+			size += rec.Size()
+		}
+		return size
+	}
+
+	// Replay the write-ahead log in order, recovering the changes made since the snapshot.
+	// Set entries without a commit were interrupted by a crash before being stored.
+	var walSeq int64
+	if snap := opts.Snapshot; snap != nil {
+		if snap.Hashes != nil {
+			secretStore = snap.Hashes
+		}
+		eventLog = snap.Events
+		ids.Raise(snap.Counter)
+		lastEventID = snap.LastEventID
+		walSeq = snap.WALSeq
+	}
+	committed := make(map[int]int)
+	for _, e := range opts.WALEntries {
+		if e.Op == WALCommit {
+			committed[e.ID]++
+		}
+	}
+	for _, e := range opts.WALEntries {
+		if e.Seq <= walSeq {
+			continue
+		}
+		switch e.Op {
+		case WALSet:
+			if e.AwaitingResubmit {
+				secretStore[e.ID] = &HashRecord{Algorithm: e.Algorithm, Encoding: e.Encoding, Namespace: e.Namespace, Tags: e.Tags, CreatedAt: time.Now(), CreatedBy: e.CreatedBy, AwaitingResubmit: true}
+			} else {
+				storeHash(Command{id: e.ID, password: e.Hash, algorithm: e.Algorithm, encoding: e.Encoding, pepperVersion: e.PepperVersion, namespace: e.Namespace, tags: e.Tags, clientIdentity: e.CreatedBy})
+			}
+			ids.Raise(e.ID)
+			if committed[e.ID] > 0 {
+				committed[e.ID]--
+			} else if opts.WAL != nil {
+				log.Println("Recovered uncommitted hash from the write-ahead log for id: ", e.ID)
+				opts.WAL.Append(WALEntry{Op: WALCommit, ID: e.ID})
+			}
+		case WALRecord:
+			if e.Record != nil {
+				secretStore[e.ID] = e.Record
+				ids.Raise(e.ID)
+			}
+		case WALDelete:
+			delete(secretStore, e.ID)
+		case WALReset:
+			secretStore = make(map[int]*HashRecord)
+		}
+	}
+
+	// process applies a command to the store. A panic is recovered and logged, and false returned.
+	process := func(r Command) (ok bool) {
+		defer func() {
+			if p := recover(); p != nil {
+				slog.Error("The store goroutine panicked", "commandType", r.requestType.String(), "id", r.id,
+					"requestID", r.requestID, "panic", p, "stack", string(debug.Stack()))
+			}
+		}()
+		opts.Pending.Add(r.requestType, -1)
+		start := time.Now()
+		switch r.requestType {
+		case GetHashCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok && ids.IsPending(r.id):
+				r.responseChannel <- Result{err: ErrHashPending}
+			case !ok && failedIDs[r.id]:
+				r.responseChannel <- Result{err: ErrHashFailed}
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			case rec.ExpiresAt != nil && !time.Now().Before(*rec.ExpiresAt):
+				// The expired hashes are only purged periodically.
+				r.responseChannel <- Result{err: ErrHashExpired}
+			case rec.AwaitingResubmit:
+				r.responseChannel <- Result{err: ErrHashAwaitingResubmit}
+			case r.version > len(rec.Versions):
+				r.responseChannel <- Result{err: ErrVersionNotFound}
+			case r.version > 0:
+				v := rec.Versions[r.version-1]
+				recordAccess(r.id, rec, v.Algorithm)
+				deprecated := warnDeprecated(opts.DeprecatedAlgorithms, r.id, v.Algorithm)
+				// Only the permanent hashes are cached, so that the cache does not outlive the expiry.
+				if rec.ExpiresAt == nil {
+					opts.Cache.Add(r.id, r.version, CachedHash{Hash: v.Hash, Algorithm: v.Algorithm})
+				}
+				r.responseChannel <- Result{value: v.Hash, deprecated: deprecated}
+			default:
+				recordAccess(r.id, rec, rec.Algorithm)
+				deprecated := warnDeprecated(opts.DeprecatedAlgorithms, r.id, rec.Algorithm)
+				if rec.ExpiresAt == nil {
+					opts.Cache.Add(r.id, 0, CachedHash{Hash: rec.Hash, Algorithm: rec.Algorithm})
+				}
+				r.responseChannel <- Result{value: rec.Hash, deprecated: deprecated}
+			}
+		case GetRawHashCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok && ids.IsPending(r.id):
+				r.responseChannel <- Result{err: ErrHashPending}
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			case rec.AwaitingResubmit:
+				r.responseChannel <- Result{err: ErrHashAwaitingResubmit}
+			default:
+				encoding := rec.Encoding
+				if encoding == "" {
+					encoding = hashEncodings[rec.Algorithm]
+				}
+				enc, ok := digestEncodings[encoding]
+				if !ok {
+					r.responseChannel <- Result{err: ErrHashNotReversible}
+					break
+				}
+				digest, err := enc.Decode(rec.Hash)
+				if err != nil {
+					log.Println("Cannot decode the hash for id: ", r.id, err)
+					r.responseChannel <- Result{err: ErrHashNotReversible}
+					break
+				}
+				recordAccess(r.id, rec, rec.Algorithm)
+				r.responseChannel <- Result{value: string(digest)}
+			}
+		case SetHashCommand:
+			setHash(r)
+		case StoreBatchCommand:
+			for _, c := range r.batch {
+				setHash(c)
+			}
+			r.responseChannel <- Result{value: strconv.FormatInt(storeSize(), 10)}
+		case GetStatsCommand:
+			// Reading the memory statistics stops the world, so the cached ones are used for frequent requests.
+			if time.Since(memStatsAt) >= MemStatsInterval {
+				runtime.ReadMemStats(&memStats)
+				memStatsAt = time.Now()
+			}
+			s := &Stats{
+				TotalNum:       ids.Last() - statsResetAt,
+				LastPurgeAt:    lastPurgeAt,
+				LastPurgeCount: lastPurgeCount,
+				GoRoutineCount: runtime.NumGoroutine(),
+				HeapAllocBytes: int64(memStats.HeapAlloc),
+				HeapSysBytes:   int64(memStats.HeapSys),
+				GCPauseNs:      int64(memStats.PauseNs[(memStats.NumGC+255)%256]),
+			}
+			s.CacheHits, s.CacheMisses = opts.Cache.Counts()
+			if s.CacheHits+s.CacheMisses > 0 {
+				s.CacheHitRatio = float64(s.CacheHits) / float64(s.CacheHits+s.CacheMisses)
+			}
+			// The average is only computed once a hash has been requested, as 0/0 is NaN which cannot be encoded to JSON.
+			if s.TotalNum > 0 {
+				s.AverageTime = float64(totalTime) / float64(s.TotalNum)
+			}
+			s.MinObservedUs, s.MaxObservedUs = minTime, maxTime
+			sJson, err := safeMarshal(s)
+			r.responseChannel <- Result{value: sJson, err: err}
+		case TickCommand:
+			// The ticker does not wait for a response.
+			if minute.Total > 0 {
+				minute.AverageUs = float64(minuteTime) / float64(minute.Total)
+			}
+			history.Add(minute)
+			minute = MinuteStats{Minute: r.before}
+			minuteTime = 0
+		case MigrateEncodingCommand:
+			// Up to a batch of records are examined, the next batch starting after the last examined id.
+			m := r.migration
+			for examined := 0; examined < m.BatchSize && m.LastID < ids.Last(); {
+				m.LastID++
+				rec, ok := secretStore[m.LastID]
+				if !ok {
+					continue
+				}
+				examined++
+				migrated, err := migrateEncoding(rec, m)
+				switch {
+				case err != nil:
+					log.Println("Cannot migrate the encoding of the hash for id: ", m.LastID, err)
+					m.Failed++
+				case migrated:
+					opts.Signer.Sign(m.LastID, rec)
+					opts.Cache.Remove(m.LastID)
+					logRecord(m.LastID)
+					m.Migrated++
+				default:
+					m.Skipped++
+				}
+			}
+			m.Done = m.LastID >= ids.Last()
+			r.responseChannel <- Result{}
+		case GetHourlyStatsCommand:
+			hJson, err := safeMarshal(hourly.Buckets())
+			r.responseChannel <- Result{value: hJson, err: err}
+		case GetStatsHistoryCommand:
+			hJson, err := safeMarshal(history.Entries())
+			r.responseChannel <- Result{value: hJson, err: err}
+		case ResetStatsCommand:
+			statsResetAt = ids.Last()
+			totalTime = 0
+			minTime, maxTime = 0, 0
+			*hourly = HourlyStats{}
+			r.responseChannel <- Result{}
+		case GetEventsCommand:
+			// Event ids are increasing, so find the first event after the requested one.
+			i := sort.Search(len(eventLog), func(i int) bool { return eventLog[i].EventID > r.eventID })
+			var sb strings.Builder
+			enc := json.NewEncoder(&sb)
+			var err error
+			for _, e := range eventLog[i:] {
+				if err = enc.Encode(e); err != nil {
+					log.Println("Cannot encode the event to JSON: ", e.EventID, err)
+					break
+				}
+			}
+			r.responseChannel <- Result{value: sb.String(), err: err}
+		case GetEventCountCommand:
+			cJson, err := safeMarshal(&EventCount{Count: len(eventLog)})
+			r.responseChannel <- Result{value: cJson, err: err}
+		case DeleteHashCommand:
+			// Deleting leaves a tombstone behind, so the hash can still be restored.
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				now := time.Now()
+				rec.Deleted = true
+				rec.DeletedAt = &now
+				logRecord(r.id)
+				recordEvent(HashDeletedEvent, r.id, rec.Algorithm)
+				r.responseChannel <- Result{}
+			}
+		case PermanentDeleteHashCommand:
+			rec, ok := secretStore[r.id]
+			if !ok {
+				r.responseChannel <- Result{err: ErrHashNotFound}
+				break
+			}
+			delete(secretStore, r.id)
+			logDelete(r.id)
+			if !rec.Deleted {
+				recordEvent(HashDeletedEvent, r.id, rec.Algorithm)
+			}
+			r.responseChannel <- Result{}
+		case RestoreHashCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case !rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashNotDeleted}
+			default:
+				rec.Deleted = false
+				rec.DeletedAt = nil
+				logRecord(r.id)
+				r.responseChannel <- Result{}
+			}
+		case SubscribeHashCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok && failedIDs[r.id]:
+				r.responseChannel <- Result{err: ErrHashFailed}
+			case !ok && !ids.IsPending(r.id):
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case ok && rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			case len(subscriptions[r.id]) >= MaxSubscriptionsPerHash:
+				r.responseChannel <- Result{err: ErrTooManySubscriptions}
+			case ids.IsPending(r.id) || rec.AwaitingResubmit:
+				subscriptions[r.id] = append(subscriptions[r.id], *r.subscription)
+				r.responseChannel <- Result{value: StatusSubscribed}
+			default:
+				// The hash is ready already.
+				notifyWebhooks(r.id, WebhookStatusReady, []WebhookSubscription{*r.subscription}, webhookFailed)
+				r.responseChannel <- Result{value: StatusNotified}
+			}
+		case WebhookFailedCommand:
+			// The reporting goroutine does not wait for a response. A retried delivery keeps its id.
+			if r.failedWebhook.ID == 0 {
+				lastWebhookID++
+				r.failedWebhook.ID = lastWebhookID
+			}
+			failedWebhooks = append(failedWebhooks, r.failedWebhook)
+			if len(failedWebhooks) > MaxFailedWebhooks {
+				failedWebhooks = slices.Delete(failedWebhooks, 0, 1)
+			}
+		case ListFailedWebhooksCommand:
+			fJson, err := safeMarshal(append([]*FailedWebhook{}, failedWebhooks...))
+			r.responseChannel <- Result{value: fJson, err: err}
+		case TakeFailedWebhookCommand:
+			// The delivery is removed while being retried, being recorded again if it fails.
+			i := slices.IndexFunc(failedWebhooks, func(f *FailedWebhook) bool { return f.ID == r.failedWebhook.ID })
+			if i < 0 {
+				r.responseChannel <- Result{err: ErrWebhookNotFound}
+				break
+			}
+			*r.failedWebhook = *failedWebhooks[i]
+			failedWebhooks = slices.Delete(failedWebhooks, i, i+1)
+			r.responseChannel <- Result{}
+		case UpdateExpiryCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok && ids.IsPending(r.id):
+				r.responseChannel <- Result{err: ErrHashPending}
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				rec.ExpiresAt = r.expiresAt
+				logRecord(r.id)
+				opts.Cache.Remove(r.id)
+				r.responseChannel <- Result{}
+			}
+		case PurgeExpiredCommand:
+			purged := 0
+			for id, rec := range secretStore {
+				if rec.ExpiresAt != nil && rec.ExpiresAt.Before(r.before) {
+					delete(secretStore, id)
+					logDelete(id)
+					if !rec.Deleted {
+						recordEvent(HashDeletedEvent, id, rec.Algorithm)
+					}
+					purged++
+				}
+			}
+			r.responseChannel <- Result{value: strconv.Itoa(purged)}
+		case PurgeTombstonesCommand:
+			// Permanently remove the tombstones created before the given time.
+			purged := 0
+			for id, rec := range secretStore {
+				if rec.Deleted && rec.DeletedAt.Before(r.before) {
+					delete(secretStore, id)
+					logDelete(id)
+					purged++
+				}
+			}
+			r.responseChannel <- Result{value: strconv.Itoa(purged)}
+		case BulkGetHashCommand:
+			resp := &BulkGetResponse{Hashes: make(map[int]string), Missing: []int{}, Deleted: []int{}}
+			for _, id := range r.ids {
+				rec, ok := secretStore[id]
+				switch {
+				case !ok:
+					resp.Missing = append(resp.Missing, id)
+				case rec.Deleted:
+					resp.Deleted = append(resp.Deleted, id)
+				case rec.AwaitingResubmit:
+					// The copies awaiting their password have no hash yet.
+					resp.Missing = append(resp.Missing, id)
+				default:
+					recordAccess(id, rec, rec.Algorithm)
+					resp.Hashes[id] = rec.Hash
+				}
+			}
+			bJson, err := safeMarshal(resp)
+			r.responseChannel <- Result{value: bJson, err: err}
+		case BulkDeleteCommand:
+			// Hashes are deleted either by id, or by namespace and creation time.
+			resp := &BulkDeleteResponse{}
+			softDelete := func(id int, rec *HashRecord) {
+				now := time.Now()
+				rec.Deleted = true
+				rec.DeletedAt = &now
+				logRecord(id)
+				recordEvent(HashDeletedEvent, id, rec.Algorithm)
+				resp.Deleted++
+			}
+			if r.ids != nil {
+				for _, id := range r.ids {
+					if rec, ok := secretStore[id]; ok && !rec.Deleted {
+						softDelete(id, rec)
+					} else {
+						resp.NotFound++
+					}
+				}
+			} else {
+				for id, rec := range secretStore {
+					if rec.Namespace == r.namespace && !rec.Deleted && rec.CreatedAt.Before(r.before) {
+						softDelete(id, rec)
+					}
+				}
+			}
+			bJson, err := safeMarshal(resp)
+			r.responseChannel <- Result{value: bJson, err: err}
+		case SearchHashesCommand:
+			// Results are ordered by id, so that the last id of a page is the cursor of the next one.
+			var ids []int
+			for id, rec := range secretStore {
+				if id > r.filter.Cursor && r.filter.Matches(rec) {
+					ids = append(ids, id)
+				}
+			}
+			sort.Ints(ids)
+			resp := &SearchResponse{Results: []SearchResult{}}
+			if len(ids) > r.filter.Limit {
+				ids = ids[:r.filter.Limit]
+				resp.NextCursor = ids[len(ids)-1]
+			}
+			for _, id := range ids {
+				rec := secretStore[id]
+				resp.Results = append(resp.Results, SearchResult{ID: id, CreatedAt: rec.CreatedAt, Algorithm: rec.Algorithm})
+			}
+			sJson, err := safeMarshal(resp)
+			r.responseChannel <- Result{value: sJson, err: err}
+		case ExportMetadataCommand:
+			// A page of at most filter.Limit records is returned, ordered by id, after the filter.Cursor id.
+			var ids []int
+			for id, rec := range secretStore {
+				if id > r.filter.Cursor && (r.includeDeleted || !rec.Deleted) {
+					ids = append(ids, id)
+				}
+			}
+			sort.Ints(ids)
+			if len(ids) > r.filter.Limit {
+				ids = ids[:r.filter.Limit]
+			}
+			page := make([]HashMetadata, 0, len(ids))
+			for _, id := range ids {
+				rec := secretStore[id]
+				page = append(page, HashMetadata{ID: id, Algorithm: rec.Algorithm, CreatedAt: rec.CreatedAt, AccessCount: rec.AccessCount, Tags: rec.Tags, Annotations: rec.Annotations, Deleted: rec.Deleted})
+			}
+			pJson, err := safeMarshal(page)
+			r.responseChannel <- Result{value: pJson, err: err}
+		case AddTagsCommand, RemoveTagCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				if r.requestType == AddTagsCommand {
+					rec.Tags = addTags(rec.Tags, r.tags)
 				} else {
-					r.responseChannel <- "Invalid hash id!"
+					rec.Tags = removeTag(rec.Tags, r.tags[0])
+				}
+				logRecord(r.id)
+				tJson, err := safeMarshal(&TagsResponse{ID: r.id, Tags: rec.Tags})
+				r.responseChannel <- Result{value: tJson, err: err}
+			}
+		case AnnotateHashCommand, GetAnnotationsCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				if r.requestType == AnnotateHashCommand {
+					if rec.Annotations == nil {
+						rec.Annotations = make(map[string]string)
+					}
+					rec.Annotations[r.annotation[0]] = r.annotation[1]
+					logRecord(r.id)
+				}
+				r.responseChannel <- annotationsOf(r.id, rec)
+			}
+		case PatchMetadataCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok && ids.IsPending(r.id):
+				r.responseChannel <- Result{err: ErrHashPending}
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				mJson, err := safeMarshal(patchMetadata(r.id, rec, r.metadataPatch))
+				logRecord(r.id)
+				// The patch may set an expiry, which the cached hashes would outlive.
+				opts.Cache.Remove(r.id)
+				r.responseChannel <- Result{value: mJson, err: err}
+			}
+		case ListHashesCommand:
+			ids := []int{}
+			for id, rec := range secretStore {
+				if r.filter.Matches(rec) {
+					ids = append(ids, id)
+				}
+			}
+			sort.Ints(ids)
+			lJson, err := safeMarshal(&ListResponse{IDs: ids})
+			r.responseChannel <- Result{value: lJson, err: err}
+		case EraseSubjectCommand:
+			// All the data of the hashes tagged with the subject are removed, leaving no tombstone nor event behind, but
+			// the WALDelete entries removing them from the snapshots when replayed.
+			resp := &EraseResponse{}
+			erased := make(map[int]bool)
+			for id, rec := range secretStore {
+				if hasTag(rec.Tags, r.tags[0]) {
+					delete(secretStore, id)
+					logDelete(id)
+					opts.Cache.Remove(id)
+					opts.Dedup.Remove(id)
+					erased[id] = true
+				}
+			}
+			kept := eventLog[:0]
+			for _, e := range eventLog {
+				if erased[e.HashID] {
+					resp.EventsDeleted++
+				} else {
+					kept = append(kept, e)
+				}
+			}
+			clear(eventLog[len(kept):])
+			eventLog = kept
+			resp.HashesDeleted = len(erased)
+			// The erased hashes must not be left in the write-ahead log, nor be recovered from it.
+			if opts.WAL != nil && len(erased) > 0 {
+				if err := opts.WAL.Erase(erased); err != nil {
+					log.Println("Cannot erase the hashes from the write-ahead log: ", err)
+					r.responseChannel <- Result{err: err}
+					break
+				}
+			}
+			eJson, err := safeMarshal(resp)
+			r.responseChannel <- Result{value: eJson, err: err}
+		case ExportSubjectCommand:
+			// The records are collected at once, so the export is consistent.
+			records := []SubjectRecord{}
+			for id, rec := range secretStore {
+				if hasTag(rec.Tags, r.tags[0]) {
+					records = append(records, SubjectRecord{ID: id, Algorithm: rec.Algorithm, CreatedAt: rec.CreatedAt, AccessCount: rec.AccessCount, Tags: rec.Tags, Annotations: rec.Annotations})
+				}
+			}
+			if len(records) == 0 {
+				r.responseChannel <- Result{err: ErrSubjectNotFound}
+				break
+			}
+			sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+			eJson, err := safeMarshal(records)
+			r.responseChannel <- Result{value: eJson, err: err}
+		case PurgeOldHashesCommand:
+			var purged []int
+			for id, rec := range secretStore {
+				if rec.CreatedAt.Before(r.before) {
+					delete(secretStore, id)
+					logDelete(id)
+					if !rec.Deleted {
+						recordEvent(HashDeletedEvent, id, rec.Algorithm)
+					}
+					purged = append(purged, id)
+				}
+			}
+			now := time.Now()
+			lastPurgeAt = &now
+			lastPurgeCount = len(purged)
+			sort.Ints(purged)
+			pJson, err := safeMarshal(purged)
+			r.responseChannel <- Result{value: pJson, err: err}
+		case DrainAndPauseCommand:
+			// The commands queued before are processed, and no other command is until resumed,
+			// so that the snapshot can be read by the caller without being modified meanwhile.
+			*r.snapshot = Snapshot{CreatedAt: time.Now(), Counter: ids.Last(), LastEventID: lastEventID, Hashes: secretStore, Events: eventLog}
+			if opts.WAL != nil {
+				r.snapshot.WALSeq = opts.WAL.Seq()
+			}
+			r.responseChannel <- Result{}
+			<-r.resume
+		case RestoreSnapshotCommand:
+			// The hash and event ids never go back, so that ids are not issued twice.
+			secretStore = r.snapshot.Hashes
+			if secretStore == nil {
+				secretStore = make(map[int]*HashRecord)
+			}
+			eventLog = r.snapshot.Events
+			ids.Raise(r.snapshot.Counter)
+			lastEventID = max(lastEventID, r.snapshot.LastEventID)
+			logReset()
+			opts.Cache.Purge()
+			opts.Dedup.Purge()
+			r.responseChannel <- Result{}
+		case CompactStoreCommand:
+			// The pending hashes would be stored under ids reissued by the compaction.
+			last := ids.Last()
+			if ids.HasPending() {
+				r.responseChannel <- Result{err: ErrHashesPending}
+				break
+			}
+			stored := make([]int, 0, len(secretStore))
+			for id := range secretStore {
+				stored = append(stored, id)
+			}
+			// Ids issued since the pending ids were checked would be reissued too.
+			if !ids.Reset(last, len(stored)) {
+				r.responseChannel <- Result{err: ErrHashesPending}
+				break
+			}
+			sort.Ints(stored)
+			mapping := make(map[int]int, len(stored))
+			compacted := make(map[int]*HashRecord, len(stored))
+			for i, id := range stored {
+				mapping[id] = i + 1
+				compacted[i+1] = secretStore[id]
+				opts.Signer.Sign(i+1, compacted[i+1])
+			}
+			for i, e := range eventLog {
+				if newID, ok := mapping[e.HashID]; ok {
+					eventLog[i].HashID = newID
+				}
+			}
+			secretStore = compacted
+			logReset()
+			opts.Cache.Purge()
+			opts.Dedup.Purge()
+			statsResetAt = min(statsResetAt, len(stored))
+			// The purged and failed ids are reissued to new hashes.
+			clear(purgedIDs)
+			clear(failedIDs)
+			mJson, err := safeMarshal(mapping)
+			r.responseChannel <- Result{value: mJson, err: err}
+		case RotateWALCommand:
+			var err error
+			if opts.WAL != nil {
+				err = opts.WAL.Rotate(r.walSeq)
+			}
+			r.responseChannel <- Result{err: err}
+		case FlushCommand:
+			flushed := &FlushResponse{FlushedAt: time.Now()}
+			var err error
+			if flushed.BytesWritten, err = backend.Flush(); err != nil {
+				log.Println("Cannot flush the storage backend: ", err)
+				r.responseChannel <- Result{err: err}
+				break
+			}
+			fJson, err := safeMarshal(flushed)
+			r.responseChannel <- Result{value: fJson, err: err}
+		case CompareHashCommand:
+			if err := compareHash(secretStore[r.id], r.expectedHash); err != nil {
+				r.responseChannel <- Result{err: err}
+			} else {
+				r.responseChannel <- algorithmOf(r.id, secretStore[r.id])
+			}
+		case GetHashInfoCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok && ids.IsPending(r.id):
+				r.responseChannel <- Result{err: ErrHashPending}
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				encoding := rec.Encoding
+				if encoding == "" {
+					encoding = hashEncodings[rec.Algorithm]
+				}
+				info := &HashInfo{ID: r.id, Algorithm: rec.Algorithm, Encoding: encoding, Namespace: rec.Namespace, Tags: append([]string{}, rec.Tags...), CreatedAt: rec.CreatedAt, CreatedBy: rec.CreatedBy, VersionCount: len(rec.Versions), AccessCount: rec.AccessCount, LastAccessed: rec.LastAccessed, AwaitingResubmit: rec.AwaitingResubmit, ExpiresAt: rec.ExpiresAt}
+				iJson, err := safeMarshal(info)
+				r.responseChannel <- Result{value: iJson, err: err}
+			}
+		case GetSignedHashCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok && ids.IsPending(r.id):
+				r.responseChannel <- Result{err: ErrHashPending}
+			case !ok && failedIDs[r.id]:
+				r.responseChannel <- Result{err: ErrHashFailed}
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			case rec.AwaitingResubmit:
+				r.responseChannel <- Result{err: ErrHashAwaitingResubmit}
+			case rec.Signature == nil:
+				r.responseChannel <- Result{err: ErrHashNotSigned}
+			default:
+				recordAccess(r.id, rec, rec.Algorithm)
+				sJson, err := safeMarshal(&SignedHashResponse{ID: r.id, Algorithm: rec.Algorithm, Hash: rec.Hash, CreatedAt: rec.CreatedAt, Signature: rec.Signature, PublicKeyID: rec.PublicKeyID})
+				r.responseChannel <- Result{value: sJson, err: err}
+			}
+		case GetPreviewCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok && ids.IsPending(r.id):
+				r.responseChannel <- Result{err: ErrHashPending}
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			case rec.AwaitingResubmit:
+				r.responseChannel <- Result{err: ErrHashAwaitingResubmit}
+			default:
+				pJson, err := safeMarshal(previewOf(rec, r.previewChars[0], r.previewChars[1]))
+				r.responseChannel <- Result{value: pJson, err: err}
+			}
+		case GetAlgorithmParametersCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok && ids.IsPending(r.id):
+				r.responseChannel <- Result{err: ErrHashPending}
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			case rec.AwaitingResubmit:
+				r.responseChannel <- Result{err: ErrHashAwaitingResubmit}
+			default:
+				params, err := parametersOf(rec)
+				if err != nil {
+					r.responseChannel <- Result{err: err}
+					break
+				}
+				pJson, err := safeMarshal(params)
+				r.responseChannel <- Result{value: pJson, err: err}
+			}
+		case InspectHashCommand:
+			rec, ok := secretStore[r.id]
+			if !ok && !ids.IsPending(r.id) && !failedIDs[r.id] {
+				r.responseChannel <- Result{err: ErrHashNotFound}
+				break
+			}
+			iJson, err := safeMarshal(&InspectResponse{ID: r.id, Pending: ids.IsPending(r.id), Failed: failedIDs[r.id], HashRecord: rec})
+			r.responseChannel <- Result{value: iJson, err: err}
+		case TopAccessedCommand:
+			tJson, err := safeMarshal(topAccessed(secretStore, r.filter.Limit))
+			r.responseChannel <- Result{value: tJson, err: err}
+		case AlgorithmDistributionCommand:
+			dJson, err := safeMarshal(algorithmDistribution(secretStore, ids.PendingCount()))
+			r.responseChannel <- Result{value: dJson, err: err}
+		case CompareAlgorithmCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			case rec.AwaitingResubmit:
+				r.responseChannel <- Result{err: ErrHashAwaitingResubmit}
+			// Any algorithm matches when none is given.
+			case r.algorithm != "" && rec.Algorithm != r.algorithm:
+				r.responseChannel <- Result{err: ErrAlgorithmMismatch}
+			default:
+				encoding := rec.Encoding
+				if encoding == "" {
+					encoding = hashEncodings[rec.Algorithm]
+				}
+				vJson, err := safeMarshal(&HashVersion{Algorithm: rec.Algorithm, Encoding: encoding, PepperVersion: rec.PepperVersion, Hash: rec.Hash})
+				r.responseChannel <- Result{value: vJson, err: err}
+			}
+		case FailHashCommand:
+			// The hash of an existing record, being re-hashed, is kept.
+			if _, ok := secretStore[r.id]; !ok {
+				failedIDs[r.id] = true
+				opts.Dedup.Remove(r.id)
+			}
+			ids.Done(r.id)
+			if subs, ok := subscriptions[r.id]; ok {
+				delete(subscriptions, r.id)
+				notifyWebhooks(r.id, WebhookStatusFailed, subs, webhookFailed)
+			}
+			if r.responseChannel != nil {
+				r.responseChannel <- Result{}
+			}
+		case PurgePendingCommand:
+			purged := ids.PurgePending(r.before)
+			for _, id := range purged {
+				purgedIDs[id] = true
+				opts.Dedup.Remove(id)
+			}
+			pJson, err := safeMarshal(purged)
+			r.responseChannel <- Result{value: pJson, err: err}
+		case CloneHashCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				clone := *rec
+				if r.namespace != "" {
+					clone.Namespace = r.namespace
+				}
+				clone.Tags = slices.Clone(rec.Tags)
+				clone.Annotations = maps.Clone(rec.Annotations)
+				clone.Versions = slices.Clone(rec.Versions)
+				clone.CreatedAt = time.Now()
+				clone.CreatedBy = r.clientIdentity
+				opts.Signer.Sign(r.targetID, &clone)
+				// The whole record is logged, its versions and annotations being cloned too.
+				secretStore[r.targetID] = &clone
+				logRecord(r.targetID)
+				recordEvent(HashSetEvent, r.targetID, clone.Algorithm)
+				r.responseChannel <- Result{value: strconv.Itoa(r.targetID)}
+			}
+			ids.Done(r.targetID)
+		case CopyHashCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				// Only the metadata are copied, the hash being computed once the password is submitted again.
+				cp := &HashRecord{Algorithm: rec.Algorithm, Encoding: rec.Encoding, Namespace: rec.Namespace, Tags: slices.Clone(rec.Tags), Annotations: maps.Clone(rec.Annotations), CreatedAt: time.Now(), CreatedBy: r.clientIdentity, AwaitingResubmit: true}
+				if r.namespace != "" {
+					cp.Namespace = r.namespace
+				}
+				if r.algorithm != "" && r.algorithm != rec.Algorithm {
+					cp.Algorithm, cp.Encoding = r.algorithm, ""
+				}
+				secretStore[r.targetID] = cp
+				logRecord(r.targetID)
+				recordEvent(HashSetEvent, r.targetID, cp.Algorithm)
+				r.responseChannel <- Result{value: strconv.Itoa(r.targetID)}
+			}
+			ids.Done(r.targetID)
+		case TouchHashCommand:
+			// The cache hits of getHashHandler are counted as accesses of their version, without waiting for a response.
+			rec, ok := secretStore[r.id]
+			var res Result
+			switch {
+			case !ok:
+				res = Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				res = Result{err: ErrHashDeleted}
+			default:
+				algorithm := rec.Algorithm
+				if r.version > 0 && r.version <= len(rec.Versions) {
+					algorithm = rec.Versions[r.version-1].Algorithm
+				}
+				recordAccess(r.id, rec, algorithm)
+				res.value, res.err = safeMarshal(&TouchResponse{ID: r.id, LastAccessed: rec.LastAccessed})
+			}
+			if r.responseChannel != nil {
+				r.responseChannel <- res
+			}
+		case GetAlgorithmCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				r.responseChannel <- algorithmOf(r.id, rec)
+			}
+		case GetVersionsCommand:
+			rec, ok := secretStore[r.id]
+			switch {
+			case !ok:
+				r.responseChannel <- Result{err: ErrHashNotFound}
+			case rec.Deleted:
+				r.responseChannel <- Result{err: ErrHashDeleted}
+			default:
+				vJson, err := safeMarshal(rec.Versions)
+				r.responseChannel <- Result{value: vJson, err: err}
+			}
+		default:
+			// Recovered as any other panic of the store goroutine, which is restarted.
+			panic(fmt.Sprintf("unknown command type %s", r.requestType))
+		}
+		if opts.Logger != nil {
+			opts.Logger.Debug("Command processed", "commandType", r.requestType.String(), "id", r.id,
+				"requestID", r.requestID, "processingDurationUs", time.Since(start).Microseconds())
+		}
+		return true
+	}
+
+	// restart answers the command which panicked and the queued ones with ErrStoreRestarted, the hashes being
+	// computed for the queued SetHashCommands marked as failed, and reinitializes the store, all its hashes being
+	// lost, which is logged to the write-ahead log so that they are not recovered on the next start either. The ids
+	// keep increasing, so that no id is issued twice.
+	restart := func(r Command) {
+		discarded := []Command{r}
+	drain:
+		for {
+			select {
+			case c, ok := <-inbound:
+				if !ok {
+					break drain
 				}
-			case SetHashCommand:
-				secretStore[r.id] = r.password
-				totalTime += time.Now().UnixMicro() - r.requestStartTs
-			case GetCountCommand:
-				counter++
-				r.responseChannel <- strconv.Itoa(counter)
-			case GetStatsCommand:
-				s := &Stats{
-					TotalNum:    counter,
-					AverageTime: float64(totalTime) / float64(counter),
+				if c.requestType == SwitchChannelCommand {
+					inbound = c.channel
+					continue
 				}
-				if counter == 0 {
-					s.AverageTime = 0
+				opts.Pending.Add(c.requestType, -1)
+				discarded = append(discarded, c)
+			default:
+				break drain
+			}
+		}
+		lost := len(secretStore)
+		secretStore = make(map[int]*HashRecord)
+		logReset()
+		totalTime, minTime, maxTime = 0, 0, 0
+		statsResetAt = ids.Last()
+		lastPurgeAt, lastPurgeCount = nil, 0
+		history = &StatsHistory{}
+		minute = MinuteStats{Minute: time.Now().Truncate(time.Minute)}
+		minuteTime = 0
+		hourly = &HourlyStats{}
+		purgedIDs = make(map[int]bool)
+		failedIDs = make(map[int]bool)
+		subscriptions = make(map[int][]WebhookSubscription)
+		failedWebhooks = nil
+		eventLog = nil
+		opts.Cache.Purge()
+		opts.Dedup.Purge()
+		for i, c := range discarded {
+			for _, set := range append([]Command{c}, c.batch...) {
+				if set.requestType == SetHashCommand || set.requestType == FailHashCommand {
+					failedIDs[set.id] = true
+					ids.Done(set.id)
 				}
-				sJson, _ := json.Marshal(s)
-				r.responseChannel <- string(sJson)
+			}
+			switch {
+			case c.responseChannel == nil:
+			case i > 0:
+				// The queued commands have not been answered, and their senders wait for the answer.
+				c.responseChannel <- Result{err: ErrStoreRestarted}
 			default:
-				log.Fatal("Unknown request type", r.requestType)
+				// The command which panicked may have been answered before, its response channel being buffered.
+				select {
+				case c.responseChannel <- Result{err: ErrStoreRestarted}:
+				default:
+				}
+			}
+		}
+		slog.Error("The store has been restarted", "discardedCommands", len(discarded), "lostHashes", lost)
+	}
+
+	// Following goroutine will run concurrently to handle requests sent to the channel.
+	// It keeps serving the commands after a panic, with a restarted store; the server is shut down if it panics more
+	// than MaxStorePanics times in StorePanicWindow.
+	go func() {
+		panics := &StorePanics{}
+		for {
+			r, ok := <-inbound
+			if !ok {
+				return
+			}
+			if r.requestType == SwitchChannelCommand {
+				inbound = r.channel
+				continue
+			}
+			if process(r) {
+				continue
+			}
+			restart(r)
+			if panics.Record(time.Now()) > MaxStorePanics && opts.OnRepeatedPanics != nil {
+				slog.Error("The store goroutine panics repeatedly, shutting the server down", "panics", MaxStorePanics+1, "window", StorePanicWindow.String())
+				opts.OnRepeatedPanics()
 			}
 		}
 	}()
@@ -100,132 +1629,633 @@ func CreatePasswordStore() chan<- Command {
 	return inboundRequests
 }
 
-// getHashHandler handles the `/hash/{id}` endpoint.
+// send forwards the command to the processor, on behalf of the request of ctx, and waits for its result, or until
+// ctx is done.
+func (s *Server) send(ctx context.Context, c Command) Result {
+	c.requestID = requestIDFrom(ctx)
+	c.clientIdentity = clientIdentityFrom(ctx)
+	return s.processor.Send(ctx, c)
+}
+
+// compareHash checks that rec holds the expected hash, comparing them in constant time.
+func compareHash(rec *HashRecord, expected string) error {
+	switch {
+	case rec == nil:
+		return ErrHashNotFound
+	case rec.Deleted:
+		return ErrHashDeleted
+	case subtle.ConstantTimeCompare([]byte(rec.Hash), []byte(expected)) != 1:
+		return ErrHashMismatch
+	}
+	return nil
+}
+
+// algorithmOf returns the AlgorithmResponse of the latest version of rec, encoded to JSON.
+func algorithmOf(id int, rec *HashRecord) Result {
+	encoding := rec.Encoding
+	if encoding == "" {
+		encoding = hashEncodings[rec.Algorithm]
+	}
+	value, err := safeMarshal(&AlgorithmResponse{ID: id, Algorithm: rec.Algorithm, Encoding: encoding})
+	return Result{value: value, err: err}
+}
+
+// InternalErrorJSON is the body of the responses to requests failing because of an internal error.
+const InternalErrorJSON = `{"error":"internal"}`
+
+// safeMarshal encodes v to JSON. If it cannot be encoded, e.g. because of a NaN, the error is logged and
+// InternalErrorJSON is returned along with it.
+func safeMarshal(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Cannot encode %T to JSON: %v", v, err)
+		return InternalErrorJSON, err
+	}
+	return string(data), nil
+}
+
+// decodeResult decodes the JSON value of the result into v. If it cannot be decoded, the error is logged and an
+// internal error written, and the caller must not handle the request any further.
+func decodeResult(w http.ResponseWriter, res Result, v any) bool {
+	if err := json.Unmarshal([]byte(res.value), v); err != nil {
+		log.Printf("Cannot decode %T from JSON: %v", v, err)
+		writeInternalError(w)
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	body, err := safeMarshal(v)
+	if err != nil {
+		writeInternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", body)
+}
+
+// writeInternalError writes InternalErrorJSON as a 500 response.
+func writeInternalError(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, "%s\n", InternalErrorJSON)
+}
+
+// recoverPanic responds with an internal error if the handler panics, instead of aborting the connection.
+// It must be deferred by the caller of the handler.
+func recoverPanic(w http.ResponseWriter, r *http.Request) {
+	err := recover()
+	if err == nil {
+		return
+	}
+	if err == http.ErrAbortHandler {
+		panic(err)
+	}
+	log.Printf("Panic while handling %s %s: %v\n%s", r.Method, r.URL.Path, err, debug.Stack())
+	writeInternalError(w)
+}
+
+// writeStoreError writes the response for an error returned by the password store.
+func writeStoreError(w http.ResponseWriter, err error) {
+	var status int
+	switch {
+	case errors.Is(err, ErrHashNotFound), errors.Is(err, ErrVersionNotFound), errors.Is(err, ErrSubjectNotFound), errors.Is(err, ErrWebhookNotFound),
+		errors.Is(err, ErrHashNotSigned):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrHashDeleted), errors.Is(err, ErrHashExpired), errors.Is(err, ErrHashFailed):
+		status = http.StatusGone
+	case errors.Is(err, ErrHashNotDeleted), errors.Is(err, ErrHashesPending), errors.Is(err, ErrHashMismatch), errors.Is(err, ErrHashNotReversible),
+		errors.Is(err, ErrAlgorithmMismatch), errors.Is(err, ErrHashAwaitingResubmit), errors.Is(err, ErrTooManySubscriptions):
+		status = http.StatusConflict
+	case errors.Is(err, ErrPasswordMismatch):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrStoreRestarted), errors.Is(err, ErrStoreStopped):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		http.Error(w, "The request has timed out!", http.StatusGatewayTimeout)
+		return
+	default:
+		// Internal errors are logged by the store, and not disclosed to the client.
+		writeInternalError(w)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
+
+// writePending writes the 202 response to requests for a hash being processed.
+func (s *Server) writePending(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	writeJSON(w, &PendingResponse{Status: "pending", EstimatedReadySecs: int(math.Ceil(s.cfg.HashPreprocessingDelay.Seconds()))})
+}
+
+// hashIDFromPath extracts the hash id from paths of the form `/hash/{id}[/...]`.
+func hashIDFromPath(path string) (int, error) {
+	m := hashIDRegex.FindStringSubmatch(path)
+	if m == nil {
+		return 0, ErrHashNotFound
+	}
+	return strconv.Atoi(m[1])
+}
+
+// getHashHandler handles the GET requests to `/hash/{id}` endpoint.
 func (s *Server) getHashHandler(w http.ResponseWriter, r *http.Request) {
 	// If the server is being termintaed, reject new requests.
-	if s.isTerminated {
+	if s.isTerminated.Load() {
 		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
 		return
 	}
-	m := regexp.MustCompile("^(.*?)/hash/")
-	id := m.ReplaceAllString(r.URL.Path, "")
-	hashId, err := strconv.Atoi(id)
+	hashId, err := hashIDFromPath(r.URL.Path)
 	if err != nil {
 		fmt.Fprintf(w, "Invalid hash id!\n")
 		log.Println("Invalid hash id!")
 		return
 	}
+	if !s.checkLink(w, r, hashId) {
+		return
+	}
+
+	// The latest version is returned unless another one is requested.
+	version := 0
+	if v := r.URL.Query().Get("version"); v != "" {
+		if version, err = strconv.Atoi(v); err != nil || version < 1 {
+			http.Error(w, ErrVersionNotFound.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Cached hashes are returned without waiting for the store, which is told to count them as accesses.
+	if cached, ok := s.cache.Get(hashId, version); ok {
+		if !s.pending.TrySend(s.inboundRequests, Command{requestType: TouchHashCommand, id: hashId, version: version, requestID: requestIDFrom(r.Context())}) {
+			log.Println("Cannot count the access to the cached hash as the store is overloaded, for id: ", hashId)
+		}
+		if warnDeprecated(s.cfg.DeprecatedAlgorithms, hashId, cached.Algorithm) {
+			w.Header().Set("Warning", DeprecatedAlgorithmWarning)
+		}
+		s.writeHash(w, r, hashId, cached.Hash)
+		return
+	}
 
 	// Retrieve the stored hashed value of the password for given id.
-	resChan := make(chan string)
-	s.inboundRequests <- Command{requestType: GetHashCommand, id: hashId, responseChannel: resChan}
-	log.Println("Hash retrieved for id: ", id)
-	fmt.Fprintf(w, "%s\n", <-resChan)
-	close(resChan)
+	res := s.send(r.Context(), Command{requestType: GetHashCommand, id: hashId, version: version})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if errors.Is(res.err, ErrHashAwaitingResubmit) {
+		writeAwaitingResubmit(w, hashId)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	if res.deprecated {
+		w.Header().Set("Warning", DeprecatedAlgorithmWarning)
+	}
+	s.writeHash(w, r, hashId, res.value)
+}
+
+// writeHash writes the hash retrieved for the id, in protobuf if accepted by the client.
+func (s *Server) writeHash(w http.ResponseWriter, r *http.Request, hashId int, hash string) {
+	log.Println("Hash retrieved for id: ", hashId)
+	if acceptsProtobuf(r) {
+		writeProtobuf(w, &hashserverpb.HashValue{Id: int64(hashId), Hash: hash})
+		return
+	}
+	fmt.Fprintf(w, "%s\n", hash)
 }
 
 // setHashHandler handles the POST requests to `/hash` endpoint.
 func (s *Server) setHashHandler(w http.ResponseWriter, r *http.Request) {
 	// If the server is being termintaed, reject new requests.
-	if s.isTerminated {
+	if s.isTerminated.Load() {
 		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
 		return
 	}
-	password := r.FormValue("password")
+	if s.rejectDraining(w) {
+		return
+	}
+	req, ok := readHashRequest(w, r)
+	if !ok || !s.allowAlgorithm(w, req.Algorithm) {
+		return
+	}
 
-	// Reject the request if not of type 'POST'.
-	if r.Method != http.MethodPost {
-		fmt.Fprintf(w, "Only POST methods are supported for `/hash` endpoint!\n")
-		log.Println("Rejecting the request as it is not of type 'POST'.")
+	// A password posted again within the dedup window is not hashed again, the caller gets the id it was issued.
+	if id, ok := s.dedup.Lookup(req); ok {
+		log.Println("Returning the id issued to the same password within the dedup window: ", id)
+		s.writeHashID(w, r, id)
 		return
 	}
 
-	// Get the current request counter value and return it to the caller.
-	resChan := make(chan string)
-	s.inboundRequests <- Command{requestType: GetCountCommand, password: "", id: 0, responseChannel: resChan}
-	id, _ := strconv.Atoi(<-resChan)
-	fmt.Fprintf(w, "%d\n", id)
-	close(resChan)
+	// Issue the next id and return it to the caller.
+	id := s.ids.Next()
+	s.dedup.Add(req, id)
+	s.writeHashID(w, r, id)
+
+	s.queueHash(r.Context(), id, req)
+}
 
-	// Push the request to inboundRequests after 5 sec.
-	c := &Command{requestType: SetHashCommand, password: password, id: id}
+// writeHashID writes the id issued to the password of the request, encoded as Protobuf if the client accepts it.
+func (s *Server) writeHashID(w http.ResponseWriter, r *http.Request, id int) {
+	if acceptsProtobuf(r) {
+		writeProtobuf(w, &hashserverpb.HashResponse{Id: int64(id)})
+	} else {
+		fmt.Fprintf(w, "%d\n", id)
+	}
+}
+
+// readHashRequest reads the password and algorithm from a form, multipart form, JSON or Protobuf encoded body.
+// If the request is invalid, it writes an error response and returns false.
+func readHashRequest(w http.ResponseWriter, r *http.Request) (*HashRequest, bool) {
+	var passwordFile string
+	if isMultipartRequest(r) {
+		var ok bool
+		if passwordFile, ok = readMultipartForm(w, r); !ok {
+			return nil, false
+		}
+	}
+	req := &HashRequest{Password: r.FormValue("password"), Algorithm: r.FormValue("algorithm"), Namespace: r.FormValue("namespace"), Encoding: r.FormValue("encoding")}
+	req.Tags = r.Form["tags"]
+	if passwordFile != "" {
+		req.Password = passwordFile
+	}
+	if isJSONRequest(r) {
+		req = &HashRequest{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxHashBodySize)).Decode(req); err != nil {
+			http.Error(w, "Invalid JSON request!", http.StatusBadRequest)
+			log.Println("Rejecting the request as the JSON body is invalid: ", err)
+			return nil, false
+		}
+	}
+	if isProtobufRequest(r) {
+		var err error
+		if req, err = decodeHashRequest(r.Body); err != nil {
+			http.Error(w, "Invalid protobuf request!", http.StatusBadRequest)
+			log.Println("Rejecting the request as the protobuf body is invalid: ", err)
+			return nil, false
+		}
+	}
+	if req.Algorithm == "" {
+		req.Algorithm = DefaultAlgorithm
+	}
+	if req.Namespace == "" {
+		req.Namespace = DefaultNamespace
+	}
+	if err := validateTags(req.Tags); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if _, ok := hashAlgorithms[req.Algorithm]; !ok {
+		http.Error(w, "Unsupported hash algorithm!", http.StatusBadRequest)
+		log.Println("Rejecting the request as the hash algorithm is not supported: ", req.Algorithm)
+		return nil, false
+	}
+	var err error
+	if req.Encoding, err = resolveEncoding(req.Algorithm, req.Encoding); err != nil {
+		http.Error(w, "Unsupported hash encoding!", http.StatusBadRequest)
+		log.Println("Rejecting the request: ", err)
+		return nil, false
+	}
+	return req, true
+}
+
+// readMultipartForm parses the multipart form of the request, limited to MaxMultipartSize, and returns the content
+// of its `password_file` part, if any. A trailing line break of the file is not part of the password.
+// If the form is invalid, it writes an error response and returns false.
+func readMultipartForm(w http.ResponseWriter, r *http.Request) (string, bool) {
+	r.Body = http.MaxBytesReader(w, r.Body, MaxMultipartSize)
+	if err := r.ParseMultipartForm(MaxMultipartSize); err != nil {
+		http.Error(w, "Invalid multipart form!", http.StatusBadRequest)
+		log.Println("Rejecting the request as the multipart form is invalid: ", err)
+		return "", false
+	}
+	f, _, err := r.FormFile("password_file")
+	if errors.Is(err, http.ErrMissingFile) {
+		return "", true
+	} else if err != nil {
+		http.Error(w, "Invalid password file!", http.StatusBadRequest)
+		return "", false
+	}
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		http.Error(w, "Invalid password file!", http.StatusBadRequest)
+		return "", false
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(string(data), "\n"), "\r"), true
+}
+
+// isMultipartRequest reports whether the request body is a multipart form.
+func isMultipartRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
+// isJSONRequest reports whether the request body is JSON encoded.
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == "application/json"
+}
+
+// queueHash computes the hash of the password and pushes it to inboundRequests after the preprocessing delay.
+// The command is logged with the id of the request held by ctx, which may be done before it is processed.
+func (s *Server) queueHash(ctx context.Context, id int, req *HashRequest) {
+	s.queueSetHash(&Command{requestType: SetHashCommand, password: req.Password, algorithm: req.Algorithm, encoding: req.Encoding, namespace: req.Namespace, tags: req.Tags, id: id, requestID: requestIDFrom(ctx), clientIdentity: clientIdentityFrom(ctx)})
+}
+
+// queueSetHash replaces the password of the SetHashCommand by its hash, and pushes it to inboundRequests after the
+// preprocessing delay.
+func (s *Server) queueSetHash(c *Command) {
+	// The computation can be killed by `/admin/kill/{id}`, which then marks the id as failed.
+	ctx, computation := s.computations.Start(c.id)
 	go func() {
-		time.Sleep(PreprocessingDelay * time.Second)
+		if c.algorithm != IdentityAlgorithm {
+			select {
+			case <-time.After(s.cfg.HashPreprocessingDelay):
+			case <-ctx.Done():
+				return
+			}
+		}
 		c.requestStartTs = time.Now().UnixMicro()
 
-		// Perform Sha512 and base64 encode.
-		s512 := sha512.Sum512([]byte(c.password))
-		s512Str := string(s512[:])
-		c.password = b64.StdEncoding.EncodeToString([]byte(s512Str))
-		s.inboundRequests <- *c
+		password, pepperVersion := s.pepper.Apply(s.normalizer.String(c.password))
+		hash, err := computeHash(password, c.algorithm, c.encoding)
+		if !s.computations.Finish(c.id, computation) {
+			log.Println("Discarding the killed hash computation for id: ", c.id)
+			return
+		}
+		if err != nil {
+			log.Printf("Cannot hash the password for id %d: %v", c.id, err)
+			s.pending.Send(s.inboundRequests, Command{requestType: FailHashCommand, id: c.id})
+			return
+		}
+		c.password = hash
+		c.pepperVersion = pepperVersion
+		s.pending.Send(s.inboundRequests, *c)
 	}()
 }
 
 // statsHandler handles the GET requests to `/stats` endpoint.
 func (s *Server) statsHandler(w http.ResponseWriter, r *http.Request) {
 	// If the server is being termintaed, reject new requests.
-	if s.isTerminated {
+	if s.isTerminated.Load() {
 		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
 		return
 	}
-	// Reject the request if not of type 'POST'.
-	if r.Method != http.MethodGet {
-		fmt.Fprintf(w, "Only GET methods are supported for `/stats` endpoint!\n")
-		log.Println("Rejecting the request as it is not of type 'GET'.")
-		return
-	}
 
 	// Get current stats.
-	resChan := make(chan string)
-	s.inboundRequests <- Command{requestType: GetStatsCommand, responseChannel: resChan}
-	resp := <-resChan
+	res := s.send(r.Context(), Command{requestType: GetStatsCommand})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	resp := res.value
+	if acceptsProtobuf(r) {
+		stats := &Stats{}
+		if !decodeResult(w, res, stats) {
+			return
+		}
+		writeProtobuf(w, stats.protobuf())
+		return
+	}
 	fmt.Fprintf(w, "%s\n", resp)
-	close(resChan)
 }
 
-// shutdownHandler handles the `/shutdown` endpoint.
+// resetStatsHandler handles the admin only POST requests to `/admin/stats/reset` endpoint.
+// The stats restart from zero, while the hash ids keep increasing.
+func (s *Server) resetStatsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if res := s.send(r.Context(), Command{requestType: ResetStatsCommand}); res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	s.audit.Record("reset-stats", r, nil)
+	log.Println("Stats reset.")
+	fmt.Fprintf(w, "Stats reset.\n")
+}
+
+// shutdownHandler handles the admin only POST requests to `/shutdown` endpoint.
 func (s *Server) shutdownHandler(w http.ResponseWriter, r *http.Request) {
-	s.isTerminated = true
-	fmt.Fprintf(w, "Terminating the server...%d\n", len(s.inboundRequests))
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	if !s.isShuttingDown.CompareAndSwap(false, true) {
+		fmt.Fprintf(w, "The server is already being terminated...\n")
+		return
+	}
+	s.audit.Record("shutdown", r, nil)
+	fmt.Fprintf(w, "Terminating the server...%d\n", s.inboundRequests.Len())
+	go s.shutdown()
+}
 
-	// Do a graceful shutdown. Wait for pending requests to finish before termintaing.
-	time.Sleep(PreprocessingDelay * time.Second)
-	go func() {
-		for len(s.inboundRequests) > 0 {
-			time.Sleep(1 * time.Second)
-			log.Printf("Pending inboundRequests: %d", len(s.inboundRequests))
-			log.Printf("Waiting for pending requests to finish...")
-		}
-		// close channel
-		close(s.inboundRequests)
-		os.Exit(0)
-	}()
+// shutdown does a graceful shutdown. The `--pre-shutdown-webhook` is notified first, and requests keep being served
+// during the `--pre-shutdown-delay`. New requests are then answered with 503 during the grace delay, so that load
+// balancers stop routing to the server, then it stops accepting connections and waits for pending requests to finish.
+func (s *Server) shutdown() {
+	if s.cfg.PreShutdownWebhook != "" {
+		s.notifyPreShutdown()
+		time.Sleep(s.cfg.PreShutdownDelay)
+	}
+	s.isTerminated.Store(true)
+	time.Sleep(s.cfg.ShutdownGraceDelay)
+	for _, server := range []*http.Server{s.httpServer, s.adminServer} {
+		if server == nil {
+			continue
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), s.cfg.ShutdownGraceDelay)
+		if err := server.Shutdown(ctx); err != nil {
+			log.Println("Cannot wait for the connections to close: ", err)
+			server.Close()
+		}
+		cancel()
+	}
+	for s.inboundRequests.Len() > 0 {
+		time.Sleep(1 * time.Second)
+		log.Printf("Pending inboundRequests: %d", s.inboundRequests.Len())
+		log.Printf("Waiting for pending requests to finish...")
+	}
+	// close channel
+	s.inboundRequests.Close()
+	close(s.done)
 }
 
-var setHashRegex = regexp.MustCompile(`/hash$`)      // to match `/hash` endpoint.
-var getHashRegex = regexp.MustCompile(`/hash/\d`)    // to match `/hash/{id}` endpoint.
-var statsRegex = regexp.MustCompile(`/stats$`)       // to match `/stats` endpoint.
-var shutdownRegex = regexp.MustCompile(`/shutdown$`) // to match `/shutdown` endpoint.
+var hashIDRegex = regexp.MustCompile(`/hash/(\d+)`) // to extract the id from `/hash/{id}` endpoints.
 
-// MatchHandlers matches endpoints to their handlers.
+// MatchHandlers matches endpoints to their handlers, by method and path: requests to an endpoint with an unsupported
+// method are answered with 405 and the supported ones in the Allow header, and requests to unknown paths with 404.
+// Endpoints are served under APIPrefix; unversioned paths are redirected there while legacy routes are enabled.
+// The admin endpoints are answered with 404 when they are served by the admin server, see matchAdminHandlers.
 func (s *Server) matchHandlers(w http.ResponseWriter, r *http.Request) {
-	switch {
-	case getHashRegex.MatchString(r.URL.Path):
-		s.getHashHandler(w, r)
-	case setHashRegex.MatchString(r.URL.Path):
-		s.setHashHandler(w, r)
-	case statsRegex.MatchString(r.URL.Path):
-		s.statsHandler(w, r)
-	case shutdownRegex.MatchString(r.URL.Path):
-		s.shutdownHandler(w, r)
-	default:
-		w.Write([]byte("This endopint is not supported by the server. Try ['/hash'|'/hash/{id}'|'/stats'|'/shutdown']\n"))
+	s.serveRoutes(w, r, false)
+}
+
+// serveRoutes serves the request on the admin server if admin, or the public server otherwise.
+func (s *Server) serveRoutes(w http.ResponseWriter, r *http.Request, admin bool) {
+	defer recoverPanic(w, r)
+	r = withRequestID(w, r)
+	r = withClientIdentity(r)
+	if !s.checkACL(w, r) {
+		return
+	}
+	if !s.checkRequestTimestamp(w, r) {
+		return
 	}
+	if !decompressBody(w, r) {
+		return
+	}
+	if s.isTerminated.Load() {
+		// Connection: close makes HTTP/1.1 clients reconnect elsewhere, and sends a GOAWAY frame on HTTP/2 connections.
+		w.Header().Set("Connection", "close")
+		http.Error(w, "Cannot accept new requests, the server is being terminated...", http.StatusServiceUnavailable)
+		return
+	}
+	if s.isPaused.Load() {
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "The store is being snapshotted, try again later!", http.StatusServiceUnavailable)
+		return
+	}
+	if !s.servesPath(r.URL.Path, admin) {
+		writeEndpointNotFound(w, admin)
+		return
+	}
+	path, versioned := strings.CutPrefix(r.URL.Path, APIPrefix)
+	if !versioned || !strings.HasPrefix(path, "/") {
+		if e, _ := s.route(r.Method, r.URL.Path); e != nil && s.cfg.APIVersion == APIVersionAll {
+			redirectToVersioned(w, r)
+			return
+		}
+		path = ""
+	}
+	e, handler := s.route(r.Method, path)
+	if e == nil {
+		writeEndpointNotFound(w, admin)
+		return
+	}
+	if handler == nil {
+		s.writeMethodNotAllowed(w, r, e)
+		return
+	}
+	if !protobufPatterns[e.Pattern] && acceptsOnlyProtobuf(r) {
+		http.Error(w, "This endpoint does not support Protobuf responses.", http.StatusNotAcceptable)
+		return
+	}
+	start := time.Now()
+	s.withTimeout(path, handler)(w, r)
+	s.metrics.Observe(endpointName(e.Name, r), time.Since(start))
+}
+
+// writeEndpointNotFound writes the 404 response to a request to a path not served by the admin server if admin,
+// or by the public server otherwise.
+func writeEndpointNotFound(w http.ResponseWriter, admin bool) {
+	if admin {
+		http.Error(w, "This endpoint is not served on the admin port. Try ['/v1/admin/...'|'/v1/metrics/histogram']", http.StatusNotFound)
+		return
+	}
+	http.Error(w, "This endopint is not supported by the server. Try ['/v1/hash'|'/v1/hash/stream'|'/v1/hash/random'|'/v1/hash/{id}'|'/v1/hash/{id}/versions'|'/v1/hash/{id}/algorithm'|'/v1/hash/{id}/raw-algorithm'|'/v1/hash/{id}/recompute'|'/v1/hash/{id}/touch'|'/v1/hash/{id}/expiry'|'/v1/hash/{id}/subscribe'|'/v1/hash/{id}/notify-ready'|'/v1/hash/{id}/clone'|'/v1/hash/{id}/copy'|'/v1/hash/{id}/raw'|'/v1/hash/{id}/hex'|'/v1/hash/{id}/base64'|'/v1/hash/{id}/hmac'|'/v1/hash/{id}/sign'|'/v1/hash/{id}/signed'|'/v1/hash/{id}/info'|'/v1/hash/{id}/qr'|'/v1/hash/{id}/link'|'/v1/hash/{id}/preview'|'/v1/hash/{id}/benchmark'|'/v1/hash/{id}/tags'|'/v1/hash/{id}/annotate'|'/v1/hash/{id}/annotations'|'/v1/hash/{id}/metadata'|'/v1/hash/{id}/tags/{tag}'|'/v1/hashes'|'/v1/hash/{id}/permanent'|'/v1/hash/{id}/restore'|'/v1/hashes/bulk'|'/v1/hashes/search'|'/v1/stats'|'/v1/stats/history'|'/v1/stats/hourly'|'/v1/events'|'/v1/events/count'|'/v1/health'|'/v1/config'|'/v1/shutdown']", http.StatusNotFound)
+}
+
+// redirectToVersioned permanently redirects a legacy, unversioned request to its APIPrefix equivalent.
+func redirectToVersioned(w http.ResponseWriter, r *http.Request) {
+	target := APIPrefix + r.URL.Path
+	if r.URL.RawQuery != "" {
+		target += "?" + r.URL.RawQuery
+	}
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Sunset", LegacyRoutesSunset.Format(http.TimeFormat))
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
 }
 
 // main starts the server.
 func main() {
-	server := &Server{inboundRequests: CreatePasswordStore()}
+	cfg, err := ParseConfig(os.Args[1:])
+	if err != nil {
+		log.Fatal("Invalid configuration: ", err)
+	}
+	setupLogging(cfg)
+	if cfg.AllowInsecureAlgorithms {
+		enableInsecureAlgorithms()
+		slog.Warn("The insecure identity algorithm is enabled, storing the passwords in clear: do not use in production!")
+	}
+	if cfg.Benchmark {
+		if err := runBenchmark(cfg); err != nil {
+			slog.Error("Benchmark failed", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+	publisher, err := NewEventPublisher(cfg)
+	if err != nil {
+		log.Fatal("Cannot create event publisher: ", err)
+	}
+	audit, err := OpenAuditLog(cfg.AuditLogFile)
+	if err != nil {
+		log.Fatal("Cannot open audit log: ", err)
+	}
+	storeOpts := StoreOptions{Publisher: publisher, DeprecatedAlgorithms: cfg.DeprecatedAlgorithms}
+	if storeOpts.Signer, err = LoadHashSigner(cfg.SignHashesKey); err != nil {
+		log.Fatal("Cannot read the hash signing key: ", err)
+	}
+	if cfg.DebugStoreLog {
+		storeOpts.Logger = newStoreLogger()
+	}
+	if cfg.WALFile != "" {
+		if storeOpts.WAL, storeOpts.WALEntries, err = OpenWAL(cfg.WALFile); err != nil {
+			log.Fatal("Cannot open write-ahead log: ", err)
+		}
+		// The log only holds the entries written since the latest snapshot.
+		if storeOpts.Snapshot, err = latestSnapshot(cfg.SnapshotDir); err != nil {
+			log.Fatal("Cannot read the latest snapshot: ", err)
+		}
+	}
+	server := NewServer(cfg, storeOpts, audit)
+	if server.pepper, err = LoadPepper(cfg.PepperFile); err != nil {
+		log.Fatal("Cannot read the pepper: ", err)
+	}
+	reloadPepperOnSignal(server.pepper)
+	if server.keystore, err = LoadKeystore(cfg.KeystoreDir); err != nil {
+		log.Fatal("Cannot read the keystore: ", err)
+	}
+	warmup, err := LoadWarmup(cfg.WarmupFile)
+	if err != nil {
+		log.Fatal("Cannot read the warmup file: ", err)
+	}
+	server.startWarmup(warmup)
+	if cfg.TombstoneRetention > 0 {
+		startTombstonePurger(server.inboundRequests, server.pending, cfg.TombstoneRetention)
+	}
+	if cfg.AutoPurgeAfter > 0 {
+		startAutoPurger(server.inboundRequests, server.pending, cfg.AutoPurgeAfter)
+	}
+	startExpiryPurger(server.inboundRequests, server.pending)
+	startStatsHistory(server.inboundRequests, server.pending)
+	shutdownOnSignal(server)
+	if !cfg.Quiet {
+		PrintBanner(cfg, os.Stderr)
+	}
+	if cfg.AdminPort > 0 {
+		startAdminServer(server)
+	}
 	http.HandleFunc("/", server.matchHandlers)
-	http.ListenAndServe(DefaultPort, nil)
+	server.httpServer = &http.Server{Addr: DefaultPort, WriteTimeout: cfg.WriteTimeout}
+	if cfg.TLSCertFile != "" {
+		if server.httpServer.TLSConfig, err = newTLSConfig(cfg); err != nil {
+			log.Fatal("Cannot read the TLS client CA: ", err)
+		}
+		err = server.httpServer.ListenAndServeTLS(cfg.TLSCertFile, cfg.TLSKeyFile)
+	} else {
+		err = server.httpServer.ListenAndServe()
+	}
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-server.done
 }
@@ -0,0 +1,5121 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"math"
+	"math/big"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	hashserverpb "github.com/KetanA/JC-Golang/proto"
+	natsserver "github.com/nats-io/nats-server/v2/test"
+	"github.com/nats-io/nats.go"
+	"google.golang.org/protobuf/proto"
+)
+
+// TestAdminToken is the `--admin-token` of the test servers.
+const TestAdminToken = "test-admin-token"
+
+// TestHashDelay is the `--hash-delay` of the test servers, short enough for the tests to wait for the hashes.
+const TestHashDelay = 50 * time.Millisecond
+
+// TestMain silences the logs of the servers under test, which log every request.
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// StatusError is the error of a test request answered with an unexpected status code.
+type StatusError struct {
+	Code int
+	Body string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status %d: %s", e.Code, strings.TrimSpace(e.Body))
+}
+
+// TestServer serves the public and admin endpoints of a Server, and its password store, in process.
+type TestServer struct {
+	Server *httptest.Server
+	Client *http.Client
+	// s is the server under test, whose store can be sent commands directly.
+	s *Server
+}
+
+// NewTestServer starts a TestServer, configured with a short `--hash-delay` and TestAdminToken, the admin
+// endpoints being served on the same port. The configure functions apply further settings before it starts.
+// The server is closed once the test and its subtests complete.
+func NewTestServer(t testing.TB, configure ...func(*Config)) *TestServer {
+	t.Helper()
+	return NewTestServerWithStore(t, StoreOptions{}, configure...)
+}
+
+// NewTestServerWithStore is NewTestServer with the options of the store.
+func NewTestServerWithStore(t testing.TB, opts StoreOptions, configure ...func(*Config)) *TestServer {
+	t.Helper()
+	cfg, err := ParseConfig([]string{"--quiet", "--admin-port", "0", "--admin-token", TestAdminToken,
+		"--hash-delay", TestHashDelay.String(), "--shutdown-grace", "0s", "--snapshot-dir", t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range configure {
+		c(cfg)
+	}
+	opts.DeprecatedAlgorithms = cfg.DeprecatedAlgorithms
+	s := NewServer(cfg, opts, nil)
+	ts := &TestServer{Server: httptest.NewServer(http.HandlerFunc(s.matchHandlers)), s: s}
+	ts.Client = ts.Server.Client()
+	t.Cleanup(ts.close)
+	return ts
+}
+
+// close stops serving, and stops the store once the hashes being computed are stored.
+func (ts *TestServer) close() {
+	ts.Server.Close()
+	for deadline := time.Now().Add(5 * time.Second); ts.s.ids.HasPending() && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-ts.s.done:
+		// The store has been stopped by a shutdown.
+	default:
+		ts.s.inboundRequests.Close()
+	}
+}
+
+// Do sends a request to the path, prefixed with APIPrefix, and returns the status code and the body of the response.
+// Its header holds the pairs of names and values of headers, set after the TestAdminToken every request is sent with.
+func (ts *TestServer) Do(method, path, body string, header ...string) (int, string, error) {
+	req, err := http.NewRequest(method, ts.Server.URL+APIPrefix+path, strings.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+TestAdminToken)
+	if strings.HasPrefix(body, "{") {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := ts.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(b), err
+}
+
+// PostHash posts the password to `/hash`, and returns the id of its hash.
+func (ts *TestServer) PostHash(password string) (int, error) {
+	body, _ := json.Marshal(&HashRequest{Password: password})
+	code, resp, err := ts.Do(http.MethodPost, "/hash", string(body))
+	if err != nil {
+		return 0, err
+	}
+	if code != http.StatusOK {
+		return 0, &StatusError{code, resp}
+	}
+	return strconv.Atoi(strings.TrimSpace(resp))
+}
+
+// GetHash returns the hash of the id, or a *StatusError, e.g. with http.StatusAccepted while it is being computed.
+func (ts *TestServer) GetHash(id int) (string, error) {
+	code, resp, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", id), "")
+	if err != nil {
+		return "", err
+	}
+	if code != http.StatusOK {
+		return "", &StatusError{code, resp}
+	}
+	return strings.TrimSpace(resp), nil
+}
+
+// WaitHash returns the hash of the id once computed, retrying while it is pending.
+func (ts *TestServer) WaitHash(id int) (string, error) {
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(TestHashDelay / 5) {
+		hash, err := ts.GetHash(id)
+		if e, ok := err.(*StatusError); !ok || e.Code != http.StatusAccepted || time.Now().After(deadline) {
+			return hash, err
+		}
+	}
+}
+
+// GetStats returns the stats of `/stats`.
+func (ts *TestServer) GetStats() (*Stats, error) {
+	code, resp, err := ts.Do(http.MethodGet, "/stats", "")
+	if err != nil {
+		return nil, err
+	}
+	if code != http.StatusOK {
+		return nil, &StatusError{code, resp}
+	}
+	stats := &Stats{}
+	return stats, json.Unmarshal([]byte(resp), stats)
+}
+
+// isStatus reports whether err is a *StatusError of the status code.
+func isStatus(err error, code int) bool {
+	var e *StatusError
+	return errors.As(err, &e) && e.Code == code
+}
+
+// mustPostHashes posts the passwords and waits for their hashes, returning their ids.
+func (ts *TestServer) mustPostHashes(t testing.TB, passwords ...string) []int {
+	t.Helper()
+	ids := make([]int, len(passwords))
+	for i, password := range passwords {
+		id, err := ts.PostHash(password)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = id
+	}
+	for _, id := range ids {
+		if _, err := ts.WaitHash(id); err != nil {
+			t.Fatalf("GET /hash/%d: %v", id, err)
+		}
+	}
+	return ids
+}
+
+// waitFor waits until cond holds, failing the test once 5 seconds have passed.
+func waitFor(t testing.TB, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(TestHashDelay / 5) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+// FormHeader is the header of the form encoded test requests.
+var FormHeader = []string{"Content-Type", "application/x-www-form-urlencoded"}
+
+func TestTestServer(t *testing.T) {
+	ts := NewTestServer(t)
+	id, err := ts.PostHash("angryMonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != 1 {
+		t.Errorf("PostHash() = %d, want 1", id)
+	}
+	hash, err := ts.WaitHash(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The SHA-512 of angryMonkey, base64 encoded.
+	if want := "ZEHhWB65gUlzdVwtDQArEyx+KVLzp/aTaRaPlBzYRIFj6vjFdqEb0Q5B8zVKCZ0vKbZPZklJz0Fd7su2A+gf7Q=="; hash != want {
+		t.Errorf("GetHash() = %q, want %q", hash, want)
+	}
+	stats, err := ts.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalNum != 1 {
+		t.Errorf("GetStats().TotalNum = %d, want 1", stats.TotalNum)
+	}
+}
+
+// TestStatsBeforeHashes checks that `/stats` answers valid JSON with an average of 0 before any hash is posted,
+// instead of the NaN of a division by zero.
+func TestStatsBeforeHashes(t *testing.T) {
+	ts := NewTestServer(t)
+	code, body, err := ts.Do(http.MethodGet, "/stats", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats map[string]any
+	if code != http.StatusOK || json.Unmarshal([]byte(body), &stats) != nil {
+		t.Fatalf("GET /stats = %d %q, want valid JSON", code, body)
+	}
+	if stats["total"] != 0.0 || stats["average"] != 0.0 || !strings.Contains(body, `"average":0`) {
+		t.Errorf("GET /stats = %s, want a total and an average of 0", body)
+	}
+}
+
+// TestEndpoints smoke tests the endpoints, in order on the same server holding the hashes 1 to 3.
+func TestEndpoints(t *testing.T) {
+	ts := NewTestServer(t)
+	ts.mustPostHashes(t, "first", "second", "third")
+	if code, body, err := ts.Do(http.MethodPost, "/hash/1/tags", "tags=subject:alice", "Content-Type", "application/x-www-form-urlencoded"); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /hash/1/tags = %d %q, %v", code, body, err)
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{http.MethodGet, "/hash/1", "", http.StatusOK},
+		{http.MethodGet, "/hash/1?version=1", "", http.StatusOK},
+		{http.MethodGet, "/hash/99", "", http.StatusNotFound},
+		{http.MethodGet, "/hash/abc", "", http.StatusNotFound},
+		{http.MethodPost, "/hash", `{"password":"fourth"}`, http.StatusOK},
+		{http.MethodPost, "/hash", `{"password":`, http.StatusBadRequest},
+		{http.MethodPost, "/hash/1", `{"password":"first","algorithm":"sha256"}`, http.StatusOK},
+		{http.MethodGet, "/hash/2/versions", "", http.StatusOK},
+		{http.MethodGet, "/hash/2/algorithm", "", http.StatusOK},
+		{http.MethodGet, "/hash/2/raw-algorithm", "", http.StatusOK},
+		{http.MethodGet, "/hash/2/raw", "", http.StatusOK},
+		{http.MethodGet, "/hash/2/hex", "", http.StatusOK},
+		{http.MethodGet, "/hash/2/base64", "", http.StatusOK},
+		{http.MethodGet, "/hash/2/hmac?key=00ff", "", http.StatusOK},
+		{http.MethodGet, "/hash/2/info", "", http.StatusOK},
+		{http.MethodGet, "/hash/2/qr", "", http.StatusOK},
+		{http.MethodGet, "/hash/2/link", "", http.StatusNotImplemented},
+		{http.MethodGet, "/hash/2/preview", "", http.StatusOK},
+		{http.MethodPost, "/hash/2/touch", "", http.StatusOK},
+		{http.MethodPut, "/hash/2/expiry", `{"ttl":"2h"}`, http.StatusOK},
+		{http.MethodPost, "/hash/2/tags", "tags=prod", http.StatusOK},
+		{http.MethodDelete, "/hash/2/tags/prod", "", http.StatusOK},
+		{http.MethodPatch, "/hash/2/metadata", `{"tags":["eu"]}`, http.StatusOK},
+		{http.MethodPost, "/hash/2/annotate", `{"key":"env","value":"prod"}`, http.StatusOK},
+		{http.MethodGet, "/hash/2/annotations", "", http.StatusOK},
+		{http.MethodGet, "/hashes", "", http.StatusOK},
+		{http.MethodGet, "/hashes?tag=eu", "", http.StatusOK},
+		{http.MethodGet, "/hashes/bulk?ids=1,2", "", http.StatusOK},
+		{http.MethodGet, "/hashes/search?algorithm=sha512", "", http.StatusOK},
+		{http.MethodGet, "/stats", "", http.StatusOK},
+		{http.MethodGet, "/stats/history", "", http.StatusOK},
+		{http.MethodGet, "/stats/hourly", "", http.StatusOK},
+		{http.MethodGet, "/events", "", http.StatusOK},
+		{http.MethodGet, "/events/count", "", http.StatusOK},
+		{http.MethodGet, "/health", "", http.StatusOK},
+		{http.MethodGet, "/config", "", http.StatusOK},
+		{http.MethodGet, "/metrics/histogram?endpoint=setHash", "", http.StatusOK},
+		{http.MethodGet, "/admin/subject/alice/export", "", http.StatusOK},
+		{http.MethodGet, "/admin/export/csv", "", http.StatusOK},
+		{http.MethodGet, "/admin/top-accessed", "", http.StatusOK},
+		{http.MethodGet, "/admin/algorithm-distribution", "", http.StatusOK},
+		{http.MethodGet, "/admin/commands/pending", "", http.StatusOK},
+		{http.MethodGet, "/admin/inspect/2", "", http.StatusOK},
+		{http.MethodGet, "/admin/failed-webhooks", "", http.StatusOK},
+		{http.MethodGet, "/admin/log-level", "", http.StatusOK},
+		{http.MethodGet, "/admin/report?format=json", "", http.StatusOK},
+		{http.MethodPost, "/admin/snapshot?name=smoke", "", http.StatusOK},
+		{http.MethodGet, "/admin/snapshots", "", http.StatusOK},
+		{http.MethodPost, "/admin/stats/reset", "", http.StatusOK},
+		{http.MethodPost, "/admin/load-test", "", http.StatusForbidden},
+		{http.MethodPost, "/admin/stress-store", "", http.StatusForbidden},
+		{http.MethodPost, "/admin/force-flush", "", http.StatusForbidden},
+		{http.MethodPost, "/admin/reconfigure-channel?capacity=100", "", http.StatusOK},
+		{http.MethodPost, "/hash/3/clone", "", http.StatusOK},
+		{http.MethodDelete, "/hash/3", "", http.StatusOK},
+		{http.MethodGet, "/hash/3", "", http.StatusGone},
+		{http.MethodPost, "/hash/3/restore", "", http.StatusOK},
+		{http.MethodDelete, "/hash/3/permanent", "", http.StatusOK},
+		{http.MethodDelete, "/admin/subject/alice", "", http.StatusOK},
+		{http.MethodPost, "/admin/gc", "", http.StatusBadRequest},
+		{http.MethodPut, "/stats", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/unknown", "", http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			header := []string{}
+			if strings.Contains(tt.body, "=") && !strings.HasPrefix(tt.body, "{") {
+				header = append(header, "Content-Type", "application/x-www-form-urlencoded")
+			}
+			code, body, err := ts.Do(tt.method, tt.path, tt.body, header...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.want {
+				t.Errorf("status = %d, want %d: %s", code, tt.want, strings.TrimSpace(body))
+			}
+		})
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ts := NewTestServer(t)
+	// The server is only shut down by an authenticated POST.
+	if code, body, err := ts.Do(http.MethodGet, "/shutdown", ""); err != nil || code != http.StatusMethodNotAllowed {
+		t.Errorf("GET /shutdown = %d %q, %v, want %d", code, body, err, http.StatusMethodNotAllowed)
+	}
+	if code, body, err := ts.Do(http.MethodPost, "/shutdown", "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("POST /shutdown without the admin token = %d %q, %v, want %d", code, body, err, http.StatusUnauthorized)
+	}
+	if ts.s.isShuttingDown.Load() {
+		t.Fatal("the server is shutting down after the rejected requests")
+	}
+	code, body, err := ts.Do(http.MethodPost, "/shutdown", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code != http.StatusOK || !strings.HasPrefix(body, "Terminating the server") {
+		t.Fatalf("POST /shutdown = %d %q", code, body)
+	}
+	<-ts.s.done
+	if code, _, err := ts.Do(http.MethodGet, "/stats", ""); err == nil && code != http.StatusServiceUnavailable {
+		t.Errorf("GET /stats after the shutdown = %d, want %d or a connection error", code, http.StatusServiceUnavailable)
+	}
+}
+
+// TestShutdownDelays checks that requests are served during the `--pre-shutdown-delay`, then rejected, and that the
+// hash being computed is stored within the `--shutdown-grace` before the store stops.
+func TestShutdownDelays(t *testing.T) {
+	const preShutdownDelay, grace = 200 * time.Millisecond, 500 * time.Millisecond
+	webhook := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	t.Cleanup(webhook.Close)
+	ts := NewTestServer(t, func(cfg *Config) {
+		cfg.HashPreprocessingDelay = 2 * preShutdownDelay
+		cfg.PreShutdownWebhook = webhook.URL
+		cfg.PreShutdownDelay = preShutdownDelay
+		cfg.ShutdownGraceDelay = grace
+	})
+	id, err := ts.PostHash("angryMonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if code, body, err := ts.Do(http.MethodPost, "/shutdown", ""); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /shutdown = %d %q, %v", code, body, err)
+	}
+	if code, body, err := ts.Do(http.MethodGet, "/stats", ""); err != nil || code != http.StatusOK {
+		t.Errorf("GET /stats during the pre-shutdown delay = %d %q, %v, want %d", code, body, err, http.StatusOK)
+	}
+	time.Sleep(preShutdownDelay + 50*time.Millisecond)
+	if code, body, err := ts.Do(http.MethodGet, "/stats", ""); err != nil || code != http.StatusServiceUnavailable {
+		t.Errorf("GET /stats after the pre-shutdown delay = %d %q, %v, want %d", code, body, err, http.StatusServiceUnavailable)
+	}
+	// The store keeps processing the in-flight commands during the grace delay.
+	for {
+		res := ts.s.send(context.Background(), Command{requestType: GetHashCommand, id: id})
+		if res.err == nil {
+			if res.value != testHash("angryMonkey") {
+				t.Errorf("hash stored during the grace delay = %s, want %s", res.value, testHash("angryMonkey"))
+			}
+			break
+		}
+		if !errors.Is(res.err, ErrHashPending) || time.Since(start) > preShutdownDelay+grace {
+			t.Fatalf("GET of the hash being computed during the grace delay: %v", res.err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	select {
+	case <-ts.s.done:
+		if elapsed := time.Since(start); elapsed < preShutdownDelay+grace {
+			t.Errorf("store stopped after %v, want after the pre-shutdown and grace delays of %v", elapsed, preShutdownDelay+grace)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the store has not stopped")
+	}
+}
+
+// matchesPattern reports whether the unversioned path matches the endpoint pattern segment by segment, `{id}`
+// matching the digits of a hash id and any other `{...}` a non-empty segment.
+func matchesPattern(pattern, path string) bool {
+	want, got := strings.Split(pattern, "/"), strings.Split(path, "/")
+	if len(want) != len(got) {
+		return false
+	}
+	for i, segment := range want {
+		switch {
+		case segment == "{id}":
+			if got[i] == "" || strings.Trim(got[i], "0123456789") != "" {
+				return false
+			}
+		case strings.HasPrefix(segment, "{"):
+			if got[i] == "" {
+				return false
+			}
+		case segment != got[i]:
+			return false
+		}
+	}
+	return true
+}
+
+// FuzzMatchHandlers fuzzes the paths of GET requests, which must be answered with a known status code without
+// panicking or leaking goroutines, and only be routed to an endpoint whose pattern they match.
+func FuzzMatchHandlers(f *testing.F) {
+	for _, e := range endpoints {
+		f.Add(APIPrefix + strings.ReplaceAll(patternParamRegex.ReplaceAllString(e.Pattern, "1"), "//", "/"))
+	}
+	for _, path := range []string{"/", "/v1", "/v1/", "/v2/stats", "/hash/1", "/v1/hash/-1", "/v1/hash/1/", "/v1//hash/1",
+		"/v1/hash/99999999999999999999", "/v1/hash/1/tags/%2F", "/v1/admin/../stats", "/v1/hash/\x00"} {
+		f.Add(path)
+	}
+	ts := NewTestServer(f)
+	ts.mustPostHashes(f, "first")
+	known := map[int]bool{}
+	for _, code := range []int{http.StatusOK, http.StatusAccepted, http.StatusMovedPermanently, http.StatusBadRequest,
+		http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound, http.StatusMethodNotAllowed, http.StatusGone,
+		http.StatusNotImplemented, http.StatusServiceUnavailable} {
+		known[code] = true
+	}
+	baseline := runtime.NumGoroutine()
+	f.Fuzz(func(t *testing.T, path string) {
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+		r := &http.Request{Method: http.MethodGet, URL: &url.URL{Path: path}, RequestURI: path, Header: http.Header{},
+			Body: http.NoBody, Host: "localhost", RemoteAddr: "127.0.0.1:1234", Proto: "HTTP/1.1", ProtoMajor: 1, ProtoMinor: 1}
+		r = r.WithContext(context.Background())
+		w := httptest.NewRecorder()
+		ts.s.matchHandlers(w, r)
+		if !known[w.Code] {
+			t.Errorf("GET %q = %d: %s", path, w.Code, strings.TrimSpace(w.Body.String()))
+		}
+		if unversioned, ok := strings.CutPrefix(path, APIPrefix); ok {
+			if e, _ := ts.s.route(http.MethodGet, unversioned); e != nil && !matchesPattern(e.Pattern, unversioned) {
+				t.Errorf("GET %q is routed to `%s` endpoint", path, e.Pattern)
+			}
+		}
+		for deadline := time.Now().Add(time.Second); runtime.NumGoroutine() > baseline+10; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("GET %q leaked %d goroutines", path, runtime.NumGoroutine()-baseline)
+			}
+		}
+	})
+}
+
+// FuzzSetHashJSON fuzzes the JSON bodies of POST /hash, which must be answered with the id of the hash or a 4xx
+// status code, never a 5xx one, without panicking or leaking goroutines.
+func FuzzSetHashJSON(f *testing.F) {
+	for _, body := range []string{
+		`{"password":"angryMonkey"}`,
+		`{"password":"angryMonkey","algorithm":"sha256"}`,
+		`{"password":"angryMonkey","algorithm":"sha512","namespace":"acme","tags":["prod","eu"],"encoding":"hex"}`,
+		`{"password":"angry\u0000Monkey"}`,
+		"{\"password\":\"angry\x00Monkey\"}",
+		`{"password":"` + strings.Repeat("a", 1<<16) + `"}`,
+		`{"password":{"nested":{"deeper":["angryMonkey",{"a":[[[]]]}]}}}`,
+		`{"password":"סיסמה‮yeknoMyrgna"}`,
+		`{"password":"مرحبا","tags":["‏عربي"]}`,
+		`{"password":""}`,
+		`{"password":null}`,
+		`{"password":1e400}`,
+		`{"password":"a","password":"b"}`,
+		`{"password":"a"}{"password":"b"}`,
+		`[]`,
+		`{`,
+		`null`,
+	} {
+		f.Add(body)
+	}
+	// The hashes are stored without delay, for the fuzzing not to wait for them.
+	ts := NewTestServer(f, func(cfg *Config) { cfg.HashPreprocessingDelay = 0 })
+	baseline := runtime.NumGoroutine()
+	f.Fuzz(func(t *testing.T, body string) {
+		r := httptest.NewRequest(http.MethodPost, APIPrefix+"/hash", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.s.matchHandlers(w, r)
+		switch resp := strings.TrimSpace(w.Body.String()); {
+		case w.Code == http.StatusOK:
+			if _, err := strconv.Atoi(resp); err != nil {
+				t.Errorf("POST /hash %q = %q, want a hash id", body, resp)
+			}
+		case w.Code < 400 || w.Code >= 500:
+			t.Errorf("POST /hash %q = %d: %s", body, w.Code, resp)
+		}
+		for deadline := time.Now().Add(5 * time.Second); ts.s.ids.HasPending() || runtime.NumGoroutine() > baseline+10; time.Sleep(10 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("POST /hash %q leaked %d goroutines", body, runtime.NumGoroutine()-baseline)
+			}
+		}
+	})
+}
+
+// StoreTest sends commands to a password store for a test, the ids being issued by the test.
+type StoreTest struct {
+	t   testing.TB
+	ids *IDCounter
+	q   *CommandQueue
+}
+
+// NewStoreTest creates a password store of the options, stopped once the test completes.
+func NewStoreTest(t testing.TB, opts StoreOptions) *StoreTest {
+	if opts.IDs == nil {
+		opts.IDs = &IDCounter{}
+	}
+	st := &StoreTest{t: t, ids: opts.IDs, q: CreatePasswordStore(opts)}
+	t.Cleanup(st.q.Close)
+	return st
+}
+
+// Send sends the command to the store and returns its result.
+func (st *StoreTest) Send(c Command) Result {
+	st.t.Helper()
+	c.responseChannel = make(chan Result, 1)
+	st.q.Send(c)
+	select {
+	case res := <-c.responseChannel:
+		return res
+	case <-time.After(5 * time.Second):
+		st.t.Fatalf("no response to the %s", c.requestType)
+		return Result{}
+	}
+}
+
+// SetHash stores the SHA-512 hash of the password under a new id, and returns the id. The command has no response,
+// it is processed before the commands sent after it.
+func (st *StoreTest) SetHash(password string) int {
+	id := st.ids.Next()
+	st.q.Send(Command{requestType: SetHashCommand, id: id, password: testHash(password), algorithm: "sha512",
+		requestStartTs: time.Now().Add(-time.Millisecond).UnixMicro()})
+	return id
+}
+
+// testHash returns the base64 encoded SHA-512 of the password.
+func testHash(password string) string {
+	sum := sha512.Sum512([]byte(password))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// decodeStats decodes the stats of a GetStatsCommand.
+func decodeStats(t *testing.T, res Result) *Stats {
+	t.Helper()
+	stats := &Stats{}
+	if err := json.Unmarshal([]byte(res.value), stats); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func TestCreatePasswordStore(t *testing.T) {
+	tests := []struct {
+		name string
+		// setup prepares the store, and returns the id the command is sent for.
+		setup   func(st *StoreTest) int
+		command Command
+		wantErr error
+		// want is contained in the value of the result, or check checks the result.
+		want  string
+		check func(t *testing.T, res Result)
+	}{
+		{
+			name:    "GetHash existing id",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: GetHashCommand},
+			want:    testHash("angryMonkey"),
+		},
+		{
+			name:    "GetHash missing id",
+			setup:   func(st *StoreTest) int { st.SetHash("angryMonkey"); return 99 },
+			command: Command{requestType: GetHashCommand},
+			wantErr: ErrHashNotFound,
+		},
+		{
+			name:    "GetHash pending id",
+			setup:   func(st *StoreTest) int { return st.ids.Next() },
+			command: Command{requestType: GetHashCommand},
+			wantErr: ErrHashPending,
+		},
+		{
+			name: "GetHash deleted id",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("angryMonkey")
+				st.Send(Command{requestType: DeleteHashCommand, id: id})
+				return id
+			},
+			command: Command{requestType: GetHashCommand},
+			wantErr: ErrHashDeleted,
+		},
+		{
+			name: "GetHash failed id",
+			setup: func(st *StoreTest) int {
+				id := st.ids.Next()
+				st.Send(Command{requestType: FailHashCommand, id: id})
+				return id
+			},
+			command: Command{requestType: GetHashCommand},
+			wantErr: ErrHashFailed,
+		},
+		{
+			name:    "GetHash missing version",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: GetHashCommand, version: 2},
+			wantErr: ErrVersionNotFound,
+		},
+		{
+			name: "SetHash and GetHash",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("first")
+				st.q.Send(Command{requestType: SetHashCommand, id: id, password: testHash("second"), algorithm: "sha512"})
+				return id
+			},
+			command: Command{requestType: GetHashCommand},
+			want:    testHash("second"),
+		},
+		{
+			name: "SetHash compare-and-swap of a modified hash",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("first")
+				st.q.Send(Command{requestType: SetHashCommand, id: id, password: testHash("second"), algorithm: "sha512", expectedHash: testHash("other")})
+				return id
+			},
+			command: Command{requestType: GetHashCommand},
+			want:    testHash("first"),
+		},
+		{
+			name:    "SetHash compare-and-swap response",
+			setup:   func(st *StoreTest) int { return st.SetHash("first") },
+			command: Command{requestType: SetHashCommand, password: testHash("second"), algorithm: "sha512", expectedHash: testHash("other")},
+			wantErr: ErrHashMismatch,
+		},
+		{
+			name:    "GetRawHash",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: GetRawHashCommand},
+			check: func(t *testing.T, res Result) {
+				if want := sha512.Sum512([]byte("angryMonkey")); res.value != string(want[:]) {
+					t.Errorf("value = %x, want %x", res.value, want)
+				}
+			},
+		},
+		{
+			name:    "GetRawHash missing id",
+			setup:   func(st *StoreTest) int { return 1 },
+			command: Command{requestType: GetRawHashCommand},
+			wantErr: ErrHashNotFound,
+		},
+		{
+			name:    "DeleteHash missing id",
+			setup:   func(st *StoreTest) int { return 1 },
+			command: Command{requestType: DeleteHashCommand},
+			wantErr: ErrHashNotFound,
+		},
+		{
+			name: "DeleteHash deleted id",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("angryMonkey")
+				st.Send(Command{requestType: DeleteHashCommand, id: id})
+				return id
+			},
+			command: Command{requestType: DeleteHashCommand},
+			wantErr: ErrHashDeleted,
+		},
+		{
+			name: "RestoreHash deleted id",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("angryMonkey")
+				st.Send(Command{requestType: DeleteHashCommand, id: id})
+				st.Send(Command{requestType: RestoreHashCommand, id: id})
+				return id
+			},
+			command: Command{requestType: GetHashCommand},
+			want:    testHash("angryMonkey"),
+		},
+		{
+			name:    "RestoreHash not deleted id",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: RestoreHashCommand},
+			wantErr: ErrHashNotDeleted,
+		},
+		{
+			name: "PermanentDeleteHash",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("angryMonkey")
+				st.Send(Command{requestType: PermanentDeleteHashCommand, id: id})
+				return id
+			},
+			command: Command{requestType: RestoreHashCommand},
+			wantErr: ErrHashNotFound,
+		},
+		{
+			name:    "GetVersions",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: GetVersionsCommand},
+			want:    `"hash":"` + testHash("angryMonkey") + `"`,
+		},
+		{
+			name: "GetVersions after a SetHash",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("first")
+				st.q.Send(Command{requestType: SetHashCommand, id: id, password: testHash("second"), algorithm: "sha512"})
+				return id
+			},
+			command: Command{requestType: GetHashCommand, version: 1},
+			want:    testHash("first"),
+		},
+		{
+			name: "BulkGetHash",
+			setup: func(st *StoreTest) int {
+				st.SetHash("first")
+				st.SetHash("second")
+				return 0
+			},
+			command: Command{requestType: BulkGetHashCommand, ids: []int{1, 2, 3}},
+			want:    testHash("second"),
+		},
+		{
+			name: "ListHashes",
+			setup: func(st *StoreTest) int {
+				st.SetHash("first")
+				st.SetHash("second")
+				return 0
+			},
+			command: Command{requestType: ListHashesCommand, filter: &SearchFilter{}},
+			want:    `"ids":[1,2]`,
+		},
+		{
+			name:    "AddTags",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: AddTagsCommand, tags: []string{"prod", "eu"}},
+			want:    `"tags":["eu","prod"]`,
+		},
+		{
+			name: "RemoveTag",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("angryMonkey")
+				st.Send(Command{requestType: AddTagsCommand, id: id, tags: []string{"prod", "eu"}})
+				return id
+			},
+			command: Command{requestType: RemoveTagCommand, tags: []string{"prod"}},
+			want:    `"tags":["eu"]`,
+		},
+		{
+			name:    "AnnotateHash",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: AnnotateHashCommand, annotation: [2]string{"env", "prod"}},
+			want:    `"env":"prod"`,
+		},
+		{
+			name:    "PatchMetadata pending id",
+			setup:   func(st *StoreTest) int { return st.ids.Next() },
+			command: Command{requestType: PatchMetadataCommand, metadataPatch: &MetadataPatch{}},
+			wantErr: ErrHashPending,
+		},
+		{
+			name:    "GetAlgorithm",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: GetAlgorithmCommand},
+			want:    `"sha512"`,
+		},
+		{
+			name:    "CompareAlgorithm mismatch",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: CompareAlgorithmCommand, algorithm: "sha256"},
+			wantErr: ErrAlgorithmMismatch,
+		},
+		{
+			name:    "CompareHash",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: CompareHashCommand, expectedHash: testHash("angryMonkey")},
+			want:    `"sha512"`,
+		},
+		{
+			name:    "CompareHash mismatch",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: CompareHashCommand, expectedHash: testHash("other")},
+			wantErr: ErrHashMismatch,
+		},
+		{
+			name:    "GetHashInfo pending id",
+			setup:   func(st *StoreTest) int { return st.ids.Next() },
+			command: Command{requestType: GetHashInfoCommand},
+			wantErr: ErrHashPending,
+		},
+		{
+			name: "TouchHash",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("angryMonkey")
+				st.Send(Command{requestType: TouchHashCommand, id: id})
+				return id
+			},
+			command: Command{requestType: GetHashInfoCommand},
+			want:    `"accessCount":1`,
+		},
+		{
+			name:    "CloneHash",
+			setup:   func(st *StoreTest) int { return st.SetHash("angryMonkey") },
+			command: Command{requestType: CloneHashCommand, targetID: 2},
+			want:    "2",
+		},
+		{
+			name: "GetEventCount",
+			setup: func(st *StoreTest) int {
+				id := st.SetHash("angryMonkey")
+				st.Send(Command{requestType: DeleteHashCommand, id: id})
+				return id
+			},
+			command: Command{requestType: GetEventCountCommand},
+			want:    `"count":2`,
+		},
+		{
+			name:    "GetStats with zero requests",
+			setup:   func(st *StoreTest) int { return 0 },
+			command: Command{requestType: GetStatsCommand},
+			check: func(t *testing.T, res Result) {
+				if stats := decodeStats(t, res); stats.TotalNum != 0 || stats.AverageTime != 0 {
+					t.Errorf("TotalNum, AverageTime = %d, %v, want 0, 0", stats.TotalNum, stats.AverageTime)
+				}
+			},
+		},
+		{
+			name: "GetStats after several requests",
+			setup: func(st *StoreTest) int {
+				st.SetHash("first")
+				st.SetHash("second")
+				st.SetHash("third")
+				return 0
+			},
+			command: Command{requestType: GetStatsCommand},
+			check: func(t *testing.T, res Result) {
+				if stats := decodeStats(t, res); stats.TotalNum != 3 || stats.AverageTime <= 0 {
+					t.Errorf("TotalNum, AverageTime = %d, %v, want 3, > 0", stats.TotalNum, stats.AverageTime)
+				}
+			},
+		},
+		{
+			name: "GetStats after a pending request",
+			setup: func(st *StoreTest) int {
+				st.SetHash("first")
+				st.ids.Next()
+				return 0
+			},
+			command: Command{requestType: GetStatsCommand},
+			check: func(t *testing.T, res Result) {
+				if stats := decodeStats(t, res); stats.TotalNum != 2 {
+					t.Errorf("TotalNum = %d, want 2", stats.TotalNum)
+				}
+			},
+		},
+		{
+			name: "ResetStats",
+			setup: func(st *StoreTest) int {
+				st.SetHash("first")
+				st.SetHash("second")
+				st.Send(Command{requestType: ResetStatsCommand})
+				st.SetHash("third")
+				return 0
+			},
+			command: Command{requestType: GetStatsCommand},
+			check: func(t *testing.T, res Result) {
+				if stats := decodeStats(t, res); stats.TotalNum != 1 || stats.AverageTime <= 0 {
+					t.Errorf("TotalNum, AverageTime = %d, %v, want 1, > 0", stats.TotalNum, stats.AverageTime)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := NewStoreTest(t, StoreOptions{})
+			c := tt.command
+			c.id = tt.setup(st)
+			res := st.Send(c)
+			if !errors.Is(res.err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", res.err, tt.wantErr)
+			}
+			if !strings.Contains(res.value, tt.want) {
+				t.Errorf("value = %q, want it to contain %q", res.value, tt.want)
+			}
+			if tt.check != nil {
+				tt.check(t, res)
+			}
+		})
+	}
+}
+
+// TestHashLifecycle checks that a hash is pending until the `--hash-delay` has elapsed, and is then retrievable.
+func TestHashLifecycle(t *testing.T) {
+	const delay = 200 * time.Millisecond
+	ts := NewTestServer(t, func(cfg *Config) { cfg.HashPreprocessingDelay = delay })
+	posted := time.Now()
+	id, err := ts.PostHash("angryMonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", id), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pending := &PendingResponse{}
+	if code != http.StatusAccepted || json.Unmarshal([]byte(body), pending) != nil || pending.Status != "pending" {
+		t.Fatalf("GET /hash/%d before the delay = %d %q, want %d and a pending status", id, code, body, http.StatusAccepted)
+	}
+	if strings.Contains(body, InvalidHashIDMessage) {
+		t.Errorf("GET /hash/%d before the delay = %q, want no %q", id, body, InvalidHashIDMessage)
+	}
+	// WaitHash retries while the hash is pending, so the hash must only be retrieved once the delay has elapsed.
+	hash, err := ts.WaitHash(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(posted); elapsed < delay {
+		t.Errorf("hash retrieved after %v, before the delay of %v", elapsed, delay)
+	}
+	digest, err := base64.StdEncoding.DecodeString(hash)
+	if err != nil || len(digest) != sha512.Size {
+		t.Fatalf("GET /hash/%d = %q, want a base64 encoded SHA-512", id, hash)
+	}
+	if want := testHash("angryMonkey"); hash != want {
+		t.Errorf("GET /hash/%d = %q, want %q", id, hash, want)
+	}
+	stats, err := ts.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.TotalNum != 1 {
+		t.Errorf("GetStats().TotalNum = %d, want 1", stats.TotalNum)
+	}
+}
+
+// BenchmarkSetHash measures concurrent POST /hash requests, which issue the hash ids without a round-trip through
+// the store goroutine. The "store round-trip" benchmark adds one before each request, as when the ids were counted
+// by the store, for comparison.
+func BenchmarkSetHash(b *testing.B) {
+	ts := NewTestServer(b)
+	var n atomic.Int64
+	post := func() {
+		body := fmt.Sprintf(`{"password":"password-%d"}`, n.Add(1))
+		r := httptest.NewRequest(http.MethodPost, APIPrefix+"/hash", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		ts.s.matchHandlers(w, r)
+		if w.Code != http.StatusOK {
+			b.Errorf("POST /hash = %d: %s", w.Code, strings.TrimSpace(w.Body.String()))
+		}
+	}
+	b.Run("handler", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				post()
+			}
+		})
+	})
+	b.Run("store round-trip", func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ts.s.send(context.Background(), Command{requestType: GetEventCountCommand})
+				post()
+			}
+		})
+	})
+}
+
+// TestRecompute checks that a hash is recomputed with the pepper rotated since it was stored, only with its password.
+func TestRecompute(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	before, err := ts.GetHash(ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	pepper := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("p", MinPepperSize)))
+	if code, body, err := ts.Do(http.MethodPost, "/admin/reload-pepper", `{"version":2,"pepper":"`+pepper+`"}`); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /admin/reload-pepper = %d %q, %v", code, body, err)
+	}
+	code, recomputed, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/recompute", ids[0]), "password=angryMonkey", "Content-Type", "application/x-www-form-urlencoded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recomputed = strings.TrimSpace(recomputed)
+	if code != http.StatusOK || recomputed == before {
+		t.Fatalf("POST /hash/%d/recompute = %d %q, want a hash other than %q", ids[0], code, recomputed, before)
+	}
+	if after, err := ts.GetHash(ids[0]); err != nil || after != recomputed {
+		t.Errorf("GET /hash/%d = %q, %v, want %q", ids[0], after, err, recomputed)
+	}
+
+	// The requests are limited to one per RecomputeInterval, so the wrong password is sent to another server.
+	ts = NewTestServer(t)
+	ids = ts.mustPostHashes(t, "angryMonkey")
+	code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/recompute", ids[0]), "password=other", "Content-Type", "application/x-www-form-urlencoded")
+	if err != nil || code != http.StatusUnauthorized {
+		t.Errorf("POST /hash/%d/recompute with a wrong password = %d %q, %v, want %d", ids[0], code, body, err, http.StatusUnauthorized)
+	}
+	if hash, err := ts.GetHash(ids[0]); err != nil || hash != testHash("angryMonkey") {
+		t.Errorf("GET /hash/%d after a wrong password = %q, %v, want it unchanged", ids[0], hash, err)
+	}
+}
+
+// TestStoreConcurrency stresses the store with commands sent at once by many goroutines, to be run with `-race`.
+func TestStoreConcurrency(t *testing.T) {
+	const goroutines = 500
+	st := NewStoreTest(t, StoreOptions{})
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			password := fmt.Sprintf("password-%d", i)
+			id := st.SetHash(password)
+			for _, c := range []Command{{requestType: GetHashCommand, id: id}, {requestType: GetStatsCommand}} {
+				c.responseChannel = make(chan Result, 1)
+				st.q.Send(c)
+				res := <-c.responseChannel
+				switch {
+				case res.err != nil:
+					t.Errorf("%s for id %d: %v", c.requestType, id, res.err)
+				case c.requestType == GetHashCommand && res.value != testHash(password):
+					t.Errorf("GetHash for id %d = %q, want %q", id, res.value, testHash(password))
+				}
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	for id := 1; id <= goroutines; id++ {
+		if res := st.Send(Command{requestType: GetHashCommand, id: id}); res.err != nil {
+			t.Errorf("GetHash for id %d: %v", id, res.err)
+		}
+	}
+	stats := decodeStats(t, st.Send(Command{requestType: GetStatsCommand}))
+	if stats.TotalNum != goroutines {
+		t.Errorf("GetStats().TotalNum = %d, want %d", stats.TotalNum, goroutines)
+	}
+	if st.ids.HasPending() {
+		t.Errorf("%d ids are still pending", st.ids.PendingCount())
+	}
+}
+
+// TestResizeUnderLoad checks that resizing the queue while the store is busy and its channel full neither blocks the
+// senders nor loses their commands.
+func TestResizeUnderLoad(t *testing.T) {
+	const goroutines, hashes = 8, 25
+	st := NewStoreTest(t, StoreOptions{})
+	st.q.Resize(1)
+	// The store is busy until its response to the stats command is read.
+	busy := make(chan Result)
+	st.q.Send(Command{requestType: GetStatsCommand, responseChannel: busy})
+	for st.q.Len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	for st.q.TrySend(Command{requestType: GetEventCountCommand, responseChannel: make(chan Result, 1)}) {
+	}
+	// notBlocked fails the test if f blocks, resuming the store for the queue to be closed.
+	notBlocked := func(name string, f func()) {
+		t.Helper()
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			f()
+		}()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			<-busy
+			t.Fatalf("%s is blocked by the resize", name)
+		}
+	}
+	resized := make(chan struct{})
+	go func() {
+		defer close(resized)
+		for _, capacity := range []int{4, 1, 16} {
+			st.q.Resize(capacity)
+		}
+	}()
+	// The first resize waits for the store to take its SwitchChannelCommand, queued to the full channel.
+	notBlocked("the swap of the channel", func() {
+		for st.q.Cap() != 4 {
+			time.Sleep(time.Millisecond)
+		}
+	})
+	var mu sync.Mutex
+	passwords := make(map[int]string)
+	var wg sync.WaitGroup
+	for i := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range hashes {
+				password := fmt.Sprintf("password-%d-%d", i, j)
+				id := st.SetHash(password)
+				mu.Lock()
+				passwords[id] = password
+				mu.Unlock()
+			}
+		}()
+	}
+	notBlocked("TrySend", func() {
+		st.q.TrySend(Command{requestType: GetEventCountCommand, responseChannel: make(chan Result, 1)})
+	})
+	<-busy
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		<-resized
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the senders or the resize are blocked")
+	}
+	if len(passwords) != goroutines*hashes {
+		t.Fatalf("%d hashes sent, want %d", len(passwords), goroutines*hashes)
+	}
+	for id, password := range passwords {
+		if res := st.Send(Command{requestType: GetHashCommand, id: id}); res.err != nil || res.value != testHash(password) {
+			t.Errorf("GetHash for id %d = %q, %v, want %q", id, res.value, res.err, testHash(password))
+		}
+	}
+	if got := st.q.Cap(); got != 16 {
+		t.Errorf("capacity = %d, want 16", got)
+	}
+}
+
+// TestQueueLenDuringResize checks that the commands left in the replaced channel are counted until processed.
+func TestQueueLenDuringResize(t *testing.T) {
+	st := NewStoreTest(t, StoreOptions{})
+	paused, resume := make(chan Result, 1), make(chan struct{})
+	st.q.Send(Command{requestType: DrainAndPauseCommand, snapshot: &Snapshot{}, resume: resume, responseChannel: paused})
+	<-paused
+	send := func(n int) {
+		for range n {
+			st.q.Send(Command{requestType: GetEventCountCommand, responseChannel: make(chan Result, 1)})
+		}
+	}
+	send(3)
+	st.q.Resize(8)
+	send(2)
+	// The SwitchChannelCommand is queued after the commands of the replaced channel.
+	if got, want := st.q.Len(), 3+1+2; got != want {
+		t.Errorf("Len() while resizing = %d, want %d", got, want)
+	}
+	close(resume)
+	waitFor(t, "the queued commands to be processed", func() bool { return st.q.Len() == 0 })
+	if got, want := st.q.Cap(), 8; got != want {
+		t.Errorf("Cap() = %d, want %d", got, want)
+	}
+}
+
+// TestCachedAccesses checks that the hashes returned from the cache are counted as accesses.
+func TestCachedAccesses(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	for range 3 {
+		if _, err := ts.GetHash(ids[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if hits, _ := ts.s.cache.Counts(); hits < 2 {
+		t.Fatalf("cache hits = %d, want at least 2", hits)
+	}
+	// WaitHash retrieved the hash once more.
+	code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/info", ids[0]), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &HashInfo{}
+	if code != http.StatusOK || json.Unmarshal([]byte(body), info) != nil || info.AccessCount != 4 {
+		t.Errorf("GET /hash/%d/info = %d %q, want an accessCount of 4", ids[0], code, body)
+	}
+}
+
+// TestDeprecatedCachedHash checks that the SHA-512 hashes are returned with the Warning header once sha512 is
+// deprecated, whether they are retrieved from the store or from the cache.
+func TestDeprecatedCachedHash(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.DeprecatedAlgorithms = []string{"sha512"} })
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	for i := range 3 {
+		resp, err := ts.Client.Get(fmt.Sprintf("%s%s/hash/%d", ts.Server.URL, APIPrefix, ids[0]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Warning") != DeprecatedAlgorithmWarning {
+			t.Errorf("GET #%d = %d, Warning %q, want 200 and %q", i, resp.StatusCode, resp.Header.Get("Warning"), DeprecatedAlgorithmWarning)
+		}
+	}
+	if hits, _ := ts.s.cache.Counts(); hits < 3 {
+		t.Errorf("cache hits = %d, want at least 3", hits)
+	}
+}
+
+func TestPepperReload(t *testing.T) {
+	path := t.TempDir() + "/pepper"
+	write := func(pepper string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(pepper), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(strings.Repeat("1", MinPepperSize))
+	p, err := LoadPepper(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, version := p.Apply("angryMonkey")
+	if version != FilePepperVersion {
+		t.Fatalf("Apply() version = %d, want %d", version, FilePepperVersion)
+	}
+	if err := p.Add(5, []byte(strings.Repeat("5", MinPepperSize))); err != nil {
+		t.Fatal(err)
+	}
+	// An unchanged file, e.g. on a stray SIGHUP, keeps the version added by the admin active.
+	if version, err := p.Reload(); err != nil || version != FilePepperVersion || p.ActiveVersion() != 5 {
+		t.Errorf("Reload() of the unchanged file = %d, %v, active %d, want %d, nil, active 5", version, err, p.ActiveVersion(), FilePepperVersion)
+	}
+	write(strings.Repeat("2", MinPepperSize))
+	if version, err := p.Reload(); err != nil || version != 6 || p.ActiveVersion() != 6 {
+		t.Errorf("Reload() of the changed file = %d, %v, active %d, want 6, nil, active 6", version, err, p.ActiveVersion())
+	}
+	if again, ok := p.ApplyVersion("angryMonkey", FilePepperVersion); !ok || again != first {
+		t.Errorf("ApplyVersion(%d) = %q, %v after the reload, want %q", FilePepperVersion, again, ok, first)
+	}
+	write("short")
+	if _, err := p.Reload(); err == nil || p.ActiveVersion() != 6 {
+		t.Errorf("Reload() of a short pepper = %v, active %d, want an error, active 6", err, p.ActiveVersion())
+	}
+}
+
+// TestTopAccessed checks that the hashes are ranked by all their retrievals, including those from the cache.
+func TestTopAccessed(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "first", "second")
+	for range 3 {
+		if _, err := ts.GetHash(ids[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	code, body, err := ts.Do(http.MethodGet, "/admin/top-accessed?n=2", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var top []TopAccessedEntry
+	if code != http.StatusOK || json.Unmarshal([]byte(body), &top) != nil {
+		t.Fatalf("GET /admin/top-accessed = %d %q", code, body)
+	}
+	// WaitHash retrieved each hash once.
+	if len(top) != 2 || top[0].ID != ids[1] || top[0].AccessCount != 4 || top[1].ID != ids[0] || top[1].AccessCount != 1 {
+		t.Errorf("GET /admin/top-accessed = %s, want id %d accessed 4 times then id %d accessed once", body, ids[1], ids[0])
+	}
+}
+
+// TestDedupRemoved checks that a password posted again within the dedup window gets a new id once its hash is gone.
+func TestDedupRemoved(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.DedupWindow = time.Minute })
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	if id, err := ts.PostHash("angryMonkey"); err != nil || id != ids[0] {
+		t.Fatalf("PostHash() again = %d, %v, want %d", id, err, ids[0])
+	}
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", ids[0]), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %q, %v", ids[0], code, body, err)
+	}
+	id, err := ts.PostHash("angryMonkey")
+	if err != nil || id == ids[0] {
+		t.Fatalf("PostHash() after the deletion = %d, %v, want a new id", id, err)
+	}
+	if _, err := ts.WaitHash(id); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ids are reissued by the compaction of the store, the hash of angryMonkey getting id 1 and the next one id 2.
+	ts = NewTestServer(t, func(cfg *Config) { cfg.DedupWindow = time.Minute })
+	ids = ts.mustPostHashes(t, "first", "angryMonkey", "second")
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d/permanent", ids[0]), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d/permanent = %d %q, %v", ids[0], code, body, err)
+	}
+	if code, body, err := ts.Do(http.MethodPost, "/admin/gc?confirm=true", ""); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /admin/gc = %d %q, %v", code, body, err)
+	}
+	if id, err = ts.PostHash("angryMonkey"); err != nil || id == ids[1] {
+		t.Fatalf("PostHash() after the compaction = %d, %v, want an id other than %d", id, err, ids[1])
+	}
+	if hash, err := ts.WaitHash(id); err != nil || hash != testHash("angryMonkey") {
+		t.Errorf("GET /hash/%d = %q, %v, want %q", id, hash, err, testHash("angryMonkey"))
+	}
+}
+
+func TestServesPath(t *testing.T) {
+	s := &Server{cfg: &Config{AdminPort: 9000}}
+	tests := []struct {
+		path          string
+		public, admin bool
+	}{
+		{"/v1/hash/1", true, false},
+		{"/v1/stats", true, false},
+		{"/v1/admin/gc", false, true},
+		{"/v1/debug/pprof/", false, true},
+		{"/v1/metrics", false, true},
+		{"/v1/metrics/histogram", false, true},
+		{"/metrics/histogram", false, true},
+	}
+	for _, tt := range tests {
+		if got := s.servesPath(tt.path, false); got != tt.public {
+			t.Errorf("servesPath(%q, false) = %v, want %v", tt.path, got, tt.public)
+		}
+		if got := s.servesPath(tt.path, true); got != tt.admin {
+			t.Errorf("servesPath(%q, true) = %v, want %v", tt.path, got, tt.admin)
+		}
+	}
+}
+
+// PanicCommand is a command type unknown to the store goroutine, which panics when processing it.
+const PanicCommand CommandType = -1
+
+// sendPanic sends a PanicCommand to the store goroutine of the server, and returns its result.
+func (ts *TestServer) sendPanic(t testing.TB) Result {
+	t.Helper()
+	res := make(chan Result, 1)
+	ts.s.inboundRequests.Send(Command{requestType: PanicCommand, responseChannel: res})
+	select {
+	case r := <-res:
+		return r
+	case <-time.After(5 * time.Second):
+		t.Fatal("no response to the PanicCommand")
+		return Result{}
+	}
+}
+
+// TestStorePanic checks that the store keeps serving the requests once restarted after a panic, the commands queued
+// behind the one which panicked being answered with ErrStoreRestarted, and the lost hashes not being recovered from
+// the write-ahead log.
+func TestStorePanic(t *testing.T) {
+	path := t.TempDir() + "/wal.log"
+	wal, _, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := NewTestServerWithStore(t, StoreOptions{WAL: wal})
+	lost := ts.mustPostHashes(t, "first")[0]
+
+	// The store goroutine is paused, so that a command is queued behind the one which panics. Its sender only waits
+	// for the answer some time after the restart, its response channel not being buffered.
+	paused, resume := make(chan Result, 1), make(chan struct{})
+	ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: DrainAndPauseCommand, snapshot: &Snapshot{}, resume: resume, responseChannel: paused})
+	<-paused
+	panicked, queued := make(chan Result, 1), make(chan Result)
+	ts.s.inboundRequests.Send(Command{requestType: PanicCommand, responseChannel: panicked})
+	ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: GetStatsCommand, responseChannel: queued})
+	close(resume)
+	if res := <-panicked; !errors.Is(res.err, ErrStoreRestarted) {
+		t.Errorf("PanicCommand = %q, %v, want %v", res.value, res.err, ErrStoreRestarted)
+	}
+	time.Sleep(50 * time.Millisecond)
+	select {
+	case res := <-queued:
+		if !errors.Is(res.err, ErrStoreRestarted) {
+			t.Errorf("GetStatsCommand queued behind the panic = %q, %v, want %v", res.value, res.err, ErrStoreRestarted)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the GetStatsCommand queued behind the panic is not answered")
+	}
+
+	if code, _, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", lost), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d stored before the restart = %d, %v, want %d", lost, code, err, http.StatusNotFound)
+	}
+	id, err := ts.PostHash("angryMonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash, err := ts.WaitHash(id); err != nil || hash != testHash("angryMonkey") {
+		t.Errorf("GET /hash/%d after the restart = %q, %v, want %q", id, hash, err, testHash("angryMonkey"))
+	}
+	if _, err := ts.GetStats(); err != nil {
+		t.Errorf("GET /stats after the restart: %v", err)
+	}
+
+	// The next start recovers the store as it was after the restart.
+	_, entries, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered := NewStoreTest(t, StoreOptions{WALEntries: entries})
+	if res := recovered.Send(Command{requestType: GetHashCommand, id: lost}); !errors.Is(res.err, ErrHashNotFound) {
+		t.Errorf("recovered hash of id %d lost by the restart = %q, %v, want %v", lost, res.value, res.err, ErrHashNotFound)
+	}
+	if res := recovered.Send(Command{requestType: GetHashCommand, id: id}); res.err != nil || res.value != testHash("angryMonkey") {
+		t.Errorf("recovered hash of id %d = %q, %v, want %q", id, res.value, res.err, testHash("angryMonkey"))
+	}
+}
+
+// TestRepeatedStorePanics checks that the server is shut down once the store goroutine panics more than
+// MaxStorePanics times in StorePanicWindow.
+func TestRepeatedStorePanics(t *testing.T) {
+	ts := NewTestServer(t)
+	for i := range MaxStorePanics {
+		if res := ts.sendPanic(t); !errors.Is(res.err, ErrStoreRestarted) {
+			t.Fatalf("PanicCommand #%d = %q, %v, want %v", i+1, res.value, res.err, ErrStoreRestarted)
+		}
+	}
+	if ts.s.isShuttingDown.Load() {
+		t.Fatalf("the server is shutting down after %d panics", MaxStorePanics)
+	}
+	if _, err := ts.GetStats(); err != nil {
+		t.Fatalf("GET /stats after %d panics: %v", MaxStorePanics, err)
+	}
+	ts.sendPanic(t)
+	select {
+	case <-ts.s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the server is not shut down after %d panics", MaxStorePanics+1)
+	}
+}
+
+// TestForceFlush checks that the hashes are on disk once flushed, being recovered from the write-ahead log left by a
+// server which is not shut down.
+func TestForceFlush(t *testing.T) {
+	path := t.TempDir() + "/wal.log"
+	wal, _, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := NewTestServerWithStore(t, StoreOptions{WAL: wal}, func(cfg *Config) { cfg.WALFile = path })
+	passwords := []string{"first", "second", "third"}
+	ids := ts.mustPostHashes(t, passwords...)
+	code, body, err := ts.Do(http.MethodPost, "/admin/force-flush", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	flushed := &FlushResponse{}
+	if code != http.StatusOK || json.Unmarshal([]byte(body), flushed) != nil || flushed.BytesWritten == 0 {
+		t.Fatalf("POST /admin/force-flush = %d %q, want the bytes written", code, body)
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() != flushed.BytesWritten {
+		t.Errorf("write-ahead log size = %v, %v, want %d", info.Size(), err, flushed.BytesWritten)
+	}
+	// The log is read as after a crash, the server still running.
+	entries, err := readWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered := NewStoreTest(t, StoreOptions{WALEntries: entries})
+	for i, id := range ids {
+		if res := recovered.Send(Command{requestType: GetHashCommand, id: id}); res.err != nil || res.value != testHash(passwords[i]) {
+			t.Errorf("recovered hash of id %d = %q, %v, want %q", id, res.value, res.err, testHash(passwords[i]))
+		}
+	}
+}
+
+// flushCounter is a StorageBackend counting its flushes, each writing 42 bytes.
+type flushCounter struct {
+	flushes atomic.Int64
+}
+
+func (b *flushCounter) Flush() (int64, error) {
+	b.flushes.Add(1)
+	return 42, nil
+}
+
+func TestFlushBackend(t *testing.T) {
+	backend := &flushCounter{}
+	st := NewStoreTest(t, StoreOptions{Backend: backend})
+	res := st.Send(Command{requestType: FlushCommand})
+	if res.err != nil || !strings.Contains(res.value, `"bytesWritten":42`) {
+		t.Errorf("FlushCommand = %q, %v, want 42 bytes written", res.value, res.err)
+	}
+	if n := backend.flushes.Load(); n != 1 {
+		t.Errorf("backend flushed %d times, want 1", n)
+	}
+}
+
+// TestWALRecovery checks that the store is recovered from its write-ahead log after a crash, with the hash whose
+// write was interrupted before its commit, and without the hashes deleted or purged before the crash.
+func TestWALRecovery(t *testing.T) {
+	path := t.TempDir() + "/wal.log"
+	wal, _, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := NewStoreTest(t, StoreOptions{WAL: wal})
+	kept, deleted, removed := st.SetHash("kept"), st.SetHash("deleted"), st.SetHash("removed")
+	st.Send(Command{requestType: AddTagsCommand, id: kept, tags: []string{"prod"}})
+	st.Send(Command{requestType: DeleteHashCommand, id: deleted})
+	st.Send(Command{requestType: PermanentDeleteHashCommand, id: removed})
+	// The crash interrupts the write of the next hash after it is logged.
+	interrupted := st.ids.Next()
+	if err := wal.Append(WALEntry{Op: WALSet, ID: interrupted, Hash: testHash("interrupted"), Algorithm: "sha512"}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, entries, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recovered := NewStoreTest(t, StoreOptions{WALEntries: entries})
+	for id, want := range map[int]string{kept: testHash("kept"), interrupted: testHash("interrupted")} {
+		if res := recovered.Send(Command{requestType: GetHashCommand, id: id}); res.err != nil || res.value != want {
+			t.Errorf("recovered hash of id %d = %q, %v, want %q", id, res.value, res.err, want)
+		}
+	}
+	if res := recovered.Send(Command{requestType: GetHashInfoCommand, id: kept}); !strings.Contains(res.value, `"tags":["prod"]`) {
+		t.Errorf("recovered info of id %d = %q, %v, want the prod tag", kept, res.value, res.err)
+	}
+	if res := recovered.Send(Command{requestType: GetHashCommand, id: deleted}); !errors.Is(res.err, ErrHashDeleted) {
+		t.Errorf("recovered hash of deleted id %d = %q, %v, want %v", deleted, res.value, res.err, ErrHashDeleted)
+	}
+	if res := recovered.Send(Command{requestType: GetHashCommand, id: removed}); !errors.Is(res.err, ErrHashNotFound) {
+		t.Errorf("recovered hash of permanently deleted id %d = %q, %v, want %v", removed, res.value, res.err, ErrHashNotFound)
+	}
+}
+
+// TestEraseSubjectRestart checks that the hashes of an erased subject are not recovered on restart, neither from the
+// snapshot taken before the erasure nor from the write-ahead log, and that none of their data is left on disk.
+func TestEraseSubjectRestart(t *testing.T) {
+	dir := t.TempDir()
+	path := dir + "/wal.log"
+	wal, _, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configure := func(cfg *Config) { cfg.WALFile, cfg.SnapshotDir = path, dir+"/snapshots" }
+	ts := NewTestServerWithStore(t, StoreOptions{WAL: wal}, configure)
+	ids := ts.mustPostHashes(t, "alice-before", "bob")
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/tags", ids[0]), "tags=subject:alice", "Content-Type", "application/x-www-form-urlencoded"); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /hash/%d/tags = %d %q, %v", ids[0], code, body, err)
+	}
+	if code, body, err := ts.Do(http.MethodPost, "/admin/snapshot?name=before", ""); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /admin/snapshot = %d %q, %v", code, body, err)
+	}
+	// The second hash of the subject is only in the write-ahead log.
+	body, _ := json.Marshal(&HashRequest{Password: "alice-after", Tags: []string{"subject:alice"}})
+	code, resp, err := ts.Do(http.MethodPost, "/hash", string(body))
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("POST /hash = %d %q, %v", code, resp, err)
+	}
+	after, _ := strconv.Atoi(strings.TrimSpace(resp))
+	if _, err := ts.WaitHash(after); err != nil {
+		t.Fatal(err)
+	}
+	erased := &EraseResponse{}
+	code, resp, err = ts.Do(http.MethodDelete, "/admin/subject/alice", "")
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), erased) != nil {
+		t.Fatalf("DELETE /admin/subject/alice = %d %q, %v", code, resp, err)
+	}
+	if erased.HashesDeleted != 2 || erased.SnapshotsRewritten != 1 {
+		t.Errorf("DELETE /admin/subject/alice = %s, want 2 hashes deleted and 1 snapshot rewritten", resp)
+	}
+	snapshots, err := listSnapshots(dir + "/snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range append([]string{path}, snapshots[0].File) {
+		if data, err := os.ReadFile(file); err != nil || strings.Contains(string(data), "subject:alice") {
+			t.Errorf("%s holds the data of the erased subject: %v", file, err)
+		}
+	}
+
+	// The server restarts from the latest snapshot and the write-ahead log, as main does.
+	wal, entries, err := OpenWAL(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	snap, err := latestSnapshot(dir + "/snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts = NewTestServerWithStore(t, StoreOptions{WAL: wal, WALEntries: entries, Snapshot: snap}, configure)
+	for _, id := range []int{ids[0], after} {
+		if hash, err := ts.GetHash(id); !isStatus(err, http.StatusNotFound) {
+			t.Errorf("GET /hash/%d after the restart = %q, %v, want %d", id, hash, err, http.StatusNotFound)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodGet, "/hashes/search?tag=subject:alice", ""); err != nil || code != http.StatusOK || !strings.Contains(resp, `"results":[]`) {
+		t.Errorf("GET /hashes/search?tag=subject:alice after the restart = %d %q, %v, want no results", code, resp, err)
+	}
+	if hash, err := ts.GetHash(ids[1]); err != nil || hash != testHash("bob") {
+		t.Errorf("GET /hash/%d after the restart = %q, %v, want %q", ids[1], hash, err, testHash("bob"))
+	}
+}
+
+// TestNATSPublisher checks that the events are published to NATSSubject of a fresh JetStream server, which has no
+// stream until the publisher creates it.
+func TestNATSPublisher(t *testing.T) {
+	opts := natsserver.DefaultTestOptions
+	opts.Port = -1
+	opts.JetStream = true
+	opts.StoreDir = t.TempDir()
+	ns := natsserver.RunServer(&opts)
+	t.Cleanup(ns.Shutdown)
+	nc, err := nats.Connect(ns.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(nc.Close)
+	received := make(chan *nats.Msg, 1)
+	if _, err := nc.ChanSubscribe(NATSSubject, received); err != nil {
+		t.Fatal(err)
+	}
+	publisher, err := NewEventPublisher(&Config{NATSURL: ns.ClientURL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	publisher.Publish(Event{EventID: 1, Timestamp: time.Now(), Type: HashSetEvent, HashID: 42, Algorithm: "sha512"})
+	select {
+	case msg := <-received:
+		var e Event
+		if err := json.Unmarshal(msg.Data, &e); err != nil || e.EventID != 1 || e.HashID != 42 || e.Type != HashSetEvent {
+			t.Errorf("received event %s, %v, want event 1 of hash 42", msg.Data, err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no event received")
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := js.StreamInfo(NATSStream); err != nil || info.State.Msgs != 1 {
+		t.Errorf("stream %s = %+v, %v, want 1 message stored", NATSStream, info, err)
+	}
+}
+
+// getEvents returns the events of `/events` recorded after the since event id.
+func (ts *TestServer) getEvents(t testing.TB, since int64) []Event {
+	t.Helper()
+	code, resp, err := ts.Do(http.MethodGet, fmt.Sprintf("/events?since=%d", since), "")
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("GET /events?since=%d = %d %s, %v", since, code, resp, err)
+	}
+	var events []Event
+	dec := json.NewDecoder(strings.NewReader(resp))
+	for dec.More() {
+		var e Event
+		if err := dec.Decode(&e); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, e)
+	}
+	return events
+}
+
+// TestEventLog checks that the events are returned ordered by id, only the ones after `since`, and that only the
+// latest `--max-events` are kept.
+func TestEventLog(t *testing.T) {
+	const maxEvents = 4
+	ts := NewTestServer(t, func(cfg *Config) { cfg.MaxEvents = maxEvents })
+	ids := ts.mustPostHashes(t, "angryMonkey", "happyMonkey")
+	for range 5 {
+		if _, err := ts.GetHash(ids[0]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", ids[1]), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %s, %v", ids[1], code, resp, err)
+	}
+
+	events := ts.getEvents(t, 0)
+	if len(events) != maxEvents {
+		t.Fatalf("got %d events, want the latest %d: %+v", len(events), maxEvents, events)
+	}
+	for i, e := range events[1:] {
+		if e.EventID != events[i].EventID+1 {
+			t.Errorf("event %d follows event %d, want consecutive ids", e.EventID, events[i].EventID)
+		}
+	}
+	if last := events[len(events)-1]; last.Type != HashDeletedEvent || last.HashID != ids[1] {
+		t.Errorf("last event = %+v, want %s of hash %d", last, HashDeletedEvent, ids[1])
+	}
+	if events[0].EventID <= 1 {
+		t.Errorf("first event id = %d, want the oldest events dropped", events[0].EventID)
+	}
+
+	since := events[1].EventID
+	if got := ts.getEvents(t, since); len(got) != 2 || got[0].EventID != since+1 || got[1].EventID != since+2 {
+		t.Errorf("events since %d = %+v, want events %d and %d", since, got, since+1, since+2)
+	}
+	if got := ts.getEvents(t, events[len(events)-1].EventID); len(got) != 0 {
+		t.Errorf("events since the last one = %+v, want none", got)
+	}
+	code, resp, err := ts.Do(http.MethodGet, "/events/count", "")
+	var count EventCount
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &count) != nil || count.Count != maxEvents {
+		t.Errorf("GET /events/count = %d %s, %v, want %d events", code, resp, err, maxEvents)
+	}
+}
+
+// TestProtobuf checks that the Protobuf responses of `/hash`, `/hash/{id}` and `/stats` carry the same data as their
+// JSON counterparts, and that the other endpoints reject the clients only accepting Protobuf.
+func TestProtobuf(t *testing.T) {
+	ts := NewTestServer(t)
+	body, err := proto.Marshal(&hashserverpb.HashRequest{Password: "angryMonkey"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, resp, err := ts.Do(http.MethodPost, "/hash", string(body), "Content-Type", ProtobufContentType, "Accept", ProtobufContentType)
+	var created hashserverpb.HashResponse
+	if err != nil || code != http.StatusOK || proto.Unmarshal([]byte(resp), &created) != nil || created.Id != 1 {
+		t.Fatalf("POST /hash = %d %q, %v, want a HashResponse of id 1", code, resp, err)
+	}
+	hash, err := ts.WaitHash(int(created.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash != testHash("angryMonkey") {
+		t.Errorf("hash of the Protobuf request = %s, want %s", hash, testHash("angryMonkey"))
+	}
+	code, resp, err = ts.Do(http.MethodGet, "/hash/1", "", "Accept", ProtobufContentType)
+	var value hashserverpb.HashValue
+	if err != nil || code != http.StatusOK || proto.Unmarshal([]byte(resp), &value) != nil {
+		t.Fatalf("GET /hash/1 = %d %q, %v, want a HashValue", code, resp, err)
+	}
+	if value.Id != 1 || value.Hash != hash {
+		t.Errorf("HashValue = %v, want id 1 and hash %s", &value, hash)
+	}
+
+	jsonStats, err := ts.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, resp, err = ts.Do(http.MethodGet, "/stats", "", "Accept", ProtobufContentType)
+	var stats hashserverpb.Stats
+	if err != nil || code != http.StatusOK || proto.Unmarshal([]byte(resp), &stats) != nil {
+		t.Fatalf("GET /stats = %d %q, %v, want a Stats message", code, resp, err)
+	}
+	if stats.Total != int64(jsonStats.TotalNum) || stats.Average != jsonStats.AverageTime || stats.LastPurgeCount != int64(jsonStats.LastPurgeCount) {
+		t.Errorf("Protobuf stats = %v, want the JSON stats %+v", &stats, jsonStats)
+	}
+
+	for _, tc := range []struct {
+		accept string
+		want   int
+	}{
+		{ProtobufContentType, http.StatusNotAcceptable},
+		{ProtobufContentType + ", application/json", http.StatusOK},
+		{"", http.StatusOK},
+	} {
+		if code, resp, err := ts.Do(http.MethodGet, "/health", "", "Accept", tc.accept); err != nil || code != tc.want {
+			t.Errorf("GET /health with Accept %q = %d %s, %v, want %d", tc.accept, code, resp, err, tc.want)
+		}
+	}
+}
+
+// TestLegacyRedirect checks that the unversioned paths are permanently redirected to APIPrefix, with their query, and
+// that the redirects announce the deprecation of the legacy paths.
+func TestLegacyRedirect(t *testing.T) {
+	ts := NewTestServer(t)
+	client := *ts.Client
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	for _, tc := range []struct {
+		method, path, location string
+	}{
+		{http.MethodGet, "/stats", APIPrefix + "/stats"},
+		{http.MethodGet, "/hash/1", APIPrefix + "/hash/1"},
+		{http.MethodGet, "/events?since=3", APIPrefix + "/events?since=3"},
+		{http.MethodPost, "/hash", APIPrefix + "/hash"},
+	} {
+		req, err := http.NewRequest(tc.method, ts.Server.URL+tc.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMovedPermanently {
+			t.Errorf("%s %s = %d, want %d", tc.method, tc.path, resp.StatusCode, http.StatusMovedPermanently)
+		}
+		if got := resp.Header.Get("Location"); got != tc.location {
+			t.Errorf("%s %s redirected to %q, want %q", tc.method, tc.path, got, tc.location)
+		}
+		if got := resp.Header.Get("Deprecation"); got != "true" {
+			t.Errorf("%s %s Deprecation = %q, want true", tc.method, tc.path, got)
+		}
+		if got, err := http.ParseTime(resp.Header.Get("Sunset")); err != nil || !got.Equal(LegacyRoutesSunset) {
+			t.Errorf("%s %s Sunset = %v, %v, want %v", tc.method, tc.path, got, err, LegacyRoutesSunset)
+		}
+	}
+}
+
+// TestTombstoneLifecycle checks that a deleted hash is gone until restored within `--tombstone-retention`, and that
+// its tombstone is permanently removed once the retention has passed.
+func TestTombstoneLifecycle(t *testing.T) {
+	ts := NewTestServer(t)
+	id := ts.mustPostHashes(t, "angryMonkey")[0]
+	deleteHash := func() {
+		t.Helper()
+		if code, resp, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", id), ""); err != nil || code != http.StatusOK {
+			t.Fatalf("DELETE /hash/%d = %d %s, %v", id, code, resp, err)
+		}
+	}
+	purgeTombstones := func(before time.Time) string {
+		t.Helper()
+		res := ts.s.send(context.Background(), Command{requestType: PurgeTombstonesCommand, before: before})
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		return res.value
+	}
+
+	deleteHash()
+	if _, err := ts.GetHash(id); !isStatus(err, http.StatusGone) {
+		t.Fatalf("GET of the deleted hash: %v, want %d", err, http.StatusGone)
+	}
+	if purged := purgeTombstones(time.Now().Add(-time.Hour)); purged != "0" {
+		t.Errorf("purged %s tombstones within the retention, want 0", purged)
+	}
+	if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/restore", id), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /hash/%d/restore = %d %s, %v", id, code, resp, err)
+	}
+	if hash, err := ts.GetHash(id); err != nil || hash != testHash("angryMonkey") {
+		t.Fatalf("GET of the restored hash = %s, %v, want %s", hash, err, testHash("angryMonkey"))
+	}
+
+	deleteHash()
+	if purged := purgeTombstones(time.Now().Add(time.Second)); purged != "1" {
+		t.Errorf("purged %s tombstones after the retention, want 1", purged)
+	}
+	if _, err := ts.GetHash(id); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("GET of the purged hash: %v, want %d", err, http.StatusNotFound)
+	}
+	if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/restore", id), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("POST /hash/%d/restore of the purged hash = %d %s, %v, want %d", id, code, resp, err, http.StatusNotFound)
+	}
+}
+
+// TestHashExpiry checks that extending the TTL of a hash keeps it past its original expiry, and that an expired hash
+// is no longer returned, even before it is purged.
+func TestHashExpiry(t *testing.T) {
+	ts := NewTestServer(t)
+	id := ts.mustPostHashes(t, "angryMonkey")[0]
+	path := fmt.Sprintf("/hash/%d/expiry", id)
+	setTTL := func(ttl string) *ExpiryResponse {
+		t.Helper()
+		code, resp, err := ts.Do(http.MethodPut, path, `{"ttl":"`+ttl+`"}`)
+		expiry := &ExpiryResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), expiry) != nil {
+			t.Fatalf("PUT %s with TTL %s = %d %s, %v", path, ttl, code, resp, err)
+		}
+		return expiry
+	}
+	purgeExpired := func(before time.Time) string {
+		t.Helper()
+		res := ts.s.send(context.Background(), Command{requestType: PurgeExpiredCommand, before: before})
+		if res.err != nil {
+			t.Fatal(res.err)
+		}
+		return res.value
+	}
+
+	start := time.Now()
+	if expiry := setTTL("1h"); expiry.ID != id || expiry.ExpiresAt == nil || expiry.ExpiresAt.Before(start.Add(time.Hour)) {
+		t.Errorf("expiry = %+v, want in 1h", expiry)
+	}
+	if expiry := setTTL("2h"); expiry.ExpiresAt == nil || expiry.ExpiresAt.Before(start.Add(2*time.Hour)) {
+		t.Errorf("extended expiry = %+v, want in 2h", expiry)
+	}
+	if purged := purgeExpired(start.Add(90 * time.Minute)); purged != "0" {
+		t.Errorf("purged %s hashes within the extended TTL, want 0", purged)
+	}
+	if hash, err := ts.GetHash(id); err != nil || hash != testHash("angryMonkey") {
+		t.Errorf("GET within the extended TTL = %s, %v, want %s", hash, err, testHash("angryMonkey"))
+	}
+
+	setTTL("50ms")
+	time.Sleep(100 * time.Millisecond)
+	if _, err := ts.GetHash(id); !isStatus(err, http.StatusGone) {
+		t.Errorf("GET of the expired hash: %v, want %d", err, http.StatusGone)
+	}
+	if purged := purgeExpired(time.Now()); purged != "1" {
+		t.Errorf("purged %s expired hashes, want 1", purged)
+	}
+	if _, err := ts.GetHash(id); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("GET of the purged hash: %v, want %d", err, http.StatusNotFound)
+	}
+	if code, resp, err := ts.Do(http.MethodPut, path, `{"ttl":"1h"}`); err != nil || code != http.StatusNotFound {
+		t.Errorf("PUT %s of the purged hash = %d %s, %v, want %d", path, code, resp, err, http.StatusNotFound)
+	}
+}
+
+// TestHashVersions checks that hashing the password of an id again with another algorithm keeps the previous hash as
+// an older version.
+func TestHashVersions(t *testing.T) {
+	ts := NewTestServer(t)
+	id := ts.mustPostHashes(t, "angryMonkey")[0]
+	if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d", id), "password=angryMonkey&algorithm=sha256", FormHeader...); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /hash/%d = %d %s, %v", id, code, resp, err)
+	}
+	var versions []HashVersion
+	waitFor(t, "the second version", func() bool {
+		code, resp, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/versions", id), "")
+		return err == nil && code == http.StatusOK && json.Unmarshal([]byte(resp), &versions) == nil && len(versions) == 2
+	})
+	sum := sha256.Sum256([]byte("angryMonkey"))
+	sha256Hash := base64.StdEncoding.EncodeToString(sum[:])
+	for i, want := range []HashVersion{{Algorithm: "sha512", Hash: testHash("angryMonkey")}, {Algorithm: "sha256", Hash: sha256Hash}} {
+		if versions[i].Algorithm != want.Algorithm || versions[i].Hash != want.Hash || versions[i].CreatedAt.IsZero() {
+			t.Errorf("version %d = %+v, want the %s hash %s", i+1, versions[i], want.Algorithm, want.Hash)
+		}
+	}
+	for _, tc := range []struct {
+		query string
+		want  string
+	}{
+		{"", sha256Hash},
+		{"?version=1", testHash("angryMonkey")},
+		{"?version=2", sha256Hash},
+	} {
+		if code, resp, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d%s", id, tc.query), ""); err != nil || code != http.StatusOK || strings.TrimSpace(resp) != tc.want {
+			t.Errorf("GET /hash/%d%s = %d %s, %v, want %s", id, tc.query, code, resp, err, tc.want)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d?version=3", id), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d?version=3 = %d %s, %v, want %d", id, code, resp, err, http.StatusNotFound)
+	}
+}
+
+// TestBulkGet checks the hashes, missing and deleted ids returned by `/hashes/bulk`, and its size limit.
+func TestBulkGet(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.MaxBulkSize = 4 })
+	ids := ts.mustPostHashes(t, "first", "second", "third")
+	if code, resp, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", ids[2]), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %s, %v", ids[2], code, resp, err)
+	}
+	for _, tc := range []struct {
+		name, ids string
+		want      BulkGetResponse
+	}{
+		{"all found", "1,2", BulkGetResponse{Hashes: map[int]string{1: testHash("first"), 2: testHash("second")}, Missing: []int{}, Deleted: []int{}}},
+		{"partial hits", "1,3,4", BulkGetResponse{Hashes: map[int]string{1: testHash("first")}, Missing: []int{4}, Deleted: []int{3}}},
+		{"all misses", "5,6", BulkGetResponse{Hashes: map[int]string{}, Missing: []int{5, 6}, Deleted: []int{}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			code, resp, err := ts.Do(http.MethodGet, "/hashes/bulk?ids="+tc.ids, "")
+			var got BulkGetResponse
+			if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &got) != nil {
+				t.Fatalf("GET /hashes/bulk?ids=%s = %d %s, %v", tc.ids, code, resp, err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("GET /hashes/bulk?ids=%s = %+v, want %+v", tc.ids, got, tc.want)
+			}
+		})
+	}
+	if code, resp, err := ts.Do(http.MethodGet, "/hashes/bulk?ids=1,2,3,4,5", ""); err != nil || code != http.StatusBadRequest {
+		t.Errorf("GET of more than --max-bulk-size ids = %d %s, %v, want %d", code, resp, err, http.StatusBadRequest)
+	}
+}
+
+// postHashRequest posts the JSON encoded request to `/hash`, and waits for its hash, returning its id.
+func (ts *TestServer) postHashRequest(t testing.TB, req *HashRequest) int {
+	t.Helper()
+	body, _ := json.Marshal(req)
+	code, resp, err := ts.Do(http.MethodPost, "/hash", string(body))
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("POST /hash %s = %d %s, %v", body, code, resp, err)
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(resp))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ts.WaitHash(id); err != nil {
+		t.Fatalf("GET /hash/%d: %v", id, err)
+	}
+	return id
+}
+
+// TestBulkDelete checks that the hashes deleted by id, or by namespace and creation time, are deleted while the
+// others are intact.
+func TestBulkDelete(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "first", "second", "third")
+	tenant := []int{
+		ts.postHashRequest(t, &HashRequest{Password: "fourth", Namespace: "tenant1"}),
+		ts.postHashRequest(t, &HashRequest{Password: "fifth", Namespace: "tenant1"}),
+	}
+	bulkDelete := func(body string) BulkDeleteResponse {
+		t.Helper()
+		code, resp, err := ts.Do(http.MethodDelete, "/hashes/bulk", body)
+		var got BulkDeleteResponse
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &got) != nil {
+			t.Fatalf("DELETE /hashes/bulk %s = %d %s, %v", body, code, resp, err)
+		}
+		return got
+	}
+	checkGone := func(gone map[int]bool) {
+		t.Helper()
+		for _, id := range append(ids, tenant...) {
+			_, err := ts.GetHash(id)
+			if gone[id] && !isStatus(err, http.StatusGone) {
+				t.Errorf("GET /hash/%d: %v, want %d", id, err, http.StatusGone)
+			}
+			if !gone[id] && err != nil {
+				t.Errorf("GET /hash/%d: %v, want the hash intact", id, err)
+			}
+		}
+	}
+
+	if got := bulkDelete(fmt.Sprintf(`{"ids":[%d,%d,99]}`, ids[0], ids[1])); got != (BulkDeleteResponse{Deleted: 2, NotFound: 1}) {
+		t.Errorf("bulk delete by id = %+v, want 2 deleted and 1 not found", got)
+	}
+	checkGone(map[int]bool{ids[0]: true, ids[1]: true})
+
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	if got := bulkDelete(`{"namespace":"tenant1","olderThan":"` + past + `"}`); got.Deleted != 0 {
+		t.Errorf("bulk delete of the namespace before its hashes = %+v, want none deleted", got)
+	}
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	if got := bulkDelete(`{"namespace":"tenant1","olderThan":"` + future + `"}`); got.Deleted != 2 {
+		t.Errorf("bulk delete of the namespace = %+v, want 2 deleted", got)
+	}
+	checkGone(map[int]bool{ids[0]: true, ids[1]: true, tenant[0]: true, tenant[1]: true})
+
+	for _, body := range []string{`{}`, `{"ids":[1],"namespace":"tenant1"}`, `{"namespace":"tenant1"}`} {
+		if code, resp, err := ts.Do(http.MethodDelete, "/hashes/bulk", body); err != nil || code != http.StatusBadRequest {
+			t.Errorf("DELETE /hashes/bulk %s = %d %s, %v, want %d", body, code, resp, err, http.StatusBadRequest)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodDelete, "/hashes/bulk", `{"ids":[3]}`, "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("DELETE /hashes/bulk without the admin token = %d %s, %v, want %d", code, resp, err, http.StatusUnauthorized)
+	}
+}
+
+// search returns the ids of the results of `/hashes/search` with the query, following the cursors of the pages.
+func (ts *TestServer) search(t testing.TB, query string) []int {
+	t.Helper()
+	ids := []int{}
+	for cursor := 0; ; {
+		code, resp, err := ts.Do(http.MethodGet, fmt.Sprintf("/hashes/search?%s&cursor=%d", query, cursor), "")
+		var page SearchResponse
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &page) != nil {
+			t.Fatalf("GET /hashes/search?%s = %d %s, %v", query, code, resp, err)
+		}
+		for _, r := range page.Results {
+			ids = append(ids, r.ID)
+		}
+		if page.NextCursor == 0 {
+			return ids
+		}
+		cursor = page.NextCursor
+	}
+}
+
+// TestSearch checks that the search filters return the matching subset of the hashes, paginated.
+func TestSearch(t *testing.T) {
+	ts := NewTestServer(t)
+	prod := ts.postHashRequest(t, &HashRequest{Password: "first", Tags: []string{"prod"}})
+	prodSHA256 := ts.postHashRequest(t, &HashRequest{Password: "second", Algorithm: "sha256", Tags: []string{"prod"}})
+	cutoff := time.Now()
+	tenant := ts.postHashRequest(t, &HashRequest{Password: "third", Namespace: "tenant1"})
+	plain := ts.postHashRequest(t, &HashRequest{Password: "fourth"})
+	deleted := ts.postHashRequest(t, &HashRequest{Password: "fifth", Tags: []string{"prod"}})
+	if code, resp, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", deleted), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %s, %v", deleted, code, resp, err)
+	}
+	for _, tc := range []struct {
+		query string
+		want  []int
+	}{
+		{"", []int{prod, prodSHA256, tenant, plain}},
+		{"limit=1", []int{prod, prodSHA256, tenant, plain}},
+		{"algorithm=sha512", []int{prod, tenant, plain}},
+		{"algorithm=sha256", []int{prodSHA256}},
+		{"tag=prod", []int{prod, prodSHA256}},
+		{"tag=prod&algorithm=sha512", []int{prod}},
+		{"namespace=tenant1", []int{tenant}},
+		{"createdAfter=" + cutoff.UTC().Format(time.RFC3339Nano), []int{tenant, plain}},
+		{"createdAfter=" + cutoff.Add(24*time.Hour).Format(time.DateOnly), []int{}},
+		{"tag=staging", []int{}},
+	} {
+		if got := ts.search(t, tc.query); !slices.Equal(got, tc.want) {
+			t.Errorf("search %q = %v, want %v", tc.query, got, tc.want)
+		}
+	}
+	for _, query := range []string{"limit=0", "cursor=-1", "createdAfter=yesterday"} {
+		if code, resp, err := ts.Do(http.MethodGet, "/hashes/search?"+query, ""); err != nil || code != http.StatusBadRequest {
+			t.Errorf("GET /hashes/search?%s = %d %s, %v, want %d", query, code, resp, err, http.StatusBadRequest)
+		}
+	}
+}
+
+// listIDs returns the ids listed by `/hashes` with the query.
+func (ts *TestServer) listIDs(t testing.TB, query string) []int {
+	t.Helper()
+	code, resp, err := ts.Do(http.MethodGet, "/hashes?"+query, "")
+	var list ListResponse
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &list) != nil {
+		t.Fatalf("GET /hashes?%s = %d %s, %v", query, code, resp, err)
+	}
+	slices.Sort(list.IDs)
+	return list.IDs
+}
+
+// TestTags checks that the tags of the hashes are kept sorted and deduplicated, and filter the list and the search.
+func TestTags(t *testing.T) {
+	ts := NewTestServer(t)
+	first := ts.postHashRequest(t, &HashRequest{Password: "first", Tags: []string{"prod", "eu", "prod"}})
+	second := ts.postHashRequest(t, &HashRequest{Password: "second"})
+	setTags := func(method, path, body string, want ...string) {
+		t.Helper()
+		code, resp, err := ts.Do(method, path, body, FormHeader...)
+		var got TagsResponse
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &got) != nil {
+			t.Fatalf("%s %s = %d %s, %v", method, path, code, resp, err)
+		}
+		if !slices.Equal(got.Tags, want) {
+			t.Errorf("%s %s tags = %v, want %v", method, path, got.Tags, want)
+		}
+	}
+
+	setTags(http.MethodPost, fmt.Sprintf("/hash/%d/tags", second), "tags=prod&tags=us&tags=prod", "prod", "us")
+	setTags(http.MethodPost, fmt.Sprintf("/hash/%d/tags", first), "tags=asia", "asia", "eu", "prod")
+	for _, tc := range []struct {
+		tag  string
+		want []int
+	}{
+		{"prod", []int{first, second}},
+		{"eu", []int{first}},
+		{"us", []int{second}},
+		{"staging", nil},
+	} {
+		if got := ts.listIDs(t, "tag="+tc.tag); !slices.Equal(got, tc.want) {
+			t.Errorf("list of the tag %s = %v, want %v", tc.tag, got, tc.want)
+		}
+	}
+
+	setTags(http.MethodDelete, fmt.Sprintf("/hash/%d/tags/prod", first), "", "asia", "eu")
+	if got := ts.listIDs(t, "tag=prod"); !slices.Equal(got, []int{second}) {
+		t.Errorf("list of the tag prod after its removal = %v, want [%d]", got, second)
+	}
+	if got := ts.search(t, "tag=eu"); !slices.Equal(got, []int{first}) {
+		t.Errorf("search of the tag eu = %v, want [%d]", got, first)
+	}
+	for _, body := range []string{"", "tags=", "tags=a/b"} {
+		if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/tags", first), body, FormHeader...); err != nil || code != http.StatusBadRequest {
+			t.Errorf("POST /hash/%d/tags %q = %d %s, %v, want %d", first, body, code, resp, err, http.StatusBadRequest)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodPost, "/hash/99/tags", "tags=prod", FormHeader...); err != nil || code != http.StatusNotFound {
+		t.Errorf("POST /hash/99/tags = %d %s, %v, want %d", code, resp, err, http.StatusNotFound)
+	}
+}
+
+// TestExportSubject checks that the export of a subject holds the metadata of all its hashes, and only theirs,
+// without the hash values.
+func TestExportSubject(t *testing.T) {
+	ts := NewTestServer(t)
+	first := ts.postHashRequest(t, &HashRequest{Password: "first", Tags: []string{"subject:alice", "prod"}})
+	ts.postHashRequest(t, &HashRequest{Password: "second", Tags: []string{"subject:bob"}})
+	third := ts.postHashRequest(t, &HashRequest{Password: "third", Algorithm: "sha256", Tags: []string{"subject:alice"}})
+	ts.postHashRequest(t, &HashRequest{Password: "fourth"})
+
+	code, resp, err := ts.Do(http.MethodGet, "/admin/subject/alice/export", "")
+	var records []SubjectRecord
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &records) != nil {
+		t.Fatalf("GET /admin/subject/alice/export = %d %s, %v", code, resp, err)
+	}
+	slices.SortFunc(records, func(a, b SubjectRecord) int { return a.ID - b.ID })
+	want := []SubjectRecord{
+		{ID: first, Algorithm: "sha512", Tags: []string{"prod", "subject:alice"}},
+		{ID: third, Algorithm: "sha256", Tags: []string{"subject:alice"}},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("exported %+v, want the hashes %d and %d", records, first, third)
+	}
+	for i, rec := range records {
+		if rec.ID != want[i].ID || rec.Algorithm != want[i].Algorithm || !slices.Equal(rec.Tags, want[i].Tags) || rec.CreatedAt.IsZero() {
+			t.Errorf("exported record %+v, want %+v created at some time", rec, want[i])
+		}
+	}
+	for _, password := range []string{"first", "third"} {
+		if strings.Contains(resp, testHash(password)) {
+			t.Errorf("the export %s holds the hash of %s", resp, password)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodGet, "/admin/subject/carol/export", ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /admin/subject/carol/export = %d %s, %v, want %d", code, resp, err, http.StatusNotFound)
+	}
+	if code, resp, err := ts.Do(http.MethodGet, "/admin/subject/alice/export", "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("GET /admin/subject/alice/export without the admin token = %d %s, %v, want %d", code, resp, err, http.StatusUnauthorized)
+	}
+}
+
+// TestAutoPurge checks that the purger removes the hashes older than `--auto-purge-after`, and that the stats report
+// its last run.
+func TestAutoPurge(t *testing.T) {
+	const maxAge = 200 * time.Millisecond
+	ts := NewTestServer(t)
+	old := ts.mustPostHashes(t, "first", "second")
+	time.Sleep(maxAge)
+	recent := ts.mustPostHashes(t, "third")[0]
+	start := time.Now()
+	if purged := purgeOldHashes(ts.s.inboundRequests, ts.s.pending, maxAge); purged != fmt.Sprintf("[%d,%d]", old[0], old[1]) {
+		t.Errorf("purged %s, want %v", purged, old)
+	}
+	for _, id := range old {
+		if _, err := ts.GetHash(id); !isStatus(err, http.StatusNotFound) {
+			t.Errorf("GET of the purged hash %d: %v, want %d", id, err, http.StatusNotFound)
+		}
+	}
+	if _, err := ts.GetHash(recent); err != nil {
+		t.Errorf("GET of the recent hash %d: %v", recent, err)
+	}
+	stats, err := ts.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.LastPurgeCount != 2 || stats.LastPurgeAt == nil || stats.LastPurgeAt.Before(start) {
+		t.Errorf("stats report the last purge at %v of %d hashes, want 2 hashes after %v", stats.LastPurgeAt, stats.LastPurgeCount, start)
+	}
+}
+
+// TestSnapshotRestore checks that restoring a named snapshot brings back the hashes it holds, and only those.
+func TestSnapshotRestore(t *testing.T) {
+	ts := NewTestServer(t)
+	before := ts.mustPostHashes(t, "first", "second")
+	code, resp, err := ts.Do(http.MethodPost, "/admin/snapshot?name=before-migration", "")
+	var info SnapshotInfo
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &info) != nil {
+		t.Fatalf("POST /admin/snapshot = %d %s, %v", code, resp, err)
+	}
+	if fi, err := os.Stat(info.File); err != nil || fi.Size() != info.Size || filepath.Dir(info.File) != ts.s.cfg.SnapshotDir {
+		t.Errorf("snapshot %+v is not saved in %s: %v", info, ts.s.cfg.SnapshotDir, err)
+	}
+	code, resp, err = ts.Do(http.MethodGet, "/admin/snapshots", "")
+	var snapshots []SnapshotInfo
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &snapshots) != nil {
+		t.Fatalf("GET /admin/snapshots = %d %s, %v", code, resp, err)
+	}
+	if len(snapshots) != 1 || snapshots[0].Name != "before-migration" || snapshots[0].File != info.File {
+		t.Errorf("snapshots = %+v, want %+v", snapshots, info)
+	}
+
+	after := ts.mustPostHashes(t, "third")[0]
+	if code, resp, err := ts.Do(http.MethodPost, "/admin/snapshot/before-migration/restore", ""); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /admin/snapshot/before-migration/restore = %d %s, %v", code, resp, err)
+	}
+	for i, password := range []string{"first", "second"} {
+		if hash, err := ts.GetHash(before[i]); err != nil || hash != testHash(password) {
+			t.Errorf("GET of the hash %d of the snapshot = %s, %v, want %s", before[i], hash, err, testHash(password))
+		}
+	}
+	if _, err := ts.GetHash(after); !isStatus(err, http.StatusNotFound) {
+		t.Errorf("GET of the hash %d stored after the snapshot: %v, want %d", after, err, http.StatusNotFound)
+	}
+	if id := ts.mustPostHashes(t, "fourth")[0]; id <= after {
+		t.Errorf("id %d issued after the restore, want ids not to be issued twice", id)
+	}
+	if code, resp, err := ts.Do(http.MethodPost, "/admin/snapshot/unknown/restore", ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("POST /admin/snapshot/unknown/restore = %d %s, %v, want %d", code, resp, err, http.StatusNotFound)
+	}
+	if code, resp, err := ts.Do(http.MethodPost, "/admin/snapshot?name=../escape", ""); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /admin/snapshot?name=../escape = %d %s, %v, want %d", code, resp, err, http.StatusBadRequest)
+	}
+}
+
+// TestCompactIDs checks that `/admin/gc` reassigns the remaining hashes to gapless ids, and that the next id follows.
+func TestCompactIDs(t *testing.T) {
+	ts := NewTestServer(t)
+	passwords := []string{"first", "second", "third", "fourth", "fifth"}
+	ids := ts.mustPostHashes(t, passwords...)
+	for _, id := range []int{ids[1], ids[3]} {
+		if code, resp, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d/permanent", id), ""); err != nil || code != http.StatusOK {
+			t.Fatalf("DELETE /hash/%d/permanent = %d %s, %v", id, code, resp, err)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodPost, "/admin/gc", ""); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /admin/gc without confirmation = %d %s, %v, want %d", code, resp, err, http.StatusBadRequest)
+	}
+	code, resp, err := ts.Do(http.MethodPost, "/admin/gc?confirm=true", "")
+	var mapping map[int]int
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &mapping) != nil {
+		t.Fatalf("POST /admin/gc?confirm=true = %d %s, %v", code, resp, err)
+	}
+	want := map[int]int{ids[0]: 1, ids[2]: 2, ids[4]: 3}
+	if !reflect.DeepEqual(mapping, want) {
+		t.Errorf("ids remapped %v, want %v", mapping, want)
+	}
+	for old, id := range mapping {
+		if hash, err := ts.GetHash(id); err != nil || hash != testHash(passwords[old-1]) {
+			t.Errorf("GET of the hash %d, previously %d = %s, %v, want %s", id, old, hash, err, testHash(passwords[old-1]))
+		}
+	}
+	if next := ts.mustPostHashes(t, "sixth")[0]; next != len(want)+1 {
+		t.Errorf("id issued after the compaction = %d, want %d", next, len(want)+1)
+	}
+}
+
+// TestCompareAndSwap checks that a hash is only replaced while it is the expected one, a concurrent update being
+// rejected once the first one is stored.
+func TestCompareAndSwap(t *testing.T) {
+	ts := NewTestServer(t)
+	id := ts.mustPostHashes(t, "first")[0]
+	path := fmt.Sprintf("/hash/%d", id)
+	cas := func(expected, password string) (int, string) {
+		t.Helper()
+		body, _ := json.Marshal(&CASRequest{ExpectedHash: expected, NewPassword: password})
+		code, resp, err := ts.Do(http.MethodPut, path, string(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code, strings.TrimSpace(resp)
+	}
+	waitHashOf := func(password string) {
+		t.Helper()
+		waitFor(t, "the hash of "+password, func() bool {
+			hash, err := ts.GetHash(id)
+			return err == nil && hash == testHash(password)
+		})
+	}
+
+	if code, resp := cas(testHash("first"), "second"); code != http.StatusOK || resp != strconv.Itoa(id) {
+		t.Fatalf("PUT %s with the current hash = %d %s, want %d and the id", path, code, resp, http.StatusOK)
+	}
+	waitHashOf("second")
+	if code, resp := cas(testHash("first"), "third"); code != http.StatusConflict {
+		t.Errorf("PUT %s with a stale hash = %d %s, want %d", path, code, resp, http.StatusConflict)
+	}
+
+	// Both updates are accepted before either is stored, but only the first one stored is applied.
+	for _, password := range []string{"third", "fourth"} {
+		if code, resp := cas(testHash("second"), password); code != http.StatusOK {
+			t.Fatalf("PUT %s of %s = %d %s, want %d", path, password, code, resp, http.StatusOK)
+		}
+	}
+	waitFor(t, "the first update", func() bool {
+		hash, err := ts.GetHash(id)
+		return err == nil && hash != testHash("second")
+	})
+	// The second update is discarded once its delay has passed.
+	time.Sleep(2 * TestHashDelay)
+	hash, err := ts.GetHash(id)
+	if err != nil || (hash != testHash("third") && hash != testHash("fourth")) {
+		t.Errorf("GET %s after the concurrent updates = %s, %v, want the hash of either update", path, hash, err)
+	}
+	code, resp, err := ts.Do(http.MethodGet, path+"/versions", "")
+	var versions []HashVersion
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), &versions) != nil || len(versions) != 3 {
+		t.Errorf("GET %s/versions = %d %s, %v, want the first hash and 2 updates", path, code, resp, err)
+	}
+	if code, resp := cas("", "fifth"); code != http.StatusBadRequest {
+		t.Errorf("PUT %s without the expected hash = %d %s, want %d", path, code, resp, http.StatusBadRequest)
+	}
+	if code, resp := cas(testHash("first"), "fifth"); code != http.StatusConflict {
+		t.Errorf("PUT %s with the first hash = %d %s, want %d", path, code, resp, http.StatusConflict)
+	}
+}
+
+// TestLoadTest checks that a 1 second load test reports the requests it posted, which are hashed and counted by the
+// stats.
+func TestLoadTest(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.AllowLoadTest = true })
+	code, resp, err := ts.Do(http.MethodPost, "/admin/load-test", `{"requestsPerSecond":50,"durationSeconds":1,"passwordLength":8}`)
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("POST /admin/load-test = %d %s, %v", code, resp, err)
+	}
+	_, data, found := strings.Cut(resp, "event: done\ndata: ")
+	var stats LoadTestStats
+	if !found || json.Unmarshal([]byte(strings.TrimSpace(data)), &stats) != nil {
+		t.Fatalf("load test events %q, want a done event", resp)
+	}
+	if stats.Requests < 40 || stats.Requests > 50 || stats.Errors != 0 || stats.ErrorRate != 0 || stats.Throughput <= 0 {
+		t.Errorf("load test stats = %+v, want about 50 requests without errors", stats)
+	}
+	waitFor(t, "the hashes of the load test", func() bool {
+		s, err := ts.GetStats()
+		return err == nil && s.TotalNum == int(stats.Requests)
+	})
+
+	ts = NewTestServer(t)
+	if code, resp, err := ts.Do(http.MethodPost, "/admin/load-test", `{"requestsPerSecond":50,"durationSeconds":1}`); err != nil || code != http.StatusForbidden {
+		t.Errorf("POST /admin/load-test without --allow-load-test = %d %s, %v, want %d", code, resp, err, http.StatusForbidden)
+	}
+}
+
+func TestBenchmark(t *testing.T) {
+	cfg, err := ParseConfig([]string{"--quiet", "--benchmark", "--benchmark-workers", "2", "--benchmark-requests", "5",
+		"--hash-delay", TestHashDelay.String(), "--snapshot-dir", t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runBenchmark(cfg); err != nil {
+		t.Errorf("runBenchmark() = %v, want nil", err)
+	}
+	cfg.BenchmarkMinRPS = 1e9
+	if err := runBenchmark(cfg); err == nil || !strings.Contains(err.Error(), "setHash throughput") {
+		t.Errorf("runBenchmark() below --benchmark-min-rps = %v, want a throughput error", err)
+	}
+
+	// Every third request fails, and the latency of a request is its index in milliseconds.
+	res := benchmarkPhase("test", cfg, func(worker, i int) error {
+		time.Sleep(time.Duration(i) * time.Millisecond)
+		if i%3 == 0 {
+			return errors.New("failed")
+		}
+		return nil
+	})
+	if res.Requests != 10 || res.Errors != 4 || len(res.Latencies) != 10 {
+		t.Errorf("benchmark result = %d requests, %d errors, %d latencies, want 10, 4 and 10", res.Requests, res.Errors, len(res.Latencies))
+	}
+	if p50, p99 := res.Percentile(50), res.Percentile(99); p50 < 2*time.Millisecond || p99 < 4*time.Millisecond || p50 > p99 {
+		t.Errorf("benchmark percentiles p50 %v p99 %v, want at least 2ms and 4ms", p50, p99)
+	}
+	if !strings.Contains(res.String(), "errors 40.00%") {
+		t.Errorf("benchmark report %q, want an error rate of 40%%", res.String())
+	}
+}
+
+func TestLatencyHistogram(t *testing.T) {
+	ts := NewTestServer(t)
+	for _, ms := range []int{0, 0, 1, 4, 5, 9, 10, 99, 100, 20000} {
+		ts.s.metrics.Observe("test", time.Duration(ms)*time.Millisecond+time.Microsecond)
+	}
+	for _, tc := range []struct {
+		query, want string
+	}{
+		{"?endpoint=test&buckets=0,1,5,10,100", "bucket_ms,count\n0,2\n1,2\n5,2\n10,2\n100,2\n"},
+		{"?endpoint=test&buckets=5", "bucket_ms,count\n5,6\n"},
+		{"?endpoint=test", "bucket_ms,count\n0,2\n1,2\n5,2\n10,1\n50,1\n100,1\n500,0\n1000,1\n"},
+		{"?endpoint=unknown&buckets=0,10", "bucket_ms,count\n0,0\n10,0\n"},
+	} {
+		code, resp, err := ts.Do(http.MethodGet, "/metrics/histogram"+tc.query, "")
+		if err != nil || code != http.StatusOK || resp != tc.want {
+			t.Errorf("GET /metrics/histogram%s = %d %q, %v, want %q", tc.query, code, resp, err, tc.want)
+		}
+	}
+	for _, query := range []string{"", "?endpoint=test&buckets=5,1", "?endpoint=test&buckets=a", "?endpoint=test&buckets=-1"} {
+		if code, resp, err := ts.Do(http.MethodGet, "/metrics/histogram"+query, ""); err != nil || code != http.StatusBadRequest {
+			t.Errorf("GET /metrics/histogram%s = %d %s, %v, want %d", query, code, resp, err, http.StatusBadRequest)
+		}
+	}
+
+	// The requests are recorded under the name of their endpoint.
+	ts.mustPostHashes(t, "first", "second", "third")
+	code, resp, err := ts.Do(http.MethodGet, "/metrics/histogram?endpoint=setHash&buckets=0", "")
+	if err != nil || code != http.StatusOK || resp != "bucket_ms,count\n0,3\n" {
+		t.Errorf("GET /metrics/histogram?endpoint=setHash = %d %q, %v, want 3 requests", code, resp, err)
+	}
+}
+
+func TestPendingHash(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.HashPreprocessingDelay = 1500 * time.Millisecond })
+	id, err := ts.PostHash("angryMonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The estimate is the delay, rounded up to the second.
+	code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", id), "")
+	if want := `{"status":"pending","estimatedReadySecs":2}`; err != nil || code != http.StatusAccepted || strings.TrimSpace(body) != want {
+		t.Errorf("GET /hash/%d while pending = %d %q, %v, want %d %s", id, code, body, err, http.StatusAccepted, want)
+	}
+	// An id not issued yet is not found, rather than pending.
+	code, body, err = ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", id+1), "")
+	if err != nil || code != http.StatusNotFound || !strings.Contains(body, InvalidHashIDMessage) {
+		t.Errorf("GET /hash/%d never issued = %d %q, %v, want %d %q", id+1, code, body, err, http.StatusNotFound, InvalidHashIDMessage)
+	}
+}
+
+func TestHashAlgorithm(t *testing.T) {
+	ts := NewTestServer(t)
+	algorithm := func(id int) (int, *AlgorithmResponse) {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/algorithm", id), "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		alg := &AlgorithmResponse{}
+		if code == http.StatusOK && json.Unmarshal([]byte(body), alg) != nil {
+			t.Fatalf("GET /hash/%d/algorithm = %q, want JSON", id, body)
+		}
+		return code, alg
+	}
+	for _, name := range slices.Sorted(maps.Keys(hashAlgorithms)) {
+		if name == IdentityAlgorithm {
+			continue
+		}
+		id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: name})
+		want := AlgorithmResponse{ID: id, Algorithm: name, Encoding: hashEncodings[name]}
+		if code, alg := algorithm(id); code != http.StatusOK || *alg != want {
+			t.Errorf("GET /hash/%d/algorithm = %d %+v, want %+v", id, code, *alg, want)
+		}
+	}
+	// The encoding is the requested one, when not the default one of the algorithm.
+	id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "sha256", Encoding: "hex"})
+	if code, alg := algorithm(id); code != http.StatusOK || alg.Algorithm != "sha256" || alg.Encoding != "hex" {
+		t.Errorf("GET /hash/%d/algorithm = %d %+v, want sha256 encoded to hex", id, code, *alg)
+	}
+
+	if code, _ := algorithm(id + 1); code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d/algorithm of an unknown id = %d, want %d", id+1, code, http.StatusNotFound)
+	}
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", id), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %q, %v", id, code, body, err)
+	}
+	if code, _ := algorithm(id); code != http.StatusGone {
+		t.Errorf("GET /hash/%d/algorithm of a deleted hash = %d, want %d", id, code, http.StatusGone)
+	}
+}
+
+func TestMultipartHash(t *testing.T) {
+	ts := NewTestServer(t)
+	post := func(fields map[string]string, file string) (int, string) {
+		t.Helper()
+		var body strings.Builder
+		mw := multipart.NewWriter(&body)
+		for name, value := range fields {
+			mw.WriteField(name, value)
+		}
+		if file != "" {
+			fw, _ := mw.CreateFormFile("password_file", "password.txt")
+			io.WriteString(fw, file)
+		}
+		mw.Close()
+		code, resp, err := ts.Do(http.MethodPost, "/hash", body.String(), "Content-Type", mw.FormDataContentType())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code, resp
+	}
+	check := func(code int, resp, password string) {
+		t.Helper()
+		id, err := strconv.Atoi(strings.TrimSpace(resp))
+		if code != http.StatusOK || err != nil {
+			t.Fatalf("POST /hash multipart = %d %q, want an id", code, resp)
+		}
+		if hash, err := ts.WaitHash(id); err != nil || hash != testHash(password) {
+			t.Errorf("GET /hash/%d = %q, %v, want the hash of %q", id, hash, err, password)
+		}
+	}
+
+	code, resp := post(map[string]string{"password": "angryMonkey", "username": "alice", "department": "sales"}, "")
+	check(code, resp, "angryMonkey")
+	// The password file takes precedence over the field, without its trailing line break.
+	code, resp = post(map[string]string{"password": "ignored"}, "fromFile\r\n")
+	check(code, resp, "fromFile")
+
+	if code, resp := post(map[string]string{"password": strings.Repeat("a", MaxMultipartSize)}, ""); code != http.StatusBadRequest {
+		t.Errorf("POST /hash multipart larger than %d bytes = %d %q, want %d", MaxMultipartSize, code, resp, http.StatusBadRequest)
+	}
+	if code, resp, err := ts.Do(http.MethodPost, "/hash", "not a multipart body", "Content-Type", "multipart/form-data; boundary=x"); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /hash invalid multipart = %d %q, %v, want %d", code, resp, err, http.StatusBadRequest)
+	}
+}
+
+func TestTouchHash(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	info := func() *HashInfo {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/info", ids[0]), "")
+		info := &HashInfo{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), info) != nil {
+			t.Fatalf("GET /hash/%d/info = %d %q, %v", ids[0], code, body, err)
+		}
+		return info
+	}
+	before := info()
+	var last time.Time
+	for i := 1; i <= 2; i++ {
+		touched := time.Now()
+		code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/touch", ids[0]), "")
+		resp := &TouchResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil {
+			t.Fatalf("POST /hash/%d/touch = %d %q, %v", ids[0], code, body, err)
+		}
+		if resp.ID != ids[0] || resp.LastAccessed.Before(touched) || !resp.LastAccessed.After(last) {
+			t.Errorf("POST /hash/%d/touch = %+v, want the time of the touch", ids[0], resp)
+		}
+		if strings.Contains(body, testHash("angryMonkey")) {
+			t.Errorf("POST /hash/%d/touch = %q, want no hash", ids[0], body)
+		}
+		last = resp.LastAccessed
+	}
+	if after := info(); after.AccessCount != before.AccessCount+2 || !after.LastAccessed.Equal(last) {
+		t.Errorf("info after 2 touches = %d accesses at %v, want %d at %v", after.AccessCount, after.LastAccessed, before.AccessCount+2, last)
+	}
+
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/touch", ids[0]+1), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("POST /hash/%d/touch of an unknown id = %d %q, %v, want %d", ids[0]+1, code, body, err, http.StatusNotFound)
+	}
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", ids[0]), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %q, %v", ids[0], code, body, err)
+	}
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/touch", ids[0]), ""); err != nil || code != http.StatusGone {
+		t.Errorf("POST /hash/%d/touch of a deleted hash = %d %q, %v, want %d", ids[0], code, body, err, http.StatusGone)
+	}
+}
+
+func TestCloneHash(t *testing.T) {
+	ts := NewTestServer(t)
+	info := func(id int) *HashInfo {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/info", id), "")
+		info := &HashInfo{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), info) != nil {
+			t.Fatalf("GET /hash/%d/info = %d %q, %v", id, code, body, err)
+		}
+		return info
+	}
+	clone := func(path string) int {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodPost, path, "")
+		id, convErr := strconv.Atoi(strings.TrimSpace(body))
+		if err != nil || code != http.StatusOK || convErr != nil {
+			t.Fatalf("POST %s = %d %q, %v, want an id", path, code, body, err)
+		}
+		return id
+	}
+	id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "sha256", Namespace: "primary", Tags: []string{"team-a"}})
+	source := info(id)
+	hash, err := ts.GetHash(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		query, namespace string
+	}{
+		{"?namespace=backup", "backup"},
+		{"", "primary"},
+	} {
+		cloned := clone(fmt.Sprintf("/hash/%d/clone%s", id, tc.query))
+		if cloned == id {
+			t.Fatalf("clone of hash %d has the same id", id)
+		}
+		if got, err := ts.GetHash(cloned); err != nil || got != hash {
+			t.Errorf("GET /hash/%d of the clone = %q, %v, want %q", cloned, got, err, hash)
+		}
+		got := info(cloned)
+		if got.Namespace != tc.namespace || got.Algorithm != source.Algorithm || !slices.Equal(got.Tags, source.Tags) || !got.CreatedAt.After(source.CreatedAt) {
+			t.Errorf("clone%s info = %+v, want namespace %q and the metadata of %+v, created later", tc.query, got, tc.namespace, source)
+		}
+	}
+
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/clone", id+10), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("POST /hash/%d/clone of an unknown id = %d %q, %v, want %d", id+10, code, body, err, http.StatusNotFound)
+	}
+}
+
+func TestShutdownRejectsRequests(t *testing.T) {
+	const grace = 300 * time.Millisecond
+	ts := NewTestServer(t, func(cfg *Config) { cfg.ShutdownGraceDelay = grace })
+	ts.s.httpServer = ts.Server.Config
+	if code, body, err := ts.Do(http.MethodPost, "/shutdown", ""); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /shutdown = %d %q, %v", code, body, err)
+	}
+	waitFor(t, "the termination", ts.s.isTerminated.Load)
+	// During the grace delay, the requests are rejected and their connection closed so that clients go elsewhere.
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, "/stats"},
+		{http.MethodPost, "/hash"},
+		{http.MethodGet, "/hash/1"},
+	} {
+		r, _ := http.NewRequest(req.method, ts.Server.URL+APIPrefix+req.path, strings.NewReader("password=angryMonkey"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := ts.Client.Do(r)
+		if err != nil {
+			t.Fatalf("%s %s during the grace delay: %v", req.method, req.path, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusServiceUnavailable || !resp.Close {
+			t.Errorf("%s %s during the grace delay = %d, closing the connection %t, want %d and the connection closed",
+				req.method, req.path, resp.StatusCode, resp.Close, http.StatusServiceUnavailable)
+		}
+	}
+	// The server then stops accepting connections.
+	select {
+	case <-ts.s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server has not shut down")
+	}
+	if code, _, err := ts.Do(http.MethodGet, "/stats", ""); err == nil {
+		t.Errorf("GET /stats after the shutdown = %d, want a connection error", code)
+	}
+}
+
+func TestMemoryStats(t *testing.T) {
+	ts := NewTestServer(t)
+	ts.mustPostHashes(t, "first", "second")
+	runtime.GC()
+	first, err := ts.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.GoRoutineCount == 0 || first.HeapAllocBytes == 0 || first.HeapSysBytes == 0 || first.GCPauseNs == 0 {
+		t.Errorf("stats = %d goroutines, heap %d/%d bytes, GC pause %dns, want non-zero values",
+			first.GoRoutineCount, first.HeapAllocBytes, first.HeapSysBytes, first.GCPauseNs)
+	}
+	// The memory statistics are read at most every MemStatsInterval, whatever the allocations meanwhile.
+	garbage := make([][]byte, 0, 64)
+	for range 64 {
+		garbage = append(garbage, make([]byte, 64<<10))
+	}
+	second, err := ts.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.HeapAllocBytes != first.HeapAllocBytes || second.GCPauseNs != first.GCPauseNs {
+		t.Errorf("stats within %v = heap %d bytes, GC pause %dns, want the cached %d and %dns",
+			MemStatsInterval, second.HeapAllocBytes, second.GCPauseNs, first.HeapAllocBytes, first.GCPauseNs)
+	}
+	runtime.KeepAlive(garbage)
+}
+
+func TestDrainAndPause(t *testing.T) {
+	st := NewStoreTest(t, StoreOptions{})
+	id := st.SetHash("first")
+	snap := &Snapshot{}
+	resume := make(chan struct{})
+	if res := st.Send(Command{requestType: DrainAndPauseCommand, snapshot: snap, resume: resume}); res.err != nil {
+		t.Fatal(res.err)
+	}
+	// The commands queued before the pause are in the snapshot.
+	if rec, ok := snap.Hashes[id]; !ok || rec.Hash != testHash("first") {
+		t.Errorf("snapshot hashes = %v, want the hash %d queued before the pause", snap.Hashes, id)
+	}
+	// No command is processed until resumed.
+	get := Command{requestType: GetHashCommand, id: id, responseChannel: make(chan Result, 1)}
+	st.q.Send(get)
+	select {
+	case res := <-get.responseChannel:
+		t.Fatalf("GetHashCommand processed while paused: %+v", res)
+	case <-time.After(100 * time.Millisecond):
+	}
+	close(resume)
+	select {
+	case res := <-get.responseChannel:
+		if res.err != nil || res.value != testHash("first") {
+			t.Errorf("GetHashCommand after the resume = %+v, want the hash of first", res)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("GetHashCommand not processed after the resume")
+	}
+
+	// The requests received while paused are rejected.
+	ts := NewTestServer(t)
+	ts.s.isPaused.Store(true)
+	if code, body, err := ts.Do(http.MethodGet, "/stats", ""); err != nil || code != http.StatusServiceUnavailable {
+		t.Errorf("GET /stats while paused = %d %q, %v, want %d", code, body, err, http.StatusServiceUnavailable)
+	}
+	ts.s.isPaused.Store(false)
+	if code, body, err := ts.Do(http.MethodGet, "/stats", ""); err != nil || code != http.StatusOK {
+		t.Errorf("GET /stats after the pause = %d %q, %v, want %d", code, body, err, http.StatusOK)
+	}
+}
+
+func TestHashEncodings(t *testing.T) {
+	ts := NewTestServer(t)
+	sum := sha512.Sum512([]byte("angryMonkey"))
+	for _, encoding := range slices.Sorted(maps.Keys(digestEncodings)) {
+		id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Encoding: encoding})
+		hash, err := ts.GetHash(id)
+		if want := digestEncodings[encoding].Encode(sum[:]); err != nil || hash != want {
+			t.Errorf("GET /hash/%d encoded to %s = %q, %v, want %q", id, encoding, hash, err, want)
+		}
+		if !verifyHash("angryMonkey", "sha512", encoding, hash) || verifyHash("other", "sha512", encoding, hash) {
+			t.Errorf("verifyHash() of the %s hash does not only match its password", encoding)
+		}
+	}
+
+	// The encoding may be given in the query, and the hashes without padding are verified like the others.
+	code, resp, err := ts.Do(http.MethodPost, "/hash?encoding=base64nopad", "password=angryMonkey", FormHeader...)
+	id, convErr := strconv.Atoi(strings.TrimSpace(resp))
+	if err != nil || code != http.StatusOK || convErr != nil {
+		t.Fatalf("POST /hash?encoding=base64nopad = %d %q, %v", code, resp, err)
+	}
+	hash, err := ts.WaitHash(id)
+	if err != nil || strings.Contains(hash, "=") || len(hash) != base64.RawStdEncoding.EncodedLen(sha512.Size) {
+		t.Errorf("GET /hash/%d encoded to base64nopad = %q, %v, want no padding", id, hash, err)
+	}
+	code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/recompute", id), "password=angryMonkey", FormHeader...)
+	if err != nil || code != http.StatusOK || strings.TrimSpace(body) != hash {
+		t.Errorf("POST /hash/%d/recompute = %d %q, %v, want the verified hash %q", id, code, body, err, hash)
+	}
+}
+
+func TestRawHash(t *testing.T) {
+	ts := NewTestServer(t)
+	sha512Sum := sha512.Sum512([]byte("angryMonkey"))
+	sha256Sum := sha256.Sum256([]byte("angryMonkey"))
+	for _, tc := range []struct {
+		req  HashRequest
+		want []byte
+	}{
+		{HashRequest{Password: "angryMonkey"}, sha512Sum[:]},
+		{HashRequest{Password: "angryMonkey", Algorithm: "sha256", Encoding: "hex"}, sha256Sum[:]},
+		{HashRequest{Password: "angryMonkey", Encoding: "base64url"}, sha512Sum[:]},
+	} {
+		id := ts.postHashRequest(t, &tc.req)
+		resp, err := ts.Client.Get(fmt.Sprintf("%s%s/hash/%d/raw", ts.Server.URL, APIPrefix, id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil || resp.StatusCode != http.StatusOK || !bytes.Equal(body, tc.want) {
+			t.Errorf("GET /hash/%d/raw of %+v = %d %x, %v, want the %d bytes %x", id, tc.req, resp.StatusCode, body, err, len(tc.want), tc.want)
+		}
+		if resp.Header.Get("Content-Type") != "application/octet-stream" || resp.ContentLength != int64(len(tc.want)) ||
+			resp.Header.Get("Content-Disposition") != fmt.Sprintf(`attachment; filename="hash-%d.bin"`, id) {
+			t.Errorf("GET /hash/%d/raw headers = %v, want a binary attachment of %d bytes", id, resp.Header, len(tc.want))
+		}
+	}
+
+	// A hash which cannot be decoded is a conflict.
+	id := ts.s.ids.Next()
+	ts.s.inboundRequests.Send(Command{requestType: SetHashCommand, id: id, password: "not hex", algorithm: "sha512", encoding: "hex"})
+	if _, err := ts.WaitHash(id); err != nil {
+		t.Fatal(err)
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/raw", id), ""); err != nil || code != http.StatusConflict {
+		t.Errorf("GET /hash/%d/raw of an invalid hex hash = %d %q, %v, want %d", id, code, body, err, http.StatusConflict)
+	}
+}
+
+// recordingHandler is a slog.Handler keeping the attributes of the records it handles, of level at least level if set.
+type recordingHandler struct {
+	level   slog.Leveler
+	mu      sync.Mutex
+	records []map[string]any
+}
+
+func (h *recordingHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.level == nil || level >= h.level.Level()
+}
+
+func (h *recordingHandler) Handle(_ context.Context, r slog.Record) error {
+	attrs := map[string]any{"msg": r.Message, "level": r.Level}
+	r.Attrs(func(a slog.Attr) bool {
+		attrs[a.Key] = a.Value.Any()
+		return true
+	})
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.records = append(h.records, attrs)
+	return nil
+}
+
+func (h *recordingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *recordingHandler) WithGroup(string) slog.Handler { return h }
+
+// messages returns the messages of the records.
+func (h *recordingHandler) messages() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var messages []string
+	for _, r := range h.records {
+		messages = append(messages, r["msg"].(string))
+	}
+	return messages
+}
+
+// find returns the records of the command type.
+func (h *recordingHandler) find(commandType string) []map[string]any {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var found []map[string]any
+	for _, r := range h.records {
+		if r["commandType"] == commandType {
+			found = append(found, r)
+		}
+	}
+	return found
+}
+
+func TestStoreLog(t *testing.T) {
+	h := &recordingHandler{}
+	ts := NewTestServerWithStore(t, StoreOptions{Logger: slog.New(h)})
+	code, resp, err := ts.Do(http.MethodPost, "/hash", "password=angryMonkey", "Content-Type", FormHeader[1], RequestIDHeader, "post-request")
+	id, convErr := strconv.Atoi(strings.TrimSpace(resp))
+	if err != nil || code != http.StatusOK || convErr != nil {
+		t.Fatalf("POST /hash = %d %q, %v", code, resp, err)
+	}
+	if _, err := ts.WaitHash(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ts.Do(http.MethodGet, "/stats", "", RequestIDHeader, "stats-request"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		commandType, requestID string
+		id                     int
+	}{
+		{"SetHashCommand", "post-request", id},
+		{"GetStatsCommand", "stats-request", 0},
+	} {
+		records := h.find(tc.commandType)
+		if len(records) != 1 {
+			t.Fatalf("%d records of %s, want 1 in %v", len(records), tc.commandType, h.records)
+		}
+		r := records[0]
+		if _, ok := r["processingDurationUs"].(int64); !ok || r["level"] != slog.LevelDebug || r["requestID"] != tc.requestID || r["id"] != int64(tc.id) {
+			t.Errorf("%s record = %v, want a debug record of id %d, request %s and its duration", tc.commandType, r, tc.id, tc.requestID)
+		}
+	}
+	// The GetHashCommand of each request made by WaitHash is logged too.
+	if len(h.find("GetHashCommand")) == 0 {
+		t.Errorf("no record of GetHashCommand in %v", h.records)
+	}
+}
+
+func TestPurgePending(t *testing.T) {
+	ts := NewTestServer(t)
+	purge := func(query string) string {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodPost, "/admin/purge-pending"+query, "")
+		if err != nil || code != http.StatusOK {
+			t.Fatalf("POST /admin/purge-pending%s = %d %q, %v", query, code, body, err)
+		}
+		return strings.TrimSpace(body)
+	}
+	// The id is stuck pending, as if its hash had never been computed.
+	id := ts.s.ids.Next()
+	if purged := purge("?olderThanSeconds=60"); purged != "[]" {
+		t.Errorf("purge of the ids pending for 60s = %s, want none", purged)
+	}
+	if code, _, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", id), ""); err != nil || code != http.StatusAccepted {
+		t.Errorf("GET /hash/%d before the purge = %d, %v, want %d", id, code, err, http.StatusAccepted)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if purged := purge("?olderThanSeconds=0"); purged != fmt.Sprintf("[%d]", id) {
+		t.Errorf("purge of the pending ids = %s, want [%d]", purged, id)
+	}
+	if code, _, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", id), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d after the purge = %d, %v, want %d", id, code, err, http.StatusNotFound)
+	}
+	// The hash computed after all is discarded.
+	ts.s.inboundRequests.Send(Command{requestType: SetHashCommand, id: id, password: testHash("late"), algorithm: "sha512"})
+	if code, _, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", id), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d after a late hash = %d, %v, want %d", id, code, err, http.StatusNotFound)
+	}
+
+	if code, body, err := ts.Do(http.MethodPost, "/admin/purge-pending?olderThanSeconds=-1", ""); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /admin/purge-pending?olderThanSeconds=-1 = %d %q, %v, want %d", code, body, err, http.StatusBadRequest)
+	}
+	if code, body, err := ts.Do(http.MethodPost, "/admin/purge-pending", "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("POST /admin/purge-pending without the admin token = %d %q, %v, want %d", code, body, err, http.StatusUnauthorized)
+	}
+}
+
+func TestUpgradeAlgorithm(t *testing.T) {
+	ts := NewTestServer(t)
+	id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "sha512"})
+	upgrade := func(expected, password string) (int, string) {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodPatch, fmt.Sprintf("/hash/%d", id),
+			fmt.Sprintf(`{"expectedAlgorithm":%q,"newAlgorithm":"argon2id","password":%q}`, expected, password))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code, body
+	}
+	if code, body := upgrade("sha512", "other"); code != http.StatusForbidden {
+		t.Errorf("PATCH /hash/%d with a wrong password = %d %q, want %d", id, code, body, http.StatusForbidden)
+	}
+	if code, body := upgrade("sha512", "angryMonkey"); code != http.StatusOK || strings.TrimSpace(body) != strconv.Itoa(id) {
+		t.Fatalf("PATCH /hash/%d = %d %q, want %d", id, code, body, id)
+	}
+	waitFor(t, "the upgraded hash", func() bool {
+		hash, err := ts.GetHash(id)
+		return err == nil && strings.HasPrefix(hash, "$argon2id$") && verifyArgon2id("angryMonkey", hash)
+	})
+	if _, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/algorithm", id), ""); err != nil || !strings.Contains(body, `"algorithm":"argon2id"`) {
+		t.Errorf("GET /hash/%d/algorithm after the upgrade = %q, %v, want argon2id", id, body, err)
+	}
+	// The hash is no longer computed with the expected algorithm.
+	if code, body := upgrade("sha512", "angryMonkey"); code != http.StatusConflict {
+		t.Errorf("PATCH /hash/%d expecting the previous algorithm = %d %q, want %d", id, code, body, http.StatusConflict)
+	}
+	if code, body, err := ts.Do(http.MethodPatch, fmt.Sprintf("/hash/%d", id), `{"expectedAlgorithm":"argon2id"}`); err != nil || code != http.StatusBadRequest {
+		t.Errorf("PATCH /hash/%d without the new algorithm = %d %q, %v, want %d", id, code, body, err, http.StatusBadRequest)
+	}
+}
+
+func TestRequestTimestamp(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.MaxRequestAge = 30 * time.Second })
+	now := time.Now().Unix()
+	for _, tc := range []struct {
+		name, timestamp string
+		want            int
+	}{
+		{"no timestamp", "", http.StatusOK},
+		{"current", strconv.FormatInt(now, 10), http.StatusOK},
+		{"within the age", strconv.FormatInt(now-25, 10), http.StatusOK},
+		{"within the skew", strconv.FormatInt(now+3, 10), http.StatusOK},
+		{"stale", strconv.FormatInt(now-35, 10), http.StatusBadRequest},
+		{"future", strconv.FormatInt(now+10, 10), http.StatusBadRequest},
+		{"invalid", "yesterday", http.StatusBadRequest},
+	} {
+		var header []string
+		if tc.timestamp != "" {
+			header = []string{RequestTimestampHeader, tc.timestamp}
+		}
+		if code, body, err := ts.Do(http.MethodGet, "/stats", "", header...); err != nil || code != tc.want {
+			t.Errorf("GET /stats with a %s timestamp = %d %q, %v, want %d", tc.name, code, body, err, tc.want)
+		}
+	}
+
+	// The timestamp is mandatory with `--require-timestamp`.
+	ts = NewTestServer(t, func(cfg *Config) { cfg.RequireTimestamp = true })
+	if code, body, err := ts.Do(http.MethodGet, "/stats", ""); err != nil || code != http.StatusBadRequest {
+		t.Errorf("GET /stats without a required timestamp = %d %q, %v, want %d", code, body, err, http.StatusBadRequest)
+	}
+	if code, body, err := ts.Do(http.MethodGet, "/stats", "", RequestTimestampHeader, strconv.FormatInt(time.Now().Unix(), 10)); err != nil || code != http.StatusOK {
+		t.Errorf("GET /stats with a required timestamp = %d %q, %v, want %d", code, body, err, http.StatusOK)
+	}
+}
+
+func TestHashHMAC(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	for _, size := range []int{1, 32, MaxHMACKeySize} {
+		key := bytes.Repeat([]byte{0xab}, size)
+		code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/hmac?key=%x", ids[0], key), "")
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(testHash("angryMonkey")))
+		if want := hex.EncodeToString(mac.Sum(nil)); err != nil || code != http.StatusOK || strings.TrimSpace(body) != want {
+			t.Errorf("GET /hash/%d/hmac with a %d byte key = %d %q, %v, want %s", ids[0], size, code, body, err, want)
+		}
+	}
+	for _, key := range []string{"", "not-hex", hex.EncodeToString(make([]byte, MaxHMACKeySize+1))} {
+		if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/hmac?key=%s", ids[0], key), ""); err != nil || code != http.StatusBadRequest {
+			t.Errorf("GET /hash/%d/hmac?key=%s = %d %q, %v, want %d", ids[0], key, code, body, err, http.StatusBadRequest)
+		}
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/hmac?key=ab", ids[0]+1), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d/hmac of an unknown id = %d %q, %v, want %d", ids[0]+1, code, body, err, http.StatusNotFound)
+	}
+}
+
+func TestStreamHash(t *testing.T) {
+	const size = 100 << 20
+	ts := NewTestServer(t)
+	// The body repeats a chunk, so that neither the client nor the test hold it in memory.
+	chunk := make([]byte, 1<<20)
+	for i := range chunk {
+		chunk[i] = byte(i * 7 % 251)
+	}
+	readers := make([]io.Reader, size/len(chunk))
+	for i := range readers {
+		readers[i] = bytes.NewReader(chunk)
+	}
+	sum := sha512.New()
+	body := io.TeeReader(io.MultiReader(readers...), sum)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	req, err := http.NewRequest(http.MethodPost, ts.Server.URL+APIPrefix+"/hash/stream", body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	resp, err := ts.Client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	runtime.ReadMemStats(&after)
+	id, convErr := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || resp.StatusCode != http.StatusOK || convErr != nil {
+		t.Fatalf("POST /hash/stream = %d %q, %v", resp.StatusCode, b, err)
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > size/4 {
+		t.Errorf("%d bytes allocated to hash a %d byte password, want it streamed", allocated, size)
+	}
+	if hash, err := ts.WaitHash(id); err != nil || hash != base64.StdEncoding.EncodeToString(sum.Sum(nil)) {
+		t.Errorf("GET /hash/%d = %q, %v, want the SHA-512 of the body", id, hash, err)
+	}
+
+	if code, body, err := ts.Do(http.MethodPost, "/hash/stream?algorithm=unknown", "password"); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /hash/stream?algorithm=unknown = %d %q, %v, want %d", code, body, err, http.StatusBadRequest)
+	}
+}
+
+func TestSignHash(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, block := range map[string]*pem.Block{
+		"rsakey": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)},
+		"eckey":  {Type: "PRIVATE KEY", Bytes: ecDER},
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The keystore is loaded from `--keystore-dir` by main.
+	ts := NewTestServer(t)
+	if ts.s.keystore, err = LoadKeystore(dir); err != nil {
+		t.Fatal(err)
+	}
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	digest := sha256.Sum256([]byte(testHash("angryMonkey")))
+
+	for _, keyID := range []string{"rsakey", "eckey"} {
+		code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/sign?keyId=%s", ids[0], keyID), "")
+		resp := &SignatureResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil {
+			t.Fatalf("GET /hash/%d/sign?keyId=%s = %d %q, %v", ids[0], keyID, code, body, err)
+		}
+		signature, err := base64.StdEncoding.DecodeString(resp.Signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode([]byte(resp.PublicKey))
+		if block == nil {
+			t.Fatalf("public key %q, want PEM", resp.PublicKey)
+		}
+		publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var verified bool
+		switch k := publicKey.(type) {
+		case *rsa.PublicKey:
+			verified = resp.Algorithm == "RSA-PKCS1v15-SHA256" && k.Equal(&rsaKey.PublicKey) &&
+				rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+		case *ecdsa.PublicKey:
+			verified = resp.Algorithm == "ECDSA-SHA256" && k.Equal(&ecKey.PublicKey) && ecdsa.VerifyASN1(k, digest[:], signature)
+		}
+		if !verified || resp.ID != ids[0] || resp.KeyID != keyID {
+			t.Errorf("GET /hash/%d/sign?keyId=%s = %+v, want a signature verified by the key", ids[0], keyID, resp)
+		}
+	}
+
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/sign?keyId=unknown", ids[0]), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d/sign with an unknown key = %d %q, %v, want %d", ids[0], code, body, err, http.StatusNotFound)
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/sign?keyId=rsakey", ids[0]+1), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d/sign of an unknown id = %d %q, %v, want %d", ids[0]+1, code, body, err, http.StatusNotFound)
+	}
+}
+
+func TestStatsHistory(t *testing.T) {
+	start := time.Now().Truncate(time.Minute)
+	st := NewStoreTest(t, StoreOptions{})
+	history := func() []MinuteStats {
+		t.Helper()
+		res := st.Send(Command{requestType: GetStatsHistoryCommand})
+		var entries []MinuteStats
+		if res.err != nil || json.Unmarshal([]byte(res.value), &entries) != nil {
+			t.Fatalf("GetStatsHistoryCommand = %+v", res)
+		}
+		return entries
+	}
+	setHash := func(elapsed time.Duration) {
+		st.q.Send(Command{requestType: SetHashCommand, id: st.ids.Next(), password: testHash("angryMonkey"), algorithm: "sha512",
+			requestStartTs: time.Now().Add(-elapsed).UnixMicro()})
+	}
+	tick := func(minute time.Time) {
+		st.q.Send(Command{requestType: TickCommand, before: minute})
+	}
+
+	// The current minute is only returned once ticked.
+	setHash(time.Second)
+	setHash(3 * time.Second)
+	if entries := history(); len(entries) != 0 {
+		t.Errorf("history before a tick = %v, want none", entries)
+	}
+	tick(start.Add(time.Minute))
+	tick(start.Add(2 * time.Minute))
+	setHash(time.Second)
+	tick(start.Add(3 * time.Minute))
+	entries := history()
+	if len(entries) != 3 {
+		t.Fatalf("history = %v, want 3 minutes", entries)
+	}
+	for i, want := range []MinuteStats{{start, 2, 2e6}, {start.Add(time.Minute), 0, 0}, {start.Add(2 * time.Minute), 1, 1e6}} {
+		got := entries[i]
+		if !got.Minute.Equal(want.Minute) || got.Total != want.Total || math.Abs(got.AverageUs-want.AverageUs) > 1e5 {
+			t.Errorf("history[%d] = %+v, want %+v", i, got, want)
+		}
+	}
+
+	// Only the last StatsHistorySize minutes are kept, oldest first.
+	for i := 4; i < StatsHistorySize+10; i++ {
+		tick(start.Add(time.Duration(i) * time.Minute))
+	}
+	entries = history()
+	if len(entries) != StatsHistorySize || !entries[0].Minute.Equal(start.Add(9*time.Minute)) {
+		t.Fatalf("history = %d minutes from %v, want %d from %v", len(entries), entries[0].Minute, StatsHistorySize, start.Add(9*time.Minute))
+	}
+	for i := 1; i < len(entries); i++ {
+		if !entries[i].Minute.Equal(entries[i-1].Minute.Add(time.Minute)) {
+			t.Fatalf("history[%d] = %v after %v, want consecutive minutes", i, entries[i].Minute, entries[i-1].Minute)
+		}
+	}
+
+	// The minutes without hashes are returned with zero values.
+	ts := NewTestServer(t)
+	ts.s.inboundRequests.Send(Command{requestType: TickCommand, before: start.Add(time.Minute)})
+	code, body, err := ts.Do(http.MethodGet, "/stats/history", "")
+	if err != nil || code != http.StatusOK || strings.Count(body, "minute") != 1 || !strings.Contains(body, `"total":0,"average":0}`) {
+		t.Errorf("GET /stats/history = %d %s, %v, want a minute with zero values", code, body, err)
+	}
+}
+
+func TestAlgorithmRateLimit(t *testing.T) {
+	cfg, err := ParseConfig([]string{"--algorithm-rate-limit", "sha256=3", "--algorithm-rate-limit", "argon2id=0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]float64{"bcrypt": 10, "argon2id": 0, "sha256": 3}; !maps.Equal(cfg.AlgorithmRateLimits, want) {
+		t.Errorf("--algorithm-rate-limit = %v, want %v", cfg.AlgorithmRateLimits, want)
+	}
+
+	// The slow algorithm is limited, in bursts of a second worth of requests, while the others are not.
+	ts := NewTestServer(t, func(cfg *Config) { cfg.AlgorithmRateLimits["sha256"] = 3 })
+	post := func(algorithm string) *http.Response {
+		t.Helper()
+		resp, err := ts.Client.PostForm(ts.Server.URL+APIPrefix+"/hash", url.Values{"password": {"angryMonkey"}, "algorithm": {algorithm}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		return resp
+	}
+	for i := range 3 {
+		if resp := post("sha256"); resp.StatusCode != http.StatusOK {
+			t.Errorf("POST /hash sha256 #%d = %d, want %d", i+1, resp.StatusCode, http.StatusOK)
+		}
+	}
+	resp := post("sha256")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("X-Algorithm-Rate-Limit") != "3" {
+		t.Errorf("POST /hash sha256 beyond the limit = %d, X-Algorithm-Rate-Limit %q, want %d and 3", resp.StatusCode,
+			resp.Header.Get("X-Algorithm-Rate-Limit"), http.StatusTooManyRequests)
+	}
+	for i := range 10 {
+		if resp := post("sha512"); resp.StatusCode != http.StatusOK {
+			t.Errorf("POST /hash sha512 #%d while sha256 is limited = %d, want %d", i+1, resp.StatusCode, http.StatusOK)
+		}
+	}
+
+	// bcrypt is limited by default: once a second worth of its requests is spent, the next one is rejected while
+	// sha512 is still served.
+	burst := int(DefaultAlgorithmRateLimits["bcrypt"])
+	for i := range burst {
+		if resp := post("bcrypt"); resp.StatusCode != http.StatusOK {
+			t.Errorf("POST /hash bcrypt #%d = %d, want %d", i+1, resp.StatusCode, http.StatusOK)
+		}
+	}
+	resp = post("bcrypt")
+	if resp.StatusCode != http.StatusTooManyRequests || resp.Header.Get("X-Algorithm-Rate-Limit") != strconv.Itoa(burst) {
+		t.Errorf("POST /hash bcrypt beyond the limit = %d, X-Algorithm-Rate-Limit %q, want %d and %d", resp.StatusCode,
+			resp.Header.Get("X-Algorithm-Rate-Limit"), http.StatusTooManyRequests, burst)
+	}
+	for i := range 10 {
+		if resp := post("sha512"); resp.StatusCode != http.StatusOK {
+			t.Errorf("POST /hash sha512 #%d while bcrypt is limited = %d, want %d", i+1, resp.StatusCode, http.StatusOK)
+		}
+	}
+}
+
+func TestIdentityAlgorithm(t *testing.T) {
+	slow := func(cfg *Config) { cfg.HashPreprocessingDelay = time.Hour }
+	ts := NewTestServer(t, slow)
+	if code, body, err := ts.Do(http.MethodPost, "/hash", "password=angryMonkey&algorithm=identity", FormHeader...); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /hash identity without --allow-insecure-algorithms = %d %q, %v, want %d", code, body, err, http.StatusBadRequest)
+	}
+	if _, err := ParseConfig([]string{"--benchmark-algorithm", IdentityAlgorithm}); err == nil {
+		t.Error("--benchmark-algorithm identity without --allow-insecure-algorithms is accepted")
+	}
+
+	// The passwords are stored as given, without waiting for the preprocessing delay.
+	enableInsecureAlgorithms()
+	t.Cleanup(func() {
+		delete(hashAlgorithms, IdentityAlgorithm)
+		delete(hashEncodings, IdentityAlgorithm)
+	})
+	ts = NewTestServer(t, slow)
+	code, resp, err := ts.Do(http.MethodPost, "/hash", "password=angryMonkey&algorithm=identity", FormHeader...)
+	id, convErr := strconv.Atoi(strings.TrimSpace(resp))
+	if err != nil || code != http.StatusOK || convErr != nil {
+		t.Fatalf("POST /hash identity = %d %q, %v", code, resp, err)
+	}
+	waitFor(t, "the identity hash", func() bool {
+		hash, err := ts.GetHash(id)
+		return err == nil && hash == "angryMonkey"
+	})
+}
+
+func TestExportCSV(t *testing.T) {
+	ts := NewTestServer(t)
+	tagged := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Tags: []string{"eu", "team-a"}})
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/annotate", tagged), `{"key":"note","value":"a \"quoted\", value"}`); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /hash/%d/annotate = %d %q, %v", tagged, code, body, err)
+	}
+	// More records than a batch, so that the export is read from the store in several batches.
+	for range CSVExportBatchSize + 10 {
+		ts.s.inboundRequests.Send(Command{requestType: SetHashCommand, id: ts.s.ids.Next(), password: testHash("other"), algorithm: "sha256"})
+	}
+	deleted := ts.mustPostHashes(t, "deleted")[0]
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", deleted), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %q, %v", deleted, code, body, err)
+	}
+
+	export := func(query string) [][]string {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodGet, "/admin/export/csv"+query, "")
+		if err != nil || code != http.StatusOK {
+			t.Fatalf("GET /admin/export/csv%s = %d, %v", query, code, err)
+		}
+		if strings.Contains(body, testHash("angryMonkey")) || strings.Contains(body, testHash("other")) {
+			t.Errorf("GET /admin/export/csv%s holds hash values", query)
+		}
+		rows, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+		if err != nil {
+			t.Fatalf("GET /admin/export/csv%s = %q, want CSV: %v", query, body, err)
+		}
+		return rows
+	}
+	rows := export("")
+	if want := []string{"id", "algorithm", "createdAt", "accessCount", "tags", "deleted", "annotations"}; !slices.Equal(rows[0], want) {
+		t.Errorf("CSV header = %v, want %v", rows[0], want)
+	}
+	if len(rows) != 1+1+CSVExportBatchSize+10 {
+		t.Fatalf("%d CSV rows, want the header and %d hashes", len(rows), 1+CSVExportBatchSize+10)
+	}
+	for i, row := range rows[1:] {
+		if id, err := strconv.Atoi(row[0]); err != nil || id != tagged+i {
+			t.Fatalf("CSV row %d = %v, want id %d", i+1, row, tagged+i)
+		}
+		if _, err := time.Parse(time.RFC3339, row[2]); err != nil || row[5] != "false" {
+			t.Errorf("CSV row %d = %v, want its creation time and not deleted", i+1, row)
+		}
+	}
+	if row := rows[1]; row[1] != "sha512" || row[4] != "eu team-a" || row[6] != `{"note":"a \"quoted\", value"}` {
+		t.Errorf("CSV row of hash %d = %v, want its tags and annotations", tagged, row)
+	}
+	if row := rows[2]; row[1] != "sha256" || row[4] != "" || row[6] != "" {
+		t.Errorf("CSV row of hash %d = %v, want sha256 without tags nor annotations", tagged+1, row)
+	}
+
+	rows = export("?include-deleted=true")
+	if last := rows[len(rows)-1]; len(rows) != 1+1+CSVExportBatchSize+10+1 || last[0] != strconv.Itoa(deleted) || last[5] != "true" {
+		t.Errorf("CSV export including the deleted hashes ends with %v, want hash %d deleted", last, deleted)
+	}
+}
+
+func TestDrain(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	health := func(method, path string) string {
+		t.Helper()
+		code, body, err := ts.Do(method, path, "")
+		resp := &HealthResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil {
+			t.Fatalf("%s %s = %d %q, %v", method, path, code, body, err)
+		}
+		return resp.Status
+	}
+	if status := health(http.MethodPost, "/admin/drain"); status != HealthDraining {
+		t.Errorf("POST /admin/drain status = %q, want %q", status, HealthDraining)
+	}
+	// The server is healthy, but rejects new hashes while still serving the existing ones.
+	if status := health(http.MethodGet, "/health"); status != HealthDraining {
+		t.Errorf("GET /health while draining = %q, want %q", status, HealthDraining)
+	}
+	if code, body, err := ts.Do(http.MethodPost, "/hash", "password=other", FormHeader...); err != nil || code != http.StatusServiceUnavailable {
+		t.Errorf("POST /hash while draining = %d %q, %v, want %d", code, body, err, http.StatusServiceUnavailable)
+	}
+	if hash, err := ts.GetHash(ids[0]); err != nil || hash != testHash("angryMonkey") {
+		t.Errorf("GET /hash/%d while draining = %q, %v", ids[0], hash, err)
+	}
+	if _, err := ts.GetStats(); err != nil {
+		t.Errorf("GET /stats while draining: %v", err)
+	}
+
+	if status := health(http.MethodPost, "/admin/undrain"); status != HealthOK {
+		t.Errorf("POST /admin/undrain status = %q, want %q", status, HealthOK)
+	}
+	ts.mustPostHashes(t, "other")
+	if code, body, err := ts.Do(http.MethodPost, "/admin/drain", "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("POST /admin/drain without the admin token = %d %q, %v, want %d", code, body, err, http.StatusUnauthorized)
+	}
+}
+
+func TestClientIdentity(t *testing.T) {
+	// The CA signs the certificate of the client, with a known subject.
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "test-ca"}, IsCA: true,
+		BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(caDER)
+	clientKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientTemplate := &x509.Certificate{SerialNumber: big.NewInt(2), Subject: pkix.Name{CommonName: "client-a", Organization: []string{"Acme"}},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(time.Hour)}
+	clientDER, err := x509.CreateCertificate(rand.Reader, clientTemplate, caCert, &clientKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := NewTestServer(t, func(cfg *Config) { cfg.TLSClientCAFile = caFile })
+	tlsConfig, err := newTLSConfig(ts.s.cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(ts.s.matchHandlers))
+	server.TLS = tlsConfig
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.Certificates = []tls.Certificate{{Certificate: [][]byte{clientDER}, PrivateKey: clientKey}}
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.PostForm(server.URL+APIPrefix+"/hash", url.Values{"password": {"angryMonkey"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	id, err := strconv.Atoi(strings.TrimSpace(string(body)))
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST /hash with a client certificate = %d %q", resp.StatusCode, body)
+	}
+	if _, err := ts.WaitHash(id); err != nil {
+		t.Fatal(err)
+	}
+	code, infoBody, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/info", id), "")
+	info := &HashInfo{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(infoBody), info) != nil || info.CreatedBy != "CN=client-a,O=Acme" {
+		t.Errorf("GET /hash/%d/info = %d %q, %v, want createdBy CN=client-a,O=Acme", id, code, infoBody, err)
+	}
+
+	// The clients without a certificate of the CA are refused.
+	if resp, err := server.Client().Get(server.URL + APIPrefix + "/stats"); err == nil {
+		resp.Body.Close()
+		t.Errorf("GET /stats without a client certificate = %d, want a TLS error", resp.StatusCode)
+	}
+	if s := (ClientIdentity{CommonName: "client-b", Organization: []string{"Acme", "Ops"}}).String(); s != "CN=client-b,O=Acme+Ops" {
+		t.Errorf("identity with 2 organizations = %q, want CN=client-b,O=Acme+Ops", s)
+	}
+}
+
+func TestPreShutdownWebhook(t *testing.T) {
+	cfg, err := ParseConfig(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PreShutdownDelay != DefaultPreShutdownDelay {
+		t.Errorf("default --pre-shutdown-delay = %v, want %v", cfg.PreShutdownDelay, DefaultPreShutdownDelay)
+	}
+	type notification struct {
+		method, contentType string
+		body                PreShutdownNotification
+	}
+	received := make(chan notification, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := notification{method: r.Method, contentType: r.Header.Get("Content-Type")}
+		json.NewDecoder(r.Body).Decode(&n.body)
+		received <- n
+		// The shutdown proceeds whatever the answer of the webhook.
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(webhook.Close)
+	ts := NewTestServer(t, func(cfg *Config) {
+		cfg.PreShutdownWebhook = webhook.URL
+		cfg.PreShutdownDelay = 300 * time.Millisecond
+	})
+	if code, body, err := ts.Do(http.MethodPost, "/shutdown", ""); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /shutdown = %d %q, %v", code, body, err)
+	}
+	select {
+	case n := <-received:
+		host, _ := os.Hostname()
+		want := notification{http.MethodPost, "application/json", PreShutdownNotification{Action: "draining", Address: host + DefaultPort}}
+		if n != want {
+			t.Errorf("pre-shutdown notification = %+v, want %+v", n, want)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the pre-shutdown webhook was not notified")
+	}
+	// The requests are still served during the delay following the notification.
+	if ts.s.isTerminated.Load() {
+		t.Error("the server is terminated right after the pre-shutdown notification")
+	}
+	select {
+	case <-ts.s.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the server has not shut down after the pre-shutdown delay")
+	}
+}
+
+func TestHashQR(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	for _, tc := range []struct {
+		query string
+		size  int
+	}{
+		{"", DefaultQRSize},
+		{"?size=128", 128},
+		{fmt.Sprintf("?size=%d", MaxQRSize), MaxQRSize},
+	} {
+		resp, err := ts.Client.Get(fmt.Sprintf("%s%s/hash/%d/qr%s", ts.Server.URL, APIPrefix, ids[0], tc.query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "image/png" || err != nil {
+			t.Fatalf("GET /hash/%d/qr%s = %d %s, %v, want a PNG image", ids[0], tc.query, resp.StatusCode, resp.Header.Get("Content-Type"), err)
+		}
+		if b := img.Bounds(); b.Dx() != tc.size || b.Dy() != tc.size {
+			t.Errorf("GET /hash/%d/qr%s = %v image, want %d pixels wide", ids[0], tc.query, b, tc.size)
+		}
+	}
+	for _, query := range []string{"?size=32", "?size=2048", "?size=big"} {
+		if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/qr%s", ids[0], query), ""); err != nil || code != http.StatusBadRequest {
+			t.Errorf("GET /hash/%d/qr%s = %d %q, %v, want %d", ids[0], query, code, body, err, http.StatusBadRequest)
+		}
+	}
+	if code, _, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/qr", ids[0]+1), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d/qr of an unknown id = %d, %v, want %d", ids[0]+1, code, err, http.StatusNotFound)
+	}
+}
+
+func TestRandomHash(t *testing.T) {
+	ts := NewTestServer(t)
+	random := func(query string) *RandomHashResponse {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodPost, "/hash/random"+query, "")
+		resp := &RandomHashResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil {
+			t.Fatalf("POST /hash/random%s = %d %q, %v", query, code, body, err)
+		}
+		return resp
+	}
+	passwords := map[string]bool{}
+	for _, tc := range []struct {
+		query, charset string
+		length         int
+	}{
+		{"", DefaultRandomCharset, DefaultRandomPasswordLength},
+		{"?length=20&charset=hex", "hex", 20},
+		{fmt.Sprintf("?length=%d&charset=printable", MaxRandomPasswordLength), "printable", MaxRandomPasswordLength},
+	} {
+		resp := random(tc.query)
+		if len(resp.Password) != tc.length || strings.Trim(resp.Password, randomCharsets[tc.charset]) != "" || passwords[resp.Password] {
+			t.Errorf("POST /hash/random%s password = %q, want %d new %s characters", tc.query, resp.Password, tc.length, tc.charset)
+		}
+		passwords[resp.Password] = true
+		// Only the hash of the password is stored, verifying it.
+		hash, err := ts.WaitHash(resp.ID)
+		if err != nil || !verifyHash(resp.Password, "sha512", "base64", hash) {
+			t.Errorf("GET /hash/%d = %q, %v, want the hash of the random password", resp.ID, hash, err)
+		}
+	}
+
+	for _, query := range []string{"?length=4", "?length=1000", "?charset=emoji"} {
+		if code, body, err := ts.Do(http.MethodPost, "/hash/random"+query, ""); err != nil || code != http.StatusBadRequest {
+			t.Errorf("POST /hash/random%s = %d %q, %v, want %d", query, code, body, err, http.StatusBadRequest)
+		}
+	}
+	if code, body, err := ts.Do(http.MethodPost, "/hash/random", "password=chosen", FormHeader...); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /hash/random with a password = %d %q, %v, want %d", code, body, err, http.StatusBadRequest)
+	}
+	if code, body, err := ts.Do(http.MethodPost, "/hash/random", "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("POST /hash/random without the admin token = %d %q, %v, want %d", code, body, err, http.StatusUnauthorized)
+	}
+}
+
+func TestStressStore(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.AllowAdminStress = true })
+	code, body, err := ts.Do(http.MethodPost, "/admin/stress-store?count=100&algorithm=sha256", "")
+	resp := &StressStoreResponse{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil {
+		t.Fatalf("POST /admin/stress-store = %d %q, %v", code, body, err)
+	}
+	if resp.Stored != 100 || resp.StoreSizeBytes <= 0 {
+		t.Errorf("POST /admin/stress-store = %+v, want 100 hashes stored and their size", resp)
+	}
+	// The hashes are stored by the time the response is sent.
+	if ids := ts.listIDs(t, ""); len(ids) != 100 || ids[0] != 1 || ids[99] != 100 {
+		t.Errorf("GET /hashes after the stress test = %d ids, want 1 to 100", len(ids))
+	}
+	if stats, err := ts.GetStats(); err != nil || stats.TotalNum != 100 {
+		t.Errorf("stats after the stress test = %+v, %v, want 100 hashes", stats, err)
+	}
+	if _, body, err := ts.Do(http.MethodGet, "/hash/100/algorithm", ""); err != nil || !strings.Contains(body, `"algorithm":"sha256"`) {
+		t.Errorf("GET /hash/100/algorithm = %q, %v, want sha256", body, err)
+	}
+
+	for _, query := range []string{"?count=0", fmt.Sprintf("?count=%d", MaxStressCount+1), "?count=10&algorithm=unknown"} {
+		if code, body, err := ts.Do(http.MethodPost, "/admin/stress-store"+query, ""); err != nil || code != http.StatusBadRequest {
+			t.Errorf("POST /admin/stress-store%s = %d %q, %v, want %d", query, code, body, err, http.StatusBadRequest)
+		}
+	}
+	ts = NewTestServer(t)
+	if code, body, err := ts.Do(http.MethodPost, "/admin/stress-store?count=10", ""); err != nil || code != http.StatusForbidden {
+		t.Errorf("POST /admin/stress-store without --allow-admin-stress = %d %q, %v, want %d", code, body, err, http.StatusForbidden)
+	}
+}
+
+func TestAlgorithmDistribution(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.DeprecatedAlgorithms = []string{"sha256", "md5"} })
+	distribution := func() map[string]any {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodGet, "/admin/algorithm-distribution", "")
+		var dist map[string]any
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), &dist) != nil {
+			t.Fatalf("GET /admin/algorithm-distribution = %d %q, %v", code, body, err)
+		}
+		return dist
+	}
+	if dist := distribution(); !reflect.DeepEqual(dist, map[string]any{PendingAlgorithm: 0.0}) {
+		t.Errorf("distribution of an empty store = %v, want no hash", dist)
+	}
+	sha512IDs := ts.mustPostHashes(t, "first", "second", "third")
+	for _, password := range []string{"fourth", "fifth"} {
+		ts.postHashRequest(t, &HashRequest{Password: password, Algorithm: "sha256"})
+	}
+	// The deleted hashes are left out, and the ids being processed counted as pending.
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", sha512IDs[0]), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %q, %v", sha512IDs[0], code, body, err)
+	}
+	pending := ts.s.ids.Next()
+	defer ts.s.ids.Done(pending)
+	want := map[string]any{"sha512": 2.0, "sha256": 2.0, PendingAlgorithm: 1.0, DeprecatedKey: []any{"sha256"}}
+	if dist := distribution(); !reflect.DeepEqual(dist, want) {
+		t.Errorf("distribution = %v, want %v", dist, want)
+	}
+}
+
+func TestShareLink(t *testing.T) {
+	const key = "link-signing-key"
+	ts := NewTestServer(t, func(cfg *Config) { cfg.LinkSigningKey = key })
+	ids := ts.mustPostHashes(t, "angryMonkey", "other")
+	get := func(link string) (int, string) {
+		t.Helper()
+		resp, err := ts.Client.Get(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(body))
+	}
+	code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/link?ttl=60", ids[0]), "")
+	link := &LinkResponse{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), link) != nil {
+		t.Fatalf("GET /hash/%d/link = %d %q, %v", ids[0], code, body, err)
+	}
+	if remaining := time.Until(link.ExpiresAt); remaining <= 58*time.Second || remaining > 60*time.Second {
+		t.Errorf("link expires at %v, want in 60s", link.ExpiresAt)
+	}
+	if code, hash := get(link.URL); code != http.StatusOK || hash != testHash("angryMonkey") {
+		t.Errorf("GET %s = %d %q, want the hash", link.URL, code, hash)
+	}
+
+	// The links expired, tampered with or of another hash are refused.
+	u, _ := url.Parse(link.URL)
+	expired := time.Now().Add(-time.Second).Unix()
+	for name, query := range map[string]url.Values{
+		"expired":     {"sig": {linkSignature(key, ids[0], expired)}, "exp": {strconv.FormatInt(expired, 10)}},
+		"extended":    {"sig": u.Query()["sig"], "exp": {strconv.FormatInt(link.ExpiresAt.Unix()+3600, 10)}},
+		"other hash":  {"sig": {linkSignature(key, ids[1], link.ExpiresAt.Unix())}, "exp": u.Query()["exp"]},
+		"without exp": {"sig": u.Query()["sig"]},
+		"another key": {"sig": {linkSignature("other-key", ids[0], link.ExpiresAt.Unix())}, "exp": u.Query()["exp"]},
+	} {
+		u.RawQuery = query.Encode()
+		if code, body := get(u.String()); code != http.StatusForbidden {
+			t.Errorf("GET of the %s link %s = %d %q, want %d", name, u, code, body, http.StatusForbidden)
+		}
+	}
+
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/link?ttl=0", ids[0]), ""); err != nil || code != http.StatusBadRequest {
+		t.Errorf("GET /hash/%d/link?ttl=0 = %d %q, %v, want %d", ids[0], code, body, err, http.StatusBadRequest)
+	}
+	ts = NewTestServer(t)
+	if code, body, err := ts.Do(http.MethodGet, "/hash/1/link", ""); err != nil || code != http.StatusNotImplemented {
+		t.Errorf("GET /hash/1/link without --link-signing-key = %d %q, %v, want %d", code, body, err, http.StatusNotImplemented)
+	}
+}
+
+func TestHashPreview(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "angryMonkey")
+	hash := testHash("angryMonkey")
+	for _, tc := range []struct {
+		query, want string
+	}{
+		{"", hash[:8] + PreviewMask + hash[len(hash)-4:]},
+		{"?prefixChars=2&suffixChars=0", hash[:2] + PreviewMask},
+		{"?prefixChars=16&suffixChars=16", hash[:16] + PreviewMask + hash[len(hash)-16:]},
+	} {
+		code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/preview%s", ids[0], tc.query), "")
+		resp := &PreviewResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil {
+			t.Fatalf("GET /hash/%d/preview%s = %d %q, %v", ids[0], tc.query, code, body, err)
+		}
+		if want := (PreviewResponse{Preview: tc.want, FullLength: len(hash), Algorithm: "sha512"}); *resp != want {
+			t.Errorf("GET /hash/%d/preview%s = %+v, want %+v", ids[0], tc.query, *resp, want)
+		}
+		if strings.Contains(body, hash) {
+			t.Errorf("GET /hash/%d/preview%s = %q, holding the full hash", ids[0], tc.query, body)
+		}
+	}
+	for _, query := range []string{"?prefixChars=-1", fmt.Sprintf("?suffixChars=%d", MaxPreviewChars+1), "?prefixChars=a"} {
+		if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/preview%s", ids[0], query), ""); err != nil || code != http.StatusBadRequest {
+			t.Errorf("GET /hash/%d/preview%s = %d %q, %v, want %d", ids[0], query, code, body, err, http.StatusBadRequest)
+		}
+	}
+	// At most half of a short hash is shown.
+	if preview := previewOf(&HashRecord{Hash: "abcdefghij", Algorithm: "identity"}, 8, 4); preview.Preview != "abc"+PreviewMask+"ij" {
+		t.Errorf("preview of a 10 character hash = %q, want 5 characters shown", preview.Preview)
+	}
+}
+
+func TestCopyHash(t *testing.T) {
+	ts := NewTestServer(t)
+	id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Namespace: "eu-west", Tags: []string{"team-a"}})
+	code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/copy", id), `{"targetNamespace":"us-west","targetAlgorithm":"sha256"}`)
+	resp := &CopyResponse{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil || resp.ID == id || resp.Status != StatusPendingResubmit {
+		t.Fatalf("POST /hash/%d/copy = %d %q, %v, want a new id awaiting its password", id, code, body, err)
+	}
+	copyID := resp.ID
+
+	// The copy has the metadata of the source for the target, but no hash until its password is submitted again.
+	code, body, err = ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", copyID), "")
+	if want := fmt.Sprintf(`{"id":%d,"status":%q}`, copyID, StatusPendingResubmit); err != nil || code != http.StatusAccepted || strings.TrimSpace(body) != want {
+		t.Errorf("GET /hash/%d of the copy = %d %q, %v, want %d %s", copyID, code, body, err, http.StatusAccepted, want)
+	}
+	code, body, err = ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/info", copyID), "")
+	info := &HashInfo{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), info) != nil {
+		t.Fatalf("GET /hash/%d/info = %d %q, %v", copyID, code, body, err)
+	}
+	if !info.AwaitingResubmit || info.Namespace != "us-west" || info.Algorithm != "sha256" || !slices.Equal(info.Tags, []string{"team-a"}) {
+		t.Errorf("GET /hash/%d/info of the copy = %+v, want the metadata of the source in us-west with sha256, awaiting its password", copyID, info)
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/raw", copyID), ""); err != nil || code != http.StatusConflict {
+		t.Errorf("GET /hash/%d/raw of the copy = %d %q, %v, want %d", copyID, code, body, err, http.StatusConflict)
+	}
+
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d", copyID), "password=angryMonkey&algorithm=sha256", FormHeader...); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /hash/%d = %d %q, %v", copyID, code, body, err)
+	}
+	sum := sha256.Sum256([]byte("angryMonkey"))
+	if hash, err := ts.WaitHash(copyID); err != nil || hash != base64.StdEncoding.EncodeToString(sum[:]) {
+		t.Errorf("GET /hash/%d after the resubmission = %q, %v, want the SHA-256 of the password", copyID, hash, err)
+	}
+
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/copy", id), `{"targetAlgorithm":"md5"}`); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /hash/%d/copy to an unknown algorithm = %d %q, %v, want %d", id, code, body, err, http.StatusBadRequest)
+	}
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/copy", copyID+10), `{}`); err != nil || code != http.StatusNotFound {
+		t.Errorf("POST /hash/%d/copy of an unknown id = %d %q, %v, want %d", copyID+10, code, body, err, http.StatusNotFound)
+	}
+}
+
+func TestAnnotations(t *testing.T) {
+	ts := NewTestServer(t)
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := OpenAuditLog(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.s.audit = audit
+	id := ts.mustPostHashes(t, "angryMonkey")[0]
+
+	longKey, longValue := strings.Repeat("k", MaxAnnotationKeySize), strings.Repeat("v", MaxAnnotationValueSize)
+	for _, a := range []AnnotateRequest{{Key: "userId", Value: "1"}, {Key: "userId", Value: "12345"}, {Key: longKey, Value: longValue}, {Key: "empty"}} {
+		body, _ := json.Marshal(&a)
+		if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/annotate", id), string(body)); err != nil || code != http.StatusOK {
+			t.Fatalf("POST /hash/%d/annotate %s = %d %q, %v", id, body, code, resp, err)
+		}
+	}
+	code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/annotations", id), "")
+	resp := &AnnotationsResponse{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil {
+		t.Fatalf("GET /hash/%d/annotations = %d %q, %v", id, code, body, err)
+	}
+	if want := map[string]string{"userId": "12345", longKey: longValue, "empty": ""}; resp.ID != id || !maps.Equal(resp.Annotations, want) {
+		t.Errorf("GET /hash/%d/annotations = %+v, want the last value of each key %v", id, resp, want)
+	}
+
+	for _, body := range []string{`{"value":"1"}`, fmt.Sprintf(`{"key":%q,"value":"1"}`, longKey+"k"), fmt.Sprintf(`{"key":"userId","value":%q}`, longValue+"v"), `{"key":`} {
+		if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/annotate", id), body); err != nil || code != http.StatusBadRequest {
+			t.Errorf("POST /hash/%d/annotate %.40s = %d %q, %v, want %d", id, body, code, resp, err, http.StatusBadRequest)
+		}
+	}
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/annotate", id+10), `{"key":"userId","value":"1"}`); err != nil || code != http.StatusNotFound {
+		t.Errorf("POST /hash/%d/annotate of an unknown id = %d %q, %v, want %d", id+10, code, body, err, http.StatusNotFound)
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/annotations", id+10), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d/annotations of an unknown id = %d %q, %v, want %d", id+10, code, body, err, http.StatusNotFound)
+	}
+
+	// Only the accepted annotations are audited.
+	data, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var annotated int
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		entry := &AuditEntry{}
+		if err := json.Unmarshal([]byte(line), entry); err != nil {
+			t.Fatalf("audit line %q: %v", line, err)
+		}
+		if entry.Action == "annotate" {
+			annotated++
+		}
+	}
+	if annotated != 4 {
+		t.Errorf("audit log has %d annotate entries, want 4:\n%s", annotated, data)
+	}
+}
+
+func TestPrintBanner(t *testing.T) {
+	cfg, err := ParseConfig([]string{"--quiet", "--api-version", APIVersionV1, "--algorithm-rate-limit", "sha512=2.5", "--algorithm-rate-limit", "sha256=0", "--snapshot-dir", "/var/snapshots"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.Quiet {
+		t.Error("--quiet does not suppress the banner")
+	}
+	var out strings.Builder
+	PrintBanner(cfg, &out)
+	for _, want := range []string{"Port:            " + strings.TrimPrefix(DefaultPort, ":"), "TLS:             disabled", "API version:     " + APIVersionV1,
+		"(default " + DefaultAlgorithm + ")", "bcrypt=10/s, sha512=2.5/s\n", "Storage:         in-memory, snapshots in /var/snapshots\n", "Audit log:       disabled"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("PrintBanner() = %q, want it to contain %q", out.String(), want)
+		}
+	}
+	for _, algorithm := range slices.Collect(maps.Keys(hashAlgorithms)) {
+		if !strings.Contains(out.String(), algorithm) {
+			t.Errorf("PrintBanner() = %q, want it to list the %s algorithm", out.String(), algorithm)
+		}
+	}
+
+	cfg.TLSCertFile, cfg.TLSClientCAFile, cfg.WALFile, cfg.AuditLogFile, cfg.AlgorithmRateLimits = "cert.pem", "ca.pem", "hashes.wal", "audit.log", nil
+	out.Reset()
+	PrintBanner(cfg, &out)
+	for _, want := range []string{"TLS:             mutual (cert.pem, clients of ca.pem)", "Rate limits:     none", "write-ahead log hashes.wal", "Audit log:       audit.log"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("PrintBanner() = %q, want it to contain %q", out.String(), want)
+		}
+	}
+}
+
+// TestPendingCommands checks that the commands queued behind a busy store goroutine are counted by type until processed.
+func TestPendingCommands(t *testing.T) {
+	ts := NewTestServer(t)
+	// The store goroutine is paused as for a snapshot, so that the commands sent meanwhile are queued.
+	paused, resume := make(chan Result, 1), make(chan struct{})
+	var once sync.Once
+	unblock := func() { once.Do(func() { close(resume) }) }
+	t.Cleanup(unblock)
+	ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: DrainAndPauseCommand, snapshot: &Snapshot{}, resume: resume, responseChannel: paused})
+	<-paused
+	for range 3 {
+		ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: SetHashCommand, id: ts.s.ids.Next(), password: testHash("angryMonkey"), algorithm: DefaultAlgorithm})
+	}
+	ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: GetHashCommand, id: 1, responseChannel: make(chan Result, 1)})
+
+	counts := map[string]int64{}
+	code, body, err := ts.Do(http.MethodGet, "/admin/commands/pending", "")
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), &counts) != nil {
+		t.Fatalf("GET /admin/commands/pending = %d %q, %v", code, body, err)
+	}
+	if counts["setHash"] != 3 || counts["getHash"] != 1 || counts["drainAndPause"] != 0 {
+		t.Errorf("GET /admin/commands/pending while the store is busy = %v, want 3 setHash and 1 getHash", counts)
+	}
+
+	unblock()
+	waitFor(t, "the queued commands to be processed", func() bool {
+		for _, count := range ts.s.pending.Counts() {
+			if count != 0 {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// TestReloadAllowlist checks that the CIDRs replaced by /admin/reload-allowlist take effect at once, without a restart.
+func TestReloadAllowlist(t *testing.T) {
+	ts := NewTestServer(t)
+	id := ts.mustPostHashes(t, "angryMonkey")[0]
+	// httptest.NewRequest requests come from 192.0.2.1, the test server ones from the loopback.
+	getFromTestNet := func() int {
+		w := httptest.NewRecorder()
+		ts.s.matchHandlers(w, httptest.NewRequest(http.MethodGet, fmt.Sprintf("%s/hash/%d", APIPrefix, id), nil))
+		return w.Code
+	}
+	if code := getFromTestNet(); code != http.StatusOK {
+		t.Fatalf("GET /hash/%d without ACL = %d, want %d", id, code, http.StatusOK)
+	}
+
+	reload := func(body string, want *ReloadAllowlistResponse) {
+		t.Helper()
+		code, resp, err := ts.Do(http.MethodPost, "/admin/reload-allowlist", body)
+		got := &ReloadAllowlistResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), got) != nil {
+			t.Fatalf("POST /admin/reload-allowlist %s = %d %q, %v", body, code, resp, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("POST /admin/reload-allowlist %s = %+v, want %+v", body, got, want)
+		}
+	}
+	none := []string{}
+	reload(`{"deny":["192.0.2.0/24","192.0.2.7/24"]}`, &ReloadAllowlistResponse{Allow: CIDRDiff{none, none}, Deny: CIDRDiff{[]string{"192.0.2.0/24"}, none}})
+	if code := getFromTestNet(); code != http.StatusForbidden {
+		t.Errorf("GET /hash/%d from a denied CIDR = %d, want %d", id, code, http.StatusForbidden)
+	}
+	if _, err := ts.GetHash(id); err != nil {
+		t.Errorf("GET /hash/%d from the loopback: %v", id, err)
+	}
+
+	reload(`{"allow":["127.0.0.0/8","192.0.2.0/24"]}`, &ReloadAllowlistResponse{Allow: CIDRDiff{[]string{"127.0.0.0/8", "192.0.2.0/24"}, none}, Deny: CIDRDiff{none, []string{"192.0.2.0/24"}}})
+	if code := getFromTestNet(); code != http.StatusOK {
+		t.Errorf("GET /hash/%d from an allowed CIDR = %d, want %d", id, code, http.StatusOK)
+	}
+	reload(`{"allow":["127.0.0.0/8"]}`, &ReloadAllowlistResponse{Allow: CIDRDiff{none, []string{"192.0.2.0/24"}}, Deny: CIDRDiff{none, none}})
+	if code := getFromTestNet(); code != http.StatusForbidden {
+		t.Errorf("GET /hash/%d from a CIDR no longer allowed = %d, want %d", id, code, http.StatusForbidden)
+	}
+
+	if code, body, err := ts.Do(http.MethodPost, "/admin/reload-allowlist", `{"deny":["192.0.2.0"]}`); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /admin/reload-allowlist with an invalid CIDR = %d %q, %v, want %d", code, body, err, http.StatusBadRequest)
+	}
+	if code := getFromTestNet(); code != http.StatusForbidden {
+		t.Errorf("GET /hash/%d after an invalid reload = %d, want the ACL unchanged", id, code)
+	}
+}
+
+// TestKillHashComputation checks that a killed hash computation marks its id as failed, leaving the others running.
+func TestKillHashComputation(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.HashPreprocessingDelay = time.Hour })
+	killed, err := ts.PostHash("angryMonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	running, err := ts.PostHash("happyMonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/admin/kill/%d", killed), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /admin/kill/%d = %d %q, %v", killed, code, body, err)
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", killed), ""); err != nil || code != http.StatusGone {
+		t.Errorf("GET /hash/%d once killed = %d %q, %v, want %d", killed, code, body, err, http.StatusGone)
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d", running), ""); err != nil || code != http.StatusAccepted {
+		t.Errorf("GET /hash/%d still being computed = %d %q, %v, want %d", running, code, body, err, http.StatusAccepted)
+	}
+
+	for _, id := range []int{killed, running + 1} {
+		if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/admin/kill/%d", id), ""); err != nil || code != http.StatusNotFound {
+			t.Errorf("DELETE /admin/kill/%d without computation = %d %q, %v, want %d", id, code, body, err, http.StatusNotFound)
+		}
+	}
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/admin/kill/%d", running), "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("DELETE /admin/kill/%d without the admin token = %d %q, %v, want %d", running, code, body, err, http.StatusUnauthorized)
+	}
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/admin/kill/%d", running), ""); err != nil || code != http.StatusOK {
+		t.Errorf("DELETE /admin/kill/%d = %d %q, %v", running, code, body, err)
+	}
+}
+
+// TestPasswordNormalizer checks that the composed and decomposed forms of a password, in any case, get the same hash
+// when stored and verify the same hash.
+func TestPasswordNormalizer(t *testing.T) {
+	composed, decomposed := "caf\u00e9", "CAFE\u0301"
+	ts := NewTestServer(t, func(cfg *Config) { cfg.PasswordNormalizer, cfg.PasswordCase = NormalizerNFC, CaseLower })
+	ids := ts.mustPostHashes(t, composed, decomposed)
+	for _, id := range ids {
+		if hash, err := ts.WaitHash(id); err != nil || hash != testHash(composed) {
+			t.Errorf("GET /hash/%d = %q, %v, want the hash of %q", id, hash, err, composed)
+		}
+	}
+	form := url.Values{"password": {decomposed}}.Encode()
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/recompute", ids[0]), form, FormHeader...); err != nil || code != http.StatusOK {
+		t.Errorf("POST /hash/%d/recompute with the decomposed password = %d %q, %v, want %d", ids[0], code, body, err, http.StatusOK)
+	}
+
+	// Without normalizer, the forms are different passwords.
+	ts = NewTestServer(t)
+	ids = ts.mustPostHashes(t, composed, decomposed)
+	for i, password := range []string{composed, decomposed} {
+		if hash, err := ts.WaitHash(ids[i]); err != nil || hash != testHash(password) {
+			t.Errorf("GET /hash/%d without normalizer = %q, %v, want the hash of %q", ids[i], hash, err, password)
+		}
+	}
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/recompute", ids[0]), form, FormHeader...); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("POST /hash/%d/recompute with the decomposed password without normalizer = %d %q, %v, want %d", ids[0], code, body, err, http.StatusUnauthorized)
+	}
+
+	for _, args := range [][]string{{"--password-normalizer", "nfd"}, {"--password-case", "upper"}} {
+		if _, err := ParseConfig(args); err == nil {
+			t.Errorf("ParseConfig(%q) succeeded, want an error", args)
+		}
+	}
+}
+
+// TestRawAlgorithm checks the parameters returned for each algorithm.
+func TestRawAlgorithm(t *testing.T) {
+	ts := NewTestServer(t)
+	parameters := func(t *testing.T, id int) *AlgorithmParameters {
+		t.Helper()
+		if _, err := ts.WaitHash(id); err != nil {
+			t.Fatal(err)
+		}
+		code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/raw-algorithm", id), "")
+		params := &AlgorithmParameters{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), params) != nil {
+			t.Fatalf("GET /hash/%d/raw-algorithm = %d %q, %v", id, code, body, err)
+		}
+		return params
+	}
+
+	t.Run("sha", func(t *testing.T) {
+		plain := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "sha256", Encoding: "hex"})
+		if got, want := parameters(t, plain), (&AlgorithmParameters{Algorithm: "sha256", Encoding: "hex"}); !reflect.DeepEqual(got, want) {
+			t.Errorf("GET /hash/%d/raw-algorithm = %+v, want %+v", plain, got, want)
+		}
+		pepper := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("p", MinPepperSize)))
+		if code, body, err := ts.Do(http.MethodPost, "/admin/reload-pepper", `{"version":2,"pepper":"`+pepper+`"}`); err != nil || code != http.StatusOK {
+			t.Fatalf("POST /admin/reload-pepper = %d %q, %v", code, body, err)
+		}
+		peppered := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "sha512"})
+		if got, want := parameters(t, peppered), (&AlgorithmParameters{Algorithm: "sha512", PepperVersion: 2, Encoding: "base64"}); !reflect.DeepEqual(got, want) {
+			t.Errorf("GET /hash/%d/raw-algorithm = %+v, want %+v", peppered, got, want)
+		}
+	})
+	t.Run("argon2id", func(t *testing.T) {
+		id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "argon2id"})
+		got := parameters(t, id)
+		if got.Algorithm != "argon2id" || got.Version != 19 || got.MemoryCost != 64*1024 || got.TimeCost != 3 || got.Parallelism != 4 || got.KeyLen != 32 || len(got.Salt) != 32 || got.Encoding != "" {
+			t.Errorf("GET /hash/%d/raw-algorithm = %+v, want the RFC 9106 parameters and a 16 bytes hex salt", id, got)
+		}
+	})
+	t.Run("bcrypt", func(t *testing.T) {
+		id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "bcrypt"})
+		if got, want := parameters(t, id), (&AlgorithmParameters{Algorithm: "bcrypt", Cost: 12, PepperVersion: 2}); !reflect.DeepEqual(got, want) {
+			t.Errorf("GET /hash/%d/raw-algorithm = %+v, want %+v", id, got, want)
+		}
+	})
+
+	if code, body, err := ts.Do(http.MethodGet, "/hash/100/raw-algorithm", ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/100/raw-algorithm of an unknown id = %d %q, %v, want %d", code, body, err, http.StatusNotFound)
+	}
+}
+
+// TestGzipRequestBody checks that gzip compressed request bodies are processed as if they were not compressed.
+func TestGzipRequestBody(t *testing.T) {
+	ts := NewTestServer(t)
+	gzipped := func(body string) string {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write([]byte(body)); err != nil {
+			t.Fatal(err)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return buf.String()
+	}
+
+	var ids []int
+	for _, tc := range []struct{ body, contentType string }{
+		{`{"password":"angryMonkey"}`, "application/json"},
+		{"password=angryMonkey", "application/x-www-form-urlencoded"},
+	} {
+		code, body, err := ts.Do(http.MethodPost, "/hash", gzipped(tc.body), "Content-Type", tc.contentType, "Content-Encoding", "gzip")
+		id, convErr := strconv.Atoi(strings.TrimSpace(body))
+		if err != nil || code != http.StatusOK || convErr != nil {
+			t.Fatalf("POST /hash of a gzip %s body = %d %q, %v", tc.contentType, code, body, err)
+		}
+		if hash, err := ts.WaitHash(id); err != nil || hash != testHash("angryMonkey") {
+			t.Errorf("GET /hash/%d posted with a gzip %s body = %q, %v, want %q", id, tc.contentType, hash, err, testHash("angryMonkey"))
+		}
+		ids = append(ids, id)
+	}
+
+	code, body, err := ts.Do(http.MethodDelete, "/hashes/bulk", gzipped(fmt.Sprintf(`{"ids":[%d,%d]}`, ids[0], ids[1])), "Content-Type", "application/json", "Content-Encoding", "gzip")
+	deleted := &BulkDeleteResponse{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), deleted) != nil || deleted.Deleted != 2 {
+		t.Errorf("DELETE /hashes/bulk of a gzip body = %d %q, %v, want both hashes deleted", code, body, err)
+	}
+
+	if code, body, err := ts.Do(http.MethodPost, "/hash", `{"password":"angryMonkey"}`, "Content-Encoding", "gzip"); err != nil || code != http.StatusBadRequest {
+		t.Errorf("POST /hash of a body which is not gzip = %d %q, %v, want %d", code, body, err, http.StatusBadRequest)
+	}
+}
+
+// TestReencodedHash checks that `/hash/{id}/hex` and `/hash/{id}/base64` convert the hash whatever its encoding.
+func TestReencodedHash(t *testing.T) {
+	ts := NewTestServer(t)
+	sum256, sum512 := sha256.Sum256([]byte("angryMonkey")), sha512.Sum512([]byte("angryMonkey"))
+	for _, tc := range []struct {
+		req *HashRequest
+		sum []byte
+	}{
+		{&HashRequest{Password: "angryMonkey", Algorithm: "sha256", Encoding: "hex"}, sum256[:]},
+		{&HashRequest{Password: "angryMonkey", Algorithm: "sha256", Encoding: "base64url"}, sum256[:]},
+		{&HashRequest{Password: "angryMonkey", Algorithm: "sha512"}, sum512[:]},
+	} {
+		id := ts.postHashRequest(t, tc.req)
+		if _, err := ts.WaitHash(id); err != nil {
+			t.Fatal(err)
+		}
+		for encoding, want := range map[string]string{"hex": hex.EncodeToString(tc.sum), "base64": base64.StdEncoding.EncodeToString(tc.sum)} {
+			resp, err := ts.Client.Get(fmt.Sprintf("%s%s/hash/%d/%s", ts.Server.URL, APIPrefix, id, encoding))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil || resp.StatusCode != http.StatusOK || strings.TrimSpace(string(body)) != want || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") {
+				t.Errorf("GET /hash/%d/%s of a %s hash = %d %q %q, %v, want text %q", id, encoding, tc.req.Encoding, resp.StatusCode, resp.Header.Get("Content-Type"), body, err, want)
+			}
+		}
+	}
+
+	ts = NewTestServer(t, func(cfg *Config) { cfg.HashPreprocessingDelay = time.Hour })
+	id, err := ts.PostHash("angryMonkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/hex", id), ""); err != nil || code != http.StatusAccepted {
+		t.Errorf("GET /hash/%d/hex of a pending hash = %d %q, %v, want %d", id, code, body, err, http.StatusAccepted)
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/base64", id+1), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d/base64 of an unknown id = %d %q, %v, want %d", id+1, code, body, err, http.StatusNotFound)
+	}
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/admin/kill/%d", id), ""); err != nil || code != http.StatusOK {
+		t.Errorf("DELETE /admin/kill/%d = %d %q, %v", id, code, body, err)
+	}
+}
+
+// TestObservedTimes checks that the stats hold the shortest and longest hash durations since they were reset.
+func TestObservedTimes(t *testing.T) {
+	st := NewStoreTest(t, StoreOptions{})
+	setHash := func(elapsed time.Duration) {
+		st.q.Send(Command{requestType: SetHashCommand, id: st.ids.Next(), password: testHash("angryMonkey"), algorithm: "sha512",
+			requestStartTs: time.Now().Add(-elapsed).UnixMicro()})
+	}
+	setHash(time.Millisecond)
+	setHash(50 * time.Millisecond)
+	setHash(10 * time.Millisecond)
+	stats := decodeStats(t, st.Send(Command{requestType: GetStatsCommand}))
+	if stats.MinObservedUs < 1000 || stats.MinObservedUs >= 10000 || stats.MaxObservedUs < 50000 || stats.MaxObservedUs >= 1000000 {
+		t.Errorf("stats observed times = [%d, %d]µs, want about [1000, 50000]µs", stats.MinObservedUs, stats.MaxObservedUs)
+	}
+
+	st.Send(Command{requestType: ResetStatsCommand})
+	if stats := decodeStats(t, st.Send(Command{requestType: GetStatsCommand})); stats.MinObservedUs != 0 || stats.MaxObservedUs != 0 {
+		t.Errorf("stats observed times once reset = [%d, %d]µs, want 0", stats.MinObservedUs, stats.MaxObservedUs)
+	}
+	setHash(20 * time.Millisecond)
+	if stats := decodeStats(t, st.Send(Command{requestType: GetStatsCommand})); stats.MinObservedUs != stats.MaxObservedUs || stats.MinObservedUs < 20000 {
+		t.Errorf("stats observed times of a single hash = [%d, %d]µs, want both about 20000µs", stats.MinObservedUs, stats.MaxObservedUs)
+	}
+}
+
+// TestInspect checks that `/admin/inspect/{id}` returns the full state of a record, and audits the inspections.
+func TestInspect(t *testing.T) {
+	ts := NewTestServer(t)
+	auditFile := filepath.Join(t.TempDir(), "audit.log")
+	audit, err := OpenAuditLog(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts.s.audit = audit
+	inspect := func(id int) *InspectResponse {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/admin/inspect/%d", id), "")
+		resp := &InspectResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil {
+			t.Fatalf("GET /admin/inspect/%d = %d %q, %v", id, code, body, err)
+		}
+		return resp
+	}
+
+	pepper := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("p", MinPepperSize)))
+	if code, body, err := ts.Do(http.MethodPost, "/admin/reload-pepper", `{"version":2,"pepper":"`+pepper+`"}`); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /admin/reload-pepper = %d %q, %v", code, body, err)
+	}
+	before := time.Now()
+	id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Namespace: "eu-west", Tags: []string{"team-b", "team-a"}})
+	hash, err := ts.WaitHash(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/annotate", id), `{"key":"userId","value":"12345"}`); err != nil || code != http.StatusOK {
+		t.Fatalf("POST /hash/%d/annotate = %d %q, %v", id, code, body, err)
+	}
+	waitFor(t, "the retrieval to be counted", func() bool { return inspect(id).AccessCount > 0 })
+
+	got := inspect(id)
+	if got.ID != id || got.Pending || got.Failed || got.HashRecord == nil {
+		t.Fatalf("GET /admin/inspect/%d = %+v, want its stored record", id, got)
+	}
+	if got.Hash != hash || got.Algorithm != DefaultAlgorithm || got.PepperVersion != 2 || got.Namespace != "eu-west" ||
+		!slices.Equal(got.Tags, []string{"team-a", "team-b"}) || !maps.Equal(got.Annotations, map[string]string{"userId": "12345"}) ||
+		len(got.Versions) != 1 || got.Versions[0].Hash != hash || got.Deleted || got.DeletedAt != nil {
+		t.Errorf("GET /admin/inspect/%d = %+v, want the hash %q peppered with version 2, its namespace, tags and annotation", id, got.HashRecord, hash)
+	}
+	if got.CreatedAt.Before(before) || got.LastAccessed.Before(got.CreatedAt) {
+		t.Errorf("GET /admin/inspect/%d created at %v, last accessed at %v, want both since %v", id, got.CreatedAt, got.LastAccessed, before)
+	}
+
+	if code, body, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", id), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %q, %v", id, code, body, err)
+	}
+	if got := inspect(id); !got.Deleted || got.DeletedAt == nil {
+		t.Errorf("GET /admin/inspect/%d once deleted = %+v, want a tombstone", id, got.HashRecord)
+	}
+
+	pending := ts.s.ids.Next()
+	if got := inspect(pending); !got.Pending || got.Failed || got.HashRecord != nil {
+		t.Errorf("GET /admin/inspect/%d being computed = %+v, want it pending without record", pending, got)
+	}
+	ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: FailHashCommand, id: pending})
+	if got := inspect(pending); got.Pending || !got.Failed || got.HashRecord != nil {
+		t.Errorf("GET /admin/inspect/%d once failed = %+v, want it failed without record", pending, got)
+	}
+
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/admin/inspect/%d", pending+1), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /admin/inspect/%d of an unknown id = %d %q, %v, want %d", pending+1, code, body, err, http.StatusNotFound)
+	}
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/admin/inspect/%d", id), "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("GET /admin/inspect/%d without the admin token = %d %q, %v, want %d", id, code, body, err, http.StatusUnauthorized)
+	}
+
+	data, err := os.ReadFile(auditFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"action":"inspect","remoteAddr":"127.0.0.1:`) || !strings.Contains(string(data), fmt.Sprintf(`"details":{"id":%d}`, id)) {
+		t.Errorf("audit log = %s, want the inspections of hash %d", data, id)
+	}
+}
+
+// TestWarmup checks that the hashes of the warmup file are stored without the preprocessing delay.
+func TestWarmup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "warmup.json")
+	if err := os.WriteFile(path, []byte(`[{"id":1,"password":"angryMonkey"},{"id":3,"password":"happyMonkey","algorithm":"sha256"}]`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := LoadWarmup(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []WarmupEntry{{ID: 1, Password: "angryMonkey", Algorithm: DefaultAlgorithm}, {ID: 3, Password: "happyMonkey", Algorithm: "sha256"}}
+	if !slices.Equal(entries, want) {
+		t.Fatalf("LoadWarmup() = %+v, want %+v", entries, want)
+	}
+
+	ts := NewTestServer(t, func(cfg *Config) { cfg.HashPreprocessingDelay = time.Hour })
+	ts.s.startWarmup(entries)
+	if last := ts.s.ids.Last(); last != 3 {
+		t.Errorf("last id issued after the warmup = %d, want the warmed ids reserved", last)
+	}
+	sum := sha256.Sum256([]byte("happyMonkey"))
+	for id, want := range map[int]string{1: testHash("angryMonkey"), 3: base64.StdEncoding.EncodeToString(sum[:])} {
+		if hash, err := ts.WaitHash(id); err != nil || hash != want {
+			t.Errorf("GET /hash/%d warmed up = %q, %v, want %q", id, hash, err, want)
+		}
+	}
+
+	for _, data := range []string{
+		`[{"id":0,"password":"angryMonkey"}]`,
+		`[{"id":1,"password":"angryMonkey"},{"id":1,"password":"happyMonkey"}]`,
+		`[{"id":1,"password":""}]`,
+		`[{"id":1,"password":"angryMonkey","algorithm":"md5"}]`,
+		`{"id":1}`,
+	} {
+		if err := os.WriteFile(path, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if entries, err := LoadWarmup(path); err == nil {
+			t.Errorf("LoadWarmup(%s) = %+v, want an error", data, entries)
+		}
+	}
+}
+
+// TestHashBenchmark checks the timing of the verifications of a hash, only enabled by --allow-benchmark.
+func TestHashBenchmark(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.AllowBenchmark = true })
+	id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "sha256"})
+	if _, err := ts.WaitHash(id); err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/hash/%d/benchmark", id)
+	benchmark := func(iterations int) *HashBenchmarkResponse {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodPost, path, fmt.Sprintf(`{"password":"angryMonkey","iterations":%d}`, iterations))
+		resp := &HashBenchmarkResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil {
+			t.Fatalf("POST %s of %d iterations = %d %q, %v", path, iterations, code, body, err)
+		}
+		return resp
+	}
+	if got := benchmark(2); got.Iterations != 2 || got.Algorithm != "sha256" || got.TotalUs < 0 || got.AverageUs != got.TotalUs/2 {
+		t.Errorf("POST %s of 2 iterations = %+v, want the average of 2 sha256 verifications", path, got)
+	}
+	// A SHA-256 verification may take less than a microsecond, unlike all of them.
+	if got := benchmark(MaxHashBenchmarkIterations); got.Iterations != MaxHashBenchmarkIterations || got.TotalUs <= 0 {
+		t.Errorf("POST %s of %d iterations = %+v, want a non-zero time", path, MaxHashBenchmarkIterations, got)
+	}
+
+	for _, tc := range []struct {
+		body   string
+		header []string
+		code   int
+	}{
+		{`{"password":"angryMonkey","iterations":101}`, nil, http.StatusBadRequest},
+		{`{"iterations":2}`, nil, http.StatusBadRequest},
+		{`{"password":"happyMonkey"}`, nil, http.StatusForbidden},
+		{`{"password":"angryMonkey"}`, []string{"Authorization", ""}, http.StatusUnauthorized},
+	} {
+		if code, body, err := ts.Do(http.MethodPost, path, tc.body, tc.header...); err != nil || code != tc.code {
+			t.Errorf("POST %s %s %q = %d %q, %v, want %d", path, tc.body, tc.header, code, body, err, tc.code)
+		}
+	}
+
+	ts = NewTestServer(t)
+	id = ts.mustPostHashes(t, "angryMonkey")[0]
+	if code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/benchmark", id), `{"password":"angryMonkey"}`); err != nil || code != http.StatusForbidden {
+		t.Errorf("POST /hash/%d/benchmark without --allow-benchmark = %d %q, %v, want %d", id, code, body, err, http.StatusForbidden)
+	}
+}
+
+// webhookDelivery is a notification received by a webhookReceiver.
+type webhookDelivery struct {
+	path      string
+	body      []byte
+	signature string
+}
+
+// newWebhookReceiver starts a server receiving webhook notifications, answering with the status returned by respond
+// for the path; the deliveries answered with 2xx are sent to the returned channel.
+func newWebhookReceiver(t testing.TB, respond func(path string) int) (*httptest.Server, <-chan webhookDelivery) {
+	t.Helper()
+	deliveries := make(chan webhookDelivery, 100)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		code := respond(r.URL.Path)
+		if code/100 == 2 {
+			deliveries <- webhookDelivery{path: r.URL.Path, body: body, signature: r.Header.Get(WebhookSignatureHeader)}
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(receiver.Close)
+	return receiver, deliveries
+}
+
+// TestSubscribeWebhook checks that the webhooks subscribed to a hash receive a signed notification once it is ready.
+func TestSubscribeWebhook(t *testing.T) {
+	var flaky atomic.Int32
+	receiver, deliveries := newWebhookReceiver(t, func(path string) int {
+		// The first delivery to /flaky fails, and is retried.
+		if path == "/flaky" && flaky.Add(1) == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	receive := func(path string) webhookDelivery {
+		t.Helper()
+		select {
+		case d := <-deliveries:
+			if d.path != path {
+				t.Fatalf("webhook notification posted to %s, want %s", d.path, path)
+			}
+			return d
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no webhook notification posted to %s", path)
+			return webhookDelivery{}
+		}
+	}
+	checkNotification := func(d webhookDelivery, secret string, id int) {
+		t.Helper()
+		notification := &WebhookNotification{}
+		if err := json.Unmarshal(d.body, notification); err != nil || *notification != (WebhookNotification{ID: id, Status: WebhookStatusReady}) {
+			t.Errorf("webhook notification = %s, %v, want hash %d ready", d.body, err, id)
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(d.body)
+		if d.signature != hex.EncodeToString(mac.Sum(nil)) {
+			t.Errorf("webhook notification signature = %q, want the HMAC-SHA256 of its body keyed with %q", d.signature, secret)
+		}
+	}
+	ts := NewTestServer(t)
+	subscribe := func(id int, path, secret, status string) {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/subscribe", id), fmt.Sprintf(`{"callbackUrl":"%s%s","secret":%q}`, receiver.URL, path, secret))
+		resp := &SubscribeResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil || *resp != (SubscribeResponse{ID: id, Status: status}) {
+			t.Fatalf("POST /hash/%d/subscribe to %s = %d %q, %v, want %s", id, path, code, body, err, status)
+		}
+	}
+
+	// The hash is only stored once subscribed to.
+	pending := ts.s.ids.Next()
+	subscribe(pending, "/flaky", "first-secret", StatusSubscribed)
+	ts.s.inboundRequests.Send(Command{requestType: SetHashCommand, id: pending, password: testHash("angryMonkey"), algorithm: DefaultAlgorithm})
+	checkNotification(receive("/flaky"), "first-secret", pending)
+	if n := flaky.Load(); n != 2 {
+		t.Errorf("webhook notified in %d attempts, want 2", n)
+	}
+
+	stored := ts.mustPostHashes(t, "happyMonkey")[0]
+	subscribe(stored, "/ready", "second-secret", StatusNotified)
+	checkNotification(receive("/ready"), "second-secret", stored)
+
+	for _, body := range []string{`{"callbackUrl":"` + receiver.URL + `"}`, `{"callbackUrl":"ftp://example.com","secret":"s"}`, `{"callbackUrl":"/relative","secret":"s"}`} {
+		if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/subscribe", stored), body); err != nil || code != http.StatusBadRequest {
+			t.Errorf("POST /hash/%d/subscribe %s = %d %q, %v, want %d", stored, body, code, resp, err, http.StatusBadRequest)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/subscribe", stored+1), `{"callbackUrl":"`+receiver.URL+`","secret":"s"}`); err != nil || code != http.StatusNotFound {
+		t.Errorf("POST /hash/%d/subscribe of an unknown id = %d %q, %v, want %d", stored+1, code, resp, err, http.StatusNotFound)
+	}
+}
+
+// TestFailedWebhooks checks that the failed webhook deliveries are listed until retried successfully.
+func TestFailedWebhooks(t *testing.T) {
+	var healthy atomic.Bool
+	receiver, deliveries := newWebhookReceiver(t, func(string) int {
+		if !healthy.Load() {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	ts := NewTestServer(t)
+	list := func() []*FailedWebhook {
+		t.Helper()
+		var failed []*FailedWebhook
+		code, body, err := ts.Do(http.MethodGet, "/admin/failed-webhooks", "")
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), &failed) != nil {
+			t.Fatalf("GET /admin/failed-webhooks = %d %q, %v", code, body, err)
+		}
+		return failed
+	}
+	retry := func(webhookID, wantCode int) {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/admin/failed-webhooks/%d/retry", webhookID), "")
+		resp := &RetryWebhookResponse{}
+		if err != nil || code != wantCode || json.Unmarshal([]byte(body), resp) != nil || *resp != (RetryWebhookResponse{ID: webhookID, Delivered: code == http.StatusOK}) {
+			t.Fatalf("POST /admin/failed-webhooks/%d/retry = %d %q, %v, want %d", webhookID, code, body, err, wantCode)
+		}
+	}
+
+	// The delivery fails all its attempts, as reported by postWebhook.
+	body := []byte(`{"id":7,"status":"ready"}`)
+	sub := WebhookSubscription{CallbackURL: receiver.URL + "/notify", Secret: "secret"}
+	err := postWebhookOnce(sub.CallbackURL, body, signWebhook(sub.Secret, body))
+	if err == nil {
+		t.Fatal("postWebhookOnce() to a failing webhook succeeded")
+	}
+	ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: WebhookFailedCommand, failedWebhook: &FailedWebhook{HashID: 7, URL: sub.CallbackURL,
+		AttemptCount: WebhookRetries + 1, LastError: err.Error(), LastAttemptAt: time.Now(), subscription: sub, body: body}})
+	failed := list()
+	if len(failed) != 1 || failed[0].ID != 1 || failed[0].HashID != 7 || failed[0].URL != sub.CallbackURL || failed[0].AttemptCount != WebhookRetries+1 || failed[0].LastError != "503 Service Unavailable" {
+		t.Fatalf("GET /admin/failed-webhooks = %+v, want the failed delivery", failed)
+	}
+
+	retry(1, http.StatusBadGateway)
+	if failed := list(); len(failed) != 1 || failed[0].ID != 1 || failed[0].AttemptCount != WebhookRetries+2 {
+		t.Errorf("GET /admin/failed-webhooks after a failed retry = %+v, want it kept with one more attempt", failed)
+	}
+	healthy.Store(true)
+	retry(1, http.StatusOK)
+	select {
+	case d := <-deliveries:
+		if !bytes.Equal(d.body, body) || d.signature != signWebhook(sub.Secret, body) {
+			t.Errorf("retried webhook notification = %s signed %q, want %s signed with its secret", d.body, d.signature, body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no retried webhook notification")
+	}
+	if failed := list(); len(failed) != 0 {
+		t.Errorf("GET /admin/failed-webhooks once delivered = %+v, want none", failed)
+	}
+	if code, body, err := ts.Do(http.MethodPost, "/admin/failed-webhooks/1/retry", ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("POST /admin/failed-webhooks/1/retry once delivered = %d %q, %v, want %d", code, body, err, http.StatusNotFound)
+	}
+
+	// Only the MaxFailedWebhooks last failures are kept.
+	for i := range MaxFailedWebhooks + 1 {
+		ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: WebhookFailedCommand, failedWebhook: &FailedWebhook{HashID: i, URL: sub.CallbackURL}})
+	}
+	if failed := list(); len(failed) != MaxFailedWebhooks || failed[0].HashID != 1 || failed[MaxFailedWebhooks-1].HashID != MaxFailedWebhooks {
+		t.Errorf("GET /admin/failed-webhooks = %d failures, want the last %d", len(failed), MaxFailedWebhooks)
+	}
+}
+
+// TestSetLogLevel checks that the level of the default logger is changed at once, the change being logged whatever
+// the new level.
+func TestSetLogLevel(t *testing.T) {
+	ts := NewTestServer(t)
+	handler := &recordingHandler{level: logLevel}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(handler))
+	t.Cleanup(func() {
+		logLevel.Set(slog.LevelInfo)
+		slog.SetDefault(previous)
+		// slog.SetDefault redirected the log package to the handler.
+		log.SetOutput(io.Discard)
+		log.SetFlags(log.LstdFlags)
+	})
+	setLevel := func(level string) {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodPut, "/admin/set-log-level", `{"level":"`+level+`"}`)
+		resp := &LogLevelResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil || resp.Level != level {
+			t.Fatalf("PUT /admin/set-log-level to %s = %d %q, %v", level, code, body, err)
+		}
+		code, body, err = ts.Do(http.MethodGet, "/admin/log-level", "")
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil || resp.Level != level {
+			t.Errorf("GET /admin/log-level = %d %q, %v, want %s", code, body, err, level)
+		}
+	}
+
+	slog.Debug("debug before")
+	setLevel("debug")
+	slog.Debug("debug at debug level")
+	setLevel("error")
+	slog.Warn("warn at error level")
+	setLevel("info")
+	slog.Debug("debug at info level")
+	slog.Info("info at info level")
+	want := []string{"Log level changed", "debug at debug level", "Log level changed", "Log level changed", "info at info level"}
+	var got []string
+	for _, msg := range handler.messages() {
+		// The server also logs the requests, through the log package.
+		if strings.Contains(msg, "level") {
+			got = append(got, msg)
+		}
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("messages logged = %q, want %q", got, want)
+	}
+
+	for _, body := range []string{`{"level":"trace"}`, `{}`, `level=debug`} {
+		if code, resp, err := ts.Do(http.MethodPut, "/admin/set-log-level", body); err != nil || code != http.StatusBadRequest {
+			t.Errorf("PUT /admin/set-log-level %s = %d %q, %v, want %d", body, code, resp, err, http.StatusBadRequest)
+		}
+	}
+	if code, body, err := ts.Do(http.MethodPut, "/admin/set-log-level", `{"level":"debug"}`, "Authorization", ""); err != nil || code != http.StatusUnauthorized || logLevel.Level() != slog.LevelInfo {
+		t.Errorf("PUT /admin/set-log-level without the admin token = %d %q, %v, want %d and the level unchanged", code, body, err, http.StatusUnauthorized)
+	}
+}
+
+// TestHourlyStats checks that the hashes are counted in the bucket of their UTC hour.
+func TestHourlyStats(t *testing.T) {
+	h := &HourlyStats{}
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	h.Add(day.Add(30*time.Minute), 1000)
+	h.Add(day.Add(59*time.Minute), 3000)
+	h.Add(day.Add(23*time.Hour+59*time.Minute), 500)
+	// 10am in UTC+2 is 8am UTC.
+	h.Add(time.Date(2024, 3, 1, 10, 0, 0, 0, time.FixedZone("UTC+2", 2*60*60)), 700)
+	buckets := h.Buckets()
+	if len(buckets) != 24 {
+		t.Fatalf("Buckets() = %d buckets, want 24", len(buckets))
+	}
+	want := map[int]HourBucket{0: {Hour: 0, Total: 2, AverageUs: 2000}, 8: {Hour: 8, Total: 1, AverageUs: 700}, 23: {Hour: 23, Total: 1, AverageUs: 500}}
+	for hour, got := range buckets {
+		w, ok := want[hour]
+		if !ok {
+			w = HourBucket{Hour: hour}
+		}
+		if got != w {
+			t.Errorf("Buckets()[%d] = %+v, want %+v", hour, got, w)
+		}
+	}
+
+	ts := NewTestServer(t)
+	before := time.Now().UTC().Hour()
+	ts.mustPostHashes(t, "angryMonkey", "happyMonkey")
+	if time.Now().UTC().Hour() != before {
+		t.Skip("the hour changed while the hashes were stored")
+	}
+	code, body, err := ts.Do(http.MethodGet, "/stats/hourly", "")
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), &buckets) != nil || len(buckets) != 24 {
+		t.Fatalf("GET /stats/hourly = %d %q, %v", code, body, err)
+	}
+	for hour, got := range buckets {
+		total := 0
+		if hour == before {
+			total = 2
+		}
+		if got.Hour != hour || got.Total != total || (total > 0) != (got.AverageUs > 0) {
+			t.Errorf("GET /stats/hourly[%d] = %+v, want %d hashes", hour, got, total)
+		}
+	}
+}
+
+// TestReport checks the sections of the report of the server activity, as JSON and HTML.
+func TestReport(t *testing.T) {
+	ts := NewTestServer(t)
+	ids := ts.mustPostHashes(t, "angryMonkey", "happyMonkey")
+	if _, err := ts.WaitHash(ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "sha256"})); err != nil {
+		t.Fatal(err)
+	}
+	ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: WebhookFailedCommand, failedWebhook: &FailedWebhook{HashID: ids[0],
+		URL: "http://example.com/notify", AttemptCount: WebhookRetries + 1, LastError: "503 Service Unavailable", LastAttemptAt: time.Now()}})
+
+	var rep *Report
+	waitFor(t, "the report of the accessed hashes", func() bool {
+		code, body, err := ts.Do(http.MethodGet, "/admin/report?format=json", "")
+		keys := map[string]json.RawMessage{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), &keys) != nil {
+			t.Fatalf("GET /admin/report?format=json = %d %q, %v", code, body, err)
+		}
+		for _, key := range []string{"generatedAt", "totalHashes", "stats", "algorithms", "hourly", "topAccessed", "recentErrors", "config"} {
+			if _, ok := keys[key]; !ok {
+				t.Fatalf("GET /admin/report?format=json = %s, want its %q key", body, key)
+			}
+		}
+		rep = &Report{}
+		if err := json.Unmarshal([]byte(body), rep); err != nil {
+			t.Fatal(err)
+		}
+		return len(rep.TopAccessed) >= 2
+	})
+	if rep.TotalHashes != 3 || !slices.Equal(rep.Algorithms, []AlgorithmShare{{"sha512", 2, 200.0 / 3}, {"sha256", 1, 100.0 / 3}, {"pending", 0, 0}}) {
+		t.Errorf("report of %d hashes by algorithm %+v, want 2 sha512, 1 sha256 and none pending", rep.TotalHashes, rep.Algorithms)
+	}
+	if rep.Stats.TotalNum != 3 || len(rep.Hourly) != 24 || len(rep.RecentErrors) != 1 || rep.RecentErrors[0].HashID != ids[0] || rep.Config.MaxBulkSize != ts.s.cfg.MaxBulkSize {
+		t.Errorf("report = %+v, want the stats of 3 hashes, 24 hours, the failed webhook and the config", rep)
+	}
+
+	code, body, err := ts.Do(http.MethodGet, "/admin/report", "")
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("GET /admin/report = %d %q, %v", code, body, err)
+	}
+	for _, want := range []string{"<h2>Hashes</h2>", "<tr><th>Total hashes</th><td>3</td></tr>", "<h2>Algorithm distribution</h2>", "<td>sha256</td><td>1</td><td>33.3%</td>",
+		"<h2>Hashes by hour (UTC)</h2>", "<td>23:00</td>", "<h2>Top accessed hashes</h2>", "<h2>Recent errors</h2>", "http://example.com/notify",
+		"<h2>Configuration</h2>", fmt.Sprintf("<tr><th>Max bulk size</th><td>%d</td></tr>", ts.s.cfg.MaxBulkSize)} {
+		if !strings.Contains(body, want) {
+			t.Errorf("GET /admin/report = %s, want it to contain %q", body, want)
+		}
+	}
+	if code, body, err := ts.Do(http.MethodGet, "/admin/report?format=pdf", ""); err != nil || code != http.StatusBadRequest {
+		t.Errorf("GET /admin/report?format=pdf = %d %q, %v, want %d", code, body, err, http.StatusBadRequest)
+	}
+	if code, body, err := ts.Do(http.MethodGet, "/admin/report", "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("GET /admin/report without the admin token = %d %q, %v, want %d", code, body, err, http.StatusUnauthorized)
+	}
+}
+
+// TestMigrateEncoding checks that the hashes of the `from` encoding are re-encoded, batch after batch, and readable.
+func TestMigrateEncoding(t *testing.T) {
+	ts := NewTestServer(t)
+	passwords := []string{"angryMonkey", "happyMonkey", "sadMonkey"}
+	ids := ts.mustPostHashes(t, passwords...)
+	hexID := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Algorithm: "sha256", Encoding: "hex"})
+	hexHash, err := ts.WaitHash(hexID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalid := ts.s.ids.Next()
+	ts.s.inboundRequests.Send(Command{requestType: SetHashCommand, id: invalid, password: "not base64!", algorithm: DefaultAlgorithm, encoding: "base64"})
+
+	code, body, err := ts.Do(http.MethodPost, "/admin/migrate-encoding?from=base64&to=base64url&batchSize=2", "")
+	got := &EncodingMigration{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), got) != nil {
+		t.Fatalf("POST /admin/migrate-encoding = %d %q, %v", code, body, err)
+	}
+	if got.Migrated != 3 || got.Skipped != 1 || got.Failed != 1 {
+		t.Errorf("POST /admin/migrate-encoding = %s, want 3 migrated, 1 skipped and 1 failed", body)
+	}
+	for i, id := range ids {
+		sum := sha512.Sum512([]byte(passwords[i]))
+		if hash, err := ts.GetHash(id); err != nil || hash != base64.URLEncoding.EncodeToString(sum[:]) {
+			t.Errorf("GET /hash/%d once migrated = %q, %v, want its base64url hash", id, hash, err)
+		}
+	}
+	if hash, err := ts.GetHash(hexID); err != nil || hash != hexHash {
+		t.Errorf("GET /hash/%d of a hex hash = %q, %v, want it unchanged %q", hexID, hash, err, hexHash)
+	}
+	if hash, err := ts.GetHash(invalid); err != nil || hash != "not base64!" {
+		t.Errorf("GET /hash/%d which failed to migrate = %q, %v, want it unchanged", invalid, hash, err)
+	}
+
+	// Nothing is left to migrate.
+	code, body, err = ts.Do(http.MethodPost, "/admin/migrate-encoding?from=base64&to=base64url", "")
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), got) != nil || got.Migrated != 0 || got.Skipped != 4 || got.Failed != 1 {
+		t.Errorf("POST /admin/migrate-encoding again = %d %q, %v, want only the invalid hash failing", code, body, err)
+	}
+	for _, query := range []string{"from=base64&to=base64", "from=base64&to=base32", "to=hex", "from=base64&to=hex&batchSize=0"} {
+		if code, body, err := ts.Do(http.MethodPost, "/admin/migrate-encoding?"+query, ""); err != nil || code != http.StatusBadRequest {
+			t.Errorf("POST /admin/migrate-encoding?%s = %d %q, %v, want %d", query, code, body, err, http.StatusBadRequest)
+		}
+	}
+}
+
+// TestSignedHash checks that the signature of a hash is verified with the public key of the server only.
+func TestSignedHash(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key-001.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	signer, err := LoadHashSigner(path)
+	if err != nil || signer.KeyID != "key-001" {
+		t.Fatalf("LoadHashSigner() = %+v, %v, want the key-001 key", signer, err)
+	}
+	ts := NewTestServerWithStore(t, StoreOptions{Signer: signer})
+	id := ts.mustPostHashes(t, "angryMonkey")[0]
+
+	code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/signed", id), "")
+	signed := &SignedHashResponse{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), signed) != nil {
+		t.Fatalf("GET /hash/%d/signed = %d %q, %v", id, code, body, err)
+	}
+	if signed.ID != id || signed.Algorithm != DefaultAlgorithm || signed.Hash != testHash("angryMonkey") || signed.PublicKeyID != "key-001" {
+		t.Errorf("GET /hash/%d/signed = %+v, want its hash signed by key-001", id, signed)
+	}
+
+	code, body, err = ts.Do(http.MethodGet, "/admin/public-key/"+signed.PublicKeyID, "")
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("GET /admin/public-key/%s = %d %q, %v", signed.PublicKeyID, code, body, err)
+	}
+	block, _ := pem.Decode([]byte(body))
+	if block == nil || block.Type != "PUBLIC KEY" {
+		t.Fatalf("GET /admin/public-key/%s = %q, want a PEM public key", signed.PublicKeyID, body)
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := fmt.Sprintf("%d|%s|%s|%s", signed.ID, signed.Algorithm, signed.Hash, signed.CreatedAt.UTC().Format(time.RFC3339Nano))
+	if !ed25519.Verify(publicKey.(ed25519.PublicKey), []byte(message), signed.Signature) {
+		t.Errorf("signature of %q does not verify", message)
+	}
+	if ed25519.Verify(publicKey.(ed25519.PublicKey), []byte(strings.Replace(message, "|", "0|", 1)), signed.Signature) {
+		t.Errorf("signature of %q verifies another id", message)
+	}
+
+	if code, body, err := ts.Do(http.MethodGet, "/admin/public-key/key-002", ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /admin/public-key/key-002 of an unknown key = %d %q, %v, want %d", code, body, err, http.StatusNotFound)
+	}
+	ts = NewTestServer(t)
+	id = ts.mustPostHashes(t, "angryMonkey")[0]
+	if code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/signed", id), ""); err != nil || code != http.StatusNotFound {
+		t.Errorf("GET /hash/%d/signed without --sign-hashes = %d %q, %v, want %d", id, code, body, err, http.StatusNotFound)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if der, err = x509.MarshalPKCS8PrivateKey(ecKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHashSigner(path); err == nil {
+		t.Error("LoadHashSigner() of an ECDSA key succeeded, want an error")
+	}
+}
+
+// TestPreHashTransforms checks the transforms applied to the passwords, alone and in order.
+func TestPreHashTransforms(t *testing.T) {
+	for _, tc := range []struct {
+		transforms []string
+		password   string
+		want       string
+	}{
+		{nil, " Angry\tMonkey\n", " Angry\tMonkey\n"},
+		{[]string{TransformTrim}, " \tAngry Monkey\n", "Angry Monkey"},
+		{[]string{TransformLowercase}, "ANGRY Monkey", "angry monkey"},
+		{[]string{TransformStripControl}, "Angry\tMon\x00key\r\n", "AngryMonkey"},
+		{[]string{NormalizerNFKC}, "\ufb01\u2460Monkey", "fi1Monkey"},
+		{[]string{NormalizerNFC}, "cafe\u0301", "caf\u00e9"},
+		{[]string{TransformTrim, TransformStripControl, TransformLowercase}, " Angry\tMonkey \n", "angrymonkey"},
+		// The order matters: the space before the null character is only trimmed once it is stripped.
+		{[]string{TransformTrim, TransformStripControl}, " Angry \x00", "Angry "},
+		{[]string{TransformStripControl, TransformTrim}, " Angry \x00", "Angry"},
+	} {
+		p, err := NewPasswordNormalizer(NormalizerNone, CasePreserve, tc.transforms)
+		if err != nil {
+			t.Fatalf("NewPasswordNormalizer(%q): %v", tc.transforms, err)
+		}
+		if got := p.String(tc.password); got != tc.want {
+			t.Errorf("transforms %q of %q = %q, want %q", tc.transforms, tc.password, got, tc.want)
+		}
+		if got, err := io.ReadAll(p.Reader(strings.NewReader(tc.password))); err != nil || string(got) != tc.want {
+			t.Errorf("transforms %q of %q read = %q, %v, want %q", tc.transforms, tc.password, got, err, tc.want)
+		}
+	}
+
+	cfg, err := ParseConfig([]string{"--pre-hash-transforms", "trim, strip-control", "--pre-hash-transforms", "lowercase"})
+	if err != nil || !slices.Equal(cfg.PreHashTransforms, []string{TransformTrim, TransformStripControl, TransformLowercase}) {
+		t.Fatalf("ParseConfig() = %v, %v, want the transforms in order", cfg, err)
+	}
+	if _, err := ParseConfig([]string{"--pre-hash-transforms", "trim,reverse"}); err == nil {
+		t.Error("ParseConfig() of an unknown transform succeeded, want an error")
+	}
+
+	ts := NewTestServer(t, func(c *Config) { c.PreHashTransforms = cfg.PreHashTransforms })
+	id := ts.postHashRequest(t, &HashRequest{Password: " Angry\tMonkey \n"})
+	if hash, err := ts.WaitHash(id); err != nil || hash != testHash("angrymonkey") {
+		t.Errorf("GET /hash/%d = %q, %v, want the hash of the transformed password", id, hash, err)
+	}
+}
+
+// TestNotifyReady checks that a push notification is posted to FCM once the hash is ready, and not if it fails.
+func TestNotifyReady(t *testing.T) {
+	type push struct {
+		authorization string
+		message       FCMMessage
+	}
+	pushes := make(chan push, 10)
+	fcm := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := push{authorization: r.Header.Get("Authorization")}
+		if err := json.NewDecoder(r.Body).Decode(&p.message); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		pushes <- p
+	}))
+	t.Cleanup(fcm.Close)
+	fcmSendURL = fcm.URL
+	t.Cleanup(func() { fcmSendURL = FCMSendURL })
+
+	ts := NewTestServer(t)
+	notifyReady := func(id int, token, status string) {
+		t.Helper()
+		code, body, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/notify-ready", id), fmt.Sprintf(`{"fcmToken":%q,"fcmServerKey":"server-key"}`, token))
+		resp := &SubscribeResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), resp) != nil || *resp != (SubscribeResponse{ID: id, Status: status}) {
+			t.Fatalf("POST /hash/%d/notify-ready = %d %q, %v, want %s", id, code, body, err, status)
+		}
+	}
+	receive := func(id int, token string) {
+		t.Helper()
+		select {
+		case p := <-pushes:
+			if want := (push{"key=server-key", FCMMessage{To: token, Data: FCMData{HashID: id}}}); p != want {
+				t.Errorf("push notification = %+v, want %+v", p, want)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no push notification for hash %d", id)
+		}
+	}
+
+	failed := ts.s.ids.Next()
+	notifyReady(failed, "device-1", StatusSubscribed)
+	ts.s.pending.Send(ts.s.inboundRequests, Command{requestType: FailHashCommand, id: failed})
+	pending := ts.s.ids.Next()
+	notifyReady(pending, "device-2", StatusSubscribed)
+	ts.s.inboundRequests.Send(Command{requestType: SetHashCommand, id: pending, password: testHash("angryMonkey"), algorithm: DefaultAlgorithm})
+	// The failed hash would have been notified first.
+	receive(pending, "device-2")
+
+	notifyReady(pending, "device-3", StatusNotified)
+	receive(pending, "device-3")
+
+	for _, body := range []string{`{"fcmToken":"device-1"}`, `{"fcmServerKey":"server-key"}`, `fcmToken=device-1`} {
+		if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/notify-ready", pending), body); err != nil || code != http.StatusBadRequest {
+			t.Errorf("POST /hash/%d/notify-ready %s = %d %q, %v, want %d", pending, body, code, resp, err, http.StatusBadRequest)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/notify-ready", failed), `{"fcmToken":"device-1","fcmServerKey":"server-key"}`); err != nil || code != http.StatusGone {
+		t.Errorf("POST /hash/%d/notify-ready of a failed hash = %d %q, %v, want %d", failed, code, resp, err, http.StatusGone)
+	}
+	select {
+	case p := <-pushes:
+		t.Errorf("unexpected push notification %+v", p)
+	default:
+	}
+}
+
+// TestTriggerGC checks that `/admin/trigger-gc` runs a garbage collection, and reports the heap sizes and its pause.
+func TestTriggerGC(t *testing.T) {
+	ts := NewTestServer(t)
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	code, body, err := ts.Do(http.MethodPost, "/admin/trigger-gc", "")
+	if err != nil || code != http.StatusOK {
+		t.Fatalf("POST /admin/trigger-gc = %d %q, %v", code, body, err)
+	}
+	fields := map[string]any{}
+	if err := json.Unmarshal([]byte(body), &fields); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"heapBeforeBytes", "heapAfterBytes", "gcPauseNs"} {
+		if v, ok := fields[key].(float64); !ok || v < 0 || v != math.Trunc(v) {
+			t.Errorf("POST /admin/trigger-gc %s = %v, want a non-negative integer", key, fields[key])
+		}
+	}
+	if fields["warning"] != TriggerGCWarning || fields["heapBeforeBytes"].(float64) == 0 || fields["heapAfterBytes"].(float64) == 0 {
+		t.Errorf("POST /admin/trigger-gc = %s, want the heap sizes and the warning", body)
+	}
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	if after.NumForcedGC <= before.NumForcedGC {
+		t.Errorf("forced garbage collections = %d, want more than %d", after.NumForcedGC, before.NumForcedGC)
+	}
+
+	if code, body, err := ts.Do(http.MethodPost, "/admin/trigger-gc", "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("POST /admin/trigger-gc without the admin token = %d %q, %v, want %d", code, body, err, http.StatusUnauthorized)
+	}
+}
+
+// TestGoroutineDump checks that the dump holds the stack of the goroutine serving it, as text and parsed as JSON.
+func TestGoroutineDump(t *testing.T) {
+	ts := NewTestServer(t)
+	const handler = "github.com/KetanA/JC-Golang.(*Server).goroutineDumpHandler"
+	code, body, err := ts.Do(http.MethodGet, "/admin/goroutine-dump", "")
+	if err != nil || code != http.StatusOK || !strings.HasPrefix(body, "goroutine ") || !strings.Contains(body, handler+"(") {
+		t.Errorf("GET /admin/goroutine-dump = %d %.200q, %v, want the stack of %s", code, body, err, handler)
+	}
+
+	code, body, err = ts.Do(http.MethodGet, "/admin/goroutine-dump?format=json", "")
+	var dumps []GoroutineDump
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), &dumps) != nil {
+		t.Fatalf("GET /admin/goroutine-dump?format=json = %d %.200q, %v", code, body, err)
+	}
+	var serving *GoroutineDump
+	for i, d := range dumps {
+		if d.ID <= 0 || d.State == "" {
+			t.Errorf("goroutine dump %+v, want its id and state", d)
+		}
+		if slices.ContainsFunc(d.Frames, func(f StackFrame) bool { return f.Function == handler }) {
+			serving = &dumps[i]
+		}
+	}
+	if serving == nil {
+		t.Fatalf("GET /admin/goroutine-dump?format=json = %d goroutines, want the one running %s", len(dumps), handler)
+	}
+	if serving.State != "running" || serving.CreatedBy == nil || serving.CreatedBy.Function != "net/http.(*Server).Serve" {
+		t.Errorf("goroutine serving the dump = %+v, want it running, created by the HTTP server", serving)
+	}
+	for _, f := range serving.Frames {
+		if f.Function == handler && (!strings.HasSuffix(f.File, "/goroutinedump.go") || f.Line <= 0) {
+			t.Errorf("frame of %s = %+v, want its location in goroutinedump.go", handler, f)
+		}
+	}
+
+	if code, body, err := ts.Do(http.MethodGet, "/admin/goroutine-dump?format=xml", ""); err != nil || code != http.StatusBadRequest {
+		t.Errorf("GET /admin/goroutine-dump?format=xml = %d %q, %v, want %d", code, body, err, http.StatusBadRequest)
+	}
+	if code, body, err := ts.Do(http.MethodGet, "/admin/goroutine-dump", "", "Authorization", ""); err != nil || code != http.StatusUnauthorized {
+		t.Errorf("GET /admin/goroutine-dump without the admin token = %d %.200q, %v, want %d", code, body, err, http.StatusUnauthorized)
+	}
+}
+
+// TestPatchMetadata checks that a merge patch only updates the metadata it holds, its null values removing them.
+func TestPatchMetadata(t *testing.T) {
+	ts := NewTestServer(t)
+	id := ts.postHashRequest(t, &HashRequest{Password: "angryMonkey", Namespace: "eu-west", Tags: []string{"team-a"}})
+	if _, err := ts.WaitHash(id); err != nil {
+		t.Fatal(err)
+	}
+	for _, body := range []string{`{"key":"env","value":"dev"}`, `{"key":"owner","value":"alice"}`} {
+		if code, resp, err := ts.Do(http.MethodPost, fmt.Sprintf("/hash/%d/annotate", id), body); err != nil || code != http.StatusOK {
+			t.Fatalf("POST /hash/%d/annotate %s = %d %q, %v", id, body, code, resp, err)
+		}
+	}
+	path := fmt.Sprintf("/hash/%d/metadata", id)
+	patch := func(body string) *MetadataResponse {
+		t.Helper()
+		code, resp, err := ts.Do(http.MethodPatch, path, body)
+		got := &MetadataResponse{}
+		if err != nil || code != http.StatusOK || json.Unmarshal([]byte(resp), got) != nil {
+			t.Fatalf("PATCH %s %s = %d %q, %v", path, body, code, resp, err)
+		}
+		return got
+	}
+
+	before := time.Now()
+	got := patch(`{"ttl":"2h"}`)
+	if got.ExpiresAt == nil || got.ExpiresAt.Before(before.Add(2*time.Hour)) || got.ExpiresAt.After(time.Now().Add(2*time.Hour)) {
+		t.Fatalf("PATCH %s of the ttl = %+v, want an expiry in 2h", path, got)
+	}
+	expiresAt := *got.ExpiresAt
+
+	got = patch(`{"tags":["new-tag","another-tag","new-tag"]}`)
+	if !slices.Equal(got.Tags, []string{"another-tag", "new-tag"}) || !maps.Equal(got.Annotations, map[string]string{"env": "dev", "owner": "alice"}) || got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("PATCH %s of the tags = %+v, want the new tags, the annotations and expiry preserved", path, got)
+	}
+	code, body, err := ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/info", id), "")
+	info := &HashInfo{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), info) != nil || !slices.Equal(info.Tags, got.Tags) || info.Namespace != "eu-west" {
+		t.Errorf("GET /hash/%d/info once patched = %d %q, %v, want the new tags in the same namespace", id, code, body, err)
+	}
+	if hash, err := ts.GetHash(id); err != nil || hash != testHash("angryMonkey") {
+		t.Errorf("GET /hash/%d once patched = %q, %v, want the hash unchanged", id, hash, err)
+	}
+
+	got = patch(`{"annotations":{"env":"prod","owner":null},"ttl":null}`)
+	if !slices.Equal(got.Tags, []string{"another-tag", "new-tag"}) || !maps.Equal(got.Annotations, map[string]string{"env": "prod"}) || got.ExpiresAt != nil {
+		t.Errorf("PATCH %s of the annotations and ttl = %+v, want owner removed, env updated and no expiry", path, got)
+	}
+	got = patch(`{"tags":null,"annotations":null}`)
+	if len(got.Tags) != 0 || len(got.Annotations) != 0 || got.ExpiresAt != nil {
+		t.Errorf("PATCH %s of null tags and annotations = %+v, want them all removed", path, got)
+	}
+	code, body, err = ts.Do(http.MethodGet, fmt.Sprintf("/hash/%d/annotations", id), "")
+	annotations := &AnnotationsResponse{}
+	if err != nil || code != http.StatusOK || json.Unmarshal([]byte(body), annotations) != nil || len(annotations.Annotations) != 0 {
+		t.Errorf("GET /hash/%d/annotations once removed = %d %q, %v, want none", id, code, body, err)
+	}
+
+	for _, body := range []string{`{"namespace":"us-west"}`, `{"ttl":"-1h"}`, `{"ttl":2}`, `{"tags":"team-a"}`, `{"annotations":{"":"x"}}`, `[]`} {
+		if code, resp, err := ts.Do(http.MethodPatch, path, body); err != nil || code != http.StatusBadRequest {
+			t.Errorf("PATCH %s %s = %d %q, %v, want %d", path, body, code, resp, err, http.StatusBadRequest)
+		}
+	}
+	if code, resp, err := ts.Do(http.MethodPatch, fmt.Sprintf("/hash/%d/metadata", id+1), `{"tags":["x"]}`); err != nil || code != http.StatusNotFound {
+		t.Errorf("PATCH /hash/%d/metadata of an unknown id = %d %q, %v, want %d", id+1, code, resp, err, http.StatusNotFound)
+	}
+	if code, resp, err := ts.Do(http.MethodDelete, fmt.Sprintf("/hash/%d", id), ""); err != nil || code != http.StatusOK {
+		t.Fatalf("DELETE /hash/%d = %d %q, %v", id, code, resp, err)
+	}
+	if code, resp, err := ts.Do(http.MethodPatch, path, `{"tags":["x"]}`); err != nil || code != http.StatusGone {
+		t.Errorf("PATCH %s of a deleted hash = %d %q, %v, want %d", path, code, resp, err, http.StatusGone)
+	}
+}
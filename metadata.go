@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+// MaxMetadataPatchBodySize is the maximum size of the body of a `/hash/{id}/metadata` request.
+const MaxMetadataPatchBodySize = 1 << 14
+
+// MetadataPatch is the update of the metadata of a hash applied by PatchMetadataCommand, decoded from a JSON merge
+// patch (RFC 7396). The metadata whose Set field is false are left unchanged.
+type MetadataPatch struct {
+	// Tags replace the tags of the hash, a nil list removing them all.
+	SetTags bool
+	Tags    []string
+	// ExpiresAt replaces the expiry of the hash, nil making it permanent.
+	SetExpiry bool
+	ExpiresAt *time.Time
+	// Annotations are merged into the annotations of the hash, their nil values removing the annotations.
+	// ClearAnnotations removes all the annotations first.
+	Annotations      map[string]*string
+	ClearAnnotations bool
+}
+
+// MetadataResponse defines response structure for '/hash/{id}/metadata' endpoint: the metadata of the hash once
+// patched.
+type MetadataResponse struct {
+	ID          int               `json:"id"`
+	Tags        []string          `json:"tags"`
+	Annotations map[string]string `json:"annotations"`
+	// ExpiresAt is null for a permanent hash.
+	ExpiresAt *time.Time `json:"expiresAt"`
+}
+
+// isJSONNull reports whether the raw JSON value is null.
+func isJSONNull(raw json.RawMessage) bool {
+	return bytes.Equal(bytes.TrimSpace(raw), []byte("null"))
+}
+
+// parseMetadataPatch decodes and validates the merge patch of the `tags`, `ttl` and `annotations` metadata.
+func parseMetadataPatch(body []byte) (*MetadataPatch, error) {
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return nil, errors.New("Invalid JSON merge patch!")
+	}
+	patch := &MetadataPatch{}
+	for name, raw := range fields {
+		switch name {
+		case "tags":
+			patch.SetTags = true
+			if isJSONNull(raw) {
+				break
+			}
+			if err := json.Unmarshal(raw, &patch.Tags); err != nil {
+				return nil, errors.New("The `tags` must be an array of strings!")
+			}
+			if err := validateTags(patch.Tags); err != nil {
+				return nil, err
+			}
+			patch.Tags = addTags(nil, patch.Tags)
+		case "ttl":
+			patch.SetExpiry = true
+			if isJSONNull(raw) {
+				break
+			}
+			var ttl string
+			if err := json.Unmarshal(raw, &ttl); err != nil {
+				return nil, errors.New("The `ttl` must be a non-negative duration, e.g. 2h!")
+			}
+			d, err := time.ParseDuration(ttl)
+			if err != nil || d < 0 {
+				return nil, errors.New("The `ttl` must be a non-negative duration, e.g. 2h!")
+			}
+			if d > 0 {
+				t := time.Now().Add(d)
+				patch.ExpiresAt = &t
+			}
+		case "annotations":
+			if isJSONNull(raw) {
+				patch.ClearAnnotations = true
+				break
+			}
+			if err := json.Unmarshal(raw, &patch.Annotations); err != nil {
+				return nil, errors.New("The `annotations` must be an object of strings!")
+			}
+			for key, value := range patch.Annotations {
+				if key == "" || len(key) > MaxAnnotationKeySize || (value != nil && len(*value) > MaxAnnotationValueSize) {
+					return nil, fmt.Errorf("The annotation keys must be of 1 to %d bytes, and their values of at most %d bytes!", MaxAnnotationKeySize, MaxAnnotationValueSize)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("Unknown metadata %q, expected `tags`, `ttl` or `annotations`!", name)
+		}
+	}
+	return patch, nil
+}
+
+// patchMetadata applies the patch to the metadata of the record, and returns the metadata of the patched record.
+func patchMetadata(id int, rec *HashRecord, patch *MetadataPatch) *MetadataResponse {
+	if patch.SetTags {
+		rec.Tags = patch.Tags
+	}
+	if patch.SetExpiry {
+		rec.ExpiresAt = patch.ExpiresAt
+	}
+	if patch.ClearAnnotations {
+		rec.Annotations = nil
+	}
+	for key, value := range patch.Annotations {
+		switch {
+		case value == nil:
+			delete(rec.Annotations, key)
+		case rec.Annotations == nil:
+			rec.Annotations = map[string]string{key: *value}
+		default:
+			rec.Annotations[key] = *value
+		}
+	}
+	resp := &MetadataResponse{ID: id, Tags: rec.Tags, Annotations: rec.Annotations, ExpiresAt: rec.ExpiresAt}
+	if resp.Tags == nil {
+		resp.Tags = []string{}
+	}
+	if resp.Annotations == nil {
+		resp.Annotations = map[string]string{}
+	}
+	return resp
+}
+
+// patchMetadataHandler handles the PATCH requests to `/hash/{id}/metadata` endpoint, updating the tags, the expiry
+// and the annotations of a hash given by a JSON merge patch, e.g. `{"tags":["prod"],"ttl":null}`.
+func (s *Server) patchMetadataHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxMetadataPatchBodySize))
+	if err != nil {
+		http.Error(w, "Invalid JSON merge patch!", http.StatusBadRequest)
+		return
+	}
+	patch, err := parseMetadataPatch(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: PatchMetadataCommand, id: hashId, metadataPatch: patch})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	s.audit.Record("patch-metadata", r, map[string]any{"id": hashId, "patch": json.RawMessage(body)})
+	log.Println("Hash metadata patched for id: ", hashId)
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HistogramMaxMs is the highest latency, in milliseconds, told apart by the histograms.
+// Higher latencies are counted as HistogramMaxMs.
+const HistogramMaxMs = 10000
+
+// DefaultHistogramBuckets are the lower bounds of the '/metrics/histogram' buckets, in milliseconds.
+var DefaultHistogramBuckets = []int{0, 1, 5, 10, 50, 100, 500, 1000}
+
+// hashEndpointNames are the endpoint names of the methods of `/hash/{id}` endpoint.
+var hashEndpointNames = map[string]string{
+	http.MethodGet:    "getHash",
+	http.MethodPost:   "rehash",
+	http.MethodPut:    "compareAndSwap",
+	http.MethodDelete: "deleteHash",
+}
+
+// Histogram counts latencies by millisecond, so that they can be grouped into any buckets.
+type Histogram struct {
+	counts [HistogramMaxMs + 1]atomic.Int64
+}
+
+// Observe counts a latency.
+func (h *Histogram) Observe(d time.Duration) {
+	h.counts[min(d.Milliseconds(), HistogramMaxMs)].Add(1)
+}
+
+// Buckets returns the number of latencies of each bucket, from its lower bound up to the next one.
+// The bounds are in milliseconds, ascending, and the last bucket has no upper bound.
+func (h *Histogram) Buckets(bounds []int) []int64 {
+	counts := make([]int64, len(bounds))
+	for i, lo := range bounds {
+		hi := HistogramMaxMs + 1
+		if i+1 < len(bounds) {
+			hi = bounds[i+1]
+		}
+		for ms := lo; ms < hi; ms++ {
+			counts[i] += h.counts[ms].Load()
+		}
+	}
+	return counts
+}
+
+// LatencyMetrics holds the latency histograms of the endpoints, by endpoint name.
+// The zero value is ready to use.
+type LatencyMetrics struct {
+	histograms sync.Map
+}
+
+// Histogram returns the histogram of the endpoint, creating it if needed.
+func (m *LatencyMetrics) Histogram(endpoint string) *Histogram {
+	if h, ok := m.histograms.Load(endpoint); ok {
+		return h.(*Histogram)
+	}
+	h, _ := m.histograms.LoadOrStore(endpoint, &Histogram{})
+	return h.(*Histogram)
+}
+
+// Observe counts a latency of the endpoint.
+func (m *LatencyMetrics) Observe(endpoint string, d time.Duration) {
+	m.Histogram(endpoint).Observe(d)
+}
+
+// endpointName returns the name the latencies of the request to the named route are recorded under.
+// The methods of `/hash/{id}` endpoint are told apart, e.g. `getHash`.
+func endpointName(route string, r *http.Request) string {
+	if name, ok := hashEndpointNames[r.Method]; ok && route == "hash" {
+		return name
+	}
+	return route
+}
+
+// histogramHandler handles the GET requests to `/metrics/histogram` endpoint.
+// The latency counts of the endpoint are returned as CSV, grouped by the buckets given in milliseconds.
+func (s *Server) histogramHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	endpoint := r.URL.Query().Get("endpoint")
+	if endpoint == "" {
+		http.Error(w, "The `endpoint` must be given, e.g. `?endpoint=setHash`!", http.StatusBadRequest)
+		return
+	}
+	bounds, err := parseBuckets(r.URL.Query().Get("buckets"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	counts := s.metrics.Histogram(endpoint).Buckets(bounds)
+	w.Header().Set("Content-Type", "text/csv")
+	fmt.Fprintf(w, "bucket_ms,count\n")
+	for i, bound := range bounds {
+		fmt.Fprintf(w, "%d,%d\n", bound, counts[i])
+	}
+}
+
+// parseBuckets parses the comma separated, ascending bucket bounds. DefaultHistogramBuckets are used when empty.
+func parseBuckets(v string) ([]int, error) {
+	if v == "" {
+		return DefaultHistogramBuckets, nil
+	}
+	var bounds []int
+	for _, f := range strings.Split(v, ",") {
+		bound, err := strconv.Atoi(strings.TrimSpace(f))
+		if err != nil || bound < 0 || bound > HistogramMaxMs || (len(bounds) > 0 && bound <= bounds[len(bounds)-1]) {
+			return nil, fmt.Errorf("The buckets must be ascending milliseconds, up to %d!", HistogramMaxMs)
+		}
+		bounds = append(bounds, bound)
+	}
+	return bounds, nil
+}
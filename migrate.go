@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Default and maximum number of records examined by each MigrateEncodingCommand of `/admin/migrate-encoding`, and
+// the pause between the batches, letting the store goroutine serve the other requests.
+const (
+	DefaultMigrationBatchSize = 500
+	MaxMigrationBatchSize     = 10000
+	MigrationBatchPause       = 10 * time.Millisecond
+)
+
+// EncodingMigration is the progress of the re-encoding of the stored hashes from one digest encoding to another.
+// The store goroutine updates it with each batch of MigrateEncodingCommand.
+type EncodingMigration struct {
+	From      string `json:"-"`
+	To        string `json:"-"`
+	BatchSize int    `json:"-"`
+	// LastID is the last id examined, the next batch starting after it, and Done is set once all ids are examined.
+	LastID   int  `json:"-"`
+	Done     bool `json:"-"`
+	Migrated int  `json:"migrated"`
+	Skipped  int  `json:"skipped"`
+	Failed   int  `json:"failed"`
+}
+
+// reencode converts a hash from one digest encoding to another.
+func reencode(hash, from, to string) (string, error) {
+	digest, err := digestEncodings[from].Decode(hash)
+	if err != nil {
+		return "", err
+	}
+	return digestEncodings[to].Encode(digest), nil
+}
+
+// migrateEncoding re-encodes the latest hash of the record and its versions having the `from` encoding of m to its
+// `to` one. It reports false, leaving the record unchanged, if its latest hash does not have the `from` encoding.
+func migrateEncoding(rec *HashRecord, m *EncodingMigration) (bool, error) {
+	if rec.Deleted || rec.AwaitingResubmit || encodingOf(rec.Algorithm, rec.Encoding) != m.From {
+		return false, nil
+	}
+	if _, err := resolveEncoding(rec.Algorithm, m.To); err != nil {
+		return false, err
+	}
+	hash, err := reencode(rec.Hash, m.From, m.To)
+	if err != nil {
+		return false, err
+	}
+	versions := make([]string, len(rec.Versions))
+	for i, v := range rec.Versions {
+		versions[i] = v.Hash
+		if encodingOf(v.Algorithm, v.Encoding) != m.From {
+			continue
+		}
+		if versions[i], err = reencode(v.Hash, m.From, m.To); err != nil {
+			return false, err
+		}
+	}
+	rec.Hash, rec.Encoding = hash, m.To
+	for i := range rec.Versions {
+		if rec.Versions[i].Hash != versions[i] {
+			rec.Versions[i].Hash, rec.Versions[i].Encoding = versions[i], m.To
+		}
+	}
+	return true, nil
+}
+
+// encodingOf returns the encoding of a hash computed with the algorithm, being the default one of the algorithm
+// when empty.
+func encodingOf(algorithm, encoding string) string {
+	if encoding == "" {
+		return hashEncodings[algorithm]
+	}
+	return encoding
+}
+
+// migrateEncodingHandler handles the admin only POST requests to `/admin/migrate-encoding` endpoint, re-encoding the
+// hashes stored with the `from` digest encoding to the `to` one, `batchSize` records at a time.
+func (s *Server) migrateEncodingHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	q := r.URL.Query()
+	m := &EncodingMigration{From: q.Get("from"), To: q.Get("to"), BatchSize: DefaultMigrationBatchSize}
+	_, fromOK := digestEncodings[m.From]
+	_, toOK := digestEncodings[m.To]
+	if !fromOK || !toOK || m.From == m.To {
+		http.Error(w, "The `from` and `to` must be two different encodings among base64, base64nopad, base64url and hex!", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("batchSize"); v != "" {
+		var err error
+		if m.BatchSize, err = strconv.Atoi(v); err != nil || m.BatchSize < 1 || m.BatchSize > MaxMigrationBatchSize {
+			http.Error(w, fmt.Sprintf("The `batchSize` must be between 1 and %d!", MaxMigrationBatchSize), http.StatusBadRequest)
+			return
+		}
+	}
+	for {
+		if res := s.send(r.Context(), Command{requestType: MigrateEncodingCommand, migration: m}); res.err != nil {
+			writeStoreError(w, res.err)
+			return
+		}
+		if m.Done {
+			break
+		}
+		time.Sleep(MigrationBatchPause)
+	}
+	s.audit.Record("migrate-encoding", r, map[string]any{"from": m.From, "to": m.To, "migrated": m.Migrated, "failed": m.Failed})
+	log.Printf("Migrated %d hashes from the %s to the %s encoding, %d skipped and %d failed.", m.Migrated, m.From, m.To, m.Skipped, m.Failed)
+	writeJSON(w, m)
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// MockCommandProcessor is a CommandProcessor answering the commands with the preset Results of their type, without
+// the store goroutine, and recording them. A command without a preset result fails the test.
+type MockCommandProcessor struct {
+	t       testing.TB
+	Results map[CommandType]Result
+	mu      sync.Mutex
+	sent    []Command
+}
+
+// NewMockCommandProcessor creates a MockCommandProcessor answering with the results.
+func NewMockCommandProcessor(t testing.TB, results map[CommandType]Result) *MockCommandProcessor {
+	return &MockCommandProcessor{t: t, Results: results}
+}
+
+// Send records the command and returns its preset result.
+func (m *MockCommandProcessor) Send(ctx context.Context, c Command) Result {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, c)
+	res, ok := m.Results[c.requestType]
+	if !ok {
+		m.t.Errorf("unexpected %s", c.requestType)
+		return Result{err: ErrHashNotFound}
+	}
+	return res
+}
+
+// Sent returns the commands sent so far.
+func (m *MockCommandProcessor) Sent() []Command {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Command{}, m.sent...)
+}
+
+// serveMocked serves the request by the handler of a server whose commands are answered by a MockCommandProcessor
+// with the results, and returns the response and the commands sent.
+func serveMocked(t *testing.T, results map[CommandType]Result, handler func(*Server) http.HandlerFunc, r *http.Request) (*httptest.ResponseRecorder, []Command) {
+	t.Helper()
+	ts := NewTestServer(t)
+	mock := NewMockCommandProcessor(t, results)
+	ts.s.processor = mock
+	w := httptest.NewRecorder()
+	handler(ts.s)(w, r)
+	return w, mock.Sent()
+}
+
+func TestGetHashHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		path        string
+		result      Result
+		wantCode    int
+		wantBody    string
+		wantVersion int
+		wantWarning bool
+	}{
+		{"stored", "/hash/1", Result{value: "hash"}, http.StatusOK, "hash\n", 0, false},
+		{"version", "/hash/1?version=2", Result{value: "hash"}, http.StatusOK, "hash\n", 2, false},
+		{"deprecated", "/hash/1", Result{value: "hash", deprecated: true}, http.StatusOK, "hash\n", 0, true},
+		{"pending", "/hash/1", Result{err: ErrHashPending}, http.StatusAccepted, `"status":"pending"`, 0, false},
+		{"not found", "/hash/1", Result{err: ErrHashNotFound}, http.StatusNotFound, InvalidHashIDMessage, 0, false},
+		{"deleted", "/hash/1", Result{err: ErrHashDeleted}, http.StatusGone, ErrHashDeleted.Error(), 0, false},
+		{"failed", "/hash/1", Result{err: ErrHashFailed}, http.StatusGone, ErrHashFailed.Error(), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, APIPrefix+tt.path, nil)
+			w, sent := serveMocked(t, map[CommandType]Result{GetHashCommand: tt.result}, func(s *Server) http.HandlerFunc { return s.getHashHandler }, r)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("GET %s = %d %q, want %d %q", tt.path, w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+			if len(sent) != 1 || sent[0].id != 1 || sent[0].version != tt.wantVersion {
+				t.Errorf("sent %+v, want a GetHashCommand of id 1 and version %d", sent, tt.wantVersion)
+			}
+			if got := w.Header().Get("Warning") == DeprecatedAlgorithmWarning; got != tt.wantWarning {
+				t.Errorf("Warning header = %q, want it set: %v", w.Header().Get("Warning"), tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestSetHashHandler(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		results  map[CommandType]Result
+		wantCode int
+		wantBody string
+		// wantSent is the type of the command the handler waits for, if any.
+		wantSent []CommandType
+	}{
+		{"new", http.MethodPost, "/hash", `{"password":"angryMonkey"}`, nil, http.StatusOK, "1\n", nil},
+		{"invalid", http.MethodPost, "/hash", `{"password":`, nil, http.StatusBadRequest, "Invalid JSON request!", nil},
+		{"unsupported algorithm", http.MethodPost, "/hash", `{"password":"angryMonkey","algorithm":"md4"}`, nil, http.StatusBadRequest, "Unsupported hash algorithm!", nil},
+		{"rehash", http.MethodPost, "/hash/1", `{"password":"angryMonkey","algorithm":"sha256"}`,
+			map[CommandType]Result{GetVersionsCommand: {value: "[]"}}, http.StatusOK, "1\n", []CommandType{GetVersionsCommand}},
+		{"rehash not found", http.MethodPost, "/hash/1", `{"password":"angryMonkey"}`,
+			map[CommandType]Result{GetVersionsCommand: {err: ErrHashNotFound}}, http.StatusNotFound, InvalidHashIDMessage, []CommandType{GetVersionsCommand}},
+		{"rehash deleted", http.MethodPost, "/hash/1", `{"password":"angryMonkey"}`,
+			map[CommandType]Result{GetVersionsCommand: {err: ErrHashDeleted}}, http.StatusGone, ErrHashDeleted.Error(), []CommandType{GetVersionsCommand}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, APIPrefix+tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			handler := func(s *Server) http.HandlerFunc { return s.setHashHandler }
+			if tt.path != "/hash" {
+				handler = func(s *Server) http.HandlerFunc { return s.rehashHandler }
+			}
+			w, sent := serveMocked(t, tt.results, handler, r)
+			if w.Code != tt.wantCode || !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("%s %s = %d %q, want %d %q", tt.method, tt.path, w.Code, w.Body.String(), tt.wantCode, tt.wantBody)
+			}
+			// The hashes are queued to the store without waiting for it.
+			if len(sent) != len(tt.wantSent) {
+				t.Fatalf("sent %+v, want %v", sent, tt.wantSent)
+			}
+			for i, c := range sent {
+				if c.requestType != tt.wantSent[i] {
+					t.Errorf("sent %s, want %s", c.requestType, tt.wantSent[i])
+				}
+			}
+		})
+	}
+}
+
+// TestInternalErrorJSON checks that the values which cannot be encoded to JSON, e.g. a NaN, and the store values
+// which cannot be decoded, are answered with a valid InternalErrorJSON and a 500 status.
+func TestInternalErrorJSON(t *testing.T) {
+	value, err := safeMarshal(&Stats{AverageTime: math.NaN()})
+	if err == nil || value != InternalErrorJSON {
+		t.Fatalf("safeMarshal(NaN) = %q, %v, want %q and an error", value, err, InternalErrorJSON)
+	}
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		results map[CommandType]Result
+		handler func(*Server) http.HandlerFunc
+	}{
+		{"stats with a NaN", http.MethodGet, "/stats", "", map[CommandType]Result{GetStatsCommand: {value: value, err: err}},
+			func(s *Server) http.HandlerFunc { return s.statsHandler }},
+		{"invalid stats", http.MethodGet, "/stats", "", map[CommandType]Result{GetStatsCommand: {value: `{"average":`}},
+			func(s *Server) http.HandlerFunc {
+				return func(w http.ResponseWriter, r *http.Request) {
+					r.Header.Set("Accept", ProtobufContentType)
+					s.statsHandler(w, r)
+				}
+			}},
+		{"invalid compared hash", http.MethodPut, "/hash/1", `{"expectedHash":"old","newPassword":"new"}`,
+			map[CommandType]Result{CompareHashCommand: {value: "not json"}}, func(s *Server) http.HandlerFunc { return s.compareAndSwapHandler }},
+		{"invalid compacted ids", http.MethodPost, "/admin/gc?confirm=true", "", map[CommandType]Result{CompactStoreCommand: {value: "not json"}},
+			func(s *Server) http.HandlerFunc { return s.gcHandler }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, APIPrefix+tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Authorization", "Bearer "+TestAdminToken)
+			r.Header.Set("Content-Type", "application/json")
+			w, _ := serveMocked(t, tt.results, tt.handler, r)
+			var body map[string]string
+			if w.Code != http.StatusInternalServerError || json.Unmarshal(w.Body.Bytes(), &body) != nil || body["error"] != "internal" {
+				t.Errorf("%s %s = %d %q, want %d %s", tt.method, tt.path, w.Code, w.Body.String(), http.StatusInternalServerError, InternalErrorJSON)
+			}
+		})
+	}
+}
+
+// slowProcessor is a CommandProcessor taking delay before forwarding the commands, or giving up once their context
+// is done.
+type slowProcessor struct {
+	CommandProcessor
+	delay time.Duration
+}
+
+// Send forwards the command after the delay.
+func (p *slowProcessor) Send(ctx context.Context, c Command) Result {
+	select {
+	case <-time.After(p.delay):
+		return p.CommandProcessor.Send(ctx, c)
+	case <-ctx.Done():
+		return Result{err: ctx.Err()}
+	}
+}
+
+func TestEndpointTimeout(t *testing.T) {
+	ts := NewTestServer(t, func(cfg *Config) { cfg.EndpointTimeouts["/stats"] = 10 * time.Millisecond })
+	ts.s.processor = &slowProcessor{CommandProcessor: ts.s.processor, delay: 200 * time.Millisecond}
+	start := time.Now()
+	if code, resp, err := ts.Do(http.MethodGet, "/stats", ""); err != nil || code != http.StatusGatewayTimeout {
+		t.Errorf("GET /stats = %d %s, %v, want %d", code, resp, err, http.StatusGatewayTimeout)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Errorf("GET /stats answered after %v, want before the slow command completes", elapsed)
+	}
+	// The endpoints without a timeout wait for the slow command.
+	if code, resp, err := ts.Do(http.MethodGet, "/events/count", ""); err != nil || code != http.StatusOK {
+		t.Errorf("GET /events/count = %d %s, %v, want %d", code, resp, err, http.StatusOK)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Values of the `--password-normalizer` and `--password-case` flags.
+const (
+	NormalizerNone = "none"
+	NormalizerNFC  = "nfc"
+	NormalizerNFKC = "nfkc"
+	CasePreserve   = "preserve"
+	CaseLower      = "lower"
+)
+
+// Values of the `--pre-hash-transforms` flag, besides the Unicode normalization forms.
+const (
+	TransformTrim         = "trim"
+	TransformLowercase    = "lowercase"
+	TransformStripControl = "strip-control"
+)
+
+// preHashTransforms holds the transforms of the passwords by `--pre-hash-transforms` value. The Unicode normalization
+// forms of unicodeForms are transforms too.
+var preHashTransforms = map[string]func(string) string{
+	TransformTrim:         strings.TrimSpace,
+	TransformLowercase:    strings.ToLower,
+	TransformStripControl: stripControl,
+}
+
+// stripControl removes the control characters of s, such as the line breaks and the tabs.
+func stripControl(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+// UnicodeForm is a Unicode normalization form, applied to a string or to the text read from a reader.
+type UnicodeForm struct {
+	String func(string) string
+	Reader func(io.Reader) io.Reader
+}
+
+// unicodeForms holds the Unicode normalization forms by `--password-normalizer` value.
+var unicodeForms = map[string]UnicodeForm{
+	NormalizerNFC:  {String: norm.NFC.String, Reader: func(r io.Reader) io.Reader { return norm.NFC.Reader(r) }},
+	NormalizerNFKC: {String: norm.NFKC.String, Reader: func(r io.Reader) io.Reader { return norm.NFKC.Reader(r) }},
+}
+
+// PasswordNormalizer normalizes the passwords before they are hashed, whether they are stored or verified, so that
+// the same password typed on different clients gets the same hash: the Unicode form is applied first, and the
+// passwords are then lowercased if enabled, and the transforms finally applied in order.
+// A nil PasswordNormalizer keeps the passwords as given.
+type PasswordNormalizer struct {
+	form       *UnicodeForm
+	lower      bool
+	transforms []func(string) string
+}
+
+// NewPasswordNormalizer creates the PasswordNormalizer of the `--password-normalizer`, `--password-case` and
+// `--pre-hash-transforms` values.
+func NewPasswordNormalizer(normalizer, passwordCase string, transforms []string) (*PasswordNormalizer, error) {
+	p := &PasswordNormalizer{}
+	if normalizer != "" && normalizer != NormalizerNone {
+		form, ok := unicodeForms[normalizer]
+		if !ok {
+			return nil, fmt.Errorf("unsupported password normalizer %q", normalizer)
+		}
+		p.form = &form
+	}
+	switch passwordCase {
+	case "", CasePreserve:
+	case CaseLower:
+		p.lower = true
+	default:
+		return nil, fmt.Errorf("unsupported password case %q", passwordCase)
+	}
+	for _, name := range transforms {
+		transform, ok := preHashTransforms[name]
+		if form, isForm := unicodeForms[name]; isForm {
+			transform, ok = form.String, true
+		}
+		if !ok {
+			return nil, fmt.Errorf("unsupported pre-hash transform %q", name)
+		}
+		p.transforms = append(p.transforms, transform)
+	}
+	return p, nil
+}
+
+// transform applies the transforms in order.
+func (p *PasswordNormalizer) transform(password string) string {
+	for _, transform := range p.transforms {
+		password = transform(password)
+	}
+	return password
+}
+
+// String returns the normalized password.
+func (p *PasswordNormalizer) String(password string) string {
+	if p == nil {
+		return password
+	}
+	if p.form != nil {
+		password = p.form.String(password)
+	}
+	if p.lower {
+		password = strings.ToLower(password)
+	}
+	return p.transform(password)
+}
+
+// Reader returns a reader of the normalized password read from r, the same as String would return.
+// With transforms, such as trim, the whole password is read before they are applied.
+func (p *PasswordNormalizer) Reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	if p.form != nil {
+		r = p.form.Reader(r)
+	}
+	if p.lower {
+		r = &lowerReader{r: bufio.NewReader(r)}
+	}
+	if len(p.transforms) > 0 {
+		r = &transformReader{r: r, transform: p.transform}
+	}
+	return r
+}
+
+// transformReader reads the whole text of r on the first Read, and returns it transformed.
+type transformReader struct {
+	r         io.Reader
+	transform func(string) string
+	out       *strings.Reader
+}
+
+func (t *transformReader) Read(p []byte) (int, error) {
+	if t.out == nil {
+		data, err := io.ReadAll(t.r)
+		if err != nil {
+			return 0, err
+		}
+		t.out = strings.NewReader(t.transform(string(data)))
+	}
+	return t.out.Read(p)
+}
+
+// lowerReader lowercases the text read from r rune by rune, as strings.ToLower does.
+type lowerReader struct {
+	r *bufio.Reader
+	// buf holds the bytes of the last lowercased rune not read yet.
+	buf []byte
+}
+
+func (l *lowerReader) Read(p []byte) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(l.buf) == 0 {
+			c, _, err := l.r.ReadRune()
+			if err != nil {
+				if n > 0 && err == io.EOF {
+					return n, nil
+				}
+				return n, err
+			}
+			l.buf = utf8.AppendRune(l.buf[:0], unicode.ToLower(c))
+		}
+		copied := copy(p[n:], l.buf)
+		l.buf = l.buf[copied:]
+		n += copied
+	}
+	return n, nil
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultPendingPurgeAge is how long ids must have been pending to be purged, when not given.
+const DefaultPendingPurgeAge = 60 * time.Second
+
+// purgePendingHandler handles the admin only POST requests to `/admin/purge-pending?olderThanSeconds={n}` endpoint.
+// The ids pending for longer are released, their hashes being discarded if ever computed, and returned.
+func (s *Server) purgePendingHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	age := DefaultPendingPurgeAge
+	if v := r.URL.Query().Get("olderThanSeconds"); v != "" {
+		secs, err := strconv.Atoi(v)
+		if err != nil || secs < 0 {
+			http.Error(w, "Invalid `olderThanSeconds`!", http.StatusBadRequest)
+			return
+		}
+		age = time.Duration(secs) * time.Second
+	}
+	res := s.send(r.Context(), Command{requestType: PurgePendingCommand, before: time.Now().Add(-age)})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	var purged []int
+	if !decodeResult(w, res, &purged) {
+		return
+	}
+	s.audit.Record("purge-pending", r, map[string][]int{"ids": purged})
+	log.Println("Pending ids purged: ", len(purged))
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	b64 "encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// FilePepperVersion is the version of the pepper first read from `--pepper-file`.
+const FilePepperVersion = 1
+
+// MinPepperSize is the minimum size of the peppers of `--pepper-file` and `/admin/reload-pepper` endpoint, in bytes.
+const MinPepperSize = 32
+
+// ErrPepperVersionExists is returned when adding a pepper version which is already in the keyring.
+var ErrPepperVersionExists = errors.New("pepper version already exists")
+
+// Pepper is the keyring of the server-side secrets mixed into the passwords before they are hashed, by version.
+// The active version is applied to the new hashes, and the previous ones are kept to verify the existing hashes.
+// The pepper of `--pepper-file` is FilePepperVersion, read again when the server receives SIGHUP, and the other
+// versions are added by `/admin/reload-pepper` endpoint. Version 0 applies no pepper. Safe for concurrent use.
+type Pepper struct {
+	path string
+	mu   sync.RWMutex
+	keys map[int][]byte
+	// fileVersion is the version of the last content read from the file, 0 until it is read.
+	fileVersion int
+	active      int
+}
+
+// LoadPepper reads the pepper from the file. No pepper is applied when path is empty.
+func LoadPepper(path string) (*Pepper, error) {
+	p := &Pepper{path: path, keys: make(map[int][]byte)}
+	if _, err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload reads the pepper file again, and returns the version of its content. The versions are never replaced, as the
+// hashes computed with them could no longer be verified: a changed content is added as the active version, after the
+// greatest one, and an unchanged one leaves the active version as it is, e.g. one added since by an admin.
+func (p *Pepper) Reload() (int, error) {
+	if p.path == "" {
+		return 0, nil
+	}
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return 0, err
+	}
+	key := []byte(strings.TrimSpace(string(data)))
+	if len(key) < MinPepperSize {
+		return 0, fmt.Errorf("the pepper file must hold at least %d bytes", MinPepperSize)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fileVersion != 0 && hmac.Equal(p.keys[p.fileVersion], key) {
+		return p.fileVersion, nil
+	}
+	version := FilePepperVersion
+	if p.fileVersion != 0 {
+		version = slices.Max(slices.Collect(maps.Keys(p.keys))) + 1
+	}
+	p.keys[version] = key
+	p.fileVersion = version
+	p.active = version
+	return version, nil
+}
+
+// Add adds the pepper version to the keyring, making it the active pepper.
+// The existing versions cannot be replaced, as the hashes computed with them could no longer be verified.
+func (p *Pepper) Add(version int, value []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.keys[version]; ok {
+		return ErrPepperVersionExists
+	}
+	if p.keys == nil {
+		p.keys = make(map[int][]byte)
+	}
+	p.keys[version] = value
+	p.active = version
+	return nil
+}
+
+// ActiveVersion returns the version of the pepper applied to the new hashes. A nil Pepper has version 0.
+func (p *Pepper) ActiveVersion() int {
+	if p == nil {
+		return 0
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.active
+}
+
+// Apply returns the password to hash and the version of the pepper applied: the base64 encoded HMAC-SHA256 of the
+// password keyed with the active pepper, or the password itself when there is no pepper. A nil Pepper applies no
+// pepper.
+func (p *Pepper) Apply(password string) (string, int) {
+	mac, version := p.NewMAC()
+	return applyMAC(mac, password), version
+}
+
+// ApplyVersion is Apply with the pepper version, e.g. the one a hash to verify was computed with.
+// It returns false if the keyring does not hold the version.
+func (p *Pepper) ApplyVersion(password string, version int) (string, bool) {
+	mac, ok := p.newVersionMAC(version)
+	return applyMAC(mac, password), ok
+}
+
+// applyMAC returns the base64 encoded MAC of the password, or the password itself when mac is nil.
+func applyMAC(mac hash.Hash, password string) string {
+	if mac == nil {
+		return password
+	}
+	mac.Write([]byte(password))
+	return b64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// NewMAC returns the HMAC-SHA256 keyed with the active pepper, for the passwords too long to be given to Apply,
+// or nil when there is no pepper, and the version of the pepper.
+func (p *Pepper) NewMAC() (hash.Hash, int) {
+	if p == nil {
+		return nil, 0
+	}
+	p.mu.RLock()
+	version := p.active
+	p.mu.RUnlock()
+	// The active version is never removed from the keyring.
+	mac, _ := p.newVersionMAC(version)
+	return mac, version
+}
+
+// newVersionMAC returns the HMAC-SHA256 keyed with the pepper version, or nil for version 0.
+// It returns false if the keyring does not hold the version.
+func (p *Pepper) newVersionMAC(version int) (hash.Hash, bool) {
+	if version == 0 {
+		return nil, true
+	}
+	if p == nil {
+		return nil, false
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	key, ok := p.keys[version]
+	if !ok {
+		return nil, false
+	}
+	if len(key) == 0 {
+		return nil, true
+	}
+	return hmac.New(sha256.New, key), true
+}
+
+// reloadPepperOnSignal creates a goroutine reloading the pepper each time the server receives SIGHUP.
+// Hashes computed with a previous pepper can be updated with `/hash/{id}/recompute` endpoint.
+func reloadPepperOnSignal(p *Pepper) {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	go func() {
+		for range sighup {
+			version, err := p.Reload()
+			if err != nil {
+				log.Println("Cannot reload the pepper: ", err)
+				continue
+			}
+			log.Printf("Pepper reloaded from %s, as version %d, the active version being %d", p.path, version, p.ActiveVersion())
+		}
+	}()
+}
+
+// MaxReloadPepperBodySize limits the size of `/admin/reload-pepper` request bodies.
+const MaxReloadPepperBodySize = 1 << 12
+
+// ReloadPepperRequest defines request structure for '/admin/reload-pepper' endpoint.
+type ReloadPepperRequest struct {
+	Version int `json:"version"`
+	// Pepper is the base64 encoded secret, of at least MinPepperSize bytes.
+	Pepper string `json:"pepper"`
+}
+
+// reloadPepperHandler handles the admin only POST requests to `/admin/reload-pepper` endpoint.
+// The pepper is added to the keyring as the active version, applied to the new hashes, while the existing hashes
+// keep being verified with the version they were computed with.
+func (s *Server) reloadPepperHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	req := &ReloadPepperRequest{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxReloadPepperBodySize)).Decode(req); err != nil || req.Version < 1 {
+		http.Error(w, "A positive `version` and the base64 encoded `pepper` must be given!", http.StatusBadRequest)
+		return
+	}
+	pepper, err := b64.StdEncoding.DecodeString(req.Pepper)
+	if err != nil || len(pepper) < MinPepperSize {
+		http.Error(w, fmt.Sprintf("The `pepper` must be base64 encoded, of at least %d bytes!", MinPepperSize), http.StatusBadRequest)
+		return
+	}
+	if err := s.pepper.Add(req.Version, pepper); err != nil {
+		http.Error(w, "The pepper version already exists!", http.StatusConflict)
+		log.Println("Rejecting the request as the pepper version already exists: ", req.Version)
+		return
+	}
+	s.audit.Record("reload-pepper", r, map[string]int{"version": req.Version})
+	log.Println("Pepper reloaded, active version: ", req.Version)
+	writeJSON(w, s.configResponse())
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// Default and maximum numbers of characters of the hash shown at each end of the previews of
+// `/hash/{id}/preview` endpoint.
+const (
+	DefaultPreviewPrefixChars = 8
+	DefaultPreviewSuffixChars = 4
+	MaxPreviewChars           = 16
+)
+
+// PreviewMask replaces the middle of the hashes in the previews.
+const PreviewMask = "****"
+
+// PreviewResponse defines response structure for '/hash/{id}/preview' endpoint.
+type PreviewResponse struct {
+	Preview    string `json:"preview"`
+	FullLength int    `json:"fullLength"`
+	Algorithm  string `json:"algorithm"`
+}
+
+// previewOf returns the preview of the latest hash of the record, showing prefix characters of the hash, the
+// PreviewMask and suffix characters. At most half of the hash is shown, the longest end being shortened otherwise.
+func previewOf(rec *HashRecord, prefix, suffix int) *PreviewResponse {
+	for prefix+suffix > len(rec.Hash)/2 {
+		if prefix > suffix {
+			prefix--
+		} else {
+			suffix--
+		}
+	}
+	preview := rec.Hash[:prefix] + PreviewMask + rec.Hash[len(rec.Hash)-suffix:]
+	return &PreviewResponse{Preview: preview, FullLength: len(rec.Hash), Algorithm: rec.Algorithm}
+}
+
+// previewHandler handles the GET requests to `/hash/{id}/preview?prefixChars=8&suffixChars=4` endpoint.
+// The preview lets a user recognize a hash without disclosing it.
+func (s *Server) previewHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	prefix, ok := previewChars(w, r, "prefixChars", DefaultPreviewPrefixChars)
+	if !ok {
+		return
+	}
+	suffix, ok := previewChars(w, r, "suffixChars", DefaultPreviewSuffixChars)
+	if !ok {
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetPreviewCommand, id: hashId, previewChars: [2]int{prefix, suffix}})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// previewChars returns the number of characters given by the parameter of the request, or def if not given.
+// If the number is invalid, it writes an error response and returns false.
+func previewChars(w http.ResponseWriter, r *http.Request, param string, def int) (int, bool) {
+	v := r.URL.Query().Get(param)
+	if v == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || n > MaxPreviewChars {
+		http.Error(w, fmt.Sprintf("The `%s` must be between 0 and %d!", param, MaxPreviewChars), http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
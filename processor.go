@@ -0,0 +1,34 @@
+package main
+
+import "context"
+
+// CommandProcessor processes the commands sent by the handlers, and returns their Result, or the error of ctx once it
+// is done. The password store goroutine processes them, but the handlers can be served by any other implementation,
+// e.g. answering preset results without the goroutine and its preprocessing delay.
+type CommandProcessor interface {
+	Send(ctx context.Context, c Command) Result
+}
+
+// storeProcessor is the CommandProcessor of the password store goroutine reading inboundRequests.
+type storeProcessor struct {
+	inboundRequests *CommandQueue
+	pending         *PendingCommands
+}
+
+// Send forwards the command to the password store and waits for its result, or until ctx is done.
+func (p *storeProcessor) Send(ctx context.Context, c Command) Result {
+	// The response channel is buffered, so that the store goroutine does not block if the request has timed out.
+	resChan := make(chan Result, 1)
+	c.responseChannel = resChan
+	p.pending.Add(c.requestType, 1)
+	if err := p.inboundRequests.SendContext(ctx, c); err != nil {
+		p.pending.Add(c.requestType, -1)
+		return Result{err: err}
+	}
+	select {
+	case res := <-resChan:
+		return res
+	case <-ctx.Done():
+		return Result{err: ctx.Err()}
+	}
+}
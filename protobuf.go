@@ -0,0 +1,140 @@
+package main
+
+//go:generate buf generate
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	hashserverpb "github.com/KetanA/JC-Golang/proto"
+	"google.golang.org/protobuf/encoding/protodelim"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ProtobufContentType is the media type of Protocol Buffers encoded bodies.
+// The message definitions live in proto/hashserver.proto, and the Go types are generated by `go generate`.
+const ProtobufContentType = "application/x-protobuf"
+
+// MaxProtobufBodySize limits the size of Protobuf request bodies.
+const MaxProtobufBodySize = 1 << 20
+
+// protobufPatterns are the patterns of the endpoints whose responses may be Protobuf encoded. The others answer
+// 406 to the clients only accepting Protobuf.
+var protobufPatterns = map[string]bool{
+	"/hash":         true,
+	"/hash/{id}":    true,
+	"/stats":        true,
+	"/events":       true,
+	"/events/count": true,
+}
+
+// HashRequest is the body of POST /hash, decoded from a form, JSON or the `HashRequest` Protobuf message.
+type HashRequest struct {
+	Password  string   `json:"password"`
+	Algorithm string   `json:"algorithm"`
+	Namespace string   `json:"namespace"`
+	Tags      []string `json:"tags"`
+	Encoding  string   `json:"encoding"`
+}
+
+// isProtobufRequest reports whether the request body is Protobuf encoded.
+func isProtobufRequest(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == ProtobufContentType
+}
+
+// acceptsProtobuf reports whether the client asked for a Protobuf encoded response.
+func acceptsProtobuf(r *http.Request) bool {
+	for _, v := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(v)); mediaType == ProtobufContentType {
+			return true
+		}
+	}
+	return false
+}
+
+// acceptsOnlyProtobuf reports whether the client asked for a Protobuf encoded response, and no other media type.
+func acceptsOnlyProtobuf(r *http.Request) bool {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return false
+	}
+	for _, v := range strings.Split(accept, ",") {
+		if mediaType, _, _ := mime.ParseMediaType(strings.TrimSpace(v)); mediaType != ProtobufContentType {
+			return false
+		}
+	}
+	return true
+}
+
+// writeProtobuf writes the encoded message as the response body.
+func writeProtobuf(w http.ResponseWriter, msg proto.Message) {
+	b, err := proto.Marshal(msg)
+	if err != nil {
+		writeInternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", ProtobufContentType)
+	w.Write(b)
+}
+
+// writeProtobufStream writes the messages as the response body, each prefixed by its varint encoded length.
+func writeProtobufStream(w http.ResponseWriter, msgs []proto.Message) {
+	var b bytes.Buffer
+	for _, msg := range msgs {
+		if _, err := protodelim.MarshalTo(&b, msg); err != nil {
+			writeInternalError(w)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", ProtobufContentType)
+	w.Write(b.Bytes())
+}
+
+// decodeHashRequest reads a `HashRequest` message from body.
+func decodeHashRequest(body io.Reader) (*HashRequest, error) {
+	b, err := io.ReadAll(io.LimitReader(body, MaxProtobufBodySize))
+	if err != nil {
+		return nil, err
+	}
+	msg := &hashserverpb.HashRequest{}
+	if err := proto.Unmarshal(b, msg); err != nil {
+		return nil, err
+	}
+	return &HashRequest{Password: msg.Password, Algorithm: msg.Algorithm, Namespace: msg.Namespace, Tags: msg.Tags, Encoding: msg.Encoding}, nil
+}
+
+// protobuf returns the `Stats` message of the stats.
+func (m *Stats) protobuf() *hashserverpb.Stats {
+	msg := &hashserverpb.Stats{
+		Total:          int64(m.TotalNum),
+		Average:        m.AverageTime,
+		LastPurgeCount: int64(m.LastPurgeCount),
+		GoRoutineCount: int64(m.GoRoutineCount),
+		HeapAllocBytes: m.HeapAllocBytes,
+		HeapSysBytes:   m.HeapSysBytes,
+		GcPauseNs:      m.GCPauseNs,
+		CacheHits:      m.CacheHits,
+		CacheMisses:    m.CacheMisses,
+		CacheHitRatio:  m.CacheHitRatio,
+		MinObservedUs:  m.MinObservedUs,
+		MaxObservedUs:  m.MaxObservedUs,
+	}
+	if m.LastPurgeAt != nil {
+		msg.LastPurgeAt = timestamppb.New(*m.LastPurgeAt)
+	}
+	return msg
+}
+
+// protobuf returns the `Event` message of the event.
+func (m *Event) protobuf() *hashserverpb.Event {
+	msg := &hashserverpb.Event{EventId: m.EventID, Type: m.Type, HashId: int64(m.HashID), Algorithm: m.Algorithm}
+	if !m.Timestamp.IsZero() {
+		msg.Timestamp = timestamppb.New(m.Timestamp)
+	}
+	return msg
+}
@@ -0,0 +1,52 @@
+package main
+
+import "log"
+
+// EventPublisherBufferSize is the number of events queued for publishing before new events are dropped.
+const EventPublisherBufferSize = 1000
+
+// EventPublisher forwards events recorded by the password store to an external system.
+// Publish must not block, as it is called from the store goroutine.
+type EventPublisher interface {
+	Publish(e Event)
+}
+
+// NewEventPublisher creates the publisher configured by cfg, or returns nil if publishing is disabled.
+func NewEventPublisher(cfg *Config) (EventPublisher, error) {
+	if cfg.NATSURL == "" {
+		return nil, nil
+	}
+	publish, err := connectNATS(cfg.NATSURL)
+	if err != nil {
+		return nil, err
+	}
+	return newAsyncPublisher(publish), nil
+}
+
+// asyncPublisher hands events over to a dedicated goroutine through a buffered channel,
+// so that publish latency does not slow down the store goroutine.
+type asyncPublisher struct {
+	events chan Event
+}
+
+// newAsyncPublisher starts the goroutine calling publish for each queued event.
+func newAsyncPublisher(publish func(Event) error) *asyncPublisher {
+	p := &asyncPublisher{events: make(chan Event, EventPublisherBufferSize)}
+	go func() {
+		for e := range p.events {
+			if err := publish(e); err != nil {
+				log.Printf("Failed to publish event %d: %v", e.EventID, err)
+			}
+		}
+	}()
+	return p
+}
+
+// Publish queues the event, dropping it if the buffer is full.
+func (p *asyncPublisher) Publish(e Event) {
+	select {
+	case p.events <- e:
+	default:
+		log.Printf("Event publisher buffer is full, dropping event %d", e.EventID)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+// NATSSubject is the subject hash events are published to.
+const NATSSubject = "hash.events"
+
+// NATSStream is the JetStream stream created to store the events published to NATSSubject.
+const NATSStream = "HASH_EVENTS"
+
+// MaxNATSReconnectDelay caps the exponential backoff between reconnection attempts.
+const MaxNATSReconnectDelay = 30 * time.Second
+
+// connectNATS connects to JetStream and returns a function publishing events as JSON to NATSSubject.
+// Lost connections are re-established in the background by the NATS client.
+func connectNATS(url string) (func(Event) error, error) {
+	nc, err := nats.Connect(url,
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.CustomReconnectDelay(natsReconnectDelay),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Printf("Disconnected from NATS: %v", err)
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("Reconnected to NATS at %s", nc.ConnectedUrl())
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	js, err := nc.JetStream()
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	// JetStream only acknowledges the events published to the subjects of a stream, so NATSStream is ensured to exist
+	// before the first event is published, once connected.
+	streamReady := false
+	return func(e Event) error {
+		if !streamReady {
+			if err := ensureNATSStream(js); err != nil {
+				return err
+			}
+			streamReady = true
+		}
+		data, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		_, err = js.Publish(NATSSubject, data)
+		return err
+	}, nil
+}
+
+// ensureNATSStream creates NATSStream bound to NATSSubject, unless it exists already.
+func ensureNATSStream(js nats.JetStreamContext) error {
+	_, err := js.StreamInfo(NATSStream)
+	if errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = js.AddStream(&nats.StreamConfig{Name: NATSStream, Subjects: []string{NATSSubject}})
+	}
+	return err
+}
+
+// natsReconnectDelay doubles the wait time for each failed attempt, up to MaxNATSReconnectDelay.
+func natsReconnectDelay(attempts int) time.Duration {
+	if attempts > 10 {
+		return MaxNATSReconnectDelay
+	}
+	return min(100*time.Millisecond<<attempts, MaxNATSReconnectDelay)
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// AutoPurgeInterval is how often hashes older than `--auto-purge-after` are purged.
+const AutoPurgeInterval = 1 * time.Hour
+
+// startAutoPurger creates a goroutine that periodically removes the hashes created more than maxAge ago.
+func startAutoPurger(inboundRequests *CommandQueue, pending *PendingCommands, maxAge time.Duration) {
+	go func() {
+		for range time.Tick(AutoPurgeInterval) {
+			purgeOldHashes(inboundRequests, pending, maxAge)
+		}
+	}()
+}
+
+// purgeOldHashes removes the hashes created more than maxAge ago, and returns the JSON array of their ids.
+func purgeOldHashes(inboundRequests *CommandQueue, pending *PendingCommands, maxAge time.Duration) string {
+	resChan := make(chan Result, 1)
+	pending.Send(inboundRequests, Command{requestType: PurgeOldHashesCommand, before: time.Now().Add(-maxAge), responseChannel: resChan})
+	purged := (<-resChan).value
+	slog.Debug("Purged old hashes", "maxAge", maxAge, "ids", purged)
+	return purged
+}
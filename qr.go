@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/skip2/go-qrcode"
+)
+
+// Bounds and default of the `size` of `/hash/{id}/qr` images, in pixels.
+const (
+	MinQRSize     = 64
+	MaxQRSize     = 1024
+	DefaultQRSize = 256
+)
+
+// encodeQR encodes the content as a QR code PNG image of size pixels, with the medium error correction level
+// recovering 15% of the data.
+func encodeQR(content string, size int) ([]byte, error) {
+	return qrcode.Encode(content, qrcode.Medium, size)
+}
+
+// qrHandler handles the GET requests to `/hash/{id}/qr` endpoint.
+// The latest hash is returned as a QR code PNG image, e.g. for verification UIs to display it for mobile scanning.
+func (s *Server) qrHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	size := DefaultQRSize
+	if v := r.URL.Query().Get("size"); v != "" {
+		if size, err = strconv.Atoi(v); err != nil || size < MinQRSize || size > MaxQRSize {
+			http.Error(w, fmt.Sprintf("The `size` must be between %d and %d pixels!", MinQRSize, MaxQRSize), http.StatusBadRequest)
+			return
+		}
+	}
+	res := s.send(r.Context(), Command{requestType: GetHashCommand, id: hashId})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	png, err := encodeQR(res.value, size)
+	if err != nil {
+		log.Printf("Cannot encode the QR code of the hash for id %d: %v", hashId, err)
+		writeInternalError(w)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Length", strconv.Itoa(len(png)))
+	w.Write(png)
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+)
+
+// PendingCommands counts the commands sent to the store goroutine and not processed yet, by type, as the
+// inboundRequests channel cannot be inspected without draining it. A command is counted by its sender before it is
+// sent, and uncounted by the store goroutine once received. A nil PendingCommands counts nothing.
+// Safe for concurrent use.
+type PendingCommands struct {
+	// counts is only read once created, every command type having its counter.
+	counts map[CommandType]*atomic.Int64
+}
+
+// NewPendingCommands creates the PendingCommands counting the commands of all the types.
+func NewPendingCommands() *PendingCommands {
+	p := &PendingCommands{counts: make(map[CommandType]*atomic.Int64)}
+	for t := range commandTypeNames {
+		p.counts[t] = &atomic.Int64{}
+	}
+	return p
+}
+
+// Add adds n, possibly negative, to the number of pending commands of the type.
+func (p *PendingCommands) Add(t CommandType, n int64) {
+	if p == nil {
+		return
+	}
+	if count, ok := p.counts[t]; ok {
+		count.Add(n)
+	}
+}
+
+// Send counts the command as pending and sends it to the store goroutine, waiting until it is received.
+func (p *PendingCommands) Send(inboundRequests *CommandQueue, c Command) {
+	p.Add(c.requestType, 1)
+	inboundRequests.Send(c)
+}
+
+// TrySend counts the command as pending and sends it to the store goroutine if it can be queued at once, and reports
+// whether it was sent.
+func (p *PendingCommands) TrySend(inboundRequests *CommandQueue, c Command) bool {
+	p.Add(c.requestType, 1)
+	if !inboundRequests.TrySend(c) {
+		p.Add(c.requestType, -1)
+		return false
+	}
+	return true
+}
+
+// Counts returns the number of pending commands by type, named in camel case without their `Command` suffix,
+// e.g. `setHash` for SetHashCommand.
+func (p *PendingCommands) Counts() map[string]int64 {
+	counts := make(map[string]int64)
+	if p == nil {
+		return counts
+	}
+	for t, count := range p.counts {
+		name := strings.TrimSuffix(t.String(), "Command")
+		counts[strings.ToLower(name[:1])+name[1:]] = count.Load()
+	}
+	return counts
+}
+
+// pendingCommandsHandler handles the admin only GET requests to `/admin/commands/pending` endpoint.
+// The counts are read without going through the store goroutine, so they are available while it is busy.
+func (s *Server) pendingCommandsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	writeJSON(w, s.pending.Counts())
+}
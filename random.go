@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"strconv"
+)
+
+// Bounds and default of the `length` of the passwords generated by `/hash/random` endpoint.
+const (
+	MinRandomPasswordLength     = 8
+	MaxRandomPasswordLength     = 256
+	DefaultRandomPasswordLength = 32
+)
+
+// DefaultRandomCharset is the default `charset` of the passwords generated by `/hash/random` endpoint.
+const DefaultRandomCharset = "alphanumeric"
+
+// randomCharsets are the characters the passwords generated by `/hash/random` endpoint are made of, by `charset`.
+var randomCharsets = map[string]string{
+	"alphanumeric": "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789",
+	"alpha":        "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz",
+	"numeric":      "0123456789",
+	"hex":          "0123456789abcdef",
+	"printable":    "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~",
+}
+
+// RandomHashResponse defines response structure for '/hash/random' endpoint.
+type RandomHashResponse struct {
+	ID int `json:"id"`
+	// Password is the generated password, returned once and never stored.
+	Password string `json:"password"`
+}
+
+// randomPassword generates a password of length random characters of the charset.
+func randomPassword(length int, charset string) (string, error) {
+	b := make([]byte, length)
+	n := big.NewInt(int64(len(charset)))
+	for i := range b {
+		c, err := rand.Int(rand.Reader, n)
+		if err != nil {
+			return "", err
+		}
+		b[i] = charset[c.Int64()]
+	}
+	return string(b), nil
+}
+
+// randomHashHandler handles the admin only POST requests to `/hash/random` endpoint.
+// A random password of the given `length` and `charset` is generated and hashed, like the ones posted to `/hash`.
+// This is the only time the password is returned: only its hash is stored, so the response must be kept secret.
+func (s *Server) randomHashHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if s.rejectDraining(w) || !s.requireAdmin(w, r) {
+		return
+	}
+	length := DefaultRandomPasswordLength
+	if v := r.URL.Query().Get("length"); v != "" {
+		var err error
+		if length, err = strconv.Atoi(v); err != nil || length < MinRandomPasswordLength || length > MaxRandomPasswordLength {
+			http.Error(w, fmt.Sprintf("The `length` must be between %d and %d!", MinRandomPasswordLength, MaxRandomPasswordLength), http.StatusBadRequest)
+			return
+		}
+	}
+	charsetName := r.URL.Query().Get("charset")
+	if charsetName == "" {
+		charsetName = DefaultRandomCharset
+	}
+	charset, ok := randomCharsets[charsetName]
+	if !ok {
+		http.Error(w, "The `charset` must be alphanumeric, alpha, numeric, hex or printable!", http.StatusBadRequest)
+		return
+	}
+	req, ok := readHashRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.Password != "" {
+		http.Error(w, "The password is generated by the server, it must not be given!", http.StatusBadRequest)
+		return
+	}
+	if !s.allowAlgorithm(w, req.Algorithm) {
+		return
+	}
+	password, err := randomPassword(length, charset)
+	if err != nil {
+		log.Println("Cannot generate a random password: ", err)
+		writeInternalError(w)
+		return
+	}
+	req.Password = password
+	id := s.ids.Next()
+	s.audit.Record("random-hash", r, map[string]int{"id": id})
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, &RandomHashResponse{ID: id, Password: password})
+	s.queueHash(r.Context(), id, req)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// RecomputeInterval is the minimum time between two `/hash/{id}/recompute` requests of a client.
+const RecomputeInterval = 1 * time.Second
+
+// RateLimiter allows a request per interval to each client. Safe for concurrent use.
+type RateLimiter struct {
+	interval time.Duration
+	mu       sync.Mutex
+	// last holds the time of the last allowed request, by client.
+	last map[string]time.Time
+}
+
+// NewRateLimiter creates a RateLimiter allowing a request per interval to each client.
+func NewRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{interval: interval, last: make(map[string]time.Time)}
+}
+
+// Allow reports whether the client may make a request now, and if so records it.
+func (l *RateLimiter) Allow(client string) bool {
+	now := time.Now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if t, ok := l.last[client]; ok && now.Sub(t) < l.interval {
+		return false
+	}
+	// Forget the clients which are allowed again, so that the map does not grow forever.
+	if len(l.last) >= 1024 {
+		for c, t := range l.last {
+			if now.Sub(t) >= l.interval {
+				delete(l.last, c)
+			}
+		}
+	}
+	l.last[client] = now
+	return true
+}
+
+// newAlgorithmLimiter creates the limiter of an algorithm allowing rps requests per second, in bursts of up to a
+// second worth of requests.
+func newAlgorithmLimiter(rps float64) *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(rps), max(int(rps), 1))
+}
+
+// allowAlgorithm reports whether a password may be hashed now with the algorithm, according to its
+// `--algorithm-rate-limit`. If not, it writes a 429 response and returns false.
+func (s *Server) allowAlgorithm(w http.ResponseWriter, algorithm string) bool {
+	limiter, ok := s.algorithmLimiters[algorithm]
+	if !ok || limiter.Allow() {
+		return true
+	}
+	w.Header().Set("X-Algorithm-Rate-Limit", strconv.FormatFloat(float64(limiter.Limit()), 'f', -1, 64))
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "Too many requests for the hash algorithm, try again later!", http.StatusTooManyRequests)
+	log.Println("Rejecting the request as the rate limit of the hash algorithm is exceeded: ", algorithm)
+	return false
+}
+
+// clientIP returns the IP address the request comes from.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
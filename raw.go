@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// hexHashHandler handles the GET requests to `/hash/{id}/hex` endpoint, returning the latest hash hex encoded.
+func (s *Server) hexHashHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeReencodedHash(w, r, "hex")
+}
+
+// base64HashHandler handles the GET requests to `/hash/{id}/base64` endpoint, returning the latest hash base64 encoded.
+func (s *Server) base64HashHandler(w http.ResponseWriter, r *http.Request) {
+	s.writeReencodedHash(w, r, "base64")
+}
+
+// writeReencodedHash writes the latest hash converted to one of the digestEncodings, whatever the encoding it was
+// stored with, so that clients do not need to decode and encode it again themselves.
+func (s *Server) writeReencodedHash(w http.ResponseWriter, r *http.Request, encoding string) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetRawHashCommand, id: hashId})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "%s\n", digestEncodings[encoding].Encode([]byte(res.value)))
+}
+
+// rawHashHandler handles the GET requests to `/hash/{id}/raw` endpoint.
+// The latest hash is decoded and returned as binary, for clients storing the digests rather than their text encoding.
+func (s *Server) rawHashHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetRawHashCommand, id: hashId})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(res.value)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="hash-%d.bin"`, hashId))
+	w.Write([]byte(res.value))
+}
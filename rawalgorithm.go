@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// AlgorithmParameters defines response structure for '/hash/{id}/raw-algorithm' endpoint: the parameters the latest
+// hash was computed with, for clients verifying the passwords offline. Only the parameters of the algorithm are set.
+type AlgorithmParameters struct {
+	Algorithm   string `json:"algorithm"`
+	Version     int    `json:"version,omitempty"`
+	MemoryCost  uint32 `json:"memoryCost,omitempty"`
+	TimeCost    uint32 `json:"timeCost,omitempty"`
+	Parallelism uint8  `json:"parallelism,omitempty"`
+	// Salt is hex encoded.
+	Salt   string `json:"salt,omitempty"`
+	KeyLen int    `json:"keyLen,omitempty"`
+	Cost   int    `json:"cost,omitempty"`
+	// PepperVersion is the version of the pepper the password was keyed with, omitted when there was none.
+	PepperVersion int `json:"pepperVersion,omitempty"`
+	// Encoding is the encoding of the digest, omitted for the algorithms embedding their parameters in the hash.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+// hashParameters holds the functions reading the parameters of the algorithms embedding them in their hashes, such
+// as the salt or the cost.
+var hashParameters = map[string]func(hash string, params *AlgorithmParameters) error{
+	"argon2id": argon2idParameters,
+	"bcrypt":   bcryptParameters,
+}
+
+// parametersOf returns the parameters the latest hash of the record was computed with.
+func parametersOf(rec *HashRecord) (*AlgorithmParameters, error) {
+	params := &AlgorithmParameters{Algorithm: rec.Algorithm, PepperVersion: rec.PepperVersion}
+	if read, ok := hashParameters[rec.Algorithm]; ok {
+		if err := read(rec.Hash, params); err != nil {
+			return nil, fmt.Errorf("cannot read the %s parameters: %w", rec.Algorithm, err)
+		}
+		return params, nil
+	}
+	params.Encoding = rec.Encoding
+	if params.Encoding == "" {
+		params.Encoding = hashEncodings[rec.Algorithm]
+	}
+	return params, nil
+}
+
+// rawAlgorithmHandler handles the GET requests to `/hash/{id}/raw-algorithm` endpoint.
+func (s *Server) rawAlgorithmHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetAlgorithmParametersCommand, id: hashId})
+	if errors.Is(res.err, ErrHashPending) {
+		s.writePending(w)
+		return
+	}
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
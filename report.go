@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// Number of entries listed in each section of the `/admin/report` report.
+const (
+	ReportTopAccessed  = 10
+	ReportRecentErrors = 10
+)
+
+//go:embed templates/report.html.tmpl
+var reportHTML string
+
+// reportTemplate renders the HTML report of `/admin/report` endpoint.
+var reportTemplate = template.Must(template.New("report").Parse(reportHTML))
+
+// AlgorithmShare is the number of hashes computed with an algorithm, and their percentage of all the hashes.
+type AlgorithmShare struct {
+	Algorithm string  `json:"algorithm"`
+	Count     int     `json:"count"`
+	Percent   float64 `json:"percent"`
+}
+
+// Report defines response structure for '/admin/report' endpoint with the json format: a summary of the server
+// activity. RecentErrors are the latest failed webhook deliveries, the only errors the server keeps track of.
+type Report struct {
+	GeneratedAt  time.Time          `json:"generatedAt"`
+	TotalHashes  int                `json:"totalHashes"`
+	Stats        *Stats             `json:"stats"`
+	Algorithms   []AlgorithmShare   `json:"algorithms"`
+	Hourly       []HourBucket       `json:"hourly"`
+	TopAccessed  []TopAccessedEntry `json:"topAccessed"`
+	RecentErrors []*FailedWebhook   `json:"recentErrors"`
+	Config       *ConfigResponse    `json:"config"`
+}
+
+// HourPercent returns the percentage of total to the busiest hour, the width of its bar in the HTML report.
+func (rep *Report) HourPercent(total int) float64 {
+	busiest := 0
+	for _, b := range rep.Hourly {
+		busiest = max(busiest, b.Total)
+	}
+	if busiest == 0 {
+		return 0
+	}
+	return 100 * float64(total) / float64(busiest)
+}
+
+// report gathers the report of the server activity from the store.
+func (s *Server) report(ctx context.Context) (*Report, error) {
+	rep := &Report{GeneratedAt: time.Now(), Stats: &Stats{}, Config: s.configResponse()}
+	var dist map[string]int
+	var failed []*FailedWebhook
+	for _, q := range []struct {
+		cmd Command
+		v   any
+	}{
+		{Command{requestType: GetStatsCommand}, rep.Stats},
+		{Command{requestType: AlgorithmDistributionCommand}, &dist},
+		{Command{requestType: GetHourlyStatsCommand}, &rep.Hourly},
+		{Command{requestType: TopAccessedCommand, filter: &SearchFilter{Limit: ReportTopAccessed}}, &rep.TopAccessed},
+		{Command{requestType: ListFailedWebhooksCommand}, &failed},
+	} {
+		res := s.send(ctx, q.cmd)
+		if res.err != nil {
+			return nil, res.err
+		}
+		if err := json.Unmarshal([]byte(res.value), q.v); err != nil {
+			return nil, fmt.Errorf("cannot read the %s reply: %w", q.cmd.requestType, err)
+		}
+	}
+	for _, count := range dist {
+		rep.TotalHashes += count
+	}
+	rep.Algorithms = make([]AlgorithmShare, 0, len(dist))
+	for algorithm, count := range dist {
+		share := AlgorithmShare{Algorithm: algorithm, Count: count}
+		if rep.TotalHashes > 0 {
+			share.Percent = 100 * float64(count) / float64(rep.TotalHashes)
+		}
+		rep.Algorithms = append(rep.Algorithms, share)
+	}
+	sort.Slice(rep.Algorithms, func(i, j int) bool {
+		if rep.Algorithms[i].Count != rep.Algorithms[j].Count {
+			return rep.Algorithms[i].Count > rep.Algorithms[j].Count
+		}
+		return rep.Algorithms[i].Algorithm < rep.Algorithms[j].Algorithm
+	})
+	sort.Slice(failed, func(i, j int) bool { return failed[i].LastAttemptAt.After(failed[j].LastAttemptAt) })
+	rep.RecentErrors = failed[:min(len(failed), ReportRecentErrors)]
+	return rep, nil
+}
+
+// reportHandler handles the admin only GET requests to `/admin/report` endpoint, rendering the report of the server
+// activity as an HTML page, by default, or as JSON with `?format=json`.
+func (s *Server) reportHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "html" && format != "json" {
+		http.Error(w, "The `format` must be 'html' or 'json'!", http.StatusBadRequest)
+		return
+	}
+	rep, err := s.report(r.Context())
+	if err != nil {
+		writeStoreError(w, err)
+		return
+	}
+	s.audit.Record("report", r, nil)
+	if format == "json" {
+		writeJSON(w, rep)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := reportTemplate.Execute(w, rep); err != nil {
+		log.Println("Cannot render the report: ", err)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+// The server is shut down when the store goroutine panics more than MaxStorePanics times in StorePanicWindow.
+const (
+	MaxStorePanics   = 3
+	StorePanicWindow = time.Minute
+)
+
+// ErrStoreRestarted is returned by the store for the commands discarded when it is restarted after a panic.
+var ErrStoreRestarted = errors.New("The store has been restarted, try again later!")
+
+// StorePanics holds the times of the recent panics of the store goroutine. It is only used by the store goroutine.
+type StorePanics struct {
+	times []time.Time
+}
+
+// Record records a panic at t, and returns the number of panics in the StorePanicWindow ending at t.
+func (p *StorePanics) Record(t time.Time) int {
+	recent := p.times[:0]
+	for _, at := range p.times {
+		if t.Sub(at) < StorePanicWindow {
+			recent = append(recent, at)
+		}
+	}
+	p.times = append(recent, t)
+	return len(p.times)
+}
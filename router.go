@@ -0,0 +1,251 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Endpoint is a path pattern served by the server, where `{id}` stands for a hash id and any other `{...}` for a
+// path segment, e.g. `/hash/{id}/tags/{tag}`.
+type Endpoint struct {
+	Pattern string
+	// Name is the name the latencies of the endpoint are recorded under.
+	Name  string
+	regex *regexp.Regexp
+}
+
+// patternParamRegex matches the parameters of the endpoint patterns.
+var patternParamRegex = regexp.MustCompile(`\{[^}]+\}`)
+
+// newEndpoint creates the Endpoint of the path pattern.
+func newEndpoint(pattern, name string) *Endpoint {
+	expr := "^"
+	last := 0
+	for _, m := range patternParamRegex.FindAllStringIndex(pattern, -1) {
+		expr += regexp.QuoteMeta(pattern[last:m[0]])
+		if pattern[m[0]:m[1]] == "{id}" {
+			expr += `\d+`
+		} else {
+			expr += `[^/]+`
+		}
+		last = m[1]
+	}
+	expr += regexp.QuoteMeta(pattern[last:]) + "$"
+	return &Endpoint{Pattern: pattern, Name: name, regex: regexp.MustCompile(expr)}
+}
+
+// endpoints are the path patterns served by the server, without the APIPrefix.
+var endpoints = []*Endpoint{
+	newEndpoint("/hash", "setHash"),
+	newEndpoint("/hash/stream", "streamHash"),
+	newEndpoint("/hash/random", "randomHash"),
+	newEndpoint("/hash/{id}", "hash"),
+	newEndpoint("/hash/{id}/versions", "versions"),
+	newEndpoint("/hash/{id}/algorithm", "algorithm"),
+	newEndpoint("/hash/{id}/raw-algorithm", "rawAlgorithm"),
+	newEndpoint("/hash/{id}/recompute", "recompute"),
+	newEndpoint("/hash/{id}/touch", "touch"),
+	newEndpoint("/hash/{id}/expiry", "expiry"),
+	newEndpoint("/hash/{id}/subscribe", "subscribe"),
+	newEndpoint("/hash/{id}/notify-ready", "notifyReady"),
+	newEndpoint("/hash/{id}/raw", "raw"),
+	newEndpoint("/hash/{id}/hex", "hex"),
+	newEndpoint("/hash/{id}/base64", "base64"),
+	newEndpoint("/hash/{id}/hmac", "hmac"),
+	newEndpoint("/hash/{id}/sign", "sign"),
+	newEndpoint("/hash/{id}/signed", "signed"),
+	newEndpoint("/hash/{id}/info", "info"),
+	newEndpoint("/hash/{id}/qr", "qr"),
+	newEndpoint("/hash/{id}/link", "link"),
+	newEndpoint("/hash/{id}/preview", "preview"),
+	newEndpoint("/hash/{id}/benchmark", "hashBenchmark"),
+	newEndpoint("/hash/{id}/clone", "clone"),
+	newEndpoint("/hash/{id}/copy", "copy"),
+	newEndpoint("/hash/{id}/annotate", "annotate"),
+	newEndpoint("/hash/{id}/metadata", "patchMetadata"),
+	newEndpoint("/hash/{id}/annotations", "annotations"),
+	newEndpoint("/hash/{id}/permanent", "permanentDelete"),
+	newEndpoint("/hash/{id}/restore", "restore"),
+	newEndpoint("/hash/{id}/tags", "addTags"),
+	newEndpoint("/hash/{id}/tags/{tag}", "removeTag"),
+	newEndpoint("/hashes", "list"),
+	newEndpoint("/hashes/bulk", "bulk"),
+	newEndpoint("/hashes/search", "search"),
+	newEndpoint("/admin/subject/{subjectId}", "eraseSubject"),
+	newEndpoint("/admin/subject/{subjectId}/export", "exportSubject"),
+	newEndpoint("/admin/snapshot", "takeSnapshot"),
+	newEndpoint("/admin/snapshots", "listSnapshots"),
+	newEndpoint("/admin/snapshot/{name}/restore", "restoreSnapshot"),
+	newEndpoint("/admin/purge-pending", "purgePending"),
+	newEndpoint("/admin/export/csv", "exportCSV"),
+	newEndpoint("/admin/gc", "gc"),
+	newEndpoint("/admin/force-flush", "forceFlush"),
+	newEndpoint("/admin/trigger-gc", "triggerGC"),
+	newEndpoint("/admin/reconfigure-channel", "reconfigureChannel"),
+	newEndpoint("/admin/load-test", "loadTest"),
+	newEndpoint("/admin/stress-store", "stressStore"),
+	newEndpoint("/admin/top-accessed", "topAccessed"),
+	newEndpoint("/admin/algorithm-distribution", "algorithmDistribution"),
+	newEndpoint("/admin/commands/pending", "pendingCommands"),
+	newEndpoint("/admin/goroutine-dump", "goroutineDump"),
+	newEndpoint("/admin/stats/reset", "resetStats"),
+	newEndpoint("/admin/drain", "drain"),
+	newEndpoint("/admin/undrain", "undrain"),
+	newEndpoint("/admin/reload-pepper", "reloadPepper"),
+	newEndpoint("/admin/reload-allowlist", "reloadAllowlist"),
+	newEndpoint("/admin/kill/{id}", "kill"),
+	newEndpoint("/admin/inspect/{id}", "inspect"),
+	newEndpoint("/admin/failed-webhooks", "failedWebhooks"),
+	newEndpoint("/admin/log-level", "logLevel"),
+	newEndpoint("/admin/set-log-level", "setLogLevel"),
+	newEndpoint("/admin/report", "report"),
+	newEndpoint("/admin/migrate-encoding", "migrateEncoding"),
+	newEndpoint("/admin/public-key/{keyId}", "publicKey"),
+	newEndpoint("/admin/failed-webhooks/{webhookId}/retry", "retryWebhook"),
+	newEndpoint("/metrics/histogram", "histogram"),
+	newEndpoint("/stats", "stats"),
+	newEndpoint("/stats/history", "statsHistory"),
+	newEndpoint("/stats/hourly", "hourlyStats"),
+	newEndpoint("/events", "events"),
+	newEndpoint("/events/count", "eventCount"),
+	newEndpoint("/health", "health"),
+	newEndpoint("/config", "config"),
+	newEndpoint("/shutdown", "shutdown"),
+}
+
+// routeMethods are the methods the routes may be registered for, in the order they are listed to the clients.
+var routeMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+
+// newRoutes returns the handlers of the server, by method and endpoint pattern.
+func (s *Server) newRoutes() map[string]map[string]http.HandlerFunc {
+	return map[string]map[string]http.HandlerFunc{
+		http.MethodGet: {
+			"/hash/{id}":                        s.getHashHandler,
+			"/hash/{id}/versions":               s.versionsHandler,
+			"/hash/{id}/algorithm":              s.algorithmHandler,
+			"/hash/{id}/raw-algorithm":          s.rawAlgorithmHandler,
+			"/hash/{id}/raw":                    s.rawHashHandler,
+			"/hash/{id}/hex":                    s.hexHashHandler,
+			"/hash/{id}/base64":                 s.base64HashHandler,
+			"/hash/{id}/hmac":                   s.hmacHandler,
+			"/hash/{id}/sign":                   s.signHandler,
+			"/hash/{id}/signed":                 s.signedHashHandler,
+			"/hash/{id}/info":                   s.infoHandler,
+			"/hash/{id}/qr":                     s.qrHandler,
+			"/hash/{id}/link":                   s.linkHandler,
+			"/hash/{id}/preview":                s.previewHandler,
+			"/hash/{id}/annotations":            s.annotationsHandler,
+			"/hashes":                           s.listHandler,
+			"/hashes/bulk":                      s.bulkGetHandler,
+			"/hashes/search":                    s.searchHandler,
+			"/admin/subject/{subjectId}/export": s.exportSubjectHandler,
+			"/admin/snapshots":                  s.listSnapshotsHandler,
+			"/admin/export/csv":                 s.exportCSVHandler,
+			"/admin/top-accessed":               s.topAccessedHandler,
+			"/admin/algorithm-distribution":     s.algorithmDistributionHandler,
+			"/admin/commands/pending":           s.pendingCommandsHandler,
+			"/admin/goroutine-dump":             s.goroutineDumpHandler,
+			"/admin/inspect/{id}":               s.inspectHandler,
+			"/admin/failed-webhooks":            s.failedWebhooksHandler,
+			"/admin/log-level":                  s.logLevelHandler,
+			"/admin/report":                     s.reportHandler,
+			"/admin/public-key/{keyId}":         s.publicKeyHandler,
+			"/metrics/histogram":                s.histogramHandler,
+			"/stats":                            s.statsHandler,
+			"/stats/history":                    s.statsHistoryHandler,
+			"/stats/hourly":                     s.hourlyStatsHandler,
+			"/events":                           s.eventsHandler,
+			"/events/count":                     s.eventCountHandler,
+			"/health":                           s.healthHandler,
+			"/config":                           s.configHandler,
+		},
+		http.MethodPost: {
+			"/hash":                                    s.setHashHandler,
+			"/hash/stream":                             s.streamHashHandler,
+			"/hash/random":                             s.randomHashHandler,
+			"/hash/{id}":                               s.rehashHandler,
+			"/hash/{id}/recompute":                     s.recomputeHandler,
+			"/hash/{id}/touch":                         s.touchHandler,
+			"/hash/{id}/benchmark":                     s.hashBenchmarkHandler,
+			"/hash/{id}/subscribe":                     s.subscribeHandler,
+			"/hash/{id}/notify-ready":                  s.notifyReadyHandler,
+			"/hash/{id}/clone":                         s.cloneHandler,
+			"/hash/{id}/copy":                          s.copyHandler,
+			"/hash/{id}/annotate":                      s.annotateHandler,
+			"/hash/{id}/restore":                       s.restoreHandler,
+			"/hash/{id}/tags":                          s.addTagsHandler,
+			"/admin/snapshot":                          s.takeSnapshotHandler,
+			"/admin/snapshot/{name}/restore":           s.restoreSnapshotHandler,
+			"/admin/purge-pending":                     s.purgePendingHandler,
+			"/admin/gc":                                s.gcHandler,
+			"/admin/force-flush":                       s.forceFlushHandler,
+			"/admin/trigger-gc":                        s.triggerGCHandler,
+			"/admin/reconfigure-channel":               s.reconfigureChannelHandler,
+			"/admin/load-test":                         s.loadTestHandler,
+			"/admin/stress-store":                      s.stressStoreHandler,
+			"/admin/stats/reset":                       s.resetStatsHandler,
+			"/admin/drain":                             s.drainHandler,
+			"/admin/undrain":                           s.undrainHandler,
+			"/admin/reload-pepper":                     s.reloadPepperHandler,
+			"/admin/reload-allowlist":                  s.reloadAllowlistHandler,
+			"/admin/failed-webhooks/{webhookId}/retry": s.retryWebhookHandler,
+			"/admin/migrate-encoding":                  s.migrateEncodingHandler,
+			"/shutdown":                                s.shutdownHandler,
+		},
+		http.MethodPut: {
+			"/hash/{id}":           s.compareAndSwapHandler,
+			"/hash/{id}/expiry":    s.expiryHandler,
+			"/admin/set-log-level": s.setLogLevelHandler,
+		},
+		http.MethodPatch: {
+			"/hash/{id}":          s.upgradeAlgorithmHandler,
+			"/hash/{id}/metadata": s.patchMetadataHandler,
+		},
+		http.MethodDelete: {
+			"/hash/{id}":                 s.deleteHashHandler,
+			"/hash/{id}/permanent":       s.permanentDeleteHandler,
+			"/hash/{id}/tags/{tag}":      s.removeTagHandler,
+			"/hashes/bulk":               s.bulkDeleteHandler,
+			"/admin/subject/{subjectId}": s.eraseSubjectHandler,
+			"/admin/kill/{id}":           s.killHandler,
+		},
+	}
+}
+
+// route returns the endpoint matching the unversioned path and its handler of the method.
+// The endpoint is nil if no endpoint matches, and the handler nil if the endpoint does not support the method.
+func (s *Server) route(method, path string) (*Endpoint, http.HandlerFunc) {
+	for _, e := range endpoints {
+		if e.regex.MatchString(path) {
+			return e, s.routes[method][e.Pattern]
+		}
+	}
+	return nil, nil
+}
+
+// allowedMethods returns the methods the endpoint supports.
+func (s *Server) allowedMethods(e *Endpoint) []string {
+	var methods []string
+	for _, method := range routeMethods {
+		if _, ok := s.routes[method][e.Pattern]; ok {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// writeMethodNotAllowed writes the 405 response to a request whose method the endpoint does not support,
+// listing the supported ones in the Allow header.
+func (s *Server) writeMethodNotAllowed(w http.ResponseWriter, r *http.Request, e *Endpoint) {
+	methods := s.allowedMethods(e)
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	list := methods[0]
+	if n := len(methods); n > 1 {
+		list = strings.Join(methods[:n-1], ", ") + " and " + methods[n-1]
+	}
+	http.Error(w, fmt.Sprintf("Only %s methods are supported for `%s` endpoint!", list, e.Pattern), http.StatusMethodNotAllowed)
+	log.Printf("Rejecting the request as its method '%s' is not supported for `%s` endpoint.", r.Method, e.Pattern)
+}
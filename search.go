@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultSearchLimit is the number of search results returned per page unless requested otherwise.
+const DefaultSearchLimit = 100
+
+// SearchFilter holds the criteria of a hash search. Empty criteria match all hashes.
+type SearchFilter struct {
+	Algorithm    string
+	Namespace    string
+	Tag          string
+	CreatedAfter time.Time
+	// Cursor is the last id of the previous page; only greater ids are returned.
+	Cursor int
+	// Limit is the maximum number of results returned.
+	Limit int
+}
+
+// Matches reports whether the record satisfies the filter criteria. Deleted hashes never match.
+func (f *SearchFilter) Matches(rec *HashRecord) bool {
+	return !rec.Deleted &&
+		(f.Algorithm == "" || rec.Algorithm == f.Algorithm) &&
+		(f.Namespace == "" || rec.Namespace == f.Namespace) &&
+		(f.Tag == "" || hasTag(rec.Tags, f.Tag)) &&
+		rec.CreatedAt.After(f.CreatedAfter)
+}
+
+// SearchResult is a hash matching a search.
+type SearchResult struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Algorithm string    `json:"algorithm"`
+}
+
+// SearchResponse defines response structure for '/hashes/search' endpoint.
+type SearchResponse struct {
+	Results []SearchResult `json:"results"`
+	// NextCursor is set when more results are available, to be passed as the `cursor` of the next request.
+	NextCursor int `json:"nextCursor,omitempty"`
+}
+
+// searchHandler handles the GET requests to `/hashes/search` endpoint.
+func (s *Server) searchHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	filter, err := parseSearchFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid search request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: SearchHashesCommand, filter: filter})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// parseSearchFilter reads the search criteria from the query parameters.
+func parseSearchFilter(r *http.Request) (*SearchFilter, error) {
+	q := r.URL.Query()
+	filter := &SearchFilter{Algorithm: q.Get("algorithm"), Namespace: q.Get("namespace"), Tag: q.Get("tag"), Limit: DefaultSearchLimit}
+	if v := q.Get("createdAfter"); v != "" {
+		t, err := parseTime(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid createdAfter %q", v)
+		}
+		filter.CreatedAfter = t
+	}
+	if v := q.Get("cursor"); v != "" {
+		cursor, err := strconv.Atoi(v)
+		if err != nil || cursor < 0 {
+			return nil, fmt.Errorf("invalid cursor %q", v)
+		}
+		filter.Cursor = cursor
+	}
+	if v := q.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > DefaultSearchLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", DefaultSearchLimit)
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
+
+// parseTime accepts either a RFC 3339 timestamp or a date.
+func parseTime(v string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.DateOnly, v)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DefaultPreShutdownDelay is the default wait time after notifying the `--pre-shutdown-webhook`, for the load
+// balancers health checks to take the server out of rotation.
+const DefaultPreShutdownDelay = 10 * time.Second
+
+// PreShutdownWebhookTimeout is the time limit of the `--pre-shutdown-webhook` notification.
+const PreShutdownWebhookTimeout = 5 * time.Second
+
+// PreShutdownNotification defines request structure of the notification posted to the `--pre-shutdown-webhook`.
+type PreShutdownNotification struct {
+	Action string `json:"action"`
+	// Address is the `host:port` of the server going out of rotation.
+	Address string `json:"address"`
+}
+
+// notifyPreShutdown posts the draining notification to the `--pre-shutdown-webhook`.
+// The shutdown proceeds whatever the outcome, which is only logged.
+func (s *Server) notifyPreShutdown() {
+	host, _ := os.Hostname()
+	body, err := safeMarshal(&PreShutdownNotification{Action: "draining", Address: host + DefaultPort})
+	if err != nil {
+		return
+	}
+	client := &http.Client{Timeout: PreShutdownWebhookTimeout}
+	resp, err := client.Post(s.cfg.PreShutdownWebhook, "application/json", strings.NewReader(body))
+	if err != nil {
+		log.Println("Cannot notify the pre-shutdown webhook: ", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Println("The pre-shutdown webhook answered: ", resp.Status)
+		return
+	}
+	log.Printf("Pre-shutdown webhook notified, shutting down in %s.", s.cfg.PreShutdownDelay)
+}
+
+// shutdownOnSignal creates a goroutine shutting the server down gracefully when it receives SIGTERM or SIGINT,
+// as the `/shutdown` endpoint does.
+func shutdownOnSignal(s *Server) {
+	sigterm := make(chan os.Signal, 1)
+	signal.Notify(sigterm, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		for sig := range sigterm {
+			if !s.isShuttingDown.CompareAndSwap(false, true) {
+				log.Println("The server is already being terminated, ignoring ", sig)
+				continue
+			}
+			log.Println("Terminating the server on ", sig)
+			go s.shutdown()
+		}
+	}()
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SnapshotTimeFormat is the layout of the timestamp prefixing snapshot file names.
+const SnapshotTimeFormat = "20060102T150405Z"
+
+// snapshotNameRegex restricts snapshot names to characters that are safe in file names.
+var snapshotNameRegex = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,64}$`)
+
+// Snapshot is the state of the password store saved to `{--snapshot-dir}/{timestamp}-{name}.json`.
+type Snapshot struct {
+	CreatedAt   time.Time           `json:"createdAt"`
+	Counter     int                 `json:"counter"`
+	LastEventID int64               `json:"lastEventId"`
+	Hashes      map[int]*HashRecord `json:"hashes"`
+	Events      []Event             `json:"events"`
+	// WALSeq is the sequence number of the last write-ahead log entry included in the snapshot.
+	WALSeq int64 `json:"walSeq"`
+}
+
+// SnapshotInfo describes a saved snapshot in the '/admin/snapshots' response.
+type SnapshotInfo struct {
+	Name      string    `json:"name"`
+	File      string    `json:"file"`
+	CreatedAt time.Time `json:"createdAt"`
+	Size      int64     `json:"size"`
+}
+
+// takeSnapshotHandler handles the admin only POST requests to `/admin/snapshot?name={name}` endpoint.
+func (s *Server) takeSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if !snapshotNameRegex.MatchString(name) {
+		http.Error(w, "Invalid snapshot name!", http.StatusBadRequest)
+		return
+	}
+	info, err := s.saveSnapshot(r.Context(), name)
+	if err != nil {
+		http.Error(w, "Cannot save the snapshot!", http.StatusInternalServerError)
+		log.Println("Cannot save the snapshot: ", err)
+		return
+	}
+	s.audit.Record("take-snapshot", r, info)
+	log.Println("Snapshot saved to ", info.File)
+	writeJSON(w, info)
+}
+
+// saveSnapshot writes the current state of the password store to a new snapshot file.
+func (s *Server) saveSnapshot(ctx context.Context, name string) (*SnapshotInfo, error) {
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	data, err := s.pauseAndEncode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.cfg.SnapshotDir, 0700); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC().Truncate(time.Second)
+	file := filepath.Join(s.cfg.SnapshotDir, now.Format(SnapshotTimeFormat)+"-"+name+".json")
+	// Write to a temporary file first, so that a snapshot is never partially written.
+	tmp := file + ".tmp"
+	if err := os.WriteFile(tmp, []byte(data), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, file); err != nil {
+		return nil, err
+	}
+	// The write-ahead log entries are now safe in the snapshot, and must be rotated even if the request timed out.
+	var seq struct {
+		WALSeq int64 `json:"walSeq"`
+	}
+	if err := json.Unmarshal([]byte(data), &seq); err != nil {
+		return nil, err
+	}
+	if res := s.send(context.WithoutCancel(ctx), Command{requestType: RotateWALCommand, walSeq: seq.WALSeq}); res.err != nil {
+		log.Println("Cannot rotate the write-ahead log: ", res.err)
+	}
+	return &SnapshotInfo{Name: name, File: file, CreatedAt: now, Size: int64(len(data))}, nil
+}
+
+// pauseAndEncode pauses the store goroutine once the queued commands are processed, and encodes its content.
+// The requests received meanwhile are answered with 503.
+func (s *Server) pauseAndEncode(ctx context.Context) (string, error) {
+	snap := &Snapshot{}
+	resume := make(chan struct{})
+	// The store goroutine is resumed even if the request times out before it is paused.
+	defer close(resume)
+	if res := s.send(ctx, Command{requestType: DrainAndPauseCommand, snapshot: snap, resume: resume}); res.err != nil {
+		return "", res.err
+	}
+	s.isPaused.Store(true)
+	defer s.isPaused.Store(false)
+	return safeMarshal(snap)
+}
+
+// listSnapshots returns the snapshots saved in dir, oldest first.
+func listSnapshots(dir string) ([]SnapshotInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []SnapshotInfo{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	snapshots := []SnapshotInfo{}
+	for _, e := range entries {
+		base, ok := strings.CutSuffix(e.Name(), ".json")
+		ts, name, found := strings.Cut(base, "-")
+		if !ok || !found || e.IsDir() {
+			continue
+		}
+		createdAt, err := time.Parse(SnapshotTimeFormat, ts)
+		fi, ferr := e.Info()
+		if err != nil || ferr != nil {
+			continue
+		}
+		snapshots = append(snapshots, SnapshotInfo{Name: name, File: filepath.Join(dir, e.Name()), CreatedAt: createdAt, Size: fi.Size()})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].CreatedAt.Before(snapshots[j].CreatedAt) })
+	return snapshots, nil
+}
+
+// listSnapshotsHandler handles the admin only GET requests to `/admin/snapshots` endpoint.
+func (s *Server) listSnapshotsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	snapshots, err := listSnapshots(s.cfg.SnapshotDir)
+	if err != nil {
+		http.Error(w, "Cannot list the snapshots!", http.StatusInternalServerError)
+		log.Println("Cannot list the snapshots: ", err)
+		return
+	}
+	writeJSON(w, snapshots)
+}
+
+// restoreSnapshotHandler handles the admin only POST requests to `/admin/snapshot/{name}/restore` endpoint.
+// The latest snapshot with the given name replaces the content of the password store.
+func (s *Server) restoreSnapshotHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	name := strings.TrimSuffix(r.URL.Path[strings.Index(r.URL.Path, "/admin/snapshot/")+len("/admin/snapshot/"):], "/restore")
+	snapshots, err := listSnapshots(s.cfg.SnapshotDir)
+	if err != nil {
+		http.Error(w, "Cannot list the snapshots!", http.StatusInternalServerError)
+		log.Println("Cannot list the snapshots: ", err)
+		return
+	}
+	var info *SnapshotInfo
+	for i := range snapshots {
+		if snapshots[i].Name == name {
+			info = &snapshots[i]
+		}
+	}
+	if info == nil {
+		http.Error(w, "Invalid snapshot name!", http.StatusNotFound)
+		return
+	}
+	snap, err := readSnapshot(info.File)
+	if err != nil {
+		http.Error(w, "Cannot read the snapshot!", http.StatusInternalServerError)
+		log.Println("Cannot read the snapshot: ", err)
+		return
+	}
+	// The store goroutine swaps its content at once, so no command sees a partially restored store.
+	if res := s.send(r.Context(), Command{requestType: RestoreSnapshotCommand, snapshot: snap}); res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	s.audit.Record("restore-snapshot", r, info)
+	log.Println("Snapshot restored from ", info.File)
+	writeJSON(w, info)
+}
+
+// readSnapshot reads a snapshot file.
+func readSnapshot(file string) (*Snapshot, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{}
+	if err := json.Unmarshal(data, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// latestSnapshot returns the most recent snapshot saved in dir, or nil if there is none.
+func latestSnapshot(dir string) (*Snapshot, error) {
+	snapshots, err := listSnapshots(dir)
+	if err != nil || len(snapshots) == 0 {
+		return nil, err
+	}
+	return readSnapshot(snapshots[len(snapshots)-1].File)
+}
+
+// eraseFromSnapshots removes the hashes tagged with the tag, and their events, from the snapshots saved in dir, and
+// returns the number of snapshots rewritten.
+func eraseFromSnapshots(dir, tag string) (int, error) {
+	snapshots, err := listSnapshots(dir)
+	if err != nil {
+		return 0, err
+	}
+	rewritten := 0
+	for _, info := range snapshots {
+		snap, err := readSnapshot(info.File)
+		if err != nil {
+			return rewritten, err
+		}
+		erased := make(map[int]bool)
+		for id, rec := range snap.Hashes {
+			if hasTag(rec.Tags, tag) {
+				delete(snap.Hashes, id)
+				erased[id] = true
+			}
+		}
+		if len(erased) == 0 {
+			continue
+		}
+		snap.Events = slices.DeleteFunc(snap.Events, func(e Event) bool { return erased[e.HashID] })
+		data, err := safeMarshal(snap)
+		if err != nil {
+			return rewritten, err
+		}
+		// The snapshot is replaced at once, so that it is never partially written.
+		tmp := info.File + ".tmp"
+		if err := os.WriteFile(tmp, []byte(data), 0600); err != nil {
+			return rewritten, err
+		}
+		if err := os.Rename(tmp, info.File); err != nil {
+			return rewritten, err
+		}
+		rewritten++
+	}
+	return rewritten, nil
+}
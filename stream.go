@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// MaxStreamBodySize limits the size of the passwords posted to `/hash/stream` endpoint.
+const MaxStreamBodySize = 1 << 30
+
+// streamHashHandler handles the POST requests to `/hash/stream?algorithm={algorithm}` endpoint.
+// The raw request body is the password, hashed as it is read so that it is never held in memory, and the id is
+// returned as by `/hash` endpoint. The other fields of `/hash` requests are given in the query.
+func (s *Server) streamHashHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if s.rejectDraining(w) {
+		return
+	}
+	query := r.URL.Query()
+	req := &HashRequest{Algorithm: query.Get("algorithm"), Namespace: query.Get("namespace"), Tags: query["tags"]}
+	if req.Algorithm == "" {
+		req.Algorithm = DefaultAlgorithm
+	}
+	if req.Namespace == "" {
+		req.Namespace = DefaultNamespace
+	}
+	if err := validateTags(req.Tags); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, ok := streamHashes[req.Algorithm]; !ok {
+		http.Error(w, "Unsupported hash algorithm for streaming!", http.StatusBadRequest)
+		log.Println("Rejecting the request as the hash algorithm does not support streaming: ", req.Algorithm)
+		return
+	}
+	if !s.allowAlgorithm(w, req.Algorithm) {
+		return
+	}
+	var err error
+	if req.Encoding, err = resolveEncoding(req.Algorithm, query.Get("encoding")); err != nil {
+		http.Error(w, "Unsupported hash encoding!", http.StatusBadRequest)
+		log.Println("Rejecting the request: ", err)
+		return
+	}
+
+	start := time.Now()
+	hash, pepperVersion, err := computeStreamHash(s.normalizer.Reader(http.MaxBytesReader(w, r.Body, MaxStreamBodySize)), req.Algorithm, req.Encoding, s.pepper)
+	if err != nil {
+		http.Error(w, "Cannot read the request body!", http.StatusBadRequest)
+		log.Println("Rejecting the request as the body cannot be read: ", err)
+		return
+	}
+	elapsed := time.Since(start)
+
+	id := s.ids.Next()
+	fmt.Fprintf(w, "%d\n", id)
+	c := Command{requestType: SetHashCommand, password: hash, algorithm: req.Algorithm, encoding: req.Encoding, pepperVersion: pepperVersion, namespace: req.Namespace, tags: req.Tags, id: id, requestID: requestIDFrom(r.Context()), clientIdentity: clientIdentityFrom(r.Context())}
+	// The hash is stored after the same delay as the other ones, the processing time including the hashing.
+	go func() {
+		time.Sleep(s.cfg.HashPreprocessingDelay)
+		c.requestStartTs = time.Now().Add(-elapsed).UnixMicro()
+		s.pending.Send(s.inboundRequests, c)
+	}()
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unsafe"
+)
+
+// MaxStressCount is the maximum number of entries created by a `/admin/stress-store` request.
+const MaxStressCount = 1000000
+
+// StressPasswordLength is the length of the passwords generated by `/admin/stress-store` endpoint.
+const StressPasswordLength = 16
+
+// StressStoreResponse defines response structure for '/admin/stress-store' endpoint.
+type StressStoreResponse struct {
+	Stored     int   `json:"stored"`
+	DurationMs int64 `json:"durationMs"`
+	// StoreSizeBytes estimates the memory used by all the records of the store, once populated.
+	StoreSizeBytes int64 `json:"storeSizeBytes"`
+}
+
+// Size estimates the memory used by the record, in bytes.
+func (rec *HashRecord) Size() int64 {
+	size := int64(unsafe.Sizeof(*rec)) + int64(len(rec.Hash)+len(rec.Algorithm)+len(rec.Encoding)+len(rec.Namespace)+len(rec.CreatedBy))
+	for _, tag := range rec.Tags {
+		size += int64(unsafe.Sizeof(tag)) + int64(len(tag))
+	}
+	for k, v := range rec.Annotations {
+		size += int64(len(k) + len(v))
+	}
+	for _, v := range rec.Versions {
+		size += int64(unsafe.Sizeof(v)) + int64(len(v.Algorithm)+len(v.Encoding)+len(v.Hash))
+	}
+	return size
+}
+
+// stressStoreHandler handles the admin only POST requests to `/admin/stress-store` endpoint.
+// The store is populated with `count` hashes of random passwords at once, without the preprocessing delay,
+// to test its capacity, e.g. the cache eviction, the memory consumption or the snapshot performance.
+func (s *Server) stressStoreHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.cfg.AllowAdminStress {
+		http.Error(w, "Store stress tests are disabled!", http.StatusForbidden)
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	count, err := strconv.Atoi(r.URL.Query().Get("count"))
+	if err != nil || count < 1 || count > MaxStressCount {
+		http.Error(w, fmt.Sprintf("The `count` must be between 1 and %d!", MaxStressCount), http.StatusBadRequest)
+		return
+	}
+	algorithm := r.URL.Query().Get("algorithm")
+	if algorithm == "" {
+		algorithm = DefaultAlgorithm
+	}
+	// Only the fast algorithms are allowed, as the passwords are hashed while the request is being handled.
+	if _, ok := streamHashes[algorithm]; !ok && (algorithm != IdentityAlgorithm || hashAlgorithms[algorithm] == nil) {
+		http.Error(w, "The `algorithm` must be sha512, sha256 or identity!", http.StatusBadRequest)
+		return
+	}
+	encoding := hashEncodings[algorithm]
+	s.audit.Record("stress-store", r, map[string]any{"count": count, "algorithm": algorithm})
+
+	start := time.Now()
+	batch := make([]Command, count)
+	for i := range batch {
+		password, err := randomPassword(StressPasswordLength, passwordChars)
+		if err == nil {
+			peppered, pepperVersion := s.pepper.Apply(s.normalizer.String(password))
+			password, err = computeHash(peppered, algorithm, encoding)
+			batch[i].pepperVersion = pepperVersion
+		}
+		if err != nil {
+			for _, c := range batch[:i] {
+				s.ids.Done(c.id)
+			}
+			log.Println("Cannot hash the stress test passwords: ", err)
+			writeInternalError(w)
+			return
+		}
+		batch[i] = Command{requestType: SetHashCommand, id: s.ids.Next(), password: password, algorithm: algorithm, encoding: encoding, namespace: DefaultNamespace, pepperVersion: batch[i].pepperVersion, requestStartTs: time.Now().UnixMicro()}
+	}
+	// The ids are released by the store whatever the outcome of the request.
+	res := s.send(context.WithoutCancel(r.Context()), Command{requestType: StoreBatchCommand, batch: batch})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	size, _ := strconv.ParseInt(res.value, 10, 64)
+	log.Printf("Store populated with %d hashes in %s", count, time.Since(start))
+	writeJSON(w, &StressStoreResponse{Stored: count, DurationMs: time.Since(start).Milliseconds(), StoreSizeBytes: size})
+}
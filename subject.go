@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// SubjectTagPrefix prefixes the subject id in the tag of the hashes holding data of a person.
+const SubjectTagPrefix = "subject:"
+
+// EraseResponse defines response structure for DELETE '/admin/subject/{subjectId}' endpoint.
+type EraseResponse struct {
+	HashesDeleted int `json:"hashesDeleted"`
+	EventsDeleted int `json:"eventsDeleted"`
+	// SnapshotsRewritten is the number of snapshots of `--snapshot-dir` the hashes have been erased from.
+	SnapshotsRewritten int `json:"snapshotsRewritten"`
+}
+
+// SubjectRecord is an entry of the '/admin/subject/{subjectId}/export' response.
+// The hash value is not exported, as it is derived from and not itself personal data.
+type SubjectRecord struct {
+	ID          int       `json:"id"`
+	Algorithm   string    `json:"algorithm"`
+	CreatedAt   time.Time `json:"createdAt"`
+	AccessCount int       `json:"accessCount"`
+	Tags        []string  `json:"tags"`
+	// Annotations are the application-specific metadata of the hash.
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// subjectIDFromPath extracts the subject id from `/admin/subject/{subjectId}[/...]` paths.
+func subjectIDFromPath(path string) string {
+	_, id, _ := strings.Cut(path, "/admin/subject/")
+	id, _, _ = strings.Cut(id, "/")
+	return id
+}
+
+// eraseSubjectHandler handles the admin only DELETE requests to `/admin/subject/{subjectId}` endpoint.
+// It permanently removes all the data of the hashes tagged with `subject:{subjectId}`, honoring the right to erasure.
+func (s *Server) eraseSubjectHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	subjectID := subjectIDFromPath(r.URL.Path)
+	tag := SubjectTagPrefix + subjectID
+	// The hashes are erased from the store, its write-ahead log and its snapshots, for them not to be restored.
+	s.snapshotMu.Lock()
+	defer s.snapshotMu.Unlock()
+	res := s.send(r.Context(), Command{requestType: EraseSubjectCommand, tags: []string{tag}})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	resp := &EraseResponse{}
+	if !decodeResult(w, res, resp) {
+		return
+	}
+	var err error
+	if resp.SnapshotsRewritten, err = eraseFromSnapshots(s.cfg.SnapshotDir, tag); err != nil {
+		log.Printf("Cannot erase the hashes of subject %s from the snapshots: %v", subjectID, err)
+		writeInternalError(w)
+		return
+	}
+	s.audit.Record("erase-subject", r, map[string]any{"subjectId": subjectID, "hashesDeleted": resp.HashesDeleted, "eventsDeleted": resp.EventsDeleted, "snapshotsRewritten": resp.SnapshotsRewritten})
+	log.Printf("Erased %d hashes of subject %s", resp.HashesDeleted, subjectID)
+	writeJSON(w, resp)
+}
+
+// exportSubjectHandler handles the admin only GET requests to `/admin/subject/{subjectId}/export` endpoint.
+// It returns the records of the hashes tagged with `subject:{subjectId}`, honoring the right of access.
+func (s *Server) exportSubjectHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	subjectID := subjectIDFromPath(r.URL.Path)
+	res := s.send(r.Context(), Command{requestType: ExportSubjectCommand, tags: []string{SubjectTagPrefix + subjectID}})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	s.audit.Record("export-subject", r, map[string]any{"subjectId": subjectID})
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
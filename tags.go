@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// MaxTagLength is the maximum length in bytes of a tag.
+const MaxTagLength = 64
+
+// TagsResponse defines response structure for '/hash/{id}/tags' endpoints.
+type TagsResponse struct {
+	ID   int      `json:"id"`
+	Tags []string `json:"tags"`
+}
+
+// ListResponse defines response structure for '/hashes' endpoint.
+type ListResponse struct {
+	IDs []int `json:"ids"`
+}
+
+// validateTags checks the tags are neither empty nor too long.
+func validateTags(tags []string) error {
+	for _, t := range tags {
+		if t == "" || len(t) > MaxTagLength || strings.Contains(t, "/") {
+			return fmt.Errorf("Invalid tag %q, tags must be 1 to %d bytes long and must not contain '/'!", t, MaxTagLength)
+		}
+	}
+	return nil
+}
+
+// addTags merges tags into the sorted and deduplicated tag list, returning the updated list.
+func addTags(list, tags []string) []string {
+	list = append(list, tags...)
+	slices.Sort(list)
+	return slices.Compact(list)
+}
+
+// removeTag removes tag from the sorted tag list, returning the updated list.
+func removeTag(list []string, tag string) []string {
+	if i, found := slices.BinarySearch(list, tag); found {
+		return slices.Delete(list, i, i+1)
+	}
+	return list
+}
+
+// hasTag reports whether the sorted tag list contains tag.
+func hasTag(list []string, tag string) bool {
+	_, found := slices.BinarySearch(list, tag)
+	return found
+}
+
+// addTagsHandler handles the POST requests to `/hash/{id}/tags` endpoint, adding the `tags` form values.
+func (s *Server) addTagsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	r.ParseForm()
+	tags := r.PostForm["tags"]
+	if err := validateTags(tags); err != nil || len(tags) == 0 {
+		if err == nil {
+			err = errors.New("At least one tag is required!")
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeTagsResult(w, s.send(r.Context(), Command{requestType: AddTagsCommand, id: hashId, tags: tags}))
+}
+
+// removeTagHandler handles the DELETE requests to `/hash/{id}/tags/{tag}` endpoint.
+func (s *Server) removeTagHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	tag := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	writeTagsResult(w, s.send(r.Context(), Command{requestType: RemoveTagCommand, id: hashId, tags: []string{tag}}))
+}
+
+// writeTagsResult writes the tags of a hash returned by the store.
+func writeTagsResult(w http.ResponseWriter, res Result) {
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// listHandler handles the GET requests to `/hashes` endpoint, listing the ids of the stored hashes.
+// The list can be restricted with the `tag` and `namespace` query parameters.
+func (s *Server) listHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	filter := &SearchFilter{Tag: r.URL.Query().Get("tag"), Namespace: r.URL.Query().Get("namespace")}
+	res := s.send(r.Context(), Command{requestType: ListHashesCommand, filter: filter})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"path"
+	"time"
+)
+
+// endpointTimeout returns the timeout configured for the unversioned path, or zero if there is none.
+// When several patterns match, the longest one wins.
+func (s *Server) endpointTimeout(p string) time.Duration {
+	var timeout time.Duration
+	longest := -1
+	for pattern, d := range s.cfg.EndpointTimeouts {
+		if ok, _ := path.Match(pattern, p); ok && len(pattern) > longest {
+			timeout, longest = d, len(pattern)
+		}
+	}
+	return timeout
+}
+
+// withTimeout wraps the handler of the unversioned path with its configured timeout.
+// The request context is cancelled when the timeout expires, making the pending store commands return a 504 response.
+func (s *Server) withTimeout(p string, handler http.HandlerFunc) http.HandlerFunc {
+	timeout := s.endpointTimeout(p)
+	if timeout <= 0 {
+		return handler
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), timeout)
+		defer cancel()
+		// The endpoint timeout replaces the server-wide write timeout, which may be shorter.
+		http.NewResponseController(w).SetWriteDeadline(time.Now().Add(timeout + time.Second))
+		handler(w, r.WithContext(ctx))
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RequestTimestampHeader is the header carrying the time a request was sent at, as Unix seconds.
+const RequestTimestampHeader = "X-Request-Timestamp"
+
+// MaxRequestClockSkew is how far in the future a request timestamp can be, allowing for unsynchronized clocks.
+const MaxRequestClockSkew = 5 * time.Second
+
+// checkRequestTimestamp rejects the requests older than `--max-request-age` according to their
+// RequestTimestampHeader, so that recorded requests cannot be replayed. The requests without a timestamp are only
+// rejected with `--require-timestamp`. If the request is rejected, it writes an error response and returns false.
+func (s *Server) checkRequestTimestamp(w http.ResponseWriter, r *http.Request) bool {
+	v := r.Header.Get(RequestTimestampHeader)
+	if v == "" {
+		if s.cfg.RequireTimestamp {
+			http.Error(w, "The `"+RequestTimestampHeader+"` header must be given!", http.StatusBadRequest)
+			return false
+		}
+		return true
+	}
+	secs, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid `"+RequestTimestampHeader+"` header!", http.StatusBadRequest)
+		return false
+	}
+	age := time.Since(time.Unix(secs, 0))
+	switch {
+	case age > s.cfg.MaxRequestAge:
+		http.Error(w, "The request is too old!", http.StatusBadRequest)
+		return false
+	case age < -MaxRequestClockSkew:
+		http.Error(w, "The request timestamp is in the future!", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// ClientIdentity is the subject of the certificate a client authenticated with, when mutual TLS is enabled.
+type ClientIdentity struct {
+	CommonName   string
+	Organization []string
+}
+
+// String returns the identity in the form `CN=client,O=org`, omitting the organization when there is none.
+func (c ClientIdentity) String() string {
+	s := "CN=" + c.CommonName
+	if len(c.Organization) > 0 {
+		s += ",O=" + strings.Join(c.Organization, "+")
+	}
+	return s
+}
+
+// clientIdentityKey is the context key of the client identity.
+type clientIdentityKey struct{}
+
+// newTLSConfig returns the TLS configuration of the server, requiring the clients to authenticate with a
+// certificate of `--tls-client-ca-file` if given.
+func newTLSConfig(cfg *Config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.TLSClientCAFile == "" {
+		return tlsConfig, nil
+	}
+	data, err := os.ReadFile(cfg.TLSClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.New("no certificate found in " + cfg.TLSClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	return tlsConfig, nil
+}
+
+// withClientIdentity returns the request with the identity of its verified client certificate in its context,
+// or the request itself when the client did not authenticate with a certificate.
+func withClientIdentity(r *http.Request) *http.Request {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+		return r
+	}
+	subject := r.TLS.VerifiedChains[0][0].Subject
+	identity := ClientIdentity{CommonName: subject.CommonName, Organization: subject.Organization}
+	return r.WithContext(context.WithValue(r.Context(), clientIdentityKey{}, identity))
+}
+
+// clientIdentityFrom returns the client identity held by ctx, or an empty string.
+func clientIdentityFrom(ctx context.Context) string {
+	identity, ok := ctx.Value(clientIdentityKey{}).(ClientIdentity)
+	if !ok {
+		return ""
+	}
+	return identity.String()
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// TombstonePurgeInterval is how often tombstones older than the retention period are purged.
+const TombstonePurgeInterval = 1 * time.Minute
+
+// deleteHashHandler handles the DELETE requests to `/hash/{id}` endpoint.
+// The hash is soft-deleted: it can be restored until its tombstone is purged.
+func (s *Server) deleteHashHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	if res := s.send(r.Context(), Command{requestType: DeleteHashCommand, id: hashId}); res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Println("Hash deleted for id: ", hashId)
+	fmt.Fprintf(w, "Hash deleted for id: %d\n", hashId)
+}
+
+// permanentDeleteHandler handles the DELETE requests to `/hash/{id}/permanent` endpoint.
+func (s *Server) permanentDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	if res := s.send(r.Context(), Command{requestType: PermanentDeleteHashCommand, id: hashId}); res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Println("Hash permanently deleted for id: ", hashId)
+	fmt.Fprintf(w, "Hash permanently deleted for id: %d\n", hashId)
+}
+
+// restoreHandler handles the POST requests to the admin only `/hash/{id}/restore` endpoint.
+func (s *Server) restoreHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	if res := s.send(r.Context(), Command{requestType: RestoreHashCommand, id: hashId}); res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Println("Hash restored for id: ", hashId)
+	fmt.Fprintf(w, "Hash restored for id: %d\n", hashId)
+}
+
+// startTombstonePurger creates a goroutine that periodically removes the tombstones older than retention.
+func startTombstonePurger(inboundRequests *CommandQueue, pending *PendingCommands, retention time.Duration) {
+	go func() {
+		for range time.Tick(TombstonePurgeInterval) {
+			resChan := make(chan Result, 1)
+			pending.Send(inboundRequests, Command{requestType: PurgeTombstonesCommand, before: time.Now().Add(-retention), responseChannel: resChan})
+			if purged := (<-resChan).value; purged != "0" {
+				log.Printf("Purged %s tombstones older than %s", purged, retention)
+			}
+		}
+	}()
+}
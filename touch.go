@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// TouchResponse defines response structure for '/hash/{id}/touch' endpoint.
+type TouchResponse struct {
+	ID           int       `json:"id"`
+	LastAccessed time.Time `json:"lastAccessed"`
+}
+
+// touchHandler handles the POST requests to `/hash/{id}/touch` endpoint.
+// The hash is marked as accessed, without being returned.
+func (s *Server) touchHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: TouchHashCommand, id: hashId})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+)
+
+// TriggerGCWarning is the warning of the `/admin/trigger-gc` responses.
+const TriggerGCWarning = "Manual garbage collection is generally unnecessary, the runtime collecting on its own, and stops the world while it runs."
+
+// TriggerGCResponse defines response structure for '/admin/trigger-gc' endpoint.
+type TriggerGCResponse struct {
+	HeapBeforeBytes int64 `json:"heapBeforeBytes"`
+	HeapAfterBytes  int64 `json:"heapAfterBytes"`
+	// GCPauseNs is the duration of the pause of the triggered garbage collection.
+	GCPauseNs int64  `json:"gcPauseNs"`
+	Warning   string `json:"warning"`
+}
+
+// triggerGCHandler handles the admin only POST requests to `/admin/trigger-gc` endpoint, running a garbage collection
+// of the Go runtime at once, to diagnose whether the garbage collection pressure causes latency spikes.
+func (s *Server) triggerGCHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	resp := &TriggerGCResponse{
+		HeapBeforeBytes: int64(before.HeapAlloc),
+		HeapAfterBytes:  int64(after.HeapAlloc),
+		GCPauseNs:       int64(after.PauseNs[(after.NumGC+255)%256]),
+		Warning:         TriggerGCWarning,
+	}
+	s.audit.Record("trigger-gc", r, nil)
+	log.Printf("Garbage collection triggered, heap from %d to %d bytes.", resp.HeapBeforeBytes, resp.HeapAfterBytes)
+	writeJSON(w, resp)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	hashserverpb "github.com/KetanA/JC-Golang/proto"
+)
+
+// HashVersion is one of the hashes computed for an id, possibly with a different algorithm.
+type HashVersion struct {
+	Algorithm string `json:"algorithm"`
+	Encoding  string `json:"encoding,omitempty"`
+	// PepperVersion is the version of the pepper the password was hashed with, 0 for none.
+	PepperVersion int       `json:"pepperVersion,omitempty"`
+	Hash          string    `json:"hash"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// AlgorithmResponse defines response structure for '/hash/{id}/algorithm' endpoint.
+type AlgorithmResponse struct {
+	ID        int    `json:"id"`
+	Algorithm string `json:"algorithm"`
+	// Encoding is the format of the hash value: `base64`, `base64nopad`, `base64url` or `hex` for the digests,
+	// or `phc` and `mcf` for the strings embedding the parameters.
+	Encoding string `json:"encoding"`
+}
+
+// rehashHandler handles the POST requests to `/hash/{id}` endpoint.
+// The password is hashed again, possibly with another algorithm, and stored as a new version of the id.
+func (s *Server) rehashHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if s.rejectDraining(w) {
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	req, ok := readHashRequest(w, r)
+	if !ok || !s.allowAlgorithm(w, req.Algorithm) {
+		return
+	}
+	// Only existing hashes can be re-hashed.
+	if res := s.send(r.Context(), Command{requestType: GetVersionsCommand, id: hashId}); res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	if acceptsProtobuf(r) {
+		writeProtobuf(w, &hashserverpb.HashResponse{Id: int64(hashId)})
+	} else {
+		fmt.Fprintf(w, "%d\n", hashId)
+	}
+	s.queueHash(r.Context(), hashId, req)
+}
+
+// versionsHandler handles the GET requests to `/hash/{id}/versions` endpoint.
+func (s *Server) versionsHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetVersionsCommand, id: hashId})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// algorithmHandler handles the GET requests to `/hash/{id}/algorithm` endpoint.
+// The algorithm of the latest version of the hash is returned, without the hash itself.
+func (s *Server) algorithmHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: GetAlgorithmCommand, id: hashId})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintf(w, "%s\n", res.value)
+}
+
+// recomputeHandler handles the POST requests to `/hash/{id}/recompute` endpoint.
+// The password, verified against the current hash, is hashed at once with the active pepper and the current
+// algorithm of the hash, and the new hash, stored as the latest version unless the hash has been modified meanwhile,
+// is returned.
+func (s *Server) recomputeHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	if s.rejectDraining(w) {
+		return
+	}
+	// Hashing is expensive, so each client is only allowed a request per RecomputeInterval.
+	if !s.recomputeLimiter.Allow(clientIP(r)) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(RecomputeInterval.Seconds())))
+		http.Error(w, "Too many recompute requests, try again later!", http.StatusTooManyRequests)
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	password := r.FormValue("password")
+	if password == "" {
+		http.Error(w, "The `password` must be given!", http.StatusBadRequest)
+		return
+	}
+	// Any algorithm matches, the current hash being returned with its algorithm, encoding and pepper version.
+	res := s.send(r.Context(), Command{requestType: CompareAlgorithmCommand, id: hashId})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	current := &HashVersion{}
+	if !decodeResult(w, res, current) || !s.allowAlgorithm(w, current.Algorithm) {
+		return
+	}
+	normalized := s.normalizer.String(password)
+	verified, ok := s.pepper.ApplyVersion(normalized, current.PepperVersion)
+	if !ok {
+		log.Printf("Cannot verify the hash for id %d: pepper version %d is not in the keyring", hashId, current.PepperVersion)
+		writeInternalError(w)
+		return
+	}
+	if !verifyHash(verified, current.Algorithm, current.Encoding, current.Hash) {
+		http.Error(w, ErrPasswordMismatch.Error(), http.StatusUnauthorized)
+		log.Println("Rejecting the recompute as the password does not match the hash for id: ", hashId)
+		return
+	}
+	peppered, pepperVersion := s.pepper.Apply(normalized)
+	hash, err := computeHash(peppered, current.Algorithm, current.Encoding)
+	if err != nil {
+		log.Printf("Cannot hash the password for id %d: %v", hashId, err)
+		writeInternalError(w)
+		return
+	}
+	// The new hash replaces the current one only if it has not been modified meanwhile.
+	res = s.send(r.Context(), Command{requestType: SetHashCommand, password: hash, algorithm: current.Algorithm, encoding: current.Encoding, pepperVersion: pepperVersion, id: hashId, expectedHash: current.Hash, requestStartTs: time.Now().UnixMicro()})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Println("Hash recomputed for id: ", hashId)
+	fmt.Fprintf(w, "%s\n", hash)
+}
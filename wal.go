@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// Operations recorded in the write-ahead log.
+const (
+	// WALSet records a SetHashCommand, before it is applied to the store.
+	WALSet = "set"
+	// WALCommit records that the SetHashCommand with the same id has been applied.
+	WALCommit = "commit"
+	// WALRecord records the whole record of the id once its metadata or tombstone has been changed, replacing it.
+	WALRecord = "record"
+	// WALDelete records that the record of the id has been removed from the store, by a permanent deletion or a purge.
+	WALDelete = "delete"
+	// WALReset records that the content of the store has been replaced, e.g. by a snapshot restore or a compaction.
+	// The records of the new content are logged after it.
+	WALReset = "reset"
+)
+
+// WALEntry is a line of the write-ahead log. Only the hashed-encoded password is written, never the plain text.
+type WALEntry struct {
+	Seq           int64    `json:"seq"`
+	Op            string   `json:"op"`
+	ID            int      `json:"id"`
+	Hash          string   `json:"hash,omitempty"`
+	Algorithm     string   `json:"algorithm,omitempty"`
+	Encoding      string   `json:"encoding,omitempty"`
+	PepperVersion int      `json:"pepperVersion,omitempty"`
+	Namespace     string   `json:"namespace,omitempty"`
+	Tags          []string `json:"tags,omitempty"`
+	CreatedBy     string   `json:"createdBy,omitempty"`
+	// AwaitingResubmit marks the copy of a hash, stored without a hash until its password is submitted again, in the
+	// logs written before the copies were logged by WALRecord.
+	AwaitingResubmit bool `json:"awaitingResubmit,omitempty"`
+	// Record is the record of the id logged by WALRecord.
+	Record *HashRecord `json:"record,omitempty"`
+}
+
+// WAL is the write-ahead log of the password store, used to recover the changes made since the last snapshot.
+// It is only used by the store goroutine.
+type WAL struct {
+	path string
+	file *os.File
+	// seq is the sequence number of the last entry.
+	seq int64
+	// written is the number of bytes appended since the last Flush.
+	written int64
+}
+
+// OpenWAL opens the write-ahead log file for appending, creating it if needed, and returns its current entries.
+func OpenWAL(path string) (*WAL, []WALEntry, error) {
+	entries, err := readWAL(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	w := &WAL{path: path, file: f}
+	if len(entries) > 0 {
+		w.seq = entries[len(entries)-1].Seq
+	}
+	return w, entries, nil
+}
+
+// readWAL reads the entries of the log file. A truncated last line, left by a crash while writing it, is ignored.
+func readWAL(path string) ([]WALEntry, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []WALEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		var e WALEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			break
+		}
+		entries = append(entries, e)
+	}
+	return entries, sc.Err()
+}
+
+// Seq returns the sequence number of the last entry written.
+func (w *WAL) Seq() int64 {
+	return w.seq
+}
+
+// Append writes the entry, assigning its sequence number, and syncs it to disk.
+func (w *WAL) Append(e WALEntry) error {
+	w.seq++
+	e.Seq = w.seq
+	line, err := json.Marshal(&e)
+	if err != nil {
+		return err
+	}
+	n, err := w.file.Write(append(line, '\n'))
+	w.written += int64(n)
+	if err != nil {
+		return err
+	}
+	return w.file.Sync()
+}
+
+// Flush syncs the log to disk, and returns the number of bytes appended since the last Flush.
+// Each entry is synced once appended already, so Flush only confirms that the log is on disk.
+func (w *WAL) Flush() (int64, error) {
+	if err := w.file.Sync(); err != nil {
+		return 0, err
+	}
+	written := w.written
+	w.written = 0
+	return written, nil
+}
+
+// Rotate removes the entries up to seq, which are saved in a snapshot, from the log.
+func (w *WAL) Rotate(seq int64) error {
+	return w.rewrite(func(e WALEntry) bool { return e.Seq > seq })
+}
+
+// Erase removes the entries of the ids from the log, so that none of their data is left on disk. Their WALDelete
+// entries are kept, for their removal to still be replayed over the snapshots taken before.
+func (w *WAL) Erase(ids map[int]bool) error {
+	return w.rewrite(func(e WALEntry) bool { return !ids[e.ID] || e.Op == WALDelete })
+}
+
+// rewrite replaces the log by its entries which are kept.
+func (w *WAL) rewrite(keep func(WALEntry) bool) error {
+	entries, err := readWAL(w.path)
+	if err != nil {
+		return err
+	}
+	tmp := w.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(f)
+	enc := json.NewEncoder(bw)
+	for _, e := range entries {
+		if !keep(e) {
+			continue
+		}
+		if err := enc.Encode(&e); err != nil {
+			f.Close()
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, w.path); err != nil {
+		return err
+	}
+	w.file.Close()
+	w.file, err = os.OpenFile(w.path, os.O_APPEND|os.O_WRONLY, 0600)
+	return err
+}
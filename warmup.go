@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// WarmupEntry is an entry of the `--warmup-file`: a password hashed and stored for the id on startup.
+type WarmupEntry struct {
+	ID       int    `json:"id"`
+	Password string `json:"password"`
+	// Algorithm is DefaultAlgorithm when empty.
+	Algorithm string `json:"algorithm"`
+}
+
+// LoadWarmup reads the JSON array of WarmupEntry of the file, or returns no entry if path is empty.
+func LoadWarmup(path string) ([]WarmupEntry, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var entries []WarmupEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	seen := make(map[int]bool)
+	for i := range entries {
+		e := &entries[i]
+		if e.Algorithm == "" {
+			e.Algorithm = DefaultAlgorithm
+		}
+		switch {
+		case e.ID < 1:
+			return nil, fmt.Errorf("entry %d: the id must be positive", i)
+		case seen[e.ID]:
+			return nil, fmt.Errorf("entry %d: duplicate id %d", i, e.ID)
+		case e.Password == "":
+			return nil, fmt.Errorf("entry %d: empty password", i)
+		case hashAlgorithms[e.Algorithm] == nil:
+			return nil, fmt.Errorf("entry %d: unsupported hash algorithm %q", i, e.Algorithm)
+		}
+		seen[e.ID] = true
+	}
+	return entries, nil
+}
+
+// startWarmup hashes and stores the entries in the background, without waiting for the preprocessing delay, through
+// SetHashCommand like the other hashes. Their ids are reserved at once, being pending until stored, so that they are
+// never issued to other hashes. The ids already issued, e.g. recovered from the write-ahead log, are skipped.
+func (s *Server) startWarmup(entries []WarmupEntry) {
+	last := s.ids.Last()
+	var warm []WarmupEntry
+	for _, e := range entries {
+		if e.ID <= last {
+			slog.Info("Skipping the warmup of an id already issued", "id", e.ID)
+			continue
+		}
+		s.ids.Reserve(e.ID)
+		warm = append(warm, e)
+	}
+	if len(warm) == 0 {
+		return
+	}
+	go func() {
+		start := time.Now()
+		slog.Info("Warming up hashes", "count", len(warm))
+		for i, e := range warm {
+			c := Command{requestType: SetHashCommand, id: e.ID, algorithm: e.Algorithm, encoding: hashEncodings[e.Algorithm], namespace: DefaultNamespace, requestStartTs: time.Now().UnixMicro()}
+			password, pepperVersion := s.pepper.Apply(s.normalizer.String(e.Password))
+			hash, err := computeHash(password, c.algorithm, c.encoding)
+			if err != nil {
+				slog.Error("Cannot warm up the hash", "id", e.ID, "err", err)
+				s.pending.Send(s.inboundRequests, Command{requestType: FailHashCommand, id: e.ID})
+				continue
+			}
+			c.password, c.pepperVersion = hash, pepperVersion
+			s.pending.Send(s.inboundRequests, c)
+			slog.Info("Warmed up hash", "id", e.ID, "progress", fmt.Sprintf("%d/%d", i+1, len(warm)))
+		}
+		slog.Info("Warmup done", "count", len(warm), "duration", time.Since(start))
+	}()
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// MaxSubscribeBodySize is the maximum size of the body of a `/hash/{id}/subscribe` request.
+const MaxSubscribeBodySize = 1 << 12
+
+// MaxSubscriptionsPerHash is the maximum number of webhooks subscribed to the same hash.
+const MaxSubscriptionsPerHash = 10
+
+// Delivery of the webhook notifications: each one is retried up to WebhookRetries times on failure, waiting
+// WebhookInitialBackoff before the first retry and twice as long before each next one.
+const (
+	WebhookTimeout        = 5 * time.Second
+	WebhookRetries        = 3
+	WebhookInitialBackoff = 1 * time.Second
+)
+
+// WebhookSignatureHeader is the header of the hex HMAC-SHA256 of the webhook notification body, keyed with the
+// secret of the subscription.
+const WebhookSignatureHeader = "X-Signature-SHA256"
+
+// Values of the `status` of the webhook notifications.
+const (
+	WebhookStatusReady  = "ready"
+	WebhookStatusFailed = "failed"
+)
+
+// Values of the `status` of `/hash/{id}/subscribe` endpoint.
+const (
+	StatusSubscribed = "subscribed"
+	StatusNotified   = "notified"
+)
+
+// ErrTooManySubscriptions is returned by the store when MaxSubscriptionsPerHash webhooks are already subscribed.
+var ErrTooManySubscriptions = errors.New("Too many webhooks are subscribed to the hash!")
+
+// WebhookSubscription defines request structure for '/hash/{id}/subscribe' endpoint: a URL posted a
+// WebhookNotification once the hash is ready.
+type WebhookSubscription struct {
+	CallbackURL string `json:"callbackUrl"`
+	// Secret keys the signature of the notifications, so that the client can verify them.
+	Secret string `json:"secret"`
+	// fcm is the device sent a push notification instead, subscribed by `/hash/{id}/notify-ready`.
+	fcm *FCMSubscription
+}
+
+// SubscribeResponse defines response structure for '/hash/{id}/subscribe' endpoint.
+type SubscribeResponse struct {
+	ID int `json:"id"`
+	// Status is StatusNotified when the hash was already ready, the notification being sent at once.
+	Status string `json:"status"`
+}
+
+// WebhookNotification defines request structure of the notifications posted to the subscribed webhooks.
+type WebhookNotification struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+}
+
+// webhookClient posts the webhook notifications.
+var webhookClient = &http.Client{Timeout: WebhookTimeout}
+
+// notifyWebhooks creates a goroutine per subscription posting the notification of the status of the hash.
+// The subscriptions are only notified once, the deliveries failing all their attempts being passed to failed.
+// The push notifications are only sent for the ready hashes, once, their failures being logged only.
+func notifyWebhooks(id int, status string, subscriptions []WebhookSubscription, failed func(*FailedWebhook)) {
+	notification, err := safeMarshal(&WebhookNotification{ID: id, Status: status})
+	if err != nil {
+		return
+	}
+	body := []byte(notification)
+	for _, sub := range subscriptions {
+		if sub.fcm != nil {
+			if status == WebhookStatusReady {
+				go func() {
+					if err := postFCM(id, sub.fcm); err != nil {
+						log.Printf("Cannot send the push notification for id %d: %v", id, err)
+					}
+				}()
+			}
+			continue
+		}
+		go func() {
+			if f := postWebhook(id, sub, body); f != nil {
+				failed(f)
+			}
+		}()
+	}
+}
+
+// postWebhook posts the body to the webhook, retrying with an exponential backoff until it answers with a 2xx status.
+// It returns the FailedWebhook to retry manually if all the attempts failed, or nil.
+func postWebhook(id int, sub WebhookSubscription, body []byte) *FailedWebhook {
+	signature := signWebhook(sub.Secret, body)
+	backoff := WebhookInitialBackoff
+	for attempt := 0; ; attempt++ {
+		err := postWebhookOnce(sub.CallbackURL, body, signature)
+		if err == nil {
+			return nil
+		}
+		if attempt == WebhookRetries {
+			log.Printf("Giving up notifying the webhook %s: %v", sub.CallbackURL, err)
+			return &FailedWebhook{HashID: id, URL: sub.CallbackURL, AttemptCount: attempt + 1, LastError: err.Error(), LastAttemptAt: time.Now(), subscription: sub, body: body}
+		}
+		log.Printf("Cannot notify the webhook %s, retrying in %s: %v", sub.CallbackURL, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// signWebhook returns the hex HMAC-SHA256 of the body keyed with the secret.
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// postWebhookOnce posts the signed body to the URL.
+func postWebhookOnce(callbackURL string, body []byte, signature string) error {
+	req, err := http.NewRequest(http.MethodPost, callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(WebhookSignatureHeader, signature)
+	resp, err := webhookClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// subscribeHandler handles the POST requests to `/hash/{id}/subscribe` endpoint.
+// The webhook is notified once the hash is ready, or has failed, instead of the client polling `/hash/{id}`.
+func (s *Server) subscribeHandler(w http.ResponseWriter, r *http.Request) {
+	if s.isTerminated.Load() {
+		fmt.Fprintf(w, "Cannot accept new requests, the server is being terminated...\n")
+		return
+	}
+	hashId, err := hashIDFromPath(r.URL.Path)
+	if err != nil {
+		fmt.Fprintf(w, "Invalid hash id!\n")
+		log.Println("Invalid hash id!")
+		return
+	}
+	sub := &WebhookSubscription{}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, MaxSubscribeBodySize)).Decode(sub); err != nil || sub.Secret == "" {
+		http.Error(w, "The `callbackUrl` and `secret` must be given!", http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(sub.CallbackURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "The `callbackUrl` must be an absolute http or https URL!", http.StatusBadRequest)
+		return
+	}
+	res := s.send(r.Context(), Command{requestType: SubscribeHashCommand, id: hashId, subscription: sub})
+	if res.err != nil {
+		writeStoreError(w, res.err)
+		return
+	}
+	log.Printf("Webhook %s subscribed to id %d", sub.CallbackURL, hashId)
+	writeJSON(w, &SubscribeResponse{ID: hashId, Status: res.value})
+}